@@ -0,0 +1,16 @@
+# Read the used space of every child of tank/home at once.
+data "zfs_channel_program" "home_usage" {
+  pool      = "tank"
+  arguments = ["tank/home"]
+  script    = <<-EOT
+    local usage = {}
+    for child in zfs.list.children((...).argv[1]) do
+      usage[child] = zfs.get_prop(child, "used")
+    end
+    return usage
+  EOT
+}
+
+output "home_usage" {
+  value = jsondecode(data.zfs_channel_program.home_usage.result)
+}
@@ -0,0 +1,19 @@
+data "zfs_compression_estimate" "data" {
+  dataset    = "tank/data"
+  candidates = ["lz4", "zstd", "zstd-9", "gzip"]
+}
+
+# Use the recommendation as the default for the datasets created by a module.
+resource "zfs_filesystem" "app" {
+  name = "tank/data/app"
+
+  property {
+    name  = "compression"
+    value = data.zfs_compression_estimate.data.recommended_compression
+  }
+}
+
+# e.g. "zstd reaches a compressratio of 2.20, within 0.05 of the 2.24 of zstd-9 at a lower cost"
+output "compression_recommendation" {
+  value = data.zfs_compression_estimate.data.recommendation
+}
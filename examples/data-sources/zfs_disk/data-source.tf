@@ -0,0 +1,17 @@
+data "zfs_disk" "free" {
+  min_size        = "4T"
+  exclude_in_pool = true
+}
+
+resource "zfs_pool" "tank" {
+  name = "tank"
+
+  mirror {
+    dynamic "device" {
+      for_each = [for disk in data.zfs_disk.free.disks : disk if disk.rotational]
+      content {
+        path = device.value.by_id_path
+      }
+    }
+  }
+}
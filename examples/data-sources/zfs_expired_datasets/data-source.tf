@@ -0,0 +1,7 @@
+data "zfs_expired_datasets" "ci" {
+  parent = "tank/ci"
+}
+
+output "expired_ci_datasets" {
+  value = data.zfs_expired_datasets.ci.names
+}
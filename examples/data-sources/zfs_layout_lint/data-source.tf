@@ -0,0 +1,4 @@
+data "zfs_layout_lint" "zdata" {
+  vdevs    = "raidz2 /dev/sda /dev/sdb /dev/sdc /dev/sdd /dev/sde /dev/sdf log /dev/nvme0n1"
+  suppress = ["slog_power_loss"]
+}
@@ -0,0 +1,26 @@
+# The golden image tank/images/base is cloned for every VM.
+data "zfs_origin_chain" "base" {
+  dataset = "tank/images/base"
+}
+
+# e.g. ["tank/vms/web01", "tank/vms/web02"]
+output "vms_using_base" {
+  value = [for clone in data.zfs_origin_chain.base.dependent_clones : clone.name if clone.depth == 1]
+}
+
+# Warn before the image is retired while VMs are still cloned from it.
+check "base_image_unused" {
+  assert {
+    condition     = data.zfs_origin_chain.base.destroyable
+    error_message = "tank/images/base still backs clones or is held."
+  }
+}
+
+data "zfs_origin_chain" "web01" {
+  dataset = "tank/vms/web01"
+}
+
+# e.g. ["tank/images/base@v3", "tank/golden@2024"]
+output "web01_ancestry" {
+  value = data.zfs_origin_chain.web01.ancestry
+}
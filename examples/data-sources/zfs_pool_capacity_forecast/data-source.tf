@@ -0,0 +1,37 @@
+# Measure the growth over 30 seconds while planning.
+data "zfs_pool_capacity_forecast" "tank" {
+  pool              = "tank"
+  sample_seconds    = 30
+  threshold_percent = 80
+}
+
+output "tank_days_until_80_percent" {
+  value = data.zfs_pool_capacity_forecast.tank.days_until_full
+}
+
+# For a steadier rate, keep the first sample around and measure the growth over all runs since.
+data "zfs_pool_capacity_forecast" "current" {
+  pool           = "tank"
+  sample_seconds = 0
+}
+
+resource "terraform_data" "tank_baseline" {
+  input = {
+    allocated  = data.zfs_pool_capacity_forecast.current.allocated
+    sampled_at = data.zfs_pool_capacity_forecast.current.sampled_at
+  }
+
+  lifecycle {
+    ignore_changes = [input]
+  }
+}
+
+data "zfs_pool_capacity_forecast" "trend" {
+  pool              = "tank"
+  threshold_percent = 80
+
+  baseline {
+    allocated  = terraform_data.tank_baseline.output.allocated
+    sampled_at = terraform_data.tank_baseline.output.sampled_at
+  }
+}
@@ -0,0 +1,14 @@
+data "zfs_pool_ddt" "tank" {
+  pool     = "tank"
+  simulate = true
+}
+
+# Only enable dedup if it saves a meaningful amount of space, and the table fits in 4G of memory.
+resource "zfs_filesystem" "backups" {
+  name = "tank/backups"
+
+  property {
+    name  = "dedup"
+    value = data.zfs_pool_ddt.tank.dedup_ratio > 1.5 && data.zfs_pool_ddt.tank.table_size_in_core < 4 * 1024 * 1024 * 1024 ? "on" : "off"
+  }
+}
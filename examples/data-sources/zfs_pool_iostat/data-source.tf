@@ -0,0 +1,22 @@
+# Record the performance of the pool over 10 seconds after provisioning, e.g. as a baseline for monitoring.
+data "zfs_pool_iostat" "tank" {
+  pool     = "tank"
+  interval = 10
+  vdevs    = true
+}
+
+output "baseline" {
+  value = {
+    read_ops    = data.zfs_pool_iostat.tank.read_ops
+    write_ops   = data.zfs_pool_iostat.tank.write_ops
+    read_bytes  = data.zfs_pool_iostat.tank.read_bytes
+    write_bytes = data.zfs_pool_iostat.tank.write_bytes
+  }
+}
+
+output "disk_write_latency_ns" {
+  value = {
+    for vdev in data.zfs_pool_iostat.tank.vdev : vdev.name => vdev.disk_wait_write_ns
+    if startswith(vdev.name, "/")
+  }
+}
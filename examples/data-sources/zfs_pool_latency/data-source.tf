@@ -0,0 +1,15 @@
+data "zfs_pool_latency" "tank" {
+  pool = "tank"
+}
+
+output "slow_devices" {
+  value = data.zfs_pool_latency.tank.slow_devices
+}
+
+# Devices which still look ONLINE but have had I/Os waiting on the disk for over a second.
+output "sluggish_devices" {
+  value = [
+    for vdev in data.zfs_pool_latency.tank.vdev : vdev.name
+    if startswith(vdev.name, "/") && anytrue([for bucket in vdev.histogram : bucket.latency_ns >= 1000000000 && bucket.disk_wait_read + bucket.disk_wait_write > 0])
+  ]
+}
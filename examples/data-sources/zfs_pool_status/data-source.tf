@@ -0,0 +1,10 @@
+data "zfs_pool_status" "zdata" {
+  name = "zdata"
+
+  lifecycle {
+    postcondition {
+      condition     = self.state == "ONLINE"
+      error_message = "zdata is ${self.state}: ${self.status}"
+    }
+  }
+}
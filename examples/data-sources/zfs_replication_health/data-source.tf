@@ -0,0 +1,8 @@
+data "zfs_replication_health" "backup" {
+  source = "dpool/DATA"
+  target = "backup/DATA"
+}
+
+output "replication_lag" {
+  value = data.zfs_replication_health.backup.lag_seconds
+}
@@ -0,0 +1,12 @@
+# What changed in tank/images since the last build.
+data "zfs_snapshot_diff" "since_build" {
+  from = "tank/images@last-build"
+}
+
+output "images_changed" {
+  value = data.zfs_snapshot_diff.since_build.changed
+}
+
+output "added_images" {
+  value = data.zfs_snapshot_diff.since_build.added
+}
@@ -1,3 +1,7 @@
 data "zfs_pool" "example" {
   name = "foo"
-}
\ No newline at end of file
+}
+# Sizes are bytes in properties_numeric, so they can be compared without parsing "1.5T" strings.
+output "free_fraction" {
+  value = data.zfs_pool.example.properties_numeric["free"] / data.zfs_pool.example.properties_numeric["size"]
+}
@@ -0,0 +1,8 @@
+resource "zfs_filesystem" "logs" {
+  name = "tank/db/logs"
+
+  property {
+    name  = "reservation"
+    value = provider::zfs::format_size(provider::zfs::parse_size("1.5T") / 10)
+  }
+}
@@ -0,0 +1,12 @@
+terraform {
+  required_providers {
+    zfs = {
+      source = "MathiasPius/zfs"
+    }
+  }
+}
+
+# Reserve a tenth of a 1.5T quota for the database logs.
+locals {
+  log_reservation = provider::zfs::parse_size("1.5T") / 10
+}
@@ -0,0 +1,4 @@
+# Returns e.g. "tank/data@before-upgrade-2023-10-15_12-00"
+output "snapshot" {
+  value = provider::zfs::snapshot_name("tank/data", plantimestamp(), "before-upgrade-%F_%H-%M")
+}
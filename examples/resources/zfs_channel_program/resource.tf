@@ -0,0 +1,23 @@
+# Snapshot every filesystem below tank/vms in a single transaction, so the snapshots are consistent with each other.
+resource "zfs_channel_program" "vm_snapshots" {
+  pool      = "tank"
+  arguments = ["tank/vms", "before-upgrade"]
+  script    = <<-EOT
+    local argv = (...).argv
+    local snapshots = {}
+    for child in zfs.list.children(argv[1]) do
+      table.insert(snapshots, child .. "@" .. argv[2])
+    end
+    for _, snapshot in ipairs(snapshots) do
+      local err = zfs.sync.snapshot(snapshot)
+      if err ~= 0 then
+        error("failed to snapshot " .. snapshot .. ": " .. err)
+      end
+    end
+    return snapshots
+  EOT
+}
+
+output "snapshots" {
+  value = jsondecode(zfs_channel_program.vm_snapshots.result)
+}
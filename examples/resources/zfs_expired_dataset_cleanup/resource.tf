@@ -0,0 +1,14 @@
+resource "zfs_filesystem" "ci_scratch" {
+  name       = "tank/ci/build-1234"
+  mountpoint = "/srv/ci/build-1234"
+  expires_at = timeadd(plantimestamp(), "72h")
+
+  lifecycle {
+    ignore_changes = [expires_at]
+  }
+}
+
+resource "zfs_expired_dataset_cleanup" "ci" {
+  parent    = "tank/ci"
+  recursive = true
+}
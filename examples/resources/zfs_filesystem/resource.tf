@@ -0,0 +1,72 @@
+resource "zfs_filesystem" "projects" {
+  name = "tank/projects"
+
+  property {
+    name  = "compression"
+    value = "zstd"
+  }
+}
+
+# Follow the compression of tank/projects, even if someone sets it on this filesystem by hand.
+resource "zfs_filesystem" "website" {
+  name = "${zfs_filesystem.projects.name}/website"
+
+  property {
+    name    = "compression"
+    inherit = true
+  }
+}
+
+# e.g. "inherited from tank/projects"
+output "website_compression_source" {
+  value = zfs_filesystem.website.property_sources["compression"]
+}
+
+# tank/backups and tank/backups/hosts are created as well if they don't exist yet.
+resource "zfs_filesystem" "host_backups" {
+  name           = "tank/backups/hosts/web01"
+  create_parents = true
+}
+
+# Operators may move this filesystem around by hand, terraform follows it instead of renaming it back.
+resource "zfs_filesystem" "scratch" {
+  name                  = "tank/scratch"
+  allow_external_rename = true
+}
+
+output "scratch_location" {
+  value = zfs_filesystem.scratch.current_name
+}
+
+# Changing the name renames the filesystem in place, unmounting it and its children even if a shell sits in them.
+resource "zfs_filesystem" "archive" {
+  name                    = "tank/archive/2023"
+  create_parents          = true
+  force_unmount_on_rename = true
+}
+
+variable "share_token" {
+  type      = string
+  sensitive = true
+}
+
+# The token is masked in plans and only its hash is kept in the state. Changing it on the host shows up as drift.
+resource "zfs_filesystem" "share" {
+  name                       = "tank/share"
+  sensitive_property_storage = "hash"
+
+  sensitive_properties = {
+    "org.example:share-token" = var.share_token
+  }
+}
+
+# Only changes to the configured properties show up in plans, not the space used by the cache.
+resource "zfs_filesystem" "cache" {
+  name            = "tank/cache"
+  drift_detection = "defined_properties"
+
+  property {
+    name  = "sync"
+    value = "disabled"
+  }
+}
@@ -0,0 +1,9 @@
+# Let cp --reflink and copy_file_range clone blocks instead of copying them.
+resource "zfs_module_parameter" "bclone" {
+  name  = "zfs_bclone_enabled"
+  value = "1"
+}
+
+output "bclone_saved" {
+  value = zfs_pool.zdata.bclone_saved
+}
@@ -0,0 +1,6 @@
+resource "zfs_permission" "backup" {
+  dataset     = "dpool/DATA"
+  user        = "backup"
+  scope       = "local+descendent"
+  permissions = ["snapshot", "send", "hold"]
+}
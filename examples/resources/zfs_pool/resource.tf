@@ -35,4 +35,21 @@ resource "zfs_pool" "zdata" {
     name  = "compression"
     value = "on"
   }
-}
\ No newline at end of file
+}
+# A pool which stays importable on hosts running OpenZFS 2.1, with block cloning held back explicitly.
+resource "zfs_pool" "portable" {
+  name          = "portable"
+  compatibility = "openzfs-2.1-linux"
+
+  device {
+    path = "/dev/disk/by-id/ata-WDC_WD40EFRX-68N_WD-WCC7K1234567"
+  }
+
+  features = {
+    encryption    = "enabled"
+    block_cloning = "disabled"
+  }
+
+  # Enable the features set to enabled above if they are added later, but never run zpool upgrade.
+  feature_upgrade = "listed"
+}
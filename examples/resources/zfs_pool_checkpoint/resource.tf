@@ -0,0 +1,28 @@
+variable "release" {
+  type = string
+}
+
+# A new checkpoint is taken for every release, before the pool is changed.
+resource "zfs_pool_checkpoint" "before_release" {
+  pool = "tank"
+
+  triggers = {
+    release = var.release
+  }
+}
+
+resource "zfs_filesystem" "app" {
+  name = "tank/app"
+
+  property {
+    name  = "recordsize"
+    value = "1M"
+  }
+
+  depends_on = [zfs_pool_checkpoint.before_release]
+}
+
+# e.g. 1269760
+output "checkpoint_size" {
+  value = zfs_pool_checkpoint.before_release.size
+}
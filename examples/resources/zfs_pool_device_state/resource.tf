@@ -0,0 +1,20 @@
+# Take a failing disk of a mirror offline before it is pulled from the chassis.
+resource "zfs_pool_device_state" "failing_disk" {
+  pool    = "tank"
+  device  = "/dev/disk/by-id/ata-ST4000NM0035-1V4107_ZC1A2B3C"
+  offline = true
+}
+
+# Clear the error counters of a disk once its cable has been replaced.
+resource "zfs_pool_device_state" "recabled_disk" {
+  pool   = "tank"
+  device = "/dev/disk/by-id/ata-ST4000NM0035-1V4107_ZC1D4E5F"
+
+  clear_triggers = {
+    cable = "replaced-2024-05-02"
+  }
+}
+
+output "recabled_disk_checksum_errors" {
+  value = zfs_pool_device_state.recabled_disk.checksum_errors
+}
@@ -0,0 +1,8 @@
+resource "zfs_pool_import" "recovered" {
+  pool               = "tank"
+  new_name           = "tank-recovered"
+  search_directories = ["/dev/disk/by-id"]
+  force              = true
+  altroot            = "/mnt/recovery"
+  readonly           = true
+}
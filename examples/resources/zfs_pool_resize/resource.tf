@@ -0,0 +1,8 @@
+resource "zfs_pool_resize" "tank" {
+  pool     = "tank"
+  grow_all = true
+
+  triggers = {
+    volume_size = aws_ebs_volume.tank.size
+  }
+}
@@ -0,0 +1,25 @@
+variable "sites" {
+  type = map(object({
+    project_id = number
+    quota      = string
+  }))
+  default = {
+    "example.com" = { project_id = 100, quota = "10G" }
+    "example.org" = { project_id = 101, quota = "2G" }
+  }
+}
+
+resource "zfs_filesystem" "www" {
+  name       = "tank/www"
+  mountpoint = "/srv/www"
+}
+
+# Each site gets its own limit within the shared filesystem.
+resource "zfs_project" "site" {
+  for_each = var.sites
+
+  path         = "${zfs_filesystem.www.mountpoint}/${each.key}"
+  project_id   = each.value.project_id
+  quota        = each.value.quota
+  object_quota = "1000000"
+}
@@ -0,0 +1,31 @@
+# The golden image is received again whenever a new one is published under the same URL.
+resource "zfs_received_dataset" "base_image" {
+  name = "tank/images/base"
+  url  = "https://images.example.com/base.zfs"
+}
+
+# A stream which is verified before it is received.
+resource "zfs_received_dataset" "pinned_image" {
+  name     = "tank/images/pinned"
+  file     = "/srv/images/base-v3.zfs"
+  checksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+  mount    = false
+}
+
+variable "image_version" {
+  type = string
+}
+
+# Streams from a command are only received again when triggers change.
+resource "zfs_received_dataset" "from_build_host" {
+  name    = "tank/images/build"
+  command = "ssh build zfs send images/base@${var.image_version}"
+
+  triggers = {
+    version = var.image_version
+  }
+}
+
+output "base_image_snapshot" {
+  value = zfs_received_dataset.base_image.snapshot
+}
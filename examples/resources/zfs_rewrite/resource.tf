@@ -0,0 +1,17 @@
+resource "zfs_filesystem" "archive" {
+  name = "tank/archive"
+
+  property {
+    name  = "compression"
+    value = "zstd-9"
+  }
+}
+
+# Recompress the data written before compression was changed.
+resource "zfs_rewrite" "archive" {
+  dataset = zfs_filesystem.archive.name
+
+  triggers = {
+    compression = "zstd-9"
+  }
+}
@@ -0,0 +1,11 @@
+# Restore tank/app to the snapshot taken before the migration whenever restore_generation is bumped.
+# The plan lists the snapshots taken since then in destroyed_snapshots.
+resource "zfs_rollback" "restore" {
+  dataset       = "tank/app"
+  snapshot      = "pre-migration"
+  destroy_newer = true
+
+  triggers = {
+    restore_generation = "1"
+  }
+}
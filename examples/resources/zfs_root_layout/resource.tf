@@ -0,0 +1,24 @@
+resource "zfs_pool" "rpool" {
+  name = "rpool"
+
+  mirror {
+    device {
+      path = "/dev/disk/by-id/nvme-disk0-part3"
+    }
+
+    device {
+      path = "/dev/disk/by-id/nvme-disk1-part3"
+    }
+  }
+
+  property {
+    name  = "altroot"
+    value = "/mnt"
+  }
+}
+
+resource "zfs_root_layout" "rpool" {
+  pool             = zfs_pool.rpool.name
+  boot_environment = "debian"
+  var_datasets     = ["log", "spool", "cache", "lib"]
+}
@@ -0,0 +1,4 @@
+resource "zfs_scratch_dataset" "ci" {
+  name       = "tank/ci/workspace"
+  mountpoint = "/srv/ci/workspace"
+}
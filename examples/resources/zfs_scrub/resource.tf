@@ -0,0 +1,12 @@
+resource "zfs_scrub" "zdata" {
+  pool                = zfs_pool.zdata.name
+  wait_for_completion = true
+
+  triggers = {
+    pool = zfs_pool.zdata.id
+  }
+
+  timeouts {
+    create = "2h"
+  }
+}
@@ -0,0 +1,21 @@
+variable "release" {
+  type = string
+}
+
+# Taken once per release. Running the pipeline again for the same release keeps the existing snapshot.
+resource "zfs_snapshot" "release" {
+  dataset     = "tank/app"
+  name        = "release-${var.release}"
+  on_conflict = "adopt"
+}
+
+# Always takes a new snapshot, e.g. tank/app@pre-migration-1 if tank/app@pre-migration is taken.
+resource "zfs_snapshot" "pre_migration" {
+  dataset     = "tank/app"
+  name        = "pre-migration"
+  on_conflict = "suffix"
+}
+
+output "pre_migration_snapshot" {
+  value = zfs_snapshot.pre_migration.snapshot
+}
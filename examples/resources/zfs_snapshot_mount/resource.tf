@@ -0,0 +1,16 @@
+# Inspect last night's snapshot in place, without creating anything.
+resource "zfs_snapshot_mount" "nightly" {
+  snapshot = "tank/data@nightly"
+}
+
+# Restore tests get a read-only clone, which is destroyed again with the resource.
+resource "zfs_snapshot_mount" "restore_test" {
+  snapshot   = "tank/data@nightly"
+  method     = "clone"
+  clone_name = "tank/restore-test"
+  mountpoint = "/mnt/restore-test"
+}
+
+output "backup_path" {
+  value = zfs_snapshot_mount.restore_test.path
+}
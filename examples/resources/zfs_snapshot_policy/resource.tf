@@ -0,0 +1,9 @@
+resource "zfs_snapshot_policy" "data" {
+  dataset   = "tank/data"
+  prefix    = "tf"
+  recursive = true
+
+  keep_hourly = 24
+  keep_daily  = 7
+  keep_weekly = 4
+}
@@ -0,0 +1,39 @@
+# Evacuate the pool "old" into "new/old": create the target, replicate, verify, then destroy the source.
+resource "zfs_pool" "new" {
+  name  = "new"
+  stage = "create"
+
+  mirror {
+    device {
+      path = "/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R123456"
+    }
+    device {
+      path = "/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R654321"
+    }
+  }
+}
+
+# Replicate old into new/old outside of terraform, e.g. with
+# zfs snapshot -r old@move && zfs send -R old@move | zfs receive new/old
+# and bump the generation afterwards to verify the replication again.
+resource "zfs_stage_verification" "old" {
+  source = "old"
+  target = "${zfs_pool.new.name}/old"
+
+  triggers = {
+    replication_generation = "1"
+  }
+}
+
+# Once verified, removing this pool from the configuration destroys it. It is refused if the verification
+# didn't succeed, or if anything was written to the pool since.
+resource "zfs_pool" "old" {
+  name  = "old"
+  stage = "destroy"
+
+  device {
+    path = "/dev/disk/by-id/ata-WDC_WD40EFRX-68N_WD-WCC7K1234567"
+  }
+
+  depends_on = [zfs_stage_verification.old]
+}
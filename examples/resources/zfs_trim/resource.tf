@@ -0,0 +1,28 @@
+# Trim continuously as blocks are freed...
+resource "zfs_pool" "fast" {
+  name = "fast"
+
+  device {
+    path = "/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R123456"
+  }
+
+  property {
+    name  = "autotrim"
+    value = "on"
+  }
+}
+
+# ...and run a full trim once a month, without slowing down the devices too much.
+resource "zfs_trim" "fast" {
+  pool                = zfs_pool.fast.name
+  rate                = "200M"
+  wait_for_completion = true
+
+  triggers = {
+    month = formatdate("YYYY-MM", plantimestamp())
+  }
+
+  timeouts {
+    create = "2h"
+  }
+}
@@ -0,0 +1,6 @@
+resource "zfs_user_quota" "myuser" {
+  dataset      = "dpool/DATA/home"
+  user         = "myuser"
+  quota        = "20G"
+  object_quota = "100000"
+}
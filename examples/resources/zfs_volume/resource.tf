@@ -0,0 +1,11 @@
+resource "zfs_volume" "vm_disk" {
+  name    = "tank/vm/web01"
+  volsize = "20G"
+
+  # Wait for udev to create the device node before anything uses device_path.
+  wait_for_device_timeout = "2m"
+}
+
+output "vm_disk_device" {
+  value = zfs_volume.vm_disk.device_path
+}
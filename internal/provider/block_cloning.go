@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// blockCloningUnsupported is the feature state reported for pools on OpenZFS releases before 2.2, which lack the feature.
+const blockCloningUnsupported = "unsupported"
+
+// BlockCloning is the state of the block_cloning feature of a pool, and the space accounted in its block
+// reference table (BRT). Sizes are in bytes.
+type BlockCloning struct {
+	feature string
+	used    int64
+	saved   int64
+	ratio   float64
+}
+
+var blockCloningSchema = schema.Schema{
+	Description: "State of the `block_cloning` feature, one of `disabled`, `enabled`, `active` or `unsupported` for OpenZFS releases before 2.2.",
+	Type:        schema.TypeString,
+	Computed:    true,
+}
+
+var bcloneUsedSchema = schema.Schema{
+	Description: "Space used by cloned blocks in bytes, counted once.",
+	Type:        schema.TypeInt,
+	Computed:    true,
+}
+
+var bcloneSavedSchema = schema.Schema{
+	Description: "Space saved by block cloning in bytes, i.e. the space the clones would take as copies.",
+	Type:        schema.TypeInt,
+	Computed:    true,
+}
+
+var bcloneRatioSchema = schema.Schema{
+	Description: "Space referenced by cloned blocks over the space they use, e.g. `2` when every cloned block has one clone.",
+	Type:        schema.TypeFloat,
+	Computed:    true,
+}
+
+// blockCloningFromProperties takes the block cloning state from the (parsable) pool properties. Pools without the
+// feature are reported as unsupported, with nothing saved.
+func blockCloningFromProperties(properties map[string]Property) (*BlockCloning, error) {
+	feature, ok := properties["feature@block_cloning"]
+	if !ok {
+		return &BlockCloning{feature: blockCloningUnsupported, ratio: 1}, nil
+	}
+
+	blockCloning := &BlockCloning{feature: feature.value, ratio: 1}
+	for name, target := range map[string]*int64{"bcloneused": &blockCloning.used, "bclonesaved": &blockCloning.saved} {
+		value := properties[name].rawValue
+		if value == "" || value == "-" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %s", name, value, err)
+		}
+		*target = parsed
+	}
+
+	if value := strings.TrimSuffix(properties["bcloneratio"].rawValue, "x"); value != "" && value != "-" {
+		ratio, err := parseDecimal(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bcloneratio %q: %s", value, err)
+		}
+		blockCloning.ratio = ratio
+	}
+
+	return blockCloning, nil
+}
+
+// setBlockCloning sets the block cloning attributes shared by the zfs_pool resource and data source.
+func setBlockCloning(d *schema.ResourceData, properties map[string]Property) error {
+	blockCloning, err := blockCloningFromProperties(properties)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{
+		"block_cloning": blockCloning.feature,
+		"bclone_used":   int(blockCloning.used),
+		"bclone_saved":  int(blockCloning.saved),
+		"bclone_ratio":  blockCloning.ratio,
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package provider
+
+import (
+	"testing"
+)
+
+// TestBlockCloningFromProperties verifies the BRT statistics are parsed, and pools without the feature are unsupported.
+func TestBlockCloningFromProperties(t *testing.T) {
+	blockCloning, err := blockCloningFromProperties(map[string]Property{
+		"feature@block_cloning": {value: "active", rawValue: "active"},
+		"bcloneused":            {value: "1.50G", rawValue: "1610612736"},
+		"bclonesaved":           {value: "3G", rawValue: "3221225472"},
+		"bcloneratio":           {value: "3.00x", rawValue: "3.00"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := BlockCloning{feature: "active", used: 1610612736, saved: 3221225472, ratio: 3}
+	if *blockCloning != expected {
+		t.Fatalf("expected %#v, got %#v", expected, *blockCloning)
+	}
+
+	blockCloning, err = blockCloningFromProperties(map[string]Property{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected = BlockCloning{feature: blockCloningUnsupported, ratio: 1}
+	if *blockCloning != expected {
+		t.Fatalf("expected %#v, got %#v", expected, *blockCloning)
+	}
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bootloaders whose limitations are checked before setting bootfs.
+const (
+	BootloaderNone        = "none"
+	BootloaderGrub        = "grub"
+	BootloaderZfsBootMenu = "zfsbootmenu"
+)
+
+var bootloaders = []string{BootloaderNone, BootloaderGrub, BootloaderZfsBootMenu}
+
+// checkBootfs returns an error if a pool couldn't boot from the dataset with the given properties.
+// GRUB can't read natively encrypted datasets at all, and ZFSBootMenu can only unlock datasets
+// when it can prompt for a passphrase or read the key from a file.
+func checkBootfs(poolName string, datasetName string, bootloader string, properties map[string]Property) error {
+	if strings.SplitN(datasetName, "/", 2)[0] != poolName {
+		return fmt.Errorf("bootfs %s is not part of pool %s", datasetName, poolName)
+	}
+
+	if datasetType := properties["type"].value; datasetType != string(FilesystemType) {
+		return fmt.Errorf("bootfs %s must be a filesystem, not a %s", datasetName, datasetType)
+	}
+
+	encryption := properties["encryption"].value
+	if encryption == "" || encryption == "off" {
+		return nil
+	}
+
+	switch bootloader {
+	case BootloaderGrub:
+		return fmt.Errorf("bootfs %s is encrypted with %s, which grub can't read. Keep the boot environment unencrypted, or use zfsbootmenu", datasetName, encryption)
+	case BootloaderZfsBootMenu:
+		keyformat := properties["keyformat"].value
+		keylocation := properties["keylocation"].value
+		if keyformat != "passphrase" && !strings.HasPrefix(keylocation, "file://") {
+			return fmt.Errorf("bootfs %s uses keyformat %s with keylocation %s, so zfsbootmenu has no way to load its key", datasetName, keyformat, keylocation)
+		}
+	}
+	return nil
+}
+
+// validateBootfs reads the properties of the dataset which should become bootfs, and checks it for the bootloader.
+func validateBootfs(config *Config, poolName string, datasetName string, bootloader string) error {
+	properties := make(map[string]Property)
+	if err := readSomeProperties(config, "zfs", datasetName, "type,encryption,keyformat,keylocation", properties); err != nil {
+		if _, ok := err.(*DatasetError); ok {
+			return fmt.Errorf("bootfs %s does not exist", datasetName)
+		}
+		return err
+	}
+	return checkBootfs(poolName, datasetName, bootloader, properties)
+}
+
+func setBootfs(config *Config, poolName string, datasetName string) error {
+	_, err := callSshCommand(config, "zpool set bootfs=%s %s", datasetName, poolName)
+	return err
+}
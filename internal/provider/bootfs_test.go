@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"testing"
+)
+
+// TestCheckBootfs verifies that boot environments are rejected when they can't be read by the configured bootloader.
+func TestCheckBootfs(t *testing.T) {
+	properties := func(datasetType string, encryption string, keyformat string, keylocation string) map[string]Property {
+		return map[string]Property{
+			"type":        {value: datasetType},
+			"encryption":  {value: encryption},
+			"keyformat":   {value: keyformat},
+			"keylocation": {value: keylocation},
+		}
+	}
+
+	cases := []struct {
+		dataset    string
+		bootloader string
+		properties map[string]Property
+		valid      bool
+	}{
+		{"rpool/ROOT/default", BootloaderGrub, properties("filesystem", "off", "none", "none"), true},
+		{"tank/ROOT/default", BootloaderGrub, properties("filesystem", "off", "none", "none"), false},
+		{"rpool/swap", BootloaderNone, properties("volume", "off", "none", "none"), false},
+		{"rpool/ROOT/default", BootloaderGrub, properties("filesystem", "aes-256-gcm", "passphrase", "prompt"), false},
+		{"rpool/ROOT/default", BootloaderZfsBootMenu, properties("filesystem", "aes-256-gcm", "passphrase", "prompt"), true},
+		{"rpool/ROOT/default", BootloaderZfsBootMenu, properties("filesystem", "aes-256-gcm", "raw", "https://keys.example.com/rpool"), false},
+		{"rpool/ROOT/default", BootloaderZfsBootMenu, properties("filesystem", "aes-256-gcm", "raw", "file:///etc/zfs/rpool.key"), true},
+		{"rpool/ROOT/default", BootloaderNone, properties("filesystem", "aes-256-gcm", "hex", "prompt"), true},
+	}
+
+	for _, c := range cases {
+		err := checkBootfs("rpool", c.dataset, c.bootloader, c.properties)
+		if c.valid && err != nil {
+			t.Fatalf("expected %s to be bootable with %s, got %s", c.dataset, c.bootloader, err)
+		}
+		if !c.valid && err == nil {
+			t.Fatalf("expected %s with %v not to be bootable with %s", c.dataset, c.properties, c.bootloader)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"math"
+	"time"
+)
+
+// CapacitySample is the space allocated in a pool at some point in time.
+type CapacitySample struct {
+	allocated int64
+	at        time.Time
+}
+
+// CapacityForecast projects when a pool fills up, assuming its allocation keeps growing at the same rate.
+type CapacityForecast struct {
+	growthPerDay  float64
+	daysUntilFull float64
+	fullAt        time.Time
+}
+
+// forecastCapacity extrapolates the growth between two samples linearly, up to thresholdPercent of the size of the
+// pool. A pool which doesn't grow is never full, which is a forecast of -1 days and a zero fullAt. A pool which
+// is past the threshold already is full in 0 days.
+func forecastCapacity(size int64, thresholdPercent int, from CapacitySample, to CapacitySample) CapacityForecast {
+	forecast := CapacityForecast{daysUntilFull: -1}
+
+	if days := to.at.Sub(from.at).Hours() / 24; days > 0 {
+		forecast.growthPerDay = float64(to.allocated-from.allocated) / days
+	}
+
+	remaining := float64(size)*float64(thresholdPercent)/100 - float64(to.allocated)
+	switch {
+	case remaining <= 0:
+		forecast.daysUntilFull = 0
+		forecast.fullAt = to.at
+	case forecast.growthPerDay > 0:
+		forecast.daysUntilFull = remaining / forecast.growthPerDay
+		// Forecasts beyond what a time.Duration can hold are as good as never.
+		if hours := forecast.daysUntilFull * 24; hours < float64(math.MaxInt64/int64(time.Hour)) {
+			forecast.fullAt = to.at.Add(time.Duration(hours * float64(time.Hour)))
+		}
+	}
+	return forecast
+}
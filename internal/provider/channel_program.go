@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// Default limits of zfs program, which the host may allow to be raised up to zfs_lua_max_instrlimit and zfs_lua_max_memlimit.
+const (
+	defaultChannelProgramInstructionLimit = 10000000
+	defaultChannelProgramMemoryLimit      = 10 * 1024 * 1024
+)
+
+// ChannelProgram is a Lua script run by zfs program, which executes atomically in syncing context.
+type ChannelProgram struct {
+	pool             string
+	script           string
+	arguments        []string
+	instructionLimit int
+	memoryLimit      int
+	readOnly         bool
+}
+
+// channelProgramFields returns the attributes shared by the zfs_channel_program resource and data source. The
+// resource runs the program once when it is created, so all of its arguments force a new resource.
+func channelProgramFields(forceNew bool) map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"pool": {
+			Description: "Name of the pool to run the program against.",
+			Type:        schema.TypeString,
+			Required:    true,
+			ForceNew:    forceNew,
+		},
+		"script": {
+			Description: "The Lua source of the program, e.g. loaded with `file()`. The arguments are available to it as `argv` in the table passed to the script, i.e. `(...).argv`.",
+			Type:        schema.TypeString,
+			Required:    true,
+			ForceNew:    forceNew,
+		},
+		"arguments": {
+			Description: "Arguments to pass to the program.",
+			Type:        schema.TypeList,
+			Optional:    true,
+			ForceNew:    forceNew,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+		"instruction_limit": {
+			Description:      fmt.Sprintf("Maximum number of Lua instructions the program may execute. Defaults to `%d`.", defaultChannelProgramInstructionLimit),
+			Type:             schema.TypeInt,
+			Optional:         true,
+			ForceNew:         forceNew,
+			Default:          defaultChannelProgramInstructionLimit,
+			ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(1)),
+		},
+		"memory_limit": {
+			Description:      fmt.Sprintf("Maximum amount of memory the program may use, in bytes. Defaults to `%d`.", defaultChannelProgramMemoryLimit),
+			Type:             schema.TypeInt,
+			Optional:         true,
+			ForceNew:         forceNew,
+			Default:          defaultChannelProgramMemoryLimit,
+			ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(1)),
+		},
+		"result": {
+			Description: "What the program returned, encoded as JSON. Use `jsondecode()` to access it.",
+			Type:        schema.TypeString,
+			Computed:    true,
+		},
+	}
+}
+
+func expandChannelProgram(d *schema.ResourceData) ChannelProgram {
+	return ChannelProgram{
+		pool:             d.Get("pool").(string),
+		script:           d.Get("script").(string),
+		arguments:        expandStringList(d.Get("arguments").([]interface{})),
+		instructionLimit: d.Get("instruction_limit").(int),
+		memoryLimit:      d.Get("memory_limit").(int),
+	}
+}
+
+// channelProgramCommand builds the zfs program command, which reads the script from stdin so that it doesn't
+// have to be copied to the host first. Read-only programs run with -n, which fails any change they attempt.
+func channelProgramCommand(program ChannelProgram) string {
+	options := fmt.Sprintf("-j -t %d -m %d", program.instructionLimit, program.memoryLimit)
+	if program.readOnly {
+		options = "-n " + options
+	}
+
+	arguments := make([]string, 0, len(program.arguments))
+	for _, argument := range program.arguments {
+		arguments = append(arguments, shellescape.Quote(argument))
+	}
+
+	command := fmt.Sprintf("printf '%%s' %s | zfs program %s %s -", shellescape.Quote(program.script), options, shellescape.Quote(program.pool))
+	if len(arguments) > 0 {
+		command += " " + strings.Join(arguments, " ")
+	}
+	return command
+}
+
+// parseChannelProgramOutput extracts the return value from the JSON output of zfs program, e.g. {"return": {"count": 3}}.
+// Programs which don't return anything yield null.
+func parseChannelProgramOutput(output string) (string, error) {
+	var parsed struct {
+		Return json.RawMessage `json:"return"`
+	}
+	if strings.TrimSpace(output) == "" {
+		return "null", nil
+	}
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		return "", fmt.Errorf("failed to parse the output of zfs program: %s", err)
+	}
+	if parsed.Return == nil {
+		return "null", nil
+	}
+	return string(parsed.Return), nil
+}
+
+func runChannelProgram(config *Config, program ChannelProgram) (string, error) {
+	// The command is too much of a pipeline for the pool to be told from it, so cached properties of the pool
+	// are dropped here instead.
+	defer config.property_cache.invalidate(program.pool)
+
+	output, err := callSshCommand(config, "%s", channelProgramCommand(program))
+	if err != nil {
+		return "", err
+	}
+	return parseChannelProgramOutput(output)
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestChannelProgramCommand verifies the script is piped to zfs program with the limits and quoted arguments.
+func TestChannelProgramCommand(t *testing.T) {
+	command := channelProgramCommand(ChannelProgram{
+		pool:             "tank",
+		script:           "return zfs.sync.snapshot((...).argv[1])",
+		arguments:        []string{"tank/data@it's"},
+		instructionLimit: 100,
+		memoryLimit:      2048,
+		readOnly:         true,
+	})
+
+	expected := `printf '%s' 'return zfs.sync.snapshot((...).argv[1])' | zfs program -n -j -t 100 -m 2048 tank - 'tank/data@it'"'"'s'`
+	if command != expected {
+		t.Fatalf("expected %s, got %s", expected, command)
+	}
+}
+
+// TestParseChannelProgramOutput verifies the return value is extracted, and missing ones become null.
+func TestParseChannelProgramOutput(t *testing.T) {
+	for output, expected := range map[string]string{
+		`{"return": {"count": 3}}`: `{"count": 3}`,
+		`{"return": 0}`:            `0`,
+		`{}`:                       `null`,
+		``:                         `null`,
+	} {
+		result, err := parseChannelProgramOutput(output)
+		if err != nil || result != expected {
+			t.Fatalf("parseChannelProgramOutput(%q): expected %s, got %s, %v", output, expected, result, err)
+		}
+	}
+
+	if _, err := parseChannelProgramOutput("return: 3"); err == nil {
+		t.Fatalf("expected an error for output which isn't JSON")
+	}
+}
+
+// TestDataSourceChannelProgramRead verifies the data source runs the program read-only and records its result.
+func TestDataSourceChannelProgramRead(t *testing.T) {
+	executor := (&fakeExecutor{}).on("printf", `{"return": ["tank/a", "tank/b"]}`)
+
+	d := schema.TestResourceDataRaw(t, dataSourceChannelProgram().Schema, map[string]interface{}{
+		"pool":   "tank",
+		"script": "return {}",
+	})
+	if diags := dataSourceChannelProgramRead(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	if len(executor.commands) != 1 || !strings.Contains(executor.commands[0], "zfs program -n -j -t 10000000 -m 10485760 tank -") {
+		t.Fatalf("unexpected commands %v", executor.commands)
+	}
+	if d.Get("result").(string) != `["tank/a", "tank/b"]` {
+		t.Fatalf("unexpected result %v", d.Get("result"))
+	}
+}
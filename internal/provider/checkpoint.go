@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// Checkpoint is the checkpoint of a pool, which the pool can be rewound to on import with --rewind-to-checkpoint.
+type Checkpoint struct {
+	// created is the time the checkpoint was taken as reported by zpool status, in the local time of the host.
+	created string
+	// size is the space held by the checkpoint in bytes, which grows as data it references is overwritten or freed.
+	size int64
+}
+
+// parseCheckpointSection parses the checkpoint section of zpool status, e.g.
+//
+//	created Thu Aug 13 15:16:53 2020, consumes 1.21M
+//
+// ok is false when there is no checkpoint, including while one is being discarded.
+func parseCheckpointSection(section string) (string, bool) {
+	if !strings.HasPrefix(section, "created ") {
+		return "", false
+	}
+	created, _, _ := strings.Cut(strings.TrimPrefix(section, "created "), ",")
+	return strings.TrimSpace(created), true
+}
+
+// parseCheckpointSize parses the checkpoint property of zpool get -p, which is - or 0 without a checkpoint.
+func parseCheckpointSize(value string) (int64, error) {
+	if value == "-" || value == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected checkpoint size %q", value)
+	}
+	return size, nil
+}
+
+// readCheckpoint returns the checkpoint of a pool, or nil if it has none.
+func readCheckpoint(config *Config, poolName string) (*Checkpoint, error) {
+	status, err := readPoolStatus(config, poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	created, ok := parseCheckpointSection(parseStatusSections(status)["checkpoint"])
+	if !ok {
+		return nil, nil
+	}
+
+	stdout, err := callSshCommand(config, "zpool get -H -p -o value checkpoint %s", shellescape.Quote(poolName))
+	if err != nil {
+		return nil, err
+	}
+	size, err := parseCheckpointSize(strings.TrimSpace(stdout))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Checkpoint{created: created, size: size}, nil
+}
+
+func createCheckpoint(config *Config, poolName string) error {
+	_, err := callSshCommand(config, "zpool checkpoint %s", shellescape.Quote(poolName))
+	return err
+}
+
+func discardCheckpoint(config *Config, poolName string) error {
+	_, err := callSshCommand(config, "zpool checkpoint -d %s", shellescape.Quote(poolName))
+	return err
+}
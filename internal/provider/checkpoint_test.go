@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"testing"
+)
+
+// TestParseCheckpointSection verifies that the creation time is taken from zpool status, and that a checkpoint which
+// is being discarded counts as none.
+func TestParseCheckpointSection(t *testing.T) {
+	cases := []struct {
+		section string
+		created string
+		ok      bool
+	}{
+		{"created Thu Aug 13 15:16:53 2020, consumes 1.21M", "Thu Aug 13 15:16:53 2020", true},
+		{"created Thu Aug 13 15:16:53 2020, consumes 1269760", "Thu Aug 13 15:16:53 2020", true},
+		{"discarding", "", false},
+		{"", "", false},
+	}
+
+	for _, c := range cases {
+		created, ok := parseCheckpointSection(c.section)
+		if created != c.created || ok != c.ok {
+			t.Fatalf("unexpected result %q, %t for %q", created, ok, c.section)
+		}
+	}
+}
+
+// TestReadCheckpoint verifies that the size is only read when the pool has a checkpoint.
+func TestReadCheckpoint(t *testing.T) {
+	status := "  pool: tank\n state: ONLINE\ncheckpoint: created Thu Aug 13 15:16:53 2020, consumes 1.21M\nconfig:\n\n\tNAME STATE READ WRITE CKSUM\n\ttank ONLINE 0 0 0\n\nerrors: No known data errors\n"
+	executor := (&fakeExecutor{}).
+		on("zpool status -pP tank", status).
+		on("zpool get -H -p -o value checkpoint tank", "1269760\n").
+		on("zpool status -pP empty", "  pool: empty\n state: ONLINE\nconfig:\n\nerrors: No known data errors\n")
+	config := newFakeConfig(executor)
+
+	checkpoint, err := readCheckpoint(config, "tank")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if checkpoint == nil || checkpoint.created != "Thu Aug 13 15:16:53 2020" || checkpoint.size != 1269760 {
+		t.Fatalf("unexpected checkpoint %+v", checkpoint)
+	}
+
+	if checkpoint, err := readCheckpoint(config, "empty"); err != nil || checkpoint != nil {
+		t.Fatalf("expected no checkpoint, got %+v, %v", checkpoint, err)
+	}
+	if executor.ran("zpool get -H -p -o value checkpoint empty") {
+		t.Fatalf("the size was read without a checkpoint")
+	}
+}
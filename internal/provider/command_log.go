@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// commandOutputLimit is how many bytes of the stdout and stderr of a command are logged, as some commands such as
+// zfs get all print a lot.
+const commandOutputLimit = 4096
+
+// CommandRecord is a command which was run on the host, as logged and written to the audit log. The command and its
+// output are redacted.
+type CommandRecord struct {
+	command  string
+	took     time.Duration
+	exitCode int
+	stdout   string
+	stderr   string
+	err      error
+}
+
+func truncateOutput(output string) string {
+	if len(output) <= commandOutputLimit {
+		return output
+	}
+	return output[:commandOutputLimit] + "...(truncated)"
+}
+
+// commandExitCode returns the exit code of a command run by the executor, or -1 if it didn't finish or the executor
+// couldn't tell, e.g. because the connection failed.
+func commandExitCode(err error, done bool) int {
+	if !done {
+		return -1
+	}
+	var exit interface{ ExitStatus() int }
+	if errors.As(err, &exit) {
+		return exit.ExitStatus()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// newCommandRecord redacts a command and its output for logging.
+func newCommandRecord(config *Config, cmd string, took time.Duration, stdout string, stderr string, done bool, err error) CommandRecord {
+	return CommandRecord{
+		command:  redactCommand(config, cmd),
+		took:     took,
+		exitCode: commandExitCode(err, done),
+		stdout:   truncateOutput(redactCommand(config, stdout)),
+		stderr:   truncateOutput(redactCommand(config, stderr)),
+		err:      err,
+	}
+}
+
+// logCommand writes a structured log entry for a command, which shows up with TF_LOG=DEBUG.
+func logCommand(ctx context.Context, record CommandRecord) {
+	fields := map[string]interface{}{
+		"command":     record.command,
+		"operation":   commandOperation(record.command),
+		"duration_ms": record.took.Milliseconds(),
+		"exit_code":   record.exitCode,
+		"stdout":      record.stdout,
+		"stderr":      record.stderr,
+	}
+	if record.err != nil {
+		fields["error"] = record.err.Error()
+	}
+	tflog.Debug(ctx, "ran command on the host", fields)
+}
+
+// isMutatingCommand reports whether a command changes a pool, by running one of the mutatingSubcommands of zfs or
+// zpool anywhere in it, including in pipelines and scripts.
+func isMutatingCommand(cmd string) bool {
+	fields := strings.Fields(cmd)
+	for i := 0; i+1 < len(fields); i++ {
+		program := strings.Trim(fields[i], `'"({`)
+		if contains(mutatingSubcommands[program], strings.Trim(fields[i+1], `'"`)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditLog appends a JSON line per command changing a pool to audit_log_path, as evidence of what terraform changed
+// on the host and when. The file is only ever appended to, so it can collect the commands of every plan and apply.
+// A nil AuditLog records nothing.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	host string
+	user string
+}
+
+// auditEntry is a line of the audit log.
+type auditEntry struct {
+	Time            string  `json:"time"`
+	Host            string  `json:"host"`
+	User            string  `json:"user"`
+	Command         string  `json:"command"`
+	Operation       string  `json:"operation"`
+	Pool            string  `json:"pool,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	ExitCode        int     `json:"exit_code"`
+	Success         bool    `json:"success"`
+	Stderr          string  `json:"stderr,omitempty"`
+}
+
+func newAuditLog(path string, host string, user string) *AuditLog {
+	if path == "" {
+		return nil
+	}
+	return &AuditLog{path: path, host: host, user: user}
+}
+
+// record appends the command to the audit log if it changes a pool. Failed commands are recorded too, as they may
+// have changed something before failing.
+func (audit *AuditLog) record(record CommandRecord, now time.Time) error {
+	if audit == nil || !isMutatingCommand(record.command) {
+		return nil
+	}
+
+	line, err := json.Marshal(auditEntry{
+		Time:            now.UTC().Format(time.RFC3339Nano),
+		Host:            audit.host,
+		User:            audit.user,
+		Command:         record.command,
+		Operation:       commandOperation(record.command),
+		Pool:            commandPool(record.command),
+		DurationSeconds: record.took.Seconds(),
+		ExitCode:        record.exitCode,
+		Success:         record.err == nil && record.exitCode == 0 && record.stderr == "",
+		Stderr:          record.stderr,
+	})
+	if err != nil {
+		return err
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	file, err := os.OpenFile(audit.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeExitError struct{ status int }
+
+func (e *fakeExitError) Error() string   { return "exited" }
+func (e *fakeExitError) ExitStatus() int { return e.status }
+
+// TestCommandExitCode verifies that exit codes are taken from the error of the executor where it has one.
+func TestCommandExitCode(t *testing.T) {
+	if code := commandExitCode(nil, true); code != 0 {
+		t.Fatalf("expected 0 for a command which succeeded, got %d", code)
+	}
+	if code := commandExitCode(&fakeExitError{status: 2}, true); code != 2 {
+		t.Fatalf("expected the exit status, got %d", code)
+	}
+	if code := commandExitCode(nil, false); code != -1 {
+		t.Fatalf("expected -1 for a command which timed out, got %d", code)
+	}
+}
+
+// TestIsMutatingCommand verifies that commands changing a pool are told apart from those only reading it, also when
+// wrapped in a script.
+func TestIsMutatingCommand(t *testing.T) {
+	cases := map[string]bool{
+		"zfs set compression=lz4 tank/data":                         true,
+		"zpool offline -t tank /dev/sdb1":                           true,
+		"nohup sh -c '(zfs receive -u tank/image < /srv/img) 2> x'": true,
+		"curl -fsSL https://example.com/img | zfs receive tank/img": true,
+		"zfs get -H -p all tank/data":                               false,
+		"zpool status -pP tank":                                     false,
+	}
+	for cmd, expected := range cases {
+		if isMutatingCommand(cmd) != expected {
+			t.Fatalf("expected isMutatingCommand(%q) to be %t", cmd, expected)
+		}
+	}
+}
+
+// TestAuditLog verifies that only commands changing a pool are appended to the audit log, with their secrets
+// redacted and failures recorded.
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	executor := (&fakeExecutor{}).
+		on("zfs get", "tank\tcompression\tlz4\n").
+		on("zfs set", "").
+		fail("zfs destroy", "cannot destroy 'tank/data': dataset is busy")
+	config := newFakeConfig(executor)
+	config.retry_max_attempts = 1
+	config.audit_log = newAuditLog(path, "storage1", "terraform")
+	config.secrets.add("hunter2")
+
+	if _, err := callSshCommand(config, "zfs get -H compression tank"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := callSshCommand(config, "zfs set org.example:token=hunter2 tank"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := callSshCommand(config, "zfs destroy tank/data"); err == nil {
+		t.Fatalf("expected the destroy to fail")
+	}
+
+	output, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the audit log: %s", err)
+	}
+	if strings.Contains(string(output), "hunter2") {
+		t.Fatalf("the audit log contains a secret: %s", output)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %q", lines)
+	}
+
+	var set, destroy auditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &set); err != nil {
+		t.Fatalf("invalid entry %q: %s", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &destroy); err != nil {
+		t.Fatalf("invalid entry %q: %s", lines[1], err)
+	}
+
+	if set.Command != "zfs set org.example:token=<redacted> tank" || set.Operation != "zfs set" || set.Pool != "tank" || !set.Success || set.Host != "storage1" || set.User != "terraform" {
+		t.Fatalf("unexpected entry %+v", set)
+	}
+	if destroy.Success || !strings.Contains(destroy.Stderr, "dataset is busy") {
+		t.Fatalf("expected the failed destroy to be recorded, got %+v", destroy)
+	}
+}
+
+// TestTruncateOutput verifies that long output is cut off at the limit.
+func TestTruncateOutput(t *testing.T) {
+	if output := truncateOutput("short"); output != "short" {
+		t.Fatalf("unexpected output %q", output)
+	}
+	long := strings.Repeat("a", commandOutputLimit+10)
+	if output := truncateOutput(long); len(output) != commandOutputLimit+len("...(truncated)") {
+		t.Fatalf("expected the output to be truncated, got %d bytes", len(output))
+	}
+}
@@ -0,0 +1,227 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// defaultCompressionCandidates are compared when no candidates are given, cheapest first.
+var defaultCompressionCandidates = []string{"lz4", "zstd", "zstd-9"}
+
+// normalizeCompression returns the algorithm an alias of the compression property stands for.
+func normalizeCompression(compression string) string {
+	switch compression {
+	case "on":
+		return "lz4"
+	case "gzip":
+		return "gzip-6"
+	case "zstd":
+		return "zstd-3"
+	case "zstd-fast":
+		return "zstd-fast-1"
+	}
+	return compression
+}
+
+// compressionFactor is a rule of thumb for how much space an algorithm saves compared to lz4 on the same data, as the
+// ratio of their compressratio minus one. The factors are rough figures, not measurements, so estimates based on them
+// are reported with measured = false. It is only used for algorithms which no dataset uses yet, real data can differ a
+// lot.
+func compressionFactor(compression string) float64 {
+	compression = normalizeCompression(compression)
+	level := func(prefix string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(compression, prefix))
+		return n
+	}
+
+	switch {
+	case compression == "off":
+		return 0
+	case compression == "zle":
+		return 0.25
+	case compression == "lzjb":
+		return 0.85
+	case compression == "lz4":
+		return 1
+	case strings.HasPrefix(compression, "zstd-fast-"):
+		return 0.9
+	case strings.HasPrefix(compression, "zstd-"):
+		return 1.2 + 0.02*float64(level("zstd-")-3)
+	case strings.HasPrefix(compression, "gzip-"):
+		return 1.1 + 0.02*float64(level("gzip-")-6)
+	}
+	return 0
+}
+
+// CompressionSample is the compression of the data a single dataset references itself, excluding its descendants.
+type CompressionSample struct {
+	name              string
+	compression       string
+	compressratio     float64
+	refcompressratio  float64
+	logicalused       int64
+	used              int64
+	logicalreferenced int64
+}
+
+// parseCompressionSamples parses zfs get -H -p -o name,property,value output for the properties read by
+// readCompressionSamples, in the order the datasets are listed.
+func parseCompressionSamples(output string) ([]CompressionSample, error) {
+	samples := make([]CompressionSample, 0)
+	index := make(map[string]int)
+
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected zfs get output line %q", line)
+		}
+		name, property, value := fields[0], fields[1], fields[2]
+
+		i, ok := index[name]
+		if !ok {
+			i = len(samples)
+			index[name] = i
+			samples = append(samples, CompressionSample{name: name})
+		}
+		sample := &samples[i]
+
+		var err error
+		switch property {
+		case "compression":
+			sample.compression = value
+		case "compressratio":
+			sample.compressratio, err = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "refcompressratio":
+			sample.refcompressratio, err = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "logicalused":
+			sample.logicalused, err = strconv.ParseInt(value, 10, 64)
+		case "used":
+			sample.used, err = strconv.ParseInt(value, 10, 64)
+		case "logicalreferenced":
+			sample.logicalreferenced, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unexpected value %q of %s on %s", value, property, name)
+		}
+	}
+
+	return samples, nil
+}
+
+func readCompressionSamples(config *Config, datasetName string) ([]CompressionSample, error) {
+	stdout, err := callSshCommand(config, "zfs get -H -p -r -t filesystem,volume -o name,property,value compression,compressratio,refcompressratio,logicalused,used,logicalreferenced %s", shellescape.Quote(datasetName))
+	if err != nil {
+		return nil, err
+	}
+	return parseCompressionSamples(stdout)
+}
+
+// CompressionEstimate is the expected compressratio of an algorithm on the data of a dataset and its descendants.
+type CompressionEstimate struct {
+	compression   string
+	compressratio float64
+	// saved is the space the algorithm saves in bytes, compared to storing the data uncompressed.
+	saved int64
+	// measured is whether the ratio was measured on datasets using the algorithm, rather than estimated.
+	measured bool
+}
+
+// weightedRatio accumulates the overall compressratio of several datasets, which is the total logical size over the
+// total physical size rather than the average of their ratios.
+type weightedRatio struct {
+	logical  float64
+	physical float64
+}
+
+func (w *weightedRatio) add(logical int64, ratio float64) {
+	if logical <= 0 || ratio <= 0 {
+		return
+	}
+	w.logical += float64(logical)
+	w.physical += float64(logical) / ratio
+}
+
+func (w weightedRatio) ratio() (float64, bool) {
+	if w.physical == 0 {
+		return 0, false
+	}
+	return w.logical / w.physical, true
+}
+
+// estimateCompression estimates the compressratio of each candidate on the samples. Algorithms already in use are
+// measured on the datasets using them, the others are extrapolated from the ratio of every compressed dataset with
+// compressionFactor. Without any compressed dataset there is nothing to extrapolate from, and those ratios are 0.
+func estimateCompression(samples []CompressionSample, candidates []string) []CompressionEstimate {
+	var logical int64
+	measured := make(map[string]*weightedRatio)
+	var baseline weightedRatio
+
+	for _, sample := range samples {
+		logical += sample.logicalreferenced
+
+		compression := normalizeCompression(sample.compression)
+		if measured[compression] == nil {
+			measured[compression] = &weightedRatio{}
+		}
+		measured[compression].add(sample.logicalreferenced, sample.refcompressratio)
+
+		// Expressed as the ratio lz4 would have reached on the same data.
+		if factor := compressionFactor(compression); factor > 0 {
+			baseline.add(sample.logicalreferenced, 1+(sample.refcompressratio-1)/factor)
+		}
+	}
+
+	lz4Ratio, ok := baseline.ratio()
+
+	estimates := make([]CompressionEstimate, 0, len(candidates))
+	for _, candidate := range candidates {
+		estimate := CompressionEstimate{compression: candidate}
+		if ratio, found := measured[normalizeCompression(candidate)]; found {
+			estimate.compressratio, estimate.measured = ratio.ratio()
+		}
+		if !estimate.measured && ok {
+			estimate.compressratio = 1 + (lz4Ratio-1)*compressionFactor(candidate)
+		}
+		if estimate.compressratio > 0 {
+			estimate.saved = logical - int64(float64(logical)/estimate.compressratio)
+		}
+		estimates = append(estimates, estimate)
+	}
+
+	return estimates
+}
+
+// recommendCompression picks the first, and so cheapest, candidate whose compressratio is within tolerance of the
+// best one, as the more expensive algorithms cost CPU on every write for little gain on data which barely compresses.
+func recommendCompression(estimates []CompressionEstimate, tolerance float64) (string, string) {
+	if len(estimates) == 0 {
+		return "", "no candidates to compare"
+	}
+
+	ranked := make([]CompressionEstimate, len(estimates))
+	copy(ranked, estimates)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].compressratio > ranked[j].compressratio })
+	best := ranked[0]
+
+	if best.compressratio == 0 {
+		return estimates[0].compression, "none of the data is compressed yet, so there is nothing to compare the candidates on"
+	}
+
+	for _, estimate := range estimates {
+		if estimate.compressratio >= best.compressratio-tolerance {
+			if estimate.compression == best.compression {
+				return estimate.compression, fmt.Sprintf("%s has the best compressratio of %.2f", estimate.compression, estimate.compressratio)
+			}
+			return estimate.compression, fmt.Sprintf("%s reaches a compressratio of %.2f, within %.2f of the %.2f of %s at a lower cost",
+				estimate.compression, estimate.compressratio, tolerance, best.compressratio, best.compression)
+		}
+	}
+	return best.compression, ""
+}
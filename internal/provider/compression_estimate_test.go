@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"math"
+	"testing"
+)
+
+const compressionSamplesOutput = "tank/data\tcompression\tlz4\n" +
+	"tank/data\tcompressratio\t1.80\n" +
+	"tank/data\trefcompressratio\t2.00\n" +
+	"tank/data\tlogicalused\t3000\n" +
+	"tank/data\tused\t1700\n" +
+	"tank/data\tlogicalreferenced\t1000\n" +
+	"tank/data/media\tcompression\toff\n" +
+	"tank/data/media\tcompressratio\t1.00\n" +
+	"tank/data/media\trefcompressratio\t1.00\n" +
+	"tank/data/media\tlogicalused\t1000\n" +
+	"tank/data/media\tused\t1000\n" +
+	"tank/data/media\tlogicalreferenced\t1000\n" +
+	"tank/data/logs\tcompression\tzstd\n" +
+	"tank/data/logs\tcompressratio\t2.20\n" +
+	"tank/data/logs\trefcompressratio\t2.20\n" +
+	"tank/data/logs\tlogicalused\t1000\n" +
+	"tank/data/logs\tused\t455\n" +
+	"tank/data/logs\tlogicalreferenced\t1000\n"
+
+// TestParseCompressionSamples verifies that the properties are grouped by dataset in the order they are listed.
+func TestParseCompressionSamples(t *testing.T) {
+	samples, err := parseCompressionSamples(compressionSamplesOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples, got %+v", samples)
+	}
+	root := samples[0]
+	if root.name != "tank/data" || root.compression != "lz4" || root.compressratio != 1.8 || root.logicalused != 3000 || root.used != 1700 {
+		t.Fatalf("unexpected root sample %+v", root)
+	}
+
+	if _, err := parseCompressionSamples("tank\tused\tlots\n"); err == nil {
+		t.Fatalf("expected an error for a value which isn't a number")
+	}
+}
+
+// TestEstimateCompression verifies that algorithms in use are measured, and others extrapolated from every
+// compressed dataset but not from uncompressed ones.
+func TestEstimateCompression(t *testing.T) {
+	samples, err := parseCompressionSamples(compressionSamplesOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	estimates := estimateCompression(samples, []string{"lz4", "zstd-3", "gzip"})
+
+	if !estimates[0].measured || estimates[0].compressratio != 2 {
+		t.Fatalf("expected lz4 to be measured at 2.00, got %+v", estimates[0])
+	}
+	if !estimates[1].measured || estimates[1].compressratio != 2.2 {
+		t.Fatalf("expected zstd-3 to be measured through its alias, got %+v", estimates[1])
+	}
+
+	// lz4 reached 2.0 on its data and zstd 2.2 on data lz4 would have reached 2.0 on, so gzip-6 is 1 + 1.0 * 1.1.
+	if estimates[2].measured || math.Abs(estimates[2].compressratio-2.1) > 0.001 {
+		t.Fatalf("expected gzip to be extrapolated to 2.10, got %+v", estimates[2])
+	}
+	// All 3000 logical bytes, including the uncompressed ones, are counted.
+	if expected := int64(3000) - int64(3000/estimates[2].compressratio); estimates[2].saved != expected {
+		t.Fatalf("expected %d bytes saved, got %d", expected, estimates[2].saved)
+	}
+
+	uncompressed := estimateCompression(samples[1:2], []string{"lz4"})
+	if uncompressed[0].compressratio != 0 || uncompressed[0].saved != 0 {
+		t.Fatalf("expected nothing to extrapolate from uncompressed data, got %+v", uncompressed[0])
+	}
+}
+
+// TestRecommendCompression verifies that the cheapest candidate within the tolerance of the best one is recommended.
+func TestRecommendCompression(t *testing.T) {
+	estimates := []CompressionEstimate{
+		{compression: "lz4", compressratio: 1.10},
+		{compression: "zstd", compressratio: 1.12},
+		{compression: "zstd-9", compressratio: 1.14},
+	}
+	if recommended, _ := recommendCompression(estimates, 0.05); recommended != "lz4" {
+		t.Fatalf("expected lz4 on data which barely compresses, got %s", recommended)
+	}
+	if recommended, _ := recommendCompression(estimates, 0.03); recommended != "zstd" {
+		t.Fatalf("expected zstd with a lower tolerance, got %s", recommended)
+	}
+	if recommended, _ := recommendCompression(estimates, 0); recommended != "zstd-9" {
+		t.Fatalf("expected zstd-9 without tolerance, got %s", recommended)
+	}
+
+	unknown := []CompressionEstimate{{compression: "lz4"}, {compression: "zstd"}}
+	if recommended, reason := recommendCompression(unknown, 0.05); recommended != "lz4" || reason == "" {
+		t.Fatalf("expected the cheapest candidate without estimates, got %s: %s", recommended, reason)
+	}
+}
@@ -0,0 +1,240 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// mutatingSubcommands are the zfs and zpool subcommands which change a pool, and are therefore run one at a time per pool.
+// Running several of them at once on the same pool tends to fail with "dataset is busy" or stall on txg syncs.
+var mutatingSubcommands = map[string][]string{
+	"zfs": {
+		"allow", "bookmark", "change-key", "clone", "create", "destroy", "hold", "inherit", "load-key", "mount", "promote",
+		"receive", "recv", "release", "rename", "rollback", "set", "snapshot", "unallow", "unload-key", "unmount", "upgrade",
+	},
+	"zpool": {
+		"add", "attach", "checkpoint", "clear", "create", "destroy", "detach", "export", "import", "offline", "online",
+		"reguid", "remove", "replace", "scrub", "set", "split", "trim", "upgrade",
+	},
+}
+
+// readOnlySubcommands are the zfs and zpool subcommands which only read, and so can run again when the connection
+// dropped while they were running.
+var readOnlySubcommands = map[string][]string{
+	"zfs":   {"diff", "get", "groupspace", "holds", "list", "projectspace", "userspace", "version"},
+	"zpool": {"events", "get", "history", "iostat", "list", "status", "version"},
+}
+
+// readOnlyCommands are the other commands which only read, and are e.g. part of pipelines of zfs and zpool commands.
+var readOnlyCommands = []string{"cat", "echo", "head", "ls", "readlink", "stat", "tail", "uname"}
+
+// zpoolOptionArguments are the options of zpool subcommands which take an argument, so it isn't mistaken for the pool name.
+var zpoolOptionArguments = map[string][]string{
+	"add":     {"-o"},
+	"attach":  {"-o"},
+	"create":  {"-m", "-o", "-O", "-R", "-t"},
+	"import":  {"-c", "-d", "-o", "-R", "-T"},
+	"replace": {"-o"},
+	"split":   {"-o", "-R"},
+	"trim":    {"-r"},
+	"upgrade": {"-V"},
+}
+
+// shellCommands splits a shell command line into the words of each of its commands, removing quotes the way the
+// shell does, so that a quoted name such as 'tank/my data' stays a single word. Commands are separated by unquoted |,
+// & or ;. Redirections such as 2>/dev/null are dropped along with their targets. Unlike in the shell, < and > within a
+// word are kept, as they are how redacted values are marked.
+func shellCommands(cmd string) [][]string {
+	commands := make([][]string, 0)
+	words := make([]string, 0)
+	var word strings.Builder
+	// started is set once a word has begun, as '' is a word too, and redirected once it is the target of a redirection.
+	started, redirected := false, false
+	end := func() {
+		if started && !redirected {
+			words = append(words, word.String())
+		}
+		word.Reset()
+		started, redirected = false, false
+	}
+	endCommand := func() {
+		end()
+		if len(words) > 0 {
+			commands = append(commands, words)
+		}
+		words = make([]string, 0)
+	}
+
+	for i := 0; i < len(cmd); i++ {
+		switch c := cmd[i]; c {
+		case ' ', '\t', '\n':
+			end()
+		case '|', '&', ';':
+			endCommand()
+		case '<', '>':
+			// Only words starting with a redirection, or with a file descriptor such as the 2 of 2>&1, are
+			// redirections, so that redacted values such as token=<redacted> are kept.
+			if started && strings.Trim(word.String(), "0123456789") != "" {
+				word.WriteByte(c)
+				continue
+			}
+			word.Reset()
+			for i+1 < len(cmd) && (cmd[i+1] == '>' || cmd[i+1] == '&') {
+				i++
+			}
+			for i+1 < len(cmd) && (cmd[i+1] == ' ' || cmd[i+1] == '\t') {
+				i++
+			}
+			started, redirected = true, true
+		case '\'':
+			closing := strings.IndexByte(cmd[i+1:], '\'')
+			if closing < 0 {
+				closing = len(cmd) - i - 1
+			}
+			word.WriteString(cmd[i+1 : i+1+closing])
+			i += closing + 1
+			started = true
+		case '"':
+			for i++; i < len(cmd) && cmd[i] != '"'; i++ {
+				if cmd[i] == '\\' && i+1 < len(cmd) && strings.IndexByte("\"\\$`", cmd[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(cmd[i])
+			}
+			started = true
+		case '\\':
+			if i+1 < len(cmd) {
+				i++
+				word.WriteByte(cmd[i])
+			}
+			started = true
+		default:
+			word.WriteByte(c)
+			started = true
+		}
+	}
+	endCommand()
+	return commands
+}
+
+// shellWords splits the first command of a shell command line into words, see shellCommands.
+func shellWords(cmd string) []string {
+	commands := shellCommands(cmd)
+	if len(commands) == 0 {
+		return []string{}
+	}
+	return commands[0]
+}
+
+// isReadOnlyCommand reports whether every command of a shell command line only reads. Command substitutions aren't
+// looked into, so command lines with them never count as read-only.
+func isReadOnlyCommand(cmd string) bool {
+	if strings.Contains(cmd, "$(") || strings.Contains(cmd, "`") {
+		return false
+	}
+
+	commands := shellCommands(cmd)
+	for _, words := range commands {
+		if subcommands, ok := readOnlySubcommands[words[0]]; ok {
+			if len(words) < 2 || !contains(subcommands, words[1]) {
+				return false
+			}
+		} else if !contains(readOnlyCommands, words[0]) {
+			return false
+		}
+	}
+	return len(commands) > 0
+}
+
+// commandPool returns the pool a zfs or zpool command changes, or "" for commands which don't change a pool, or
+// whose pool can't be told. zfs commands take the dataset last, while zpool commands take the pool first, after
+// their options. Only the first command of a pipeline or list is considered.
+func commandPool(cmd string) string {
+	fields := shellWords(cmd)
+	if len(fields) < 3 || !contains(mutatingSubcommands[fields[0]], fields[1]) {
+		return ""
+	}
+
+	target := ""
+	if fields[0] == "zfs" {
+		target = fields[len(fields)-1]
+	} else {
+		arguments := fields[2:]
+		for i := 0; i < len(arguments); i++ {
+			argument := arguments[i]
+			if contains(zpoolOptionArguments[fields[1]], argument) {
+				i++
+				continue
+			}
+			if strings.HasPrefix(argument, "-") || strings.Contains(argument, "=") {
+				continue
+			}
+			target = argument
+			break
+		}
+	}
+
+	if strings.HasPrefix(target, "-") || strings.HasPrefix(target, "/") {
+		return ""
+	}
+	// A zpool command without a pool, such as zpool import -a, leaves nothing to split.
+	if parts := strings.FieldsFunc(target, func(r rune) bool { return r == '/' || r == '@' || r == '#' }); len(parts) > 0 {
+		return parts[0]
+	}
+	return ""
+}
+
+// CommandLimiter bounds how many commands run on the host at once, and serializes commands changing the same pool.
+type CommandLimiter struct {
+	slots chan struct{}
+	pools sync.Map
+}
+
+// newCommandLimiter returns a limiter allowing max concurrent commands, or any number if max is 0.
+func newCommandLimiter(max int) *CommandLimiter {
+	limiter := &CommandLimiter{}
+	if max > 0 {
+		limiter.slots = make(chan struct{}, max)
+	}
+	return limiter
+}
+
+// acquire waits until cmd may run, and returns a function to call once it has finished. A nil limiter lets every
+// command run immediately.
+func (limiter *CommandLimiter) acquire(ctx context.Context, cmd string) (func(), error) {
+	if limiter == nil {
+		return func() {}, nil
+	}
+
+	var poolLock chan struct{}
+	if pool := commandPool(cmd); pool != "" {
+		lock, _ := limiter.pools.LoadOrStore(pool, make(chan struct{}, 1))
+		poolLock = lock.(chan struct{})
+		select {
+		case poolLock <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if limiter.slots != nil {
+		select {
+		case limiter.slots <- struct{}{}:
+		case <-ctx.Done():
+			if poolLock != nil {
+				<-poolLock
+			}
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() {
+		if limiter.slots != nil {
+			<-limiter.slots
+		}
+		if poolLock != nil {
+			<-poolLock
+		}
+	}, nil
+}
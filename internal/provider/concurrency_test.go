@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestShellWords verifies that quotes are removed the way the shell does, and redirections and later commands dropped.
+func TestShellWords(t *testing.T) {
+	for cmd, expected := range map[string][]string{
+		"zfs set quota=10G 'tank/my data'":                 {"zfs", "set", "quota=10G", "tank/my data"},
+		`zfs set org.example:note='it'"'"'s' "tank/\"x\""`: {"zfs", "set", "org.example:note=it's", `tank/"x"`},
+		"zfs destroy tank/data 2>/dev/null && echo done":   {"zfs", "destroy", "tank/data"},
+		"zfs receive tank/image < /srv/image.zfs":          {"zfs", "receive", "tank/image"},
+		"zpool list -H '' tank":                            {"zpool", "list", "-H", "", "tank"},
+		"":                                                 {},
+	} {
+		if words := shellWords(cmd); !reflect.DeepEqual(words, expected) {
+			t.Fatalf("shellWords(%q): expected %q, got %q", cmd, expected, words)
+		}
+	}
+}
+
+// TestCommandPool verifies the pool changed by a command is found after options and property assignments.
+func TestCommandPool(t *testing.T) {
+	for cmd, expected := range map[string]string{
+		"zfs create -o compression=on tank/data":                                    "tank",
+		"zfs snapshot tank/data@daily":                                              "tank",
+		"zfs destroy -r tank/data 2>/dev/null":                                      "tank",
+		"zfs set quota=10G 'tank/data'":                                             "tank",
+		"zfs list -H -o name tank":                                                  "",
+		"zpool create -o ashift=12 -O compression=on tank mirror /dev/sda /dev/sdb": "tank",
+		"zpool set autotrim=on tank":                                                "tank",
+		"zpool trim -r 100M -d tank /dev/sda":                                       "tank",
+		"zpool import -d /dev/disk/by-id tank":                                      "tank",
+		"zpool status -pP tank":                                                     "",
+		"zfs mount -a":                                                              "",
+		"cat /sys/module/zfs/parameters/zfs_arc_max":                                "",
+		"zpool import -d /dev/disk/by-id":                                           "",
+		"zpool import -a":                                                           "",
+		"zfs set quota=10G 'tank two/my data'":                                      "tank two",
+		"zfs receive -u tank/image < /srv/image.zfs":                                "tank",
+		"zfs destroy tank/data 2>&1 | grep -v busy":                                 "tank",
+		"zfs snapshot \"tank/my data@daily\"; zfs list":                             "tank",
+	} {
+		if pool := commandPool(cmd); pool != expected {
+			t.Fatalf("commandPool(%q): expected %q, got %q", cmd, expected, pool)
+		}
+	}
+}
+
+// TestCommandLimiter verifies that commands changing the same pool wait for each other, while other pools don't.
+func TestCommandLimiter(t *testing.T) {
+	limiter := newCommandLimiter(0)
+
+	release, err := limiter.acquire(context.Background(), "zfs create tank/a")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	other, err := limiter.acquire(context.Background(), "zfs create backup/a")
+	if err != nil {
+		t.Fatalf("expected a command on another pool to run, got %s", err)
+	}
+	other()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, "zfs create tank/b"); err == nil {
+		t.Fatalf("expected a second command on the same pool to wait")
+	}
+
+	release()
+	if release, err = limiter.acquire(context.Background(), "zfs create tank/b"); err != nil {
+		t.Fatalf("expected the pool to be released, got %s", err)
+	}
+	release()
+}
+
+// TestCommandLimiter_MaxConcurrent verifies that no more than the maximum number of commands run at once.
+func TestCommandLimiter_MaxConcurrent(t *testing.T) {
+	limiter := newCommandLimiter(1)
+
+	release, err := limiter.acquire(context.Background(), "zfs list")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, "zpool list"); err == nil {
+		t.Fatalf("expected the second command to wait")
+	}
+
+	release()
+	if release, err = limiter.acquire(context.Background(), "zpool list"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	release()
+}
+
+// TestIsReadOnlyCommand verifies that only command lines made up entirely of reads are read-only.
+func TestIsReadOnlyCommand(t *testing.T) {
+	cases := map[string]bool{
+		"zfs get -H -o value guid tank/data":                          true,
+		"zfs get -H all tank && echo --sep-- && zfs get -Hp all tank": true,
+		"zpool list -H | head -n 1":                                   true,
+		"zpool status -P tank 2>/dev/null":                            true,
+		"zpool create tank /dev/sda":                                  false,
+		"zfs list -H -o name | xargs zfs destroy":                     false,
+		"zfs list -H -o name; zfs destroy -r tank/data":               false,
+		"zfs list $(zfs destroy tank/data)":                           false,
+		"mktemp -d /var/tmp/terraform-zfs-receive.XXXXXXXX":           false,
+		"": false,
+	}
+	for cmd, expected := range cases {
+		if readOnly := isReadOnlyCommand(cmd); readOnly != expected {
+			t.Fatalf("isReadOnlyCommand(%q): expected %t, got %t", cmd, expected, readOnly)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceChannelProgram() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Runs a read-only ZFS channel program, a Lua script executed by `zfs program -n`, on every refresh, e.g. to gather properties of many datasets at once. Programs which attempt to change anything fail.",
+
+		ReadContext: dataSourceChannelProgramRead,
+
+		Schema: channelProgramFields(false),
+	}
+}
+
+func dataSourceChannelProgramRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	program := expandChannelProgram(d)
+	program.readOnly = true
+	result, err := runChannelProgram(config, program)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("result", result); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(program.pool)
+
+	return diags
+}
@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceCompressionEstimate() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Compares compression algorithms on the data of a dataset and its descendants, to help pick a default for a pool or module. " +
+			"Nothing is compressed or written: algorithms which datasets already use are measured from their `refcompressratio`, " +
+			"and the others are extrapolated from those with rules of thumb, so estimates are only a rough guide. Data written before the compression was changed counts towards the algorithm in use now.",
+
+		ReadContext: dataSourceCompressionEstimateRead,
+
+		Schema: map[string]*schema.Schema{
+			"dataset": {
+				Description: "Name of the filesystem or volume.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"candidates": {
+				Description: "Values of the `compression` property to compare, cheapest first. Defaults to `lz4`, `zstd` and `zstd-9`.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+					ValidateDiagFunc: validation.ToDiagFunc(func(value interface{}, key string) ([]string, []error) {
+						if err := validateProperty("compression", value.(string), false); err != nil {
+							return nil, []error{err}
+						}
+						return nil, nil
+					}),
+				},
+			},
+			"tolerance": {
+				Description:      "How much lower the compressratio of a cheaper candidate may be than the best one for it to be recommended instead. Defaults to `0.05`.",
+				Type:             schema.TypeFloat,
+				Optional:         true,
+				Default:          0.05,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.FloatAtLeast(0)),
+			},
+			"compression": {
+				Description: "Current value of the `compression` property of the dataset.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"compressratio": {
+				Description: "Current compressratio of the dataset and its descendants.",
+				Type:        schema.TypeFloat,
+				Computed:    true,
+			},
+			"logicalused": {
+				Description: "Space the dataset and its descendants would use uncompressed, in bytes.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"used": {
+				Description: "Space the dataset and its descendants use, in bytes.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"estimate": {
+				Description: "The estimate of each candidate, in the order of `candidates`.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"compression": {
+							Description: "The candidate.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"compressratio": {
+							Description: "Expected compressratio of the data referenced by the dataset and its descendants. Unless `measured` is set, this is a heuristic, not a measurement: " +
+								"the ratios measured for the algorithms in use are scaled by fixed factors relative to `lz4`, e.g. `zstd` is assumed to save 20% more space than `lz4`, `gzip` 10% more and `lzjb` 15% less, " +
+								"whatever the data is. It can be far off. 0 if nothing is compressed yet to extrapolate from.",
+							Type:     schema.TypeFloat,
+							Computed: true,
+						},
+						"saved": {
+							Description: "Expected space saved compared to storing the data uncompressed, in bytes.",
+							Type:        schema.TypeInt,
+							Computed:    true,
+						},
+						"measured": {
+							Description: "Whether the compressratio was measured on datasets using the candidate. Otherwise it is a heuristic estimate, see `compressratio`.",
+							Type:        schema.TypeBool,
+							Computed:    true,
+						},
+					},
+				},
+			},
+			"recommended_compression": {
+				Description: "The first candidate whose compressratio is within `tolerance` of the best one. Check `measured`, as the comparison may rest on heuristic estimates.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"recommendation": {
+				Description: "Why `recommended_compression` was picked.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceCompressionEstimateRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	datasetName := d.Get("dataset").(string)
+	samples, err := readCompressionSamples(config, datasetName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	if len(samples) == 0 || samples[0].name != datasetName {
+		return diag.Errorf("%s has no compression to read", datasetName)
+	}
+
+	candidates := defaultCompressionCandidates
+	if raw := d.Get("candidates").([]interface{}); len(raw) > 0 {
+		candidates = make([]string, 0, len(raw))
+		for _, candidate := range raw {
+			candidates = append(candidates, candidate.(string))
+		}
+	}
+
+	estimates := estimateCompression(samples, candidates)
+	recommended, reason := recommendCompression(estimates, d.Get("tolerance").(float64))
+
+	flattened := make([]map[string]interface{}, 0, len(estimates))
+	for _, estimate := range estimates {
+		flattened = append(flattened, map[string]interface{}{
+			"compression":   estimate.compression,
+			"compressratio": estimate.compressratio,
+			"saved":         int(estimate.saved),
+			"measured":      estimate.measured,
+		})
+	}
+
+	root := samples[0]
+	values := map[string]interface{}{
+		"compression":             root.compression,
+		"compressratio":           root.compressratio,
+		"logicalused":             int(root.logicalused),
+		"used":                    int(root.used),
+		"estimate":                flattened,
+		"recommended_compression": recommended,
+		"recommendation":          reason,
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	d.SetId(datasetName)
+
+	return diags
+}
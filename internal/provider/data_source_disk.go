@@ -0,0 +1,139 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceDisk() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Block devices on the host which could be used in a pool, so layouts can be built from their stable by-id paths with `for_each` instead of hard-coded `/dev/sdX` names.",
+
+		ReadContext: dataSourceDiskRead,
+
+		Schema: map[string]*schema.Schema{
+			"min_size": {
+				Description:      "Only list disks of at least this size, e.g. `1T`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateSize,
+			},
+			"exclude_in_pool": {
+				Description: "Leave out disks which carry a zfs label, i.e. are (or were) part of a pool. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"disks": {
+				Description: "The disks, sorted by kernel name.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Description: "Kernel name of the disk, e.g. `sda`.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"path": {
+							Description: "Device path of the disk, e.g. `/dev/sda`. This may change between reboots.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"by_id_path": {
+							Description: "Stable path of the disk under `/dev/disk/by-id`, preferring the model and serial number over the WWN, or under `/dev/diskid` on FreeBSD. Empty if there is none.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"by_id_paths": {
+							Description: "All paths of the disk under `/dev/disk/by-id`, or `/dev/diskid` on FreeBSD.",
+							Type:        schema.TypeList,
+							Computed:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+						"size": {
+							Description: "Size of the disk in bytes.",
+							Type:        schema.TypeInt,
+							Computed:    true,
+						},
+						"model": {
+							Description: "Model of the disk.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"serial": {
+							Description: "Serial number of the disk.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"wwn": {
+							Description: "World wide name of the disk.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"rotational": {
+							Description: "Whether the disk is a spinning disk rather than solid state.",
+							Type:        schema.TypeBool,
+							Computed:    true,
+						},
+						"in_pool": {
+							Description: "Whether the disk or one of its partitions carries a zfs label.",
+							Type:        schema.TypeBool,
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceDiskRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	minSize := int64(0)
+	if value, ok := d.GetOk("min_size"); ok {
+		size, err := parseSize(value.(string))
+		if err != nil {
+			return diagFromErr(err)
+		}
+		minSize = size
+	}
+
+	disks, err := listDisks(config)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	flattened := make([]map[string]interface{}, 0)
+	for _, disk := range disks {
+		if disk.size < minSize || (disk.inPool && d.Get("exclude_in_pool").(bool)) {
+			continue
+		}
+		flattened = append(flattened, map[string]interface{}{
+			"name":        disk.name,
+			"path":        disk.path,
+			"by_id_path":  preferredByIdPath(disk.byIdPaths),
+			"by_id_paths": disk.byIdPaths,
+			"size":        int(disk.size),
+			"model":       disk.model,
+			"serial":      disk.serial,
+			"wwn":         disk.wwn,
+			"rotational":  disk.rotational,
+			"in_pool":     disk.inPool,
+		})
+	}
+
+	if err := d.Set("disks", flattened); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId("disks")
+
+	return diags
+}
@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceExpiredDatasets() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Datasets whose `terraform:expires_at` user property, as set by the `expires_at` attribute, lies in the past.",
+
+		ReadContext: dataSourceExpiredDatasetsRead,
+
+		Schema: map[string]*schema.Schema{
+			"parent": {
+				Description: "Only consider this dataset and its descendents. Defaults to all datasets on the host.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"now": {
+				Description:      "Time to compare the expiry against, in RFC 3339 format. Defaults to the clock of the machine running terraform.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IsRFC3339Time),
+			},
+			"names": {
+				Description: "Names of the expired datasets, sorted by name.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"datasets": {
+				Description: "The expired datasets, sorted by name.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Description: "Name of the dataset.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"expires_at": {
+							Description: "Time at which the dataset expired.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceExpiredDatasetsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	now := time.Now()
+	if value := d.Get("now").(string); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return diagFromErr(err)
+		}
+		now = parsed
+	}
+
+	parent := d.Get("parent").(string)
+	datasets, err := listExpiringDatasets(config, parent)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	names := make([]string, 0)
+	flattened := make([]map[string]interface{}, 0)
+	for _, dataset := range expiredDatasets(datasets, now) {
+		names = append(names, dataset.name)
+		flattened = append(flattened, map[string]interface{}{
+			"name":       dataset.name,
+			"expires_at": dataset.expiresAt.Format(time.RFC3339),
+		})
+	}
+
+	if err := d.Set("names", names); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("datasets", flattened); err != nil {
+		return diagFromErr(err)
+	}
+
+	if parent == "" {
+		parent = "*"
+	}
+	d.SetId(parent)
+
+	return diags
+}
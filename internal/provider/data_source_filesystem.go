@@ -47,8 +47,10 @@ func dataSourceFilesystem() *schema.Resource {
 				Type:        schema.TypeInt,
 				Computed:    true,
 			},
-			"properties":     &propertiesSchema,
-			"raw_properties": &rawPropertiesSchema,
+			"properties":         &propertiesSchema,
+			"raw_properties":     &rawPropertiesSchema,
+			"properties_numeric": &numericPropertiesSchema,
+			"property_sources":   &propertySourcesSchema,
 		},
 	}
 }
@@ -71,13 +73,13 @@ func dataSourceFilesystemRead(ctx context.Context, d *schema.ResourceData, meta
 			{
 				if err.errmsg != "dataset does not exist" {
 					log.Printf("[DEBUG] zfs err: %s", err.Error())
-					return diag.FromErr(err)
+					return diagFromErr(err)
 				}
 			}
 		default:
 			{
 				log.Printf("[DEBUG] zfs err: %s", err.Error())
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 	}
@@ -87,32 +89,32 @@ func dataSourceFilesystemRead(ctx context.Context, d *schema.ResourceData, meta
 	if filesystem.mountpoint != "" && filesystem.mountpoint != "none" && filesystem.mountpoint != "legacy" {
 		owner, err := getFileOwnership(config, filesystem.mountpoint)
 		if err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		if err := d.Set("owner", owner.userName); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		if err = d.Set("group", owner.groupName); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		if err = d.Set("uid", owner.uid); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		if err = d.Set("gid", owner.gid); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		if err = d.Set("mountpoint", filesystem.mountpoint); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 	}
 
 	if err = updateCalculatedPropertiesInState(d, filesystem.properties); err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	return diags
@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+var lintSuppressSchema = schema.Schema{
+	Description: "Lint rules to suppress. One of `vdev_width`, `parity_ratio`, `mixed_vdevs`, `mixed_media`, `slog_power_loss` or `cache_size`.",
+	Type:        schema.TypeSet,
+	Optional:    true,
+	Elem: &schema.Schema{
+		Type:             schema.TypeString,
+		ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(lintRules, false)),
+	},
+}
+
+func dataSourceLayoutLint() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Checks a proposed pool layout against common best practices, such as vdev width, parity, mixing rotational and solid state devices, log devices without power-loss protection and oversized cache devices. Every finding is reported as a warning during plan.",
+
+		ReadContext: dataSourceLayoutLintRead,
+
+		Schema: map[string]*schema.Schema{
+			"vdevs": {
+				Description: "The proposed layout, formatted as it would be passed to `zpool create`, e.g. `mirror /dev/sda /dev/sdb log /dev/nvme0n1`.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"slog_power_loss_protection": {
+				Description: "Hint that the log devices have power-loss protection.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"suppress": &lintSuppressSchema,
+			"score": {
+				Description: "Score from 0 to 100, lowered by every warning that isn't suppressed.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"warnings": {
+				Description: "Warnings that weren't suppressed.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"rule": {
+							Description: "Identifier of the rule, which can be used to suppress it.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"message": {
+							Description: "Description of the problem.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceLayoutLintRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	vdevs := d.Get("vdevs").(string)
+	warnings, score, err := lintVdevSpec(
+		config,
+		vdevs,
+		d.Get("slog_power_loss_protection").(bool),
+		expandStringSet(d.Get("suppress").(*schema.Set)),
+	)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("score", score); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("warnings", flattenLintWarnings(warnings)); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(vdevs)
+
+	return append(diags, lintDiagnostics(warnings)...)
+}
+
+func flattenLintWarnings(warnings []LintWarning) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(warnings))
+	for _, warning := range warnings {
+		out = append(out, map[string]interface{}{
+			"rule":    warning.rule,
+			"message": warning.message,
+		})
+	}
+	return out
+}
+
+// formatLintWarnings formats warnings as `rule: message`, for attributes listing them.
+func formatLintWarnings(warnings []LintWarning) []string {
+	formatted := make([]string, 0, len(warnings))
+	for _, warning := range warnings {
+		formatted = append(formatted, warning.rule+": "+warning.message)
+	}
+	return formatted
+}
+
+func lintDiagnostics(warnings []LintWarning) diag.Diagnostics {
+	var diags diag.Diagnostics
+	for _, warning := range warnings {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Pool layout: " + warning.rule,
+			Detail:   warning.message,
+		})
+	}
+	return diags
+}
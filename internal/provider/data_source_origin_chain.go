@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceOriginChain() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "The clone ancestry of a dataset, and the clones and holds which depend on it and its snapshots. Useful to refuse destroying snapshots which still back live clones, " +
+			"the way `zfs destroy -nv` would.",
+
+		ReadContext: dataSourceOriginChainRead,
+
+		Schema: map[string]*schema.Schema{
+			"dataset": {
+				Description: "Name of the filesystem or volume.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"origin": {
+				Description: "The snapshot the dataset was cloned from. Empty if it isn't a clone.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"ancestry": {
+				Description: "The origin of the dataset, followed by the origin of the dataset that snapshot belongs to and so on, nearest first. Empty if the dataset isn't a clone.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"root": {
+				Description: "The dataset at the end of the ancestry, which isn't a clone itself. The dataset itself if it isn't a clone.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"snapshot": {
+				Description: "The snapshots of the dataset and its descendants, which are destroyed along with it.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Description: "Full name of the snapshot.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"clones": {
+							Description: "The datasets cloned from the snapshot.",
+							Type:        schema.TypeList,
+							Computed:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+						"holds": {
+							Description: "Tags of the holds on the snapshot.",
+							Type:        schema.TypeList,
+							Computed:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+			"dependent_clones": {
+				Description: "Clones outside of the dataset which depend on its snapshots, followed by the clones depending on those in turn.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Description: "Name of the clone.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"origin": {
+							Description: "The snapshot it was cloned from.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"depth": {
+							Description: "1 for clones of the snapshots of the dataset, 2 for clones of the snapshots of those, and so on.",
+							Type:        schema.TypeInt,
+							Computed:    true,
+						},
+					},
+				},
+			},
+			"destroyable": {
+				Description: "Whether the dataset can be destroyed with its snapshots without destroying other datasets or releasing holds, i.e. there are no dependent clones or holds.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceOriginChainRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	datasetName := d.Get("dataset").(string)
+	graph, err := readOriginGraph(config, datasetName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	ancestry, err := graph.ancestry(datasetName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	origin, root := "", datasetName
+	if len(ancestry) > 0 {
+		origin = ancestry[0]
+		root = strings.SplitN(ancestry[len(ancestry)-1], "@", 2)[0]
+	}
+
+	snapshots := graph.snapshots(datasetName)
+	held := make([]string, 0)
+	for _, snapshot := range snapshots {
+		if snapshot.userrefs > 0 {
+			held = append(held, snapshot.name)
+		}
+	}
+	holds, err := readHolds(config, held)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	tags := make(map[string][]string)
+	for _, hold := range holds {
+		tags[hold.snapshot] = append(tags[hold.snapshot], hold.tag)
+	}
+
+	flattenedSnapshots := make([]map[string]interface{}, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		snapshotTags := tags[snapshot.name]
+		if snapshotTags == nil {
+			snapshotTags = make([]string, 0)
+		}
+		flattenedSnapshots = append(flattenedSnapshots, map[string]interface{}{
+			"name":   snapshot.name,
+			"clones": snapshot.clones,
+			"holds":  snapshotTags,
+		})
+	}
+
+	dependents := graph.dependentClones(datasetName)
+	flattenedDependents := make([]map[string]interface{}, 0, len(dependents))
+	for _, dependent := range dependents {
+		flattenedDependents = append(flattenedDependents, map[string]interface{}{
+			"name":   dependent.name,
+			"origin": dependent.origin,
+			"depth":  dependent.depth,
+		})
+	}
+
+	values := map[string]interface{}{
+		"origin":           origin,
+		"ancestry":         ancestry,
+		"root":             root,
+		"snapshot":         flattenedSnapshots,
+		"dependent_clones": flattenedDependents,
+		"destroyable":      len(dependents) == 0 && len(holds) == 0,
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	d.SetId(datasetName)
+
+	return diags
+}
@@ -21,18 +21,25 @@ func dataSourcePool() *schema.Resource {
 				Type:        schema.TypeString,
 				Required:    true,
 			},
-			"size": {
-				Description: "Size of the pool.",
-				Type:        schema.TypeString,
-				Computed:    true,
-			},
+			"size": &poolSizeSchema,
 			"capacity": {
-				Description: "Capacity of the pool.",
+				Description: "Percentage of the pool which is allocated, formatted as e.g. `45%`.",
 				Type:        schema.TypeString,
 				Computed:    true,
 			},
-			"properties":     &propertiesSchema,
-			"raw_properties": &rawPropertiesSchema,
+			"allocated":          &poolAllocatedSchema,
+			"free":               &poolFreeSchema,
+			"capacity_percent":   &poolCapacityPercentSchema,
+			"fragmentation":      &poolFragmentationSchema,
+			"dedup_ratio":        &poolDedupRatioSchema,
+			"block_cloning":      &blockCloningSchema,
+			"bclone_used":        &bcloneUsedSchema,
+			"bclone_saved":       &bcloneSavedSchema,
+			"bclone_ratio":       &bcloneRatioSchema,
+			"properties":         &propertiesSchema,
+			"raw_properties":     &rawPropertiesSchema,
+			"properties_numeric": &numericPropertiesSchema,
+			"property_sources":   &propertySourcesSchema,
 		},
 	}
 }
@@ -46,13 +53,25 @@ func dataSourcePoolRead(ctx context.Context, d *schema.ResourceData, meta interf
 
 	poolName := d.Get("name").(string)
 
-	pool, err := describePool(config, poolName, getPropertyNames(d))
+	pool, err := describePool(config, poolName, getPropertyNames(d), false)
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	if err = updateCalculatedPropertiesInState(d, pool.properties); err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+
+	if err = d.Set("capacity", pool.properties["capacity"].value); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err = setPoolUsage(d, *pool.usage); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err = setBlockCloning(d, pool.properties); err != nil {
+		return diagFromErr(err)
 	}
 
 	d.SetId(pool.guid)
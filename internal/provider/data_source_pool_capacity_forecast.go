@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourcePoolCapacityForecast() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Projects when a pool fills up, from the growth of its allocated space. The growth is measured over `sample_seconds` while reading the data source, " +
+			"or since a `baseline` from an earlier run, which gives a steadier rate. The projection is linear and only as good as the period it was measured over.",
+
+		ReadContext: dataSourcePoolCapacityForecastRead,
+
+		Timeouts: &schema.ResourceTimeout{
+			Read: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"sample_seconds": {
+				Description:      "Seconds to measure the growth over when there is no `baseline`. `0` measures nothing, so only a pool past the threshold is forecast to be full. Defaults to `10`.",
+				Type:             schema.TypeInt,
+				Optional:         true,
+				Default:          10,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntBetween(0, 300)),
+			},
+			"threshold_percent": {
+				Description:      "Percentage of the size of the pool which counts as full, e.g. `80` since pools slow down when they are nearly full. Defaults to `100`.",
+				Type:             schema.TypeInt,
+				Optional:         true,
+				Default:          100,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntBetween(1, 100)),
+			},
+			"baseline": {
+				Description: "An earlier sample to measure the growth since, e.g. the `allocated` and `sampled_at` of a previous run kept in a `terraform_data` resource.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"allocated": {
+							Description: "Space allocated in the pool at the time, in bytes.",
+							Type:        schema.TypeInt,
+							Required:    true,
+						},
+						"sampled_at": {
+							Description:      "Time of the sample in RFC 3339 format.",
+							Type:             schema.TypeString,
+							Required:         true,
+							ValidateDiagFunc: validation.ToDiagFunc(validation.IsRFC3339Time),
+						},
+					},
+				},
+			},
+			"size":      &poolSizeSchema,
+			"allocated": &poolAllocatedSchema,
+			"sampled_at": {
+				Description: "Time `allocated` was read in RFC 3339 format.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"growth_bytes_per_day": {
+				Description: "Growth of the allocated space in bytes per day. Negative if the pool shrank.",
+				Type:        schema.TypeFloat,
+				Computed:    true,
+			},
+			"days_until_full": {
+				Description: "Days until the allocated space reaches `threshold_percent` of the size at the current growth. 0 if it already has, -1 if the pool isn't growing.",
+				Type:        schema.TypeFloat,
+				Computed:    true,
+			},
+			"full_at": {
+				Description: "Projected time the pool is full in RFC 3339 format. Empty if the pool isn't growing.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourcePoolCapacityForecastRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	usage, err := readPoolUsage(config, poolName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	from := CapacitySample{allocated: usage.allocated, at: time.Now()}
+	to := from
+
+	if baselines := d.Get("baseline").([]interface{}); len(baselines) > 0 && baselines[0] != nil {
+		baseline := baselines[0].(map[string]interface{})
+		at, err := time.Parse(time.RFC3339, baseline["sampled_at"].(string))
+		if err != nil {
+			return diagFromErr(err)
+		}
+		if at.After(to.at) {
+			return diagFromErr(fmt.Errorf("the baseline of %s was sampled in the future, at %s", poolName, baseline["sampled_at"]))
+		}
+		from = CapacitySample{allocated: int64(baseline["allocated"].(int)), at: at}
+	} else if seconds := d.Get("sample_seconds").(int); seconds > 0 {
+		select {
+		case <-ctx.Done():
+			return diagFromErr(ctx.Err())
+		case <-time.After(time.Duration(seconds) * time.Second):
+		}
+
+		if usage, err = readPoolUsage(config, poolName); err != nil {
+			return diagFromErr(err)
+		}
+		to = CapacitySample{allocated: usage.allocated, at: time.Now()}
+	}
+
+	forecast := forecastCapacity(usage.size, d.Get("threshold_percent").(int), from, to)
+
+	fullAt := ""
+	if !forecast.fullAt.IsZero() {
+		fullAt = forecast.fullAt.UTC().Format(time.RFC3339)
+	}
+
+	values := map[string]interface{}{
+		"size":                 int(usage.size),
+		"allocated":            int(usage.allocated),
+		"sampled_at":           to.at.UTC().Format(time.RFC3339),
+		"growth_bytes_per_day": forecast.growthPerDay,
+		"days_until_full":      forecast.daysUntilFull,
+		"full_at":              fullAt,
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	d.SetId(poolName)
+
+	return diags
+}
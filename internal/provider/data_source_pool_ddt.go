@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourcePoolDdt() *schema.Resource {
+	bucketFields := map[string]*schema.Schema{
+		"refcount": {
+			Description: "How many times the blocks in this bucket are referenced, rounded down to a power of two.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		},
+	}
+	for _, kind := range []string{"allocated", "referenced"} {
+		bucketFields[kind+"_blocks"] = &schema.Schema{
+			Description: "Number of " + kind + " blocks.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		}
+		bucketFields[kind+"_logical_size"] = &schema.Schema{
+			Description: "Logical size of the " + kind + " blocks in bytes, before compression.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		}
+		bucketFields[kind+"_physical_size"] = &schema.Schema{
+			Description: "Physical size of the " + kind + " blocks in bytes, after compression.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		}
+		bucketFields[kind+"_disk_size"] = &schema.Schema{
+			Description: "Size of the " + kind + " blocks on disk in bytes, including parity and copies.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		}
+	}
+
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Statistics of the dedup table of a pool, or a simulation of it for a pool without dedup, to judge whether the table fits in memory before enabling dedup.",
+
+		ReadContext: dataSourcePoolDdtRead,
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"simulate": {
+				Description: "Simulate the dedup table which the existing data would produce with `zdb -S`, instead of reading the actual table. This reads every block of the pool, so it can take a long time. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"entries": {
+				Description: "Number of entries in the dedup table, i.e. unique blocks.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"entry_size_on_disk": {
+				Description: "Average size of a dedup table entry on disk in bytes. Zero when simulated.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"entry_size_in_core": {
+				Description: "Average size of a dedup table entry in memory in bytes. When simulated, 320 bytes is assumed.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"table_size_on_disk": {
+				Description: "Total size of the dedup table on disk in bytes. Zero when simulated.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"table_size_in_core": {
+				Description: "Total size of the dedup table in memory in bytes, which should fit in the ARC for acceptable performance.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"dedup_ratio": {
+				Description: "Space referenced over space allocated by deduplicated blocks, e.g. `1.5`.",
+				Type:        schema.TypeFloat,
+				Computed:    true,
+			},
+			"histogram": {
+				Description: "The dedup table histogram, with one bucket per power of two of references.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: bucketFields,
+				},
+			},
+		},
+	}
+}
+
+func flattenDdtBucket(bucket DdtBucket) map[string]interface{} {
+	return map[string]interface{}{
+		"refcount":                 int(bucket.refcount),
+		"allocated_blocks":         int(bucket.allocatedBlocks),
+		"allocated_logical_size":   int(bucket.allocatedLsize),
+		"allocated_physical_size":  int(bucket.allocatedPsize),
+		"allocated_disk_size":      int(bucket.allocatedDsize),
+		"referenced_blocks":        int(bucket.referencedBlocks),
+		"referenced_logical_size":  int(bucket.referencedLsize),
+		"referenced_physical_size": int(bucket.referencedPsize),
+		"referenced_disk_size":     int(bucket.referencedDsize),
+	}
+}
+
+func dataSourcePoolDdtRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	stats, err := readDdtStats(config, poolName, d.Get("simulate").(bool))
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("entries", int(stats.entries)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("entry_size_on_disk", int(stats.entryDiskSize)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("entry_size_in_core", int(stats.entryCoreSize)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("table_size_on_disk", int(stats.entries*stats.entryDiskSize)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("table_size_in_core", int(stats.entries*stats.entryCoreSize)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("dedup_ratio", stats.dedupRatio()); err != nil {
+		return diagFromErr(err)
+	}
+
+	histogram := make([]map[string]interface{}, 0)
+	for _, bucket := range stats.histogram {
+		histogram = append(histogram, flattenDdtBucket(bucket))
+	}
+	if err := d.Set("histogram", histogram); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(poolName)
+
+	return diags
+}
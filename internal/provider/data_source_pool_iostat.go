@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+var iostatDescriptions = map[string]string{
+	"alloc":       "Allocated space in bytes. Zero for devices.",
+	"free":        "Free space in bytes. Zero for devices.",
+	"read_ops":    "Read operations per second.",
+	"write_ops":   "Write operations per second.",
+	"read_bytes":  "Bytes read per second.",
+	"write_bytes": "Bytes written per second.",
+}
+
+func dataSourcePoolIostat() *schema.Resource {
+	statisticFields := map[string]*schema.Schema{
+		"name": {
+			Description: "Name of the pool, vdev (e.g. `mirror-0`) or device path.",
+			Type:        schema.TypeString,
+			Computed:    true,
+		},
+	}
+	for _, column := range iostatColumns {
+		statisticFields[column] = &schema.Schema{
+			Description: iostatDescriptions[column],
+			Type:        schema.TypeInt,
+			Computed:    true,
+		}
+	}
+	for _, column := range iostatLatencyColumns {
+		statisticFields[column] = &schema.Schema{
+			Description: "Average `" + column[:len(column)-3] + "` latency of zpool iostat -l in nanoseconds. Zero if `latency` is disabled or the host doesn't report it.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		}
+	}
+
+	fields := map[string]*schema.Schema{
+		"pool": {
+			Description: "Name of the pool.",
+			Type:        schema.TypeString,
+			Required:    true,
+		},
+		"interval": {
+			Description:      "Seconds to sample the statistics over. `0` returns the averages since the pool was imported instead. Defaults to `1`.",
+			Type:             schema.TypeInt,
+			Optional:         true,
+			Default:          1,
+			ValidateDiagFunc: validation.ToDiagFunc(validation.IntBetween(0, 30)),
+		},
+		"vdevs": {
+			Description: "Also sample every vdev and device of the pool. Defaults to `false`.",
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+		},
+		"latency": {
+			Description: "Also sample the average latencies, which requires OpenZFS 0.7 or newer. Latency histograms are available from `zfs_pool_latency`. Defaults to `true`.",
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     true,
+		},
+		"vdev": {
+			Description: "The statistics of the pool itself, followed by those of each vdev and device if `vdevs` is set, in the order listed by zpool iostat.",
+			Type:        schema.TypeList,
+			Computed:    true,
+			Elem: &schema.Resource{
+				Schema: statisticFields,
+			},
+		},
+	}
+	for _, column := range iostatColumns {
+		fields[column] = &schema.Schema{
+			Description: iostatDescriptions[column] + " Of the pool as a whole.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		}
+	}
+
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "A sample of the operations, bandwidth and latencies of a pool and its vdevs, as reported by `zpool iostat`, e.g. to record the baseline performance of a freshly provisioned pool. The sample is taken anew on every refresh.",
+
+		ReadContext: dataSourcePoolIostatRead,
+
+		Schema: fields,
+	}
+}
+
+func flattenVdevIostat(vdev VdevIostat) map[string]interface{} {
+	flattened := map[string]interface{}{
+		"name": vdev.name,
+	}
+	for _, column := range append(append([]string{}, iostatColumns...), iostatLatencyColumns...) {
+		flattened[column] = int(vdev.values[column])
+	}
+	return flattened
+}
+
+func dataSourcePoolIostatRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	report, err := readIostat(config, poolName, d.Get("interval").(int), d.Get("vdevs").(bool), d.Get("latency").(bool))
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	vdevs := make([]map[string]interface{}, 0, len(report))
+	for _, vdev := range report {
+		vdevs = append(vdevs, flattenVdevIostat(vdev))
+	}
+
+	if err := d.Set("vdev", vdevs); err != nil {
+		return diagFromErr(err)
+	}
+
+	for _, column := range iostatColumns {
+		if err := d.Set(column, int(report[0].values[column])); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	d.SetId(poolName)
+
+	return diags
+}
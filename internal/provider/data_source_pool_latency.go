@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourcePoolLatency() *schema.Resource {
+	bucketFields := map[string]*schema.Schema{
+		"latency_ns": {
+			Description: "Upper bound of the bucket in nanoseconds. Buckets are powers of two, so an I/O is counted in the first bucket it fits in.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		},
+	}
+	for _, column := range latencyColumns {
+		bucketFields[column] = &schema.Schema{
+			Description: "Number of I/Os in the `" + column + "` histogram of zpool iostat. Zero if the host doesn't report it.",
+			Type:        schema.TypeInt,
+			Computed:    true,
+		}
+	}
+
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Slow I/O counters and latency histograms of a pool and its vdevs, as reported by `zpool status -s` and `zpool iostat -w`, to spot failing disks before they are faulted.",
+
+		ReadContext: dataSourcePoolLatencyRead,
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"vdev": {
+				Description: "The pool itself and each of its vdevs and devices, in the order listed by zpool iostat.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Description: "Name of the pool, vdev (e.g. `mirror-0`) or device path.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"slow_ios": {
+							Description: "Number of I/Os which didn't complete within `zio_slow_io_ms`, 30 seconds by default.",
+							Type:        schema.TypeInt,
+							Computed:    true,
+						},
+						"histogram": {
+							Description: "The latency histogram since the pool was imported, with one bucket per power of two nanoseconds.",
+							Type:        schema.TypeList,
+							Computed:    true,
+							Elem: &schema.Resource{
+								Schema: bucketFields,
+							},
+						},
+					},
+				},
+			},
+			"slow_devices": {
+				Description: "Names of the devices with slow I/Os, without the pool and its vdevs.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	}
+}
+
+func flattenLatencyBucket(bucket LatencyBucket) map[string]interface{} {
+	flattened := map[string]interface{}{
+		"latency_ns": int(bucket.latency),
+	}
+	for _, column := range latencyColumns {
+		flattened[column] = int(bucket.counts[column])
+	}
+	return flattened
+}
+
+func dataSourcePoolLatencyRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	status, err := describePoolStatus(config, poolName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	histograms, err := readLatencyHistograms(config, poolName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	slowIos := make(map[string]int64, len(status.vdevs))
+	slowDevices := make([]string, 0)
+	for _, vdev := range status.vdevs {
+		slowIos[vdev.name] = vdev.slowIos
+		// Device paths are absolute with -P, which tells them apart from the pool and vdevs such as mirror-0.
+		if vdev.slowIos > 0 && strings.HasPrefix(vdev.name, "/") {
+			slowDevices = append(slowDevices, vdev.name)
+		}
+	}
+
+	vdevs := make([]map[string]interface{}, 0, len(histograms))
+	for _, histogram := range histograms {
+		buckets := make([]map[string]interface{}, 0, len(histogram.buckets))
+		for _, bucket := range histogram.buckets {
+			buckets = append(buckets, flattenLatencyBucket(bucket))
+		}
+		vdevs = append(vdevs, map[string]interface{}{
+			"name":      histogram.name,
+			"slow_ios":  int(slowIos[histogram.name]),
+			"histogram": buckets,
+		})
+	}
+
+	if err := d.Set("vdev", vdevs); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("slow_devices", slowDevices); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(poolName)
+
+	return diags
+}
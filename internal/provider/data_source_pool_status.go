@@ -0,0 +1,258 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// poolStatusFields returns the computed attributes describing the output of zpool status. They are
+// used both at the top level of the zfs_pool_status data source and in the status block of zfs_pool.
+func poolStatusFields() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"state": {
+			Description: "Overall state of the pool, e.g. `ONLINE`, `DEGRADED` or `FAULTED`.",
+			Type:        schema.TypeString,
+			Computed:    true,
+		},
+		"status": {
+			Description: "Explanation of the pool state, including errata notices. Empty for healthy pools.",
+			Type:        schema.TypeString,
+			Computed:    true,
+		},
+		"action": {
+			Description: "Recommended action to resolve the reported status. Empty for healthy pools.",
+			Type:        schema.TypeString,
+			Computed:    true,
+		},
+		"errors": {
+			Description: "Summary of known data errors.",
+			Type:        schema.TypeString,
+			Computed:    true,
+		},
+		"scan": {
+			Description: "The last scrub or resilver.",
+			Type:        schema.TypeList,
+			Computed:    true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"function": {
+						Description: "Either `scrub` or `resilver`. Empty if the pool was never scanned.",
+						Type:        schema.TypeString,
+						Computed:    true,
+					},
+					"state": {
+						Description: "One of `in_progress`, `finished`, `canceled` or `none`.",
+						Type:        schema.TypeString,
+						Computed:    true,
+					},
+					"progress": {
+						Description: "Percentage of the scan which has completed.",
+						Type:        schema.TypeFloat,
+						Computed:    true,
+					},
+					"repaired_bytes": {
+						Description: "Number of bytes repaired or resilvered.",
+						Type:        schema.TypeInt,
+						Computed:    true,
+					},
+					"errors": {
+						Description: "Number of errors found by a finished scan.",
+						Type:        schema.TypeInt,
+						Computed:    true,
+					},
+					"duration_seconds": {
+						Description: "How long a finished scan took.",
+						Type:        schema.TypeInt,
+						Computed:    true,
+					},
+				},
+			},
+		},
+		"vdev": {
+			Description: "State and error counters of the pool itself and each of its vdevs and devices, in the order listed by zpool status.",
+			Type:        schema.TypeList,
+			Computed:    true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"name": {
+						Description: "Name of the pool, vdev (e.g. `mirror-0`) or device path.",
+						Type:        schema.TypeString,
+						Computed:    true,
+					},
+					"state": {
+						Description: "State of the vdev, e.g. `ONLINE`, `DEGRADED`, `FAULTED`, `OFFLINE` or `AVAIL` for spares.",
+						Type:        schema.TypeString,
+						Computed:    true,
+					},
+					"read_errors": {
+						Description: "Number of read errors.",
+						Type:        schema.TypeInt,
+						Computed:    true,
+					},
+					"write_errors": {
+						Description: "Number of write errors.",
+						Type:        schema.TypeInt,
+						Computed:    true,
+					},
+					"checksum_errors": {
+						Description: "Number of checksum errors.",
+						Type:        schema.TypeInt,
+						Computed:    true,
+					},
+					"slow_ios": {
+						Description: "Number of I/Os which didn't complete within `zio_slow_io_ms`, 30 seconds by default. A growing count on an `ONLINE` device is an early sign of a failing disk.",
+						Type:        schema.TypeInt,
+						Computed:    true,
+					},
+					"message": {
+						Description: "Additional information, e.g. `(resilvering)` or `too many errors`.",
+						Type:        schema.TypeString,
+						Computed:    true,
+					},
+				},
+			},
+		},
+	}
+}
+
+// poolHealthFields returns computed booleans summarizing the pool status, for use in lifecycle conditions.
+func poolHealthFields() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"is_healthy": {
+			Description: "Whether the pool is `ONLINE` without any read, write or checksum errors on its vdevs and without known data errors.",
+			Type:        schema.TypeBool,
+			Computed:    true,
+		},
+		"is_degraded": {
+			Description: "Whether the pool is `DEGRADED`, i.e. still usable but with reduced redundancy.",
+			Type:        schema.TypeBool,
+			Computed:    true,
+		},
+		"has_checksum_errors": {
+			Description: "Whether any vdev of the pool has checksum errors.",
+			Type:        schema.TypeBool,
+			Computed:    true,
+		},
+		"has_data_errors": {
+			Description: "Whether zpool status reports known data errors.",
+			Type:        schema.TypeBool,
+			Computed:    true,
+		},
+		"has_slow_ios": {
+			Description: "Whether any vdev of the pool has slow I/Os.",
+			Type:        schema.TypeBool,
+			Computed:    true,
+		},
+	}
+}
+
+// noDataErrors is the errors section of zpool status for pools without data errors.
+const noDataErrors = "No known data errors"
+
+func flattenPoolHealth(status PoolStatus) map[string]interface{} {
+	vdevErrors, checksumErrors, slowIos := false, false, false
+	for _, vdev := range status.vdevs {
+		if vdev.slowIos > 0 {
+			slowIos = true
+		}
+		if vdev.readErrors > 0 || vdev.writeErrors > 0 || vdev.checksumErrors > 0 {
+			vdevErrors = true
+		}
+		if vdev.checksumErrors > 0 {
+			checksumErrors = true
+		}
+	}
+	dataErrors := status.errors != "" && status.errors != noDataErrors
+
+	return map[string]interface{}{
+		"is_healthy":          status.state == "ONLINE" && !vdevErrors && !dataErrors,
+		"is_degraded":         status.state == "DEGRADED",
+		"has_checksum_errors": checksumErrors,
+		"has_data_errors":     dataErrors,
+		"has_slow_ios":        slowIos,
+	}
+}
+
+func flattenPoolStatus(status PoolStatus) map[string]interface{} {
+	vdevs := make([]map[string]interface{}, 0, len(status.vdevs))
+	for _, vdev := range status.vdevs {
+		vdevs = append(vdevs, map[string]interface{}{
+			"name":            vdev.name,
+			"state":           vdev.state,
+			"read_errors":     int(vdev.readErrors),
+			"write_errors":    int(vdev.writeErrors),
+			"checksum_errors": int(vdev.checksumErrors),
+			"slow_ios":        int(vdev.slowIos),
+			"message":         vdev.message,
+		})
+	}
+
+	return map[string]interface{}{
+		"state":  status.state,
+		"status": status.status,
+		"action": status.action,
+		"errors": status.errors,
+		"scan": []map[string]interface{}{
+			{
+				"function":         status.scan.function,
+				"state":            string(status.scan.state),
+				"progress":         status.scan.progress,
+				"repaired_bytes":   int(status.scan.repaired),
+				"errors":           int(status.scan.errors),
+				"duration_seconds": int(status.scan.duration),
+			},
+		},
+		"vdev": vdevs,
+	}
+}
+
+func dataSourcePoolStatus() *schema.Resource {
+	fields := poolStatusFields()
+	fields["name"] = &schema.Schema{
+		Description: "Name of the zpool.",
+		Type:        schema.TypeString,
+		Required:    true,
+	}
+	for key, field := range poolHealthFields() {
+		fields[key] = field
+	}
+
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Health of a pool and its vdevs, as reported by zpool status.",
+
+		ReadContext: dataSourcePoolStatusRead,
+
+		Schema: fields,
+	}
+}
+
+func dataSourcePoolStatusRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName := d.Get("name").(string)
+	status, err := describePoolStatus(config, poolName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	for key, value := range flattenPoolStatus(*status) {
+		if err := d.Set(key, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	for key, value := range flattenPoolHealth(*status) {
+		if err := d.Set(key, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	d.SetId(poolName)
+
+	return diags
+}
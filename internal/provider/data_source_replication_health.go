@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceReplicationHealth() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Replication freshness between a source and a target dataset on the same host. Snapshots are matched by guid, so the target may use different snapshot names.",
+
+		ReadContext: dataSourceReplicationHealthRead,
+
+		Schema: map[string]*schema.Schema{
+			"source": {
+				Description: "Name of the dataset being replicated from.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"target": {
+				Description: "Name of the dataset being replicated to.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"latest_source_snapshot": {
+				Description: "Name of the newest snapshot on the source dataset. Empty if the source has no snapshots.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"common_snapshot": {
+				Description: "Name (on the source) of the newest snapshot present on both datasets. Empty if there is none.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"common_snapshot_creation": {
+				Description: "Creation time of the newest common snapshot, in seconds since the epoch. 0 if there is none.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"lag_seconds": {
+				Description: "Age of the newest common snapshot in seconds, measured against the clock of the machine running terraform. -1 if there is no common snapshot.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"in_sync": {
+				Description: "Whether the newest source snapshot exists on the target.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"estimated_catchup_bytes": {
+				Description: "Estimated size of the stream needed to bring the target up to the newest source snapshot. If there is no common snapshot this is the size of a full stream.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceReplicationHealthRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	source := d.Get("source").(string)
+	target := d.Get("target").(string)
+
+	sourceSnapshots, err := listSnapshots(config, source)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	targetSnapshots, err := listSnapshots(config, target)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	latest := ""
+	if len(sourceSnapshots) > 0 {
+		latest = sourceSnapshots[len(sourceSnapshots)-1].name
+	}
+
+	common := newestCommonSnapshot(sourceSnapshots, targetSnapshots)
+
+	commonName := ""
+	commonCreation := int64(0)
+	lag := int64(-1)
+	if common != nil {
+		commonName = common.name
+		commonCreation = common.creation
+		lag = time.Now().Unix() - common.creation
+	}
+
+	inSync := latest != "" && latest == commonName
+
+	estimate := int64(0)
+	if latest != "" && !inSync {
+		if estimate, err = estimateSendSize(config, commonName, latest); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	if err := d.Set("latest_source_snapshot", latest); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("common_snapshot", commonName); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("common_snapshot_creation", int(commonCreation)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("lag_seconds", int(lag)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("in_sync", inSync); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("estimated_catchup_bytes", int(estimate)); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(source + ":" + target)
+
+	return diags
+}
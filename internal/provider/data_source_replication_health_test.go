@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"testing"
+)
+
+// TestNewestCommonSnapshot_MatchesByGuid verifies that snapshots are matched by
+// guid rather than by name, and that the newest match wins.
+func TestNewestCommonSnapshot_MatchesByGuid(t *testing.T) {
+	source, err := parseSnapshotList("tank/data@a\t111\t1700000000\ntank/data@b\t222\t1700000100\ntank/data@c\t333\t1700000200")
+	if err != nil {
+		t.Fatalf("parseSnapshotList returned error: %v", err)
+	}
+
+	target, err := parseSnapshotList("backup/data@renamed-a\t111\t1700000000\nbackup/data@renamed-b\t222\t1700000100")
+	if err != nil {
+		t.Fatalf("parseSnapshotList returned error: %v", err)
+	}
+
+	common := newestCommonSnapshot(source, target)
+	if common == nil {
+		t.Fatalf("expected a common snapshot")
+	}
+
+	if common.name != "tank/data@b" || common.creation != 1700000100 {
+		t.Fatalf("unexpected common snapshot: %#v", common)
+	}
+}
+
+// TestNewestCommonSnapshot_None verifies that unrelated datasets have no common snapshot.
+func TestNewestCommonSnapshot_None(t *testing.T) {
+	source := []Snapshot{{name: "tank/data@a", guid: "111"}}
+	target := []Snapshot{{name: "backup/data@a", guid: "999"}}
+
+	if common := newestCommonSnapshot(source, target); common != nil {
+		t.Fatalf("expected no common snapshot, got %#v", common)
+	}
+}
+
+// TestParseSendSize verifies that the size estimate is extracted from a dry-run zfs send.
+func TestParseSendSize(t *testing.T) {
+	size, err := parseSendSize("incremental\ttank/data@b\ttank/data@c\t4096\nsize\t4096")
+	if err != nil {
+		t.Fatalf("parseSendSize returned error: %v", err)
+	}
+	if size != 4096 {
+		t.Fatalf("expected 4096, got %d", size)
+	}
+
+	if _, err := parseSendSize("full\ttank/data@c"); err == nil {
+		t.Fatalf("expected an error when no size is present")
+	}
+}
@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceSnapshotDiff() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "The files changed between a snapshot and a later snapshot of the same dataset, or the live dataset, as listed by `zfs diff`. Useful to skip replication or image builds when nothing changed. Requires the `diff` permission on the dataset.",
+
+		ReadContext: dataSourceSnapshotDiffRead,
+
+		Schema: map[string]*schema.Schema{
+			"from": {
+				Description: "Full name of the earlier snapshot, e.g. `tank/data@monday`.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"to": {
+				Description: "Full name of the later snapshot, e.g. `tank/data@tuesday`, or the name of the dataset itself. Defaults to the live dataset.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"added": {
+				Description: "Paths of the files and directories which were added.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"modified": {
+				Description: "Paths of the files and directories which were modified. A directory is modified when entries are added to or removed from it.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"removed": {
+				Description: "Paths of the files and directories which were removed.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"renamed": {
+				Description: "Files and directories which were renamed.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"from": {
+							Description: "Path before the rename.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"to": {
+							Description: "Path after the rename.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+					},
+				},
+			},
+			"change_count": {
+				Description: "Total number of changes.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"changed": {
+				Description: "Whether anything changed.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceSnapshotDiffRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	from := d.Get("from").(string)
+	if !strings.Contains(from, "@") {
+		return diagFromErr(fmt.Errorf("from must be the full name of a snapshot, got %q", from))
+	}
+	to := d.Get("to").(string)
+
+	diff, err := readSnapshotDiff(config, from, to)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("added", diff.added); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("modified", diff.modified); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("removed", diff.removed); err != nil {
+		return diagFromErr(err)
+	}
+
+	renamed := make([]map[string]interface{}, 0, len(diff.renamed))
+	for _, rename := range diff.renamed {
+		renamed = append(renamed, map[string]interface{}{"from": rename.from, "to": rename.to})
+	}
+	if err := d.Set("renamed", renamed); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("change_count", diff.count()); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("changed", diff.count() > 0); err != nil {
+		return diagFromErr(err)
+	}
+
+	if to == "" {
+		to = strings.SplitN(from, "@", 2)[0]
+	}
+	d.SetId(fmt.Sprintf("%s..%s", from, to))
+
+	return diags
+}
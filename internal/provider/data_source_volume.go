@@ -27,8 +27,10 @@ func dataSourceVolume() *schema.Resource {
 				Type:        schema.TypeString,
 				Computed:    true,
 			},
-			"properties":     &propertiesSchema,
-			"raw_properties": &rawPropertiesSchema,
+			"properties":         &propertiesSchema,
+			"raw_properties":     &rawPropertiesSchema,
+			"properties_numeric": &numericPropertiesSchema,
+			"property_sources":   &propertySourcesSchema,
 		},
 	}
 }
@@ -51,13 +53,13 @@ func dataSourceVolumeRead(ctx context.Context, d *schema.ResourceData, meta inte
 			{
 				if err.errmsg != "dataset does not exist" {
 					log.Printf("[DEBUG] zfs err: %s", err.Error())
-					return diag.FromErr(err)
+					return diagFromErr(err)
 				}
 			}
 		default:
 			{
 				log.Printf("[DEBUG] zfs err: %s", err.Error())
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 	}
@@ -65,7 +67,7 @@ func dataSourceVolumeRead(ctx context.Context, d *schema.ResourceData, meta inte
 	d.SetId(volume.guid)
 
 	if err = updateCalculatedPropertiesInState(d, volume.properties); err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	return diags
@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// simulatedEntryCoreSize is the in-core size assumed for each entry of a simulated dedup table, as zdb -S
+// doesn't report one. It is roughly what a legacy dedup table entry takes in memory.
+const simulatedEntryCoreSize = 320
+
+// DdtBucket is a row of the dedup table histogram, counting the blocks referenced refcount times.
+type DdtBucket struct {
+	refcount         int64
+	allocatedBlocks  int64
+	allocatedLsize   int64
+	allocatedPsize   int64
+	allocatedDsize   int64
+	referencedBlocks int64
+	referencedLsize  int64
+	referencedPsize  int64
+	referencedDsize  int64
+}
+
+// DdtStats are the dedup table statistics printed by zpool status -D, or simulated by zdb -S.
+type DdtStats struct {
+	entries         int64
+	entryDiskSize   int64
+	entryCoreSize   int64
+	histogram       []DdtBucket
+	total           DdtBucket
+	hasEntryDetails bool
+}
+
+var ddtEntriesPattern = regexp.MustCompile(`DDT entries (\d+), size (\S+) on disk, (\S+) in core`)
+
+// parseDdtBucket parses a histogram row such as "     2      512     64M     64M     64M    1.02K    128M    128M    128M".
+// The refcount of the Total row is left at zero.
+func parseDdtBucket(fields []string) (DdtBucket, error) {
+	values := make([]int64, len(fields))
+	for i, field := range fields {
+		if i == 0 && field == "Total" {
+			continue
+		}
+		value, err := parseSize(field)
+		if err != nil {
+			return DdtBucket{}, fmt.Errorf("invalid dedup table histogram value %q", field)
+		}
+		values[i] = value
+	}
+	return DdtBucket{
+		refcount:         values[0],
+		allocatedBlocks:  values[1],
+		allocatedLsize:   values[2],
+		allocatedPsize:   values[3],
+		allocatedDsize:   values[4],
+		referencedBlocks: values[5],
+		referencedLsize:  values[6],
+		referencedPsize:  values[7],
+		referencedDsize:  values[8],
+	}, nil
+}
+
+// parseDdtStats parses the dedup section of zpool status -D, e.g.
+//
+//	dedup: DDT entries 1536, size 312 on disk, 180 in core
+//
+//	bucket              allocated                       referenced
+//	______   ______________________________   ______________________________
+//	refcnt   blocks   LSIZE   PSIZE   DSIZE   blocks   LSIZE   PSIZE   DSIZE
+//	------   ------   -----   -----   -----   ------   -----   -----   -----
+//	     1    1.00K    128M    128M    128M    1.00K    128M    128M    128M
+//	     2      512     64M     64M     64M    1.00K    128M    128M    128M
+//	 Total    1.50K    192M    192M    192M    2.00K    256M    256M    256M
+//
+// The sizes on the DDT entries line are per entry. The histogram printed by zdb -S has the same layout, but no
+// entries line, in which case the number of entries is the number of unique blocks.
+func parseDdtStats(output string) (*DdtStats, error) {
+	stats := &DdtStats{histogram: make([]DdtBucket, 0)}
+
+	if match := ddtEntriesPattern.FindStringSubmatch(output); match != nil {
+		var err error
+		if stats.entries, err = parseSize(match[1]); err != nil {
+			return nil, err
+		}
+		if stats.entryDiskSize, err = parseSize(match[2]); err != nil {
+			return nil, err
+		}
+		if stats.entryCoreSize, err = parseSize(match[3]); err != nil {
+			return nil, err
+		}
+		stats.hasEntryDetails = true
+	}
+
+	foundTotal := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 9 || fields[0] == "refcnt" || strings.HasPrefix(fields[0], "-") || strings.HasPrefix(fields[0], "_") {
+			continue
+		}
+		bucket, err := parseDdtBucket(fields)
+		if err != nil {
+			return nil, err
+		}
+		if fields[0] == "Total" {
+			stats.total = bucket
+			foundTotal = true
+		} else {
+			stats.histogram = append(stats.histogram, bucket)
+		}
+	}
+
+	if !stats.hasEntryDetails && foundTotal {
+		stats.entries = stats.total.allocatedBlocks
+		stats.entryCoreSize = simulatedEntryCoreSize
+	}
+
+	return stats, nil
+}
+
+// dedupRatio is the space referenced by the pool over the space it actually allocates, which is 1 without dedup.
+func (stats DdtStats) dedupRatio() float64 {
+	if stats.total.allocatedDsize == 0 {
+		return 1
+	}
+	return float64(stats.total.referencedDsize) / float64(stats.total.allocatedDsize)
+}
+
+func readDdtStats(config *Config, poolName string, simulate bool) (*DdtStats, error) {
+	command := "zpool status -pD %s"
+	if simulate {
+		// This walks every block in the pool, so it can take a long time on large pools.
+		command = "zdb -S %s"
+	}
+	stdout, err := callSshCommand(config, command, poolName)
+	if err != nil {
+		return nil, err
+	}
+	return parseDdtStats(stdout)
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"testing"
+)
+
+const testStatusDedup = `  pool: tank
+ state: ONLINE
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  sda       ONLINE       0     0     0
+
+errors: No known data errors
+
+ dedup: DDT entries 1536, size 312 on disk, 180 in core
+
+bucket              allocated                       referenced          
+______   ______________________________   ______________________________
+refcnt   blocks   LSIZE   PSIZE   DSIZE   blocks   LSIZE   PSIZE   DSIZE
+------   ------   -----   -----   -----   ------   -----   -----   -----
+     1    1.00K    128M    128M    128M    1.00K    128M    128M    128M
+     2      512     64M     64M     64M    1.00K    128M    128M    128M
+ Total    1.50K    192M    192M    192M    2.00K    256M    256M    256M
+`
+
+const testSimulatedDedup = `Simulated DDT histogram:
+
+bucket              allocated                       referenced          
+______   ______________________________   ______________________________
+refcnt   blocks   LSIZE   PSIZE   DSIZE   blocks   LSIZE   PSIZE   DSIZE
+------   ------   -----   -----   -----   ------   -----   -----   -----
+     1    2.00K    256M    256M    256M    2.00K    256M    256M    256M
+     4    1.00K    128M    128M    128M    4.00K    512M    512M    512M
+ Total    3.00K    384M    384M    384M    6.00K    768M    768M    768M
+
+dedup = 2.00, compress = 1.00, copies = 1.00, dedup * compress / copies = 2.00
+`
+
+// TestParseDdtStats verifies the entries line and histogram of zpool status -D are parsed.
+func TestParseDdtStats(t *testing.T) {
+	stats, err := parseDdtStats(testStatusDedup)
+	if err != nil {
+		t.Fatalf("parseDdtStats returned error: %v", err)
+	}
+
+	if stats.entries != 1536 || stats.entryDiskSize != 312 || stats.entryCoreSize != 180 {
+		t.Fatalf("unexpected entries: %#v", *stats)
+	}
+
+	if len(stats.histogram) != 2 {
+		t.Fatalf("expected 2 buckets, got %#v", stats.histogram)
+	}
+
+	expected := DdtBucket{
+		refcount:         2,
+		allocatedBlocks:  512,
+		allocatedLsize:   64 << 20,
+		allocatedPsize:   64 << 20,
+		allocatedDsize:   64 << 20,
+		referencedBlocks: 1024,
+		referencedLsize:  128 << 20,
+		referencedPsize:  128 << 20,
+		referencedDsize:  128 << 20,
+	}
+	if stats.histogram[1] != expected {
+		t.Fatalf("expected %#v, got %#v", expected, stats.histogram[1])
+	}
+
+	if ratio := stats.dedupRatio(); ratio < 1.33 || ratio > 1.34 {
+		t.Fatalf("unexpected dedup ratio %f", ratio)
+	}
+}
+
+// TestParseDdtStats_Simulated verifies that the entries of a simulated table are its unique blocks.
+func TestParseDdtStats_Simulated(t *testing.T) {
+	stats, err := parseDdtStats(testSimulatedDedup)
+	if err != nil {
+		t.Fatalf("parseDdtStats returned error: %v", err)
+	}
+
+	if stats.entries != 3072 || stats.entryCoreSize != simulatedEntryCoreSize || stats.entryDiskSize != 0 {
+		t.Fatalf("unexpected entries: %#v", *stats)
+	}
+
+	if stats.dedupRatio() != 2 {
+		t.Fatalf("unexpected dedup ratio %f", stats.dedupRatio())
+	}
+}
+
+// TestParseDdtStats_Empty verifies that pools without dedup report an empty table.
+func TestParseDdtStats_Empty(t *testing.T) {
+	stats, err := parseDdtStats(testStatusScrubFinished + "\n\n dedup: no DDT entries\n")
+	if err != nil {
+		t.Fatalf("parseDdtStats returned error: %v", err)
+	}
+
+	if stats.entries != 0 || len(stats.histogram) != 0 || stats.dedupRatio() != 1 {
+		t.Fatalf("unexpected stats: %#v", *stats)
+	}
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// emptyDatasetThreshold is the amount of logical data a dataset may reference and still be considered
+// empty, which covers the metadata of a freshly created filesystem.
+const emptyDatasetThreshold = 1024 * 1024
+
+var forceDestroySchema = schema.Schema{
+	Description: "Destroy the resource even if it contains child datasets, snapshots or more than 1M of data. Defaults to `false`, which makes destroying a non-empty resource fail instead.",
+	Type:        schema.TypeBool,
+	Optional:    true,
+	Default:     false,
+}
+
+// DatasetContents summarizes what would be lost by destroying a dataset recursively.
+type DatasetContents struct {
+	children  int
+	snapshots int
+	data      int64
+}
+
+func (c DatasetContents) empty() bool {
+	return c.children == 0 && c.snapshots == 0 && c.data <= emptyDatasetThreshold
+}
+
+func (c DatasetContents) String() string {
+	contents := make([]string, 0)
+	if c.children > 0 {
+		contents = append(contents, fmt.Sprintf("%d child datasets", c.children))
+	}
+	if c.snapshots > 0 {
+		contents = append(contents, fmt.Sprintf("%d snapshots", c.snapshots))
+	}
+	if c.data > emptyDatasetThreshold {
+		contents = append(contents, fmt.Sprintf("%d bytes of data", c.data))
+	}
+	return strings.Join(contents, ", ")
+}
+
+// parseDatasetContents parses `zfs list -H -p -r -t all -o name,type,logicalreferenced` of a dataset.
+func parseDatasetContents(datasetName string, output string) (*DatasetContents, error) {
+	contents := DatasetContents{}
+
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.Comma = '\t'
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case line[0] == datasetName:
+			if contents.data, err = strconv.ParseInt(line[2], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid logicalreferenced %s of %s: %s", line[2], datasetName, err)
+			}
+		case line[1] == "snapshot":
+			contents.snapshots++
+		case line[1] == "filesystem" || line[1] == "volume":
+			contents.children++
+		}
+	}
+
+	return &contents, nil
+}
+
+// checkDestroySafe refuses to destroy a dataset (or the root dataset of a pool) which isn't empty, unless force is set.
+func checkDestroySafe(config *Config, datasetName string, force bool) error {
+	if force {
+		return nil
+	}
+
+	stdout, err := callSshCommand(config, "zfs list -H -p -r -t all -o name,type,logicalreferenced %s", shellescape.Quote(datasetName))
+	if err != nil {
+		return err
+	}
+
+	contents, err := parseDatasetContents(datasetName, stdout)
+	if err != nil {
+		return err
+	}
+
+	if !contents.empty() {
+		return fmt.Errorf("refusing to destroy %s, which contains %s. Set force_destroy = true to destroy it anyway", datasetName, contents)
+	}
+	return nil
+}
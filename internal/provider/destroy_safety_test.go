@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestParseDatasetContents verifies that children, snapshots and data of a dataset are counted.
+func TestParseDatasetContents(t *testing.T) {
+	contents, err := parseDatasetContents("tank/data", "tank/data\tfilesystem\t5368709120\n"+
+		"tank/data@daily\tsnapshot\t5368709120\n"+
+		"tank/data/child\tfilesystem\t43008\n"+
+		"tank/data/child@daily\tsnapshot\t43008\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if contents.children != 1 || contents.snapshots != 2 || contents.data != 5368709120 || contents.empty() {
+		t.Fatalf("unexpected contents %+v", *contents)
+	}
+
+	contents, err = parseDatasetContents("tank/empty", "tank/empty\tfilesystem\t43008\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !contents.empty() {
+		t.Fatalf("expected a fresh dataset to be empty, got %+v", *contents)
+	}
+}
+
+// TestResourceFilesystemDeleteRefusesNonEmpty verifies that non-empty filesystems are only destroyed with force_destroy.
+func TestResourceFilesystemDeleteRefusesNonEmpty(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs list -H -p -r -t all", "tank/data\tfilesystem\t43008\ntank/data@daily\tsnapshot\t43008\n").
+		on("zfs destroy", "")
+
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{"name": "tank/data"})
+	diags := resourceFilesystemDelete(context.Background(), d, newFakeConfig(executor))
+	if !diags.HasError() || !strings.Contains(diags[0].Summary, "1 snapshots") {
+		t.Fatalf("expected the destroy to be refused, got %v", diags)
+	}
+	if executor.ran("zfs destroy") {
+		t.Fatalf("destroyed a non-empty filesystem")
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{"name": "tank/data", "force_destroy": true})
+	if diags := resourceFilesystemDelete(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if !executor.ran("zfs destroy -r tank/data") {
+		t.Fatalf("expected the filesystem to be destroyed, ran %v", executor.commands)
+	}
+}
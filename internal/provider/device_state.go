@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/alessio/shellescape"
+)
+
+// findDeviceStatus returns the vdev of a pool status which is the given device, matching partitions to their whole
+// disk, as zpool shows /dev/sda1 for a pool created on /dev/sda.
+func findDeviceStatus(status *PoolStatus, device string) (*VdevStatus, bool) {
+	for i := range status.vdevs {
+		if status.vdevs[i].name == device {
+			return &status.vdevs[i], true
+		}
+	}
+	for i := range status.vdevs {
+		if wholeDisk(status.vdevs[i].name) == device {
+			return &status.vdevs[i], true
+		}
+	}
+	return nil, false
+}
+
+// offlineDevice takes a device offline, so the pool stops using it. A temporary offline only lasts until the host
+// reboots.
+func offlineDevice(config *Config, poolName string, device string, temporary bool) error {
+	options := ""
+	if temporary {
+		options = " -t"
+	}
+	_, err := callSshCommand(config, "zpool offline%s %s %s", options, shellescape.Quote(poolName), shellescape.Quote(device))
+	return err
+}
+
+// onlineDevice brings a device back online, resilvering whatever was written while it was offline.
+func onlineDevice(config *Config, poolName string, device string) error {
+	_, err := callSshCommand(config, "zpool online %s %s", shellescape.Quote(poolName), shellescape.Quote(device))
+	return err
+}
+
+// clearDeviceErrors resets the error counters of a device, which also brings a faulted device back if it works again.
+func clearDeviceErrors(config *Config, poolName string, device string) error {
+	_, err := callSshCommand(config, "zpool clear %s %s", shellescape.Quote(poolName), shellescape.Quote(device))
+	return err
+}
+
+// describeDeviceStatus returns the status of a device of a pool, or nil if the pool has no such device.
+func describeDeviceStatus(config *Config, poolName string, device string) (*VdevStatus, error) {
+	status, err := describePoolStatus(config, poolName)
+	if err != nil {
+		return nil, err
+	}
+	vdev, ok := findDeviceStatus(status, device)
+	if !ok {
+		return nil, nil
+	}
+	return vdev, nil
+}
+
+// deviceStateId identifies a zfs_pool_device_state by its pool and device.
+func deviceStateId(poolName string, device string) string {
+	return fmt.Sprintf("%s:%s", poolName, device)
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const deviceStateStatus = "  pool: tank\n state: DEGRADED\nconfig:\n\n" +
+	"\tNAME           STATE     READ WRITE CKSUM  SLOW\n" +
+	"\ttank           DEGRADED     0     0     0     -\n" +
+	"\t  mirror-0     DEGRADED     0     0     0     -\n" +
+	"\t    /dev/sda1  ONLINE       0     0     0     0\n" +
+	"\t    /dev/sdb1  OFFLINE      2     0     5     0\n" +
+	"\nerrors: No known data errors\n"
+
+// TestFindDeviceStatus verifies that devices are found by their exact path first, and by the disk of their
+// partition otherwise.
+func TestFindDeviceStatus(t *testing.T) {
+	status, err := parsePoolStatus(deviceStateStatus)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]string{
+		"/dev/sda1": "/dev/sda1",
+		"/dev/sdb":  "/dev/sdb1",
+		"/dev/sdc":  "",
+	}
+	for device, expected := range cases {
+		vdev, ok := findDeviceStatus(status, device)
+		if expected == "" {
+			if ok {
+				t.Fatalf("expected no vdev for %s, got %+v", device, vdev)
+			}
+			continue
+		}
+		if !ok || vdev.name != expected {
+			t.Fatalf("expected %s for %s, got %+v", expected, device, vdev)
+		}
+	}
+}
+
+// TestResourcePoolDeviceStateCreate verifies that only devices which aren't in the configured state are taken offline
+// or brought online, using the path zpool knows them by.
+func TestResourcePoolDeviceStateCreate(t *testing.T) {
+	cases := []struct {
+		device  string
+		offline bool
+		command string
+	}{
+		{"/dev/sda", true, "zpool offline -t tank /dev/sda1"},
+		{"/dev/sdb", false, "zpool online tank /dev/sdb1"},
+		{"/dev/sdb", true, ""},
+		{"/dev/sda", false, ""},
+	}
+
+	for _, c := range cases {
+		executor := (&fakeExecutor{}).
+			on("zpool status -pPs tank", deviceStateStatus).
+			on("zpool offline", "").
+			on("zpool online", "")
+		d := schema.TestResourceDataRaw(t, resourcePoolDeviceState().Schema, map[string]interface{}{
+			"pool":      "tank",
+			"device":    c.device,
+			"offline":   c.offline,
+			"temporary": true,
+		})
+
+		if diags := resourcePoolDeviceStateCreate(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+			t.Fatalf("unexpected error for %+v: %v", c, diags)
+		}
+		if c.command != "" && !executor.ran(c.command) {
+			t.Fatalf("expected %q to run for %+v, ran %v", c.command, c, executor.commands)
+		}
+		if c.command == "" && (executor.ran("zpool offline") || executor.ran("zpool online")) {
+			t.Fatalf("expected no change for %+v, ran %v", c, executor.commands)
+		}
+		if d.Id() != "tank:"+c.device {
+			t.Fatalf("unexpected id %q", d.Id())
+		}
+	}
+}
+
+// TestResourcePoolDeviceStateRead verifies that the state of the device is read back, and that a device which is gone
+// removes the resource from the state.
+func TestResourcePoolDeviceStateRead(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zpool status -pPs tank", deviceStateStatus)
+	config := newFakeConfig(executor)
+
+	d := schema.TestResourceDataRaw(t, resourcePoolDeviceState().Schema, map[string]interface{}{"pool": "tank", "device": "/dev/sdb"})
+	d.SetId("tank:/dev/sdb")
+	if diags := resourcePoolDeviceStateRead(context.Background(), d, config); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if !d.Get("offline").(bool) || d.Get("vdev") != "/dev/sdb1" || d.Get("read_errors") != 2 || d.Get("checksum_errors") != 5 {
+		t.Fatalf("unexpected state offline=%v vdev=%v read=%v cksum=%v", d.Get("offline"), d.Get("vdev"), d.Get("read_errors"), d.Get("checksum_errors"))
+	}
+
+	d = schema.TestResourceDataRaw(t, resourcePoolDeviceState().Schema, map[string]interface{}{"pool": "tank", "device": "/dev/sdc"})
+	d.SetId("tank:/dev/sdc")
+	if diags := resourcePoolDeviceStateRead(context.Background(), d, config); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expected a missing device to be removed from the state")
+	}
+}
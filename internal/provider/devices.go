@@ -0,0 +1,391 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+)
+
+// devicePollInterval is how often devices are checked for while waiting for them to appear.
+const devicePollInterval = 2 * time.Second
+
+var (
+	awsVolumePattern = regexp.MustCompile(`^vol-([0-9a-f]+)$`)
+	azureLunPattern  = regexp.MustCompile(`^azure:lun(\d+)$`)
+
+	// Partitions zpool creates on whole disks, e.g. /dev/sda1, /dev/nvme0n1p1 or /dev/disk/by-id/ata-...-part1 on
+	// Linux, /dev/ada0p1 or /dev/diskid/DISK-S3Z1NB0K123456Ap1 on FreeBSD and /dev/dsk/c1t0d0s0 on illumos.
+	diskPartitionPattern    = regexp.MustCompile(`^(/dev/(?:sd|vd|xvd|hd)[a-z]+)\d+$`)
+	nvmePartitionPattern    = regexp.MustCompile(`^(/dev/(?:nvme\d+n\d+|mmcblk\d+|loop\d+))p\d+$`)
+	byIdPartitionPattern    = regexp.MustCompile(`^(/dev/disk/.+)-part\d+$`)
+	freebsdPartitionPattern = regexp.MustCompile(`^(/dev/(?:(?:ada|da|nda|nvd|vtbd|mmcsd)\d+|diskid/.+))[ps]\d+[a-h]?$`)
+	illumosPartitionPattern = regexp.MustCompile(`^(/dev/r?dsk/c\d+(?:t[0-9A-Fa-f]+)?d\d+)[sp]\d+$`)
+
+	// Disk names on illumos which contain the WWN of the disk, and so don't change when it moves to another port.
+	illumosWwnPattern = regexp.MustCompile(`^/dev/dsk/c\d+t[0-9A-Fa-f]{16,}d\d+`)
+)
+
+// byIdPrefix is where udev creates the stable device names required by require_by_id_paths.
+const byIdPrefix = "/dev/disk/by-id/"
+
+// freebsdStablePrefixes are where FreeBSD creates links to disks and partitions named after their ident, GPT label
+// or GPT id, which don't change between boots like /dev/ada0 may.
+var freebsdStablePrefixes = []string{"/dev/diskid/", "/dev/gpt/", "/dev/gptid/"}
+
+// resolveDevicePath turns a cloud volume or iSCSI LUN reference into the stable device path the volume shows up as
+// once attached to the instance. Anything which isn't a recognized reference is returned unchanged.
+//
+//	vol-0123abcd  -> /dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol0123abcd (AWS EBS on nitro instances)
+//	gcp:data-disk -> /dev/disk/by-id/google-data-disk (GCP persistent disk device name)
+//	azure:lun3    -> /dev/disk/azure/scsi1/lun3 (Azure data disk LUN)
+//	iscsi:10.0.0.5/iqn.2003-01.org.example:storage/1 -> /dev/disk/by-path/ip-10.0.0.5:3260-iscsi-iqn.2003-01.org.example:storage-lun-1
+func resolveDevicePath(reference string) string {
+	if match := awsVolumePattern.FindStringSubmatch(reference); match != nil {
+		return "/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol" + match[1]
+	}
+	if name := strings.TrimPrefix(reference, "gcp:"); name != reference {
+		return "/dev/disk/by-id/google-" + name
+	}
+	if match := azureLunPattern.FindStringSubmatch(reference); match != nil {
+		return "/dev/disk/azure/scsi1/lun" + match[1]
+	}
+	if target, lun, ok := parseIscsiReference(reference); ok {
+		return iscsiDevicePath(*target, lun)
+	}
+	return reference
+}
+
+// resourceGetter is implemented by both schema.ResourceData and schema.ResourceDiff.
+type resourceGetter interface {
+	Get(key string) interface{}
+}
+
+// configuredDevices returns the device blocks of a pool resource, keyed by their resolved device paths.
+func configuredDevices(d resourceGetter) map[string]Device {
+	blocks := make([]interface{}, 0)
+	for _, class := range []string{"device", "log", "cache"} {
+		blocks = append(blocks, d.Get(class).([]interface{})...)
+	}
+	for _, mirror := range d.Get("mirror").([]interface{}) {
+		blocks = append(blocks, mirror.(map[string]interface{})["device"].([]interface{})...)
+	}
+
+	devices := make(map[string]Device)
+	for _, block := range blocks {
+		block := block.(map[string]interface{})
+		device := Device{path: block["path"].(string)}
+		if timeout, ok := block["wait_for_device_timeout"].(string); ok {
+			device.waitTimeout = timeout
+		}
+		devices[resolveDevicePath(device.path)] = device
+	}
+	return devices
+}
+
+// deviceReferences maps resolved device paths to the cloud volume references they were configured as.
+func deviceReferences(devices map[string]Device) map[string]string {
+	references := make(map[string]string)
+	for path, device := range devices {
+		if path != device.path {
+			references[path] = device.path
+		}
+	}
+	return references
+}
+
+// restoreDeviceConfiguration replaces devices read back from zpool with their configured blocks, so that
+// state keeps cloud volume references and device options instead of showing a diff on every plan.
+func restoreDeviceConfiguration(layout *PoolLayout, configured map[string]Device) {
+	restore := func(devices []Device) {
+		for i := range devices {
+			if device, ok := configured[devices[i].path]; ok {
+				devices[i] = device
+			}
+		}
+	}
+
+	for _, mirror := range layout.mirrors {
+		restore(mirror.devices)
+	}
+	for _, raidz := range layout.raidz {
+		restore(raidz.devices)
+	}
+	restore(layout.striped)
+	restore(layout.logs)
+	restore(layout.caches)
+}
+
+// wholeDisk returns the disk a partition belongs to, or the path unchanged if it isn't a partition.
+func wholeDisk(path string) string {
+	for _, pattern := range []*regexp.Regexp{diskPartitionPattern, nvmePartitionPattern, byIdPartitionPattern, freebsdPartitionPattern, illumosPartitionPattern} {
+		if match := pattern.FindStringSubmatch(path); match != nil {
+			return match[1]
+		}
+	}
+	return path
+}
+
+// canonicalDevicePaths resolves the symlinks of device paths, e.g. /dev/disk/by-id/wwn-0x5000c500a1b2c3d4 to /dev/sda.
+// On FreeBSD, GPT labels such as /dev/gpt/zfs0 aren't links, they are resolved to the partition they label instead.
+func canonicalDevicePaths(config *Config, paths []string) (map[string]string, error) {
+	quoted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		quoted = append(quoted, shellescape.Quote(path))
+	}
+
+	// Unlike -f and -e, -m prints one line per path even if it doesn't exist, so the output lines up with the input.
+	// It is only known to GNU readlink, so elsewhere each path is resolved on its own, falling back to the path itself.
+	var command string
+	switch hostPlatform(config) {
+	case PlatformFreeBSD:
+		command = "for path in %s; do realpath \"$path\" 2>/dev/null || echo \"$path\"; done"
+	case PlatformIllumos:
+		command = "/usr/gnu/bin/readlink -m %s"
+	default:
+		command = "readlink -m %s"
+	}
+	stdout, err := callSshCommand(config, command, strings.Join(quoted, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != len(paths) {
+		return nil, fmt.Errorf("expected %d paths from readlink, got %q", len(paths), stdout)
+	}
+
+	labels := make(map[string]string)
+	if hostPlatform(config) == PlatformFreeBSD {
+		stdout, err := callSshCommand(config, "glabel status -s 2>/dev/null || true")
+		if err != nil {
+			return nil, err
+		}
+		labels = parseGlabelStatus(stdout)
+	}
+
+	canonical := make(map[string]string)
+	for i, path := range paths {
+		canonical[path] = lines[i]
+		if provider, ok := labels[lines[i]]; ok {
+			canonical[path] = provider
+		}
+	}
+	return canonical, nil
+}
+
+// parseGlabelStatus parses `glabel status -s` into the partitions behind each label, e.g.
+//
+//	gpt/zfs0  N/A  ada0p3
+//	gptid/5f3a2b1c-0d4e-11ee-9c1a-001b21a1b2c3  N/A  ada0p3
+func parseGlabelStatus(output string) map[string]string {
+	labels := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 {
+			labels["/dev/"+fields[0]] = "/dev/" + fields[2]
+		}
+	}
+	return labels
+}
+
+// normalizeLayoutDevices renames the devices read back from zpool to the configured path referring to the same
+// disk, e.g. /dev/sda1 or /dev/disk/by-id/ata-...-part1 when /dev/sda was configured, so that semantically
+// identical layouts don't show a diff. Paths are first compared after resolving symlinks, then by their whole disk.
+func normalizeLayoutDevices(config *Config, layout *PoolLayout, configured map[string]Device) error {
+	unmatched := make([]*Device, 0)
+	collect := func(devices []Device) {
+		for i := range devices {
+			if _, ok := configured[devices[i].path]; !ok {
+				unmatched = append(unmatched, &devices[i])
+			}
+		}
+	}
+	for _, mirror := range layout.mirrors {
+		collect(mirror.devices)
+	}
+	for _, raidz := range layout.raidz {
+		collect(raidz.devices)
+	}
+	collect(layout.striped)
+	collect(layout.logs)
+	collect(layout.caches)
+
+	if len(unmatched) == 0 || len(configured) == 0 {
+		return nil
+	}
+
+	paths := mapKeys(configured)
+	sort.Strings(paths)
+	for _, device := range unmatched {
+		paths = append(paths, device.path)
+	}
+	canonical, err := canonicalDevicePaths(config, paths)
+	if err != nil {
+		return err
+	}
+
+	byPath := make(map[string]string)
+	byDisk := make(map[string]string)
+	for path := range configured {
+		byPath[canonical[path]] = path
+		byDisk[wholeDisk(canonical[path])] = path
+	}
+
+	for _, device := range unmatched {
+		actual := canonical[device.path]
+		if path, ok := byPath[actual]; ok {
+			log.Printf("[DEBUG] %s is configured as %s", device.path, path)
+			device.path = path
+		} else if path, ok := byDisk[wholeDisk(actual)]; ok {
+			log.Printf("[DEBUG] %s is a partition of %s", device.path, path)
+			device.path = path
+		}
+	}
+	return nil
+}
+
+// isStableDevicePath reports whether a device path doesn't change between boots: a /dev/disk/by-id path on Linux, a
+// disk ident, GPT label or GPT id on FreeBSD, and a disk name containing the WWN of the disk on illumos.
+func isStableDevicePath(platform string, path string) bool {
+	switch platform {
+	case PlatformFreeBSD:
+		for _, prefix := range freebsdStablePrefixes {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+		return false
+	case PlatformIllumos:
+		return illumosWwnPattern.MatchString(path)
+	default:
+		return strings.HasPrefix(path, byIdPrefix)
+	}
+}
+
+// stableDevicePaths describes the paths accepted by isStableDevicePath on a platform.
+func stableDevicePaths(platform string) string {
+	switch platform {
+	case PlatformFreeBSD:
+		return strings.Join(freebsdStablePrefixes, ", ")
+	case PlatformIllumos:
+		return "/dev/dsk/c#t<WWN>d#"
+	default:
+		return byIdPrefix
+	}
+}
+
+// checkByIdPaths returns an error listing the configured devices which don't use a stable path on the platform.
+// Cloud volume and iSCSI references are accepted, as they resolve to stable paths, as are file vdevs outside of /dev.
+func checkByIdPaths(platform string, devices map[string]Device) error {
+	unstable := make([]string, 0)
+	for path, device := range devices {
+		if path != device.path || !strings.HasPrefix(path, "/dev/") || isStableDevicePath(platform, path) {
+			continue
+		}
+		unstable = append(unstable, path)
+	}
+	if len(unstable) > 0 {
+		sort.Strings(unstable)
+		return fmt.Errorf("require_by_id_paths is set, but these devices don't use a stable path (%s): %s", stableDevicePaths(platform), strings.Join(unstable, ", "))
+	}
+	return nil
+}
+
+// listExistingDevices returns those of the given paths which exist on the host.
+func listExistingDevices(config *Config, paths []string) ([]string, error) {
+	quoted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		quoted = append(quoted, shellescape.Quote(path))
+	}
+
+	// ls only prints the paths which exist, and complains about the rest on stderr.
+	stdout, err := callSshCommand(config, "ls -d %s 2>/dev/null || true", strings.Join(quoted, " "))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(stdout), nil
+}
+
+// waitForDevices waits for devices with a wait_for_device_timeout to appear, e.g. volumes which were only
+// just attached to the host. It gives up once the timeout of a device which is still missing has passed.
+func waitForDevices(ctx context.Context, config *Config, devices map[string]Device) error {
+	deadlines := make(map[string]time.Time)
+	for path, device := range devices {
+		if device.waitTimeout == "" {
+			continue
+		}
+		timeout, err := time.ParseDuration(device.waitTimeout)
+		if err != nil {
+			return err
+		}
+		deadlines[path] = time.Now().Add(timeout)
+	}
+
+	for len(deadlines) > 0 {
+		existing, err := listExistingDevices(config, mapKeys(deadlines))
+		if err != nil {
+			return err
+		}
+
+		for path, deadline := range deadlines {
+			if contains(existing, path) {
+				delete(deadlines, path)
+			} else if time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for %s to appear after %s", path, devices[path].waitTimeout)
+			}
+		}
+
+		if len(deadlines) == 0 {
+			break
+		}
+
+		log.Printf("[DEBUG] waiting for devices: %v", mapKeys(deadlines))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(devicePollInterval):
+		}
+	}
+	return nil
+}
+
+// checkDeviceReferencesSupported rejects cloud volume and iSCSI references on platforms other than Linux, as they
+// are resolved to /dev/disk/by-id and /dev/disk/by-path links, and iSCSI targets are logged in to with iscsiadm.
+func checkDeviceReferencesSupported(config *Config, devices map[string]Device) error {
+	for path, device := range devices {
+		if path != device.path && hostPlatform(config) != PlatformLinux {
+			return unsupportedOnPlatform(config, fmt.Sprintf("the device reference %s", device.path))
+		}
+	}
+	return nil
+}
+
+// checkDevicesExist returns an error listing every resolved cloud volume which isn't attached to the host.
+func checkDevicesExist(config *Config, references map[string]string) error {
+	if len(references) == 0 {
+		return nil
+	}
+
+	existing, err := listExistingDevices(config, mapKeys(references))
+	if err != nil {
+		return err
+	}
+
+	missing := make([]string, 0)
+	for path, reference := range references {
+		if !contains(existing, path) {
+			missing = append(missing, fmt.Sprintf("%s (%s)", reference, path))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("the following volumes are not attached: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
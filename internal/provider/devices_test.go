@@ -0,0 +1,193 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestResolveDevicePath verifies that cloud volume references map to their stable device paths, and other paths are left alone.
+func TestResolveDevicePath(t *testing.T) {
+	cases := map[string]string{
+		"vol-0123456789abcdef0": "/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol0123456789abcdef0",
+		"gcp:data-disk":         "/dev/disk/by-id/google-data-disk",
+		"azure:lun3":            "/dev/disk/azure/scsi1/lun3",
+		"/dev/sdb":              "/dev/sdb",
+		"vol-notahexid":         "vol-notahexid",
+	}
+
+	for reference, expected := range cases {
+		if path := resolveDevicePath(reference); path != expected {
+			t.Fatalf("expected %s to resolve to %s, got %s", reference, expected, path)
+		}
+	}
+}
+
+// TestRestoreDeviceConfiguration verifies that resolved paths read back from zpool are replaced with their configured blocks.
+func TestRestoreDeviceConfiguration(t *testing.T) {
+	layout := PoolLayout{
+		mirrors: []Mirror{{devices: []Device{{path: "/dev/disk/by-id/google-a"}, {path: "/dev/sdb"}}}},
+		logs:    []Device{{path: "/dev/disk/azure/scsi1/lun0"}},
+	}
+
+	restoreDeviceConfiguration(&layout, map[string]Device{
+		"/dev/disk/by-id/google-a":   {path: "gcp:a", waitTimeout: "5m"},
+		"/dev/disk/azure/scsi1/lun0": {path: "azure:lun0"},
+	})
+
+	if layout.mirrors[0].devices[0] != (Device{path: "gcp:a", waitTimeout: "5m"}) || layout.mirrors[0].devices[1].path != "/dev/sdb" {
+		t.Fatalf("unexpected mirror devices %+v", layout.mirrors[0].devices)
+	}
+	if layout.logs[0].path != "azure:lun0" {
+		t.Fatalf("unexpected log device %s", layout.logs[0].path)
+	}
+}
+
+// TestWaitForDevices verifies that devices which exist stop the wait, and missing devices fail once their timeout passes.
+func TestWaitForDevices(t *testing.T) {
+	executor := (&fakeExecutor{}).on("ls -d", "/dev/sdb")
+	config := newFakeConfig(executor)
+
+	err := waitForDevices(context.Background(), config, map[string]Device{
+		"/dev/sda": {path: "/dev/sda"},
+		"/dev/sdb": {path: "/dev/sdb", waitTimeout: "1m"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = waitForDevices(context.Background(), config, map[string]Device{
+		"/dev/sdc": {path: "/dev/sdc", waitTimeout: "0s"},
+	})
+	if err == nil {
+		t.Fatalf("expected a timeout for a missing device")
+	}
+}
+
+// TestWholeDisk verifies that partitions created by zpool map back to their disk.
+func TestWholeDisk(t *testing.T) {
+	cases := map[string]string{
+		"/dev/sda1":                             "/dev/sda",
+		"/dev/nvme0n1p1":                        "/dev/nvme0n1",
+		"/dev/disk/by-id/ata-Samsung_123-part1": "/dev/disk/by-id/ata-Samsung_123",
+		"/dev/sda":                              "/dev/sda",
+		"/dev/nvme0n1":                          "/dev/nvme0n1",
+		"/dev/ada0p3":                           "/dev/ada0",
+		"/dev/da1s1a":                           "/dev/da1",
+		"/dev/diskid/DISK-S3Z1NB0K123456Ap1":    "/dev/diskid/DISK-S3Z1NB0K123456A",
+		"/dev/dsk/c1t0d0s0":                     "/dev/dsk/c1t0d0",
+		"/dev/dsk/c0t5000C500A1B2C3D4d0s0":      "/dev/dsk/c0t5000C500A1B2C3D4d0",
+		"/dev/ada0":                             "/dev/ada0",
+	}
+	for path, expected := range cases {
+		if disk := wholeDisk(path); disk != expected {
+			t.Fatalf("expected %s to belong to %s, got %s", path, expected, disk)
+		}
+	}
+}
+
+// TestNormalizeLayoutDevices verifies that devices reported under another name than configured are renamed.
+func TestNormalizeLayoutDevices(t *testing.T) {
+	// readlink receives the sorted configured paths, followed by the devices which didn't match any of them.
+	executor := (&fakeExecutor{}).on("readlink -m /dev/nvme0n1 /dev/sda /dev/sdb /dev/disk/by-id/wwn-0x5000c500a1b2c3d4-part1 /dev/sdb1",
+		"/dev/nvme0n1\n/dev/sda\n/dev/sdb\n/dev/sda1\n/dev/sdb1\n")
+	layout := PoolLayout{
+		mirrors: []Mirror{{devices: []Device{{path: "/dev/disk/by-id/wwn-0x5000c500a1b2c3d4-part1"}, {path: "/dev/sdb1"}}}},
+		caches:  []Device{{path: "/dev/nvme0n1"}},
+	}
+	configured := map[string]Device{"/dev/sda": {path: "/dev/sda"}, "/dev/sdb": {path: "/dev/sdb"}, "/dev/nvme0n1": {path: "/dev/nvme0n1"}}
+
+	if err := normalizeLayoutDevices(newFakeConfig(executor), &layout, configured); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if layout.mirrors[0].devices[0].path != "/dev/sda" || layout.mirrors[0].devices[1].path != "/dev/sdb" || layout.caches[0].path != "/dev/nvme0n1" {
+		t.Fatalf("unexpected layout %+v", layout)
+	}
+}
+
+// TestNormalizeLayoutDevicesFreeBSD verifies that FreeBSD hosts resolve paths without GNU readlink, and that GPT
+// labels are matched through the partition they label.
+func TestNormalizeLayoutDevicesFreeBSD(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("for path in /dev/ada0 /dev/ada1 /dev/gpt/zfs0 /dev/ada1p3; do realpath", "/dev/ada0\n/dev/ada1\n/dev/gpt/zfs0\n/dev/ada1p3\n").
+		on("glabel status -s", "gpt/zfs0  N/A  ada0p3\ngptid/5f3a2b1c-0d4e-11ee-9c1a-001b21a1b2c3  N/A  ada1p3\n")
+	config := newFakeConfig(executor)
+	config.platform = PlatformFreeBSD
+
+	layout := PoolLayout{mirrors: []Mirror{{devices: []Device{{path: "/dev/gpt/zfs0"}, {path: "/dev/ada1p3"}}}}}
+	configured := map[string]Device{"/dev/ada0": {path: "/dev/ada0"}, "/dev/ada1": {path: "/dev/ada1"}}
+
+	if err := normalizeLayoutDevices(config, &layout, configured); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if layout.mirrors[0].devices[0].path != "/dev/ada0" || layout.mirrors[0].devices[1].path != "/dev/ada1" {
+		t.Fatalf("unexpected layout %+v", layout)
+	}
+	if executor.ran("readlink -m") {
+		t.Fatalf("ran GNU readlink on freebsd: %v", executor.commands)
+	}
+}
+
+// TestCheckByIdPaths verifies that only plain /dev paths without a stable name on the platform are rejected.
+func TestCheckByIdPaths(t *testing.T) {
+	devices := map[string]Device{
+		"/dev/disk/by-id/ata-Samsung_123": {path: "/dev/disk/by-id/ata-Samsung_123"},
+		"/dev/disk/by-id/google-data":     {path: "gcp:data"},
+		"/var/lib/zfs/file.img":           {path: "/var/lib/zfs/file.img"},
+	}
+	if err := checkByIdPaths(PlatformLinux, devices); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	devices["/dev/sdb"] = Device{path: "/dev/sdb"}
+	if err := checkByIdPaths(PlatformLinux, devices); err == nil {
+		t.Fatalf("expected /dev/sdb to be rejected")
+	}
+
+	freebsd := map[string]Device{"/dev/gpt/zfs0": {path: "/dev/gpt/zfs0"}, "/dev/diskid/DISK-S3Z1NB0K123456A": {path: "/dev/diskid/DISK-S3Z1NB0K123456A"}}
+	if err := checkByIdPaths(PlatformFreeBSD, freebsd); err != nil {
+		t.Fatalf("unexpected error on freebsd: %s", err)
+	}
+	freebsd["/dev/ada1"] = Device{path: "/dev/ada1"}
+	if err := checkByIdPaths(PlatformFreeBSD, freebsd); err == nil {
+		t.Fatalf("expected /dev/ada1 to be rejected on freebsd")
+	}
+
+	illumos := map[string]Device{"/dev/dsk/c0t5000C500A1B2C3D4d0": {path: "/dev/dsk/c0t5000C500A1B2C3D4d0"}}
+	if err := checkByIdPaths(PlatformIllumos, illumos); err != nil {
+		t.Fatalf("unexpected error on illumos: %s", err)
+	}
+	illumos["/dev/dsk/c1t0d0"] = Device{path: "/dev/dsk/c1t0d0"}
+	if err := checkByIdPaths(PlatformIllumos, illumos); err == nil {
+		t.Fatalf("expected /dev/dsk/c1t0d0 to be rejected on illumos")
+	}
+}
+
+// TestWaitForVolumeDevice verifies that the device node of a volume is waited for, unless it has none or waiting is disabled.
+func TestWaitForVolumeDevice(t *testing.T) {
+	executor := (&fakeExecutor{}).on("ls -d", "/dev/zvol/tank/disk")
+	config := newFakeConfig(executor)
+
+	d := schema.TestResourceDataRaw(t, resourceVolume().Schema, map[string]interface{}{"name": "tank/disk", "volsize": "1G"})
+	if err := waitForVolumeDevice(context.Background(), config, d, "tank/disk"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !executor.ran("ls -d /dev/zvol/tank/disk") {
+		t.Fatalf("expected the device node to be waited for, ran %v", executor.commands)
+	}
+
+	executor = &fakeExecutor{}
+	for _, raw := range []map[string]interface{}{
+		{"name": "tank/disk", "volsize": "1G", "wait_for_device_timeout": "0s"},
+		{"name": "tank/disk", "volsize": "1G", "property": []interface{}{map[string]interface{}{"name": "volmode", "value": "none"}}},
+	} {
+		d := schema.TestResourceDataRaw(t, resourceVolume().Schema, raw)
+		if err := waitForVolumeDevice(context.Background(), newFakeConfig(executor), d, "tank/disk"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(executor.commands) > 0 {
+		t.Fatalf("expected no wait, ran %v", executor.commands)
+	}
+}
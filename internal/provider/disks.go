@@ -0,0 +1,248 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Disk is a block device on the host, as listed by lsblk, or geom on FreeBSD.
+type Disk struct {
+	name       string
+	path       string
+	size       int64
+	model      string
+	serial     string
+	wwn        string
+	rotational bool
+	byIdPaths  []string
+	inPool     bool
+}
+
+var lsblkPairPattern = regexp.MustCompile(`([A-Z:]+)="([^"]*)"`)
+
+// parseLsblkPairs parses the KEY="value" output of lsblk -P, one map per device.
+func parseLsblkPairs(output string) []map[string]string {
+	devices := make([]map[string]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		matches := lsblkPairPattern.FindAllStringSubmatch(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		device := make(map[string]string)
+		for _, match := range matches {
+			device[match[1]] = strings.TrimSpace(match[2])
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// parseDisks parses `lsblk -b -n -P -o NAME,PKNAME,TYPE,SIZE,MODEL,SERIAL,WWN,ROTA,FSTYPE`. Only whole disks are
+// returned, and a disk counts as part of a pool if it or one of its partitions carries a zfs label.
+func parseDisks(output string) ([]Disk, error) {
+	devices := parseLsblkPairs(output)
+
+	inPool := make(map[string]bool)
+	for _, device := range devices {
+		if device["FSTYPE"] != "zfs_member" {
+			continue
+		}
+		inPool[device["NAME"]] = true
+		if device["PKNAME"] != "" {
+			inPool[device["PKNAME"]] = true
+		}
+	}
+
+	disks := make([]Disk, 0)
+	for _, device := range devices {
+		if device["TYPE"] != "disk" {
+			continue
+		}
+		size, err := strconv.ParseInt(device["SIZE"], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		disks = append(disks, Disk{
+			name:       device["NAME"],
+			path:       "/dev/" + device["NAME"],
+			size:       size,
+			model:      device["MODEL"],
+			serial:     device["SERIAL"],
+			wwn:        device["WWN"],
+			rotational: device["ROTA"] == "1",
+			byIdPaths:  make([]string, 0),
+			inPool:     inPool[device["NAME"]],
+		})
+	}
+
+	sort.Slice(disks, func(i, j int) bool { return disks[i].name < disks[j].name })
+	return disks, nil
+}
+
+// parseByIdLinks parses `ls -l /dev/disk/by-id` into the by-id paths of each device, skipping partitions.
+func parseByIdLinks(output string) map[string][]string {
+	links := make(map[string][]string)
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(line, " -> ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields := strings.Fields(parts[0])
+		if len(fields) == 0 {
+			continue
+		}
+		link := fields[len(fields)-1]
+		target := parts[1][strings.LastIndex(parts[1], "/")+1:]
+		if byIdPartitionPattern.MatchString(byIdPrefix + link) {
+			continue
+		}
+		links[strings.TrimSpace(target)] = append(links[strings.TrimSpace(target)], byIdPrefix+link)
+	}
+	for _, paths := range links {
+		sort.Strings(paths)
+	}
+	return links
+}
+
+// preferredByIdPath picks the by-id path which is easiest to recognize, i.e. the one with the model and serial
+// number rather than a WWN or EUI, which all refer to the same disk.
+func preferredByIdPath(paths []string) string {
+	for _, path := range paths {
+		name := strings.TrimPrefix(path, byIdPrefix)
+		if !strings.HasPrefix(name, "wwn-") && !strings.Contains(name, "-eui.") && !strings.HasPrefix(name, "nvme-nvme.") {
+			return path
+		}
+	}
+	if len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+// diskIdPrefix is where FreeBSD creates stable links to disks, named after the ident of the disk.
+const diskIdPrefix = "/dev/diskid/DISK-"
+
+// parseGeomDisks parses `geom disk list`, which lists every disk in a block such as
+//
+//	Geom name: ada0
+//	Providers:
+//	1. Name: ada0
+//	   Mediasize: 500107862016 (466G)
+//	   descr: Samsung SSD 860 EVO 500GB
+//	   lunid: 5002538e40a1b2c3
+//	   ident: S3Z1NB0K123456A
+//	   rotationrate: 0
+//
+// A rotation rate of 0 means the disk doesn't spin. Disks with an ident get their /dev/diskid link as by-id path.
+func parseGeomDisks(output string) ([]Disk, error) {
+	disks := make([]Disk, 0)
+	for _, block := range strings.Split(output, "Geom name: ")[1:] {
+		fields := make(map[string]string)
+		for _, line := range strings.Split(block, "\n")[1:] {
+			parts := strings.SplitN(strings.TrimSpace(line), ": ", 2)
+			if len(parts) == 2 {
+				fields[strings.TrimPrefix(parts[0], "1. ")] = strings.TrimSpace(parts[1])
+			}
+		}
+
+		name := strings.TrimSpace(strings.SplitN(block, "\n", 2)[0])
+		size, err := strconv.ParseInt(strings.Fields(fields["Mediasize"] + " 0")[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size of disk %s: %s", name, err)
+		}
+
+		disk := Disk{
+			name:       name,
+			path:       "/dev/" + name,
+			size:       size,
+			model:      fields["descr"],
+			serial:     fields["ident"],
+			wwn:        fields["lunid"],
+			rotational: fields["rotationrate"] != "0" && fields["rotationrate"] != "unknown" && fields["rotationrate"] != "",
+			byIdPaths:  make([]string, 0),
+		}
+		if disk.serial != "" && disk.serial != "(null)" {
+			disk.byIdPaths = append(disk.byIdPaths, diskIdPrefix+disk.serial)
+		}
+		disks = append(disks, disk)
+	}
+
+	sort.Slice(disks, func(i, j int) bool { return disks[i].name < disks[j].name })
+	return disks, nil
+}
+
+// parseGpartZfsDisks parses `gpart show -p` into the disks which have a freebsd-zfs partition, e.g.
+//
+//	=>       40  976773088  ada0  GPT  (466G)
+//	         40       1024  ada0p1  freebsd-boot  (512K)
+//	   67109928  909663200  ada0p3  freebsd-zfs  (434G)
+func parseGpartZfsDisks(output string) map[string]bool {
+	disks := make(map[string]bool)
+	disk := ""
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[0] == "=>" {
+			disk = fields[3]
+		} else if len(fields) >= 4 && fields[3] == "freebsd-zfs" && disk != "" {
+			disks[disk] = true
+		}
+	}
+	return disks
+}
+
+// listGeomDisks lists the disks of a FreeBSD host. Disks given to a pool whole have no partition table, so only
+// pools on freebsd-zfs partitions, as the installer creates them, are noticed.
+func listGeomDisks(config *Config) ([]Disk, error) {
+	stdout, err := callSshCommand(config, "geom disk list")
+	if err != nil {
+		return nil, err
+	}
+	disks, err := parseGeomDisks(stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err = callSshCommand(config, "gpart show -p 2>/dev/null || true")
+	if err != nil {
+		return nil, err
+	}
+	inPool := parseGpartZfsDisks(stdout)
+	for i := range disks {
+		disks[i].inPool = inPool[disks[i].name]
+	}
+	return disks, nil
+}
+
+func listDisks(config *Config) ([]Disk, error) {
+	switch hostPlatform(config) {
+	case PlatformFreeBSD:
+		return listGeomDisks(config)
+	case PlatformIllumos:
+		return nil, unsupportedOnPlatform(config, "listing disks")
+	}
+
+	stdout, err := callSshCommand(config, "lsblk -b -n -P -o NAME,PKNAME,TYPE,SIZE,MODEL,SERIAL,WWN,ROTA,FSTYPE")
+	if err != nil {
+		return nil, err
+	}
+	disks, err := parseDisks(stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Not every host has by-id links, e.g. some virtual machines, so a missing directory isn't an error.
+	stdout, err = callSshCommand(config, "ls -l /dev/disk/by-id 2>/dev/null || true")
+	if err != nil {
+		return nil, err
+	}
+	links := parseByIdLinks(stdout)
+	for i := range disks {
+		if paths, ok := links[disks[i].name]; ok {
+			disks[i].byIdPaths = paths
+		}
+	}
+	return disks, nil
+}
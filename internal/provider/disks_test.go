@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testLsblkPairs = `NAME="sda" PKNAME="" TYPE="disk" SIZE="4000787030016" MODEL="WDC WD40EFRX-68N" SERIAL="WD-WCC7K1234567" WWN="0x50014ee2b1234567" ROTA="1" FSTYPE=""
+NAME="sda1" PKNAME="sda" TYPE="part" SIZE="4000776716288" MODEL="" SERIAL="" WWN="0x50014ee2b1234567" ROTA="1" FSTYPE="zfs_member"
+NAME="sdb" PKNAME="" TYPE="disk" SIZE="4000787030016" MODEL="WDC WD40EFRX-68N" SERIAL="WD-WCC7K7654321" WWN="0x50014ee2b7654321" ROTA="1" FSTYPE=""
+NAME="sr0" PKNAME="" TYPE="rom" SIZE="1073741312" MODEL="QEMU DVD-ROM" SERIAL="QM00003" WWN="" ROTA="1" FSTYPE=""
+NAME="nvme0n1" PKNAME="" TYPE="disk" SIZE="1000204886016" MODEL="Samsung SSD 980 PRO 1TB" SERIAL="S5GXNF0R123456" WWN="eui.002538b111111111" ROTA="0" FSTYPE="zfs_member"`
+
+const testByIdListing = `total 0
+lrwxrwxrwx 1 root root  9 Oct 15 12:00 ata-WDC_WD40EFRX-68N_WD-WCC7K1234567 -> ../../sda
+lrwxrwxrwx 1 root root 10 Oct 15 12:00 ata-WDC_WD40EFRX-68N_WD-WCC7K1234567-part1 -> ../../sda1
+lrwxrwxrwx 1 root root 13 Oct 15 12:00 nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R123456 -> ../../nvme0n1
+lrwxrwxrwx 1 root root 13 Oct 15 12:00 nvme-eui.002538b111111111 -> ../../nvme0n1
+lrwxrwxrwx 1 root root  9 Oct 15 12:00 wwn-0x50014ee2b1234567 -> ../../sda`
+
+// TestParseDisks verifies that only whole disks are listed, and that a zfs label on a partition marks its disk as in a pool.
+func TestParseDisks(t *testing.T) {
+	disks, err := parseDisks(testLsblkPairs)
+	if err != nil {
+		t.Fatalf("parseDisks returned error: %v", err)
+	}
+
+	if len(disks) != 3 {
+		t.Fatalf("expected 3 disks, got %d: %#v", len(disks), disks)
+	}
+
+	expected := Disk{
+		name:       "sda",
+		path:       "/dev/sda",
+		size:       4000787030016,
+		model:      "WDC WD40EFRX-68N",
+		serial:     "WD-WCC7K1234567",
+		wwn:        "0x50014ee2b1234567",
+		rotational: true,
+		byIdPaths:  []string{},
+		inPool:     true,
+	}
+	if !reflect.DeepEqual(disks[1], expected) {
+		t.Fatalf("expected %#v, got %#v", expected, disks[1])
+	}
+
+	if disks[0].name != "nvme0n1" || disks[0].rotational || !disks[0].inPool {
+		t.Fatalf("unexpected nvme disk %#v", disks[0])
+	}
+	if disks[2].name != "sdb" || disks[2].inPool {
+		t.Fatalf("unexpected unused disk %#v", disks[2])
+	}
+}
+
+// TestParseByIdLinks verifies that partition links are skipped, and that the model and serial name is preferred.
+func TestParseByIdLinks(t *testing.T) {
+	links := parseByIdLinks(testByIdListing)
+
+	expected := map[string][]string{
+		"sda": {
+			"/dev/disk/by-id/ata-WDC_WD40EFRX-68N_WD-WCC7K1234567",
+			"/dev/disk/by-id/wwn-0x50014ee2b1234567",
+		},
+		"nvme0n1": {
+			"/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R123456",
+			"/dev/disk/by-id/nvme-eui.002538b111111111",
+		},
+	}
+	if !reflect.DeepEqual(links, expected) {
+		t.Fatalf("expected %v, got %v", expected, links)
+	}
+
+	if path := preferredByIdPath([]string{"/dev/disk/by-id/nvme-eui.002538b111111111", "/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R123456"}); path != "/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R123456" {
+		t.Fatalf("unexpected preferred path %q", path)
+	}
+	if path := preferredByIdPath([]string{"/dev/disk/by-id/wwn-0x50014ee2b1234567"}); path != "/dev/disk/by-id/wwn-0x50014ee2b1234567" {
+		t.Fatalf("unexpected fallback path %q", path)
+	}
+	if path := preferredByIdPath(nil); path != "" {
+		t.Fatalf("expected no path, got %q", path)
+	}
+}
+
+const testGeomDiskList = `Geom name: ada0
+Providers:
+1. Name: ada0
+   Mediasize: 500107862016 (466G)
+   Sectorsize: 512
+   Mode: r1w1e3
+   descr: Samsung SSD 860 EVO 500GB
+   lunid: 5002538e40a1b2c3
+   ident: S3Z1NB0K123456A
+   rotationrate: 0
+   fwsectors: 63
+   fwheads: 16
+
+Geom name: da0
+Providers:
+1. Name: da0
+   Mediasize: 4000787030016 (3.6T)
+   Sectorsize: 512
+   Mode: r0w0e0
+   descr: ATA WDC WD40EFRX-68N
+   ident: WD-WCC7K1234567
+   rotationrate: 5400
+`
+
+const testGpartShow = `=>       40  976773088  ada0  GPT  (466G)
+         40       1024  ada0p1  freebsd-boot  (512K)
+       1064        984          - free -  (492K)
+       2048    4194304  ada0p2  freebsd-swap  (2.0G)
+    4196352  972576768  ada0p3  freebsd-zfs  (464G)
+`
+
+// TestParseGeomDisks verifies that FreeBSD disks get their /dev/diskid path, and that freebsd-zfs partitions mark their disk as in a pool.
+func TestParseGeomDisks(t *testing.T) {
+	disks, err := parseGeomDisks(testGeomDiskList)
+	if err != nil {
+		t.Fatalf("parseGeomDisks returned error: %v", err)
+	}
+
+	expected := []Disk{
+		{
+			name:      "ada0",
+			path:      "/dev/ada0",
+			size:      500107862016,
+			model:     "Samsung SSD 860 EVO 500GB",
+			serial:    "S3Z1NB0K123456A",
+			wwn:       "5002538e40a1b2c3",
+			byIdPaths: []string{"/dev/diskid/DISK-S3Z1NB0K123456A"},
+		},
+		{
+			name:       "da0",
+			path:       "/dev/da0",
+			size:       4000787030016,
+			model:      "ATA WDC WD40EFRX-68N",
+			serial:     "WD-WCC7K1234567",
+			rotational: true,
+			byIdPaths:  []string{"/dev/diskid/DISK-WD-WCC7K1234567"},
+		},
+	}
+	if !reflect.DeepEqual(disks, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, disks)
+	}
+
+	inPool := parseGpartZfsDisks(testGpartShow)
+	if !reflect.DeepEqual(inPool, map[string]bool{"ada0": true}) {
+		t.Fatalf("expected only ada0 in a pool, got %v", inPool)
+	}
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// How much of a pool or dataset is read back on refresh, and reported as changed outside of terraform.
+const (
+	DriftDetectionFull              = "full"
+	DriftDetectionDefinedProperties = "defined_properties"
+	DriftDetectionNone              = "none"
+)
+
+var driftDetectionModes = []string{DriftDetectionFull, DriftDetectionDefinedProperties, DriftDetectionNone}
+
+var driftDetectionSchema = schema.Schema{
+	Description: "How much is read back on refresh, and so can show up as changed outside of terraform. " +
+		"`full` reads everything, including values which change as the resource is used, such as `used`, `available` or `fragmentation` in `raw_properties`. " +
+		"`defined_properties` only keeps the properties of `property` blocks and dedicated attributes in the property maps, and doesn't refresh usage attributes or the status and health of pools, " +
+		"so only changes to what is managed show up. `none` only checks that the resource still exists, and keeps the state of the last apply otherwise, " +
+		"which is the fastest but doesn't notice any changes. Only `full` works with a `property_mode` other than `defined`. Defaults to `full`.",
+	Type:             schema.TypeString,
+	Optional:         true,
+	Default:          DriftDetectionFull,
+	ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(driftDetectionModes, false)),
+}
+
+// runtimeProperties change as a pool or dataset is used, rather than by configuration.
+var runtimeProperties = []string{
+	"allocated", "available", "bcloneratio", "bclonesaved", "bcloneused", "capacity", "checkpoint", "compressratio",
+	"dedupratio", "expandsize", "fragmentation", "free", "freeing", "leaked", "logicalreferenced", "logicalused",
+	"referenced", "refcompressratio", "snapshots_changed", "used", "usedbychildren", "usedbydataset",
+	"usedbyrefreservation", "usedbysnapshots", "written",
+}
+
+// isNewOrFullRead reports whether Read has to read the resource in full, because drift_detection asks for it or the
+// resource was just created and has nothing in its state yet.
+func isNewOrFullRead(d *schema.ResourceData) bool {
+	return d.IsNewResource() || d.Get("drift_detection").(string) != DriftDetectionNone
+}
+
+// driftProperties returns the properties to keep in the state. With drift_detection = defined_properties these are
+// only the properties of property blocks, and the properties behind dedicated attributes given as managed.
+func driftProperties(d *schema.ResourceData, properties map[string]Property, managed []string) map[string]Property {
+	if d.Get("drift_detection").(string) != DriftDetectionDefinedProperties {
+		return properties
+	}
+
+	kept := make(map[string]Property)
+	for _, name := range append(getPropertyNames(d), managed...) {
+		if property, ok := properties[name]; ok && !contains(runtimeProperties, name) {
+			kept[name] = property
+		}
+	}
+	return kept
+}
+
+// refreshesUsage reports whether values which change as the resource is used, such as the allocated space of a pool,
+// are read back.
+func refreshesUsage(d *schema.ResourceData) bool {
+	return d.IsNewResource() || d.Get("drift_detection").(string) == DriftDetectionFull
+}
+
+// validateDriftDetection rejects property modes which need to see every property to reset those which aren't
+// configured.
+func validateDriftDetection(d *schema.ResourceDiff) error {
+	mode, propertyMode := d.Get("drift_detection").(string), d.Get("property_mode").(string)
+	if mode != DriftDetectionFull && propertyMode != "defined" {
+		return fmt.Errorf("property_mode %q needs drift_detection = %q to see the properties which aren't configured, it is %q", propertyMode, DriftDetectionFull, mode)
+	}
+	return nil
+}
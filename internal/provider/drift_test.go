@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// TestDriftProperties verifies that defined_properties only keeps configured and managed properties, and never the
+// ones which change as the dataset is used.
+func TestDriftProperties(t *testing.T) {
+	properties := map[string]Property{
+		"compression": {value: "lz4", source: SourceLocal},
+		"atime":       {value: "off", source: SourceLocal},
+		"mountpoint":  {value: "/srv", source: SourceLocal},
+		"used":        {value: "1.2G", source: SourceNone},
+		"available":   {value: "10G", source: SourceNone},
+	}
+	raw := map[string]interface{}{
+		"name":     "tank/data",
+		"property": []interface{}{map[string]interface{}{"name": "compression", "value": "lz4"}},
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, raw)
+	if kept := driftProperties(d, properties, []string{"mountpoint", "used"}); len(kept) != len(properties) {
+		t.Fatalf("expected full to keep every property, got %v", mapKeys(kept))
+	}
+
+	raw["drift_detection"] = DriftDetectionDefinedProperties
+	d = schema.TestResourceDataRaw(t, resourceFilesystem().Schema, raw)
+	names := mapKeys(driftProperties(d, properties, []string{"mountpoint", "used"}))
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"compression", "mountpoint"}) {
+		t.Fatalf("unexpected properties %v", names)
+	}
+}
+
+// TestValidateDriftDetection verifies that property modes which reset unconfigured properties need a full read.
+func TestValidateDriftDetection(t *testing.T) {
+	state := &terraform.InstanceState{ID: "1234", Attributes: map[string]string{"id": "1234", "name": "tank/data"}}
+
+	cases := []struct {
+		config map[string]interface{}
+		valid  bool
+	}{
+		{map[string]interface{}{"name": "tank/data", "drift_detection": DriftDetectionNone}, true},
+		{map[string]interface{}{"name": "tank/data", "property_mode": "all"}, true},
+		{map[string]interface{}{"name": "tank/data", "property_mode": "native", "drift_detection": DriftDetectionDefinedProperties}, false},
+	}
+
+	for _, c := range cases {
+		_, err := resourceFilesystem().Diff(context.Background(), state, terraform.NewResourceConfigRaw(c.config), nil)
+		if (err == nil) != c.valid {
+			t.Fatalf("expected valid %t for %v, got %v", c.valid, c.config, err)
+		}
+	}
+}
+
+// TestReadDriftDetectionNone verifies that a refresh with drift_detection = none only checks that the dataset exists.
+func TestReadDriftDetectionNone(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zfs get -H -o value guid tank/data", "1234\n")
+	config := newFakeConfig(executor)
+
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{
+		"name":            "tank/data",
+		"drift_detection": DriftDetectionNone,
+	})
+	d.SetId("1234")
+
+	if diags := resourceFilesystemRead(context.Background(), d, config); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if len(executor.commands) != 1 {
+		t.Fatalf("expected only the guid to be read, got %v", executor.commands)
+	}
+	if d.Id() != "1234" {
+		t.Fatalf("the dataset was dropped from the state")
+	}
+}
@@ -1,33 +1,214 @@
 package provider
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// ErrorKind classifies why a command failed, judging by its stderr.
+type ErrorKind string
+
+const (
+	ErrorKindUnknown          ErrorKind = "unknown"
+	ErrorKindPermissionDenied ErrorKind = "permission denied"
+	ErrorKindNoSuchPool       ErrorKind = "no such pool"
+	ErrorKindNoSuchDataset    ErrorKind = "no such dataset"
+	ErrorKindDeviceInUse      ErrorKind = "device in use"
+	ErrorKindOutOfSpace       ErrorKind = "out of space"
+	ErrorKindNotSupported     ErrorKind = "not supported"
+	ErrorKindBusy             ErrorKind = "busy"
+)
+
+// ErrorClass describes a kind of failure, recognized by fragments of the messages zfs, zpool, sudo and the
+// shell print for it, along with what to do about it.
+type ErrorClass struct {
+	kind      ErrorKind
+	fragments []string
+	summary   string
+	hint      string
+}
+
+// errorClasses are checked in order, so more specific messages come first. zfs prints e.g.
+// "cannot create 'tank/a': permission denied" or "cannot open 'tank/a': dataset does not exist".
+var errorClasses = []ErrorClass{
+	{
+		kind:      ErrorKindPermissionDenied,
+		fragments: []string{"permission denied", "Permission denied", "a password is required", "is not in the sudoers file", "must be run as root"},
+		summary:   "Permission denied",
+		hint:      "The user the provider connects as lacks the permission. Delegate it with zfs allow, e.g. through zfs_permission, or set use_sudo.",
+	},
+	{
+		kind:      ErrorKindNoSuchPool,
+		fragments: []string{"no such pool"},
+		summary:   "Pool does not exist",
+		hint:      "Check the name of the pool, and that it is imported on the host (zpool import lists the pools which can be imported).",
+	},
+	{
+		kind:      ErrorKindNoSuchDataset,
+		fragments: []string{"dataset does not exist"},
+		summary:   "Dataset does not exist",
+		hint:      "The dataset may have been destroyed or renamed outside of terraform. Check the name with zfs list.",
+	},
+	{
+		kind:      ErrorKindDeviceInUse,
+		fragments: []string{"is in use", "is part of active pool", "is part of exported pool", "is part of potentially active pool", "contains a filesystem", "is busy or mounted", "currently mounted"},
+		summary:   "Device in use",
+		hint:      "The device belongs to another pool or holds a filesystem. Check it with zpool status and lsblk, and wipe it with zpool labelclear or wipefs only if its data isn't needed.",
+	},
+	{
+		kind:      ErrorKindOutOfSpace,
+		fragments: []string{"out of space", "No space left on device", "quota exceeded", "exceeds the available space", "size is greater than available space"},
+		summary:   "Out of space",
+		hint:      "Free up space in the pool, e.g. by destroying old snapshots, or raise the quota or reservation which limits the dataset.",
+	},
+	{
+		kind:      ErrorKindNotSupported,
+		fragments: []string{"not supported", "unsupported", "invalid option", "unrecognized command", "feature is not enabled"},
+		summary:   "Not supported by the host",
+		hint:      "The OpenZFS version of the host, or the features enabled on the pool, may not support this. Check them with zfs version and zpool get all.",
+	},
+	{
+		kind:      ErrorKindBusy,
+		fragments: transientErrors,
+		summary:   "Pool or dataset busy",
+		hint:      "Something holds the pool or dataset open, e.g. a process working in its mountpoint or a running scrub. The command was retried up to retry_max_attempts times.",
+	},
+}
+
+var unknownErrorClass = ErrorClass{kind: ErrorKindUnknown, summary: "Command failed"}
+
+// classifyStderr returns the class of the failure a command printed to stderr.
+func classifyStderr(stderr string) ErrorClass {
+	for _, class := range errorClasses {
+		for _, fragment := range class.fragments {
+			if strings.Contains(stderr, fragment) {
+				return class
+			}
+		}
+	}
+	return unknownErrorClass
+}
+
+// CommandFailure is implemented by the errors of commands which ran on the host, or were meant to.
+type CommandFailure interface {
+	error
+	failedCommand() string
+	output() string
+}
+
 type SshConnectError struct {
-	inner error
+	inner   error
+	command string
 }
 
 func (e *SshConnectError) Error() string {
 	return e.inner.Error()
 }
 
+func (e *SshConnectError) failedCommand() string { return e.command }
+func (e *SshConnectError) output() string        { return "" }
+
 type StderrError struct {
-	stderr string
+	stderr  string
+	command string
 }
 
 func (e *StderrError) Error() string {
 	return e.stderr
 }
 
+func (e *StderrError) failedCommand() string { return e.command }
+func (e *StderrError) output() string        { return e.stderr }
+
 type DatasetError struct {
-	errmsg string
+	errmsg  string
+	stderr  string
+	command string
 }
 
 func (e *DatasetError) Error() string {
 	return e.errmsg
 }
 
+func (e *DatasetError) failedCommand() string { return e.command }
+func (e *DatasetError) output() string        { return e.stderr }
+
 type PoolError struct {
-	errmsg string
+	errmsg  string
+	stderr  string
+	command string
 }
 
 func (e *PoolError) Error() string {
 	return e.errmsg
 }
+
+func (e *PoolError) failedCommand() string { return e.command }
+func (e *PoolError) output() string        { return e.stderr }
+
+// diagFromErr turns an error into diagnostics like diag.FromErr, but explains why a command failed: the summary
+// names the kind of failure, and the detail holds the error, a hint on how to fix it and the command which failed.
+func diagFromErr(err error) diag.Diagnostics {
+	if err == nil {
+		return nil
+	}
+
+	var failure CommandFailure
+	if !errors.As(err, &failure) {
+		return diag.FromErr(err)
+	}
+
+	class := classifyStderr(failure.output())
+	if _, ok := failure.(*SshConnectError); ok {
+		class = ErrorClass{
+			summary: "Failed to run a command on the host",
+			hint:    "Check that the host is reachable over ssh with the configured credentials, and that the command finishes within a minute.",
+		}
+	}
+
+	detail := []string{strings.TrimSpace(err.Error())}
+	if stderr := strings.TrimSpace(failure.output()); stderr != "" && !strings.Contains(detail[0], stderr) {
+		detail = append(detail, stderr)
+	}
+	if class.hint != "" {
+		detail = append(detail, class.hint)
+	}
+	if command := failure.failedCommand(); command != "" {
+		detail = append(detail, "Command: "+command)
+	}
+
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  class.summary,
+		Detail:   strings.Join(detail, "\n\n"),
+	}}
+}
+
+// PropertyApplyError reports which properties could not be applied to a resource, and which ones were applied
+// before and after them, since a failing property doesn't stop the remaining ones from being applied.
+type PropertyApplyError struct {
+	applied []string
+	failed  map[string]error
+}
+
+func (e *PropertyApplyError) Error() string {
+	names := mapKeys(e.failed)
+	sort.Strings(names)
+
+	failures := make([]string, 0, len(names))
+	for _, name := range names {
+		failures = append(failures, fmt.Sprintf("%s: %s", name, strings.TrimSpace(e.failed[name].Error())))
+	}
+
+	applied := "none"
+	if len(e.applied) > 0 {
+		sort.Strings(e.applied)
+		applied = strings.Join(e.applied, ", ")
+	}
+
+	return fmt.Sprintf("failed to apply %d of %d properties:\n%s\napplied: %s", len(e.failed), len(e.failed)+len(e.applied), strings.Join(failures, "\n"), applied)
+}
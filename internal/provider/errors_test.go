@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestClassifyStderr verifies that common zfs, zpool and sudo messages are recognized.
+func TestClassifyStderr(t *testing.T) {
+	cases := map[string]ErrorKind{
+		"cannot create 'tank/a': permission denied":                                    ErrorKindPermissionDenied,
+		"sudo: a password is required":                                                 ErrorKindPermissionDenied,
+		"cannot open 'tank': no such pool":                                             ErrorKindNoSuchPool,
+		"/dev/sdb is in use and contains a unknown filesystem.":                        ErrorKindDeviceInUse,
+		"/dev/sdc is part of exported pool 'old'":                                      ErrorKindDeviceInUse,
+		"cannot create 'tank/vm': out of space":                                        ErrorKindOutOfSpace,
+		"cannot set property for 'tank': operation not supported on this type of pool": ErrorKindNotSupported,
+		"cannot destroy 'tank/a': dataset is busy":                                     ErrorKindBusy,
+		"something unexpected":                                                         ErrorKindUnknown,
+	}
+	for stderr, expected := range cases {
+		if kind := classifyStderr(stderr).kind; kind != expected {
+			t.Fatalf("expected %q for %q, got %q", expected, stderr, kind)
+		}
+	}
+}
+
+// TestDiagFromErr verifies that failed commands become diagnostics with a summary, a hint and the redacted command.
+func TestDiagFromErr(t *testing.T) {
+	executor := (&fakeExecutor{}).fail("zfs create", "cannot create 'tank/a': permission denied")
+	config := newFakeConfig(executor)
+	config.sudo_password = "hunter2"
+
+	_, err := callSshCommand(config, "zfs create -o org:note=hunter2 tank/a")
+	diags := diagFromErr(fmt.Errorf("failed to create tank/a: %w", err))
+	if len(diags) != 1 || diags[0].Summary != "Permission denied" {
+		t.Fatalf("unexpected diagnostics %#v", diags)
+	}
+	for _, fragment := range []string{"failed to create tank/a", "zfs allow", "Command: zfs create -o org:note=<redacted> tank/a"} {
+		if !strings.Contains(diags[0].Detail, fragment) {
+			t.Fatalf("expected %q in the detail, got %s", fragment, diags[0].Detail)
+		}
+	}
+	if strings.Contains(diags[0].Detail, "hunter2") {
+		t.Fatalf("expected the password to be redacted, got %s", diags[0].Detail)
+	}
+
+	if diags := diagFromErr(fmt.Errorf("plain error")); len(diags) != 1 || diags[0].Summary != "plain error" {
+		t.Fatalf("expected other errors to be passed through, got %#v", diags)
+	}
+}
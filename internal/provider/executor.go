@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appleboy/easyssh-proxy"
+)
+
+// Executor runs shell commands on the host managed by the provider. All zfs and zpool invocations
+// go through callSshCommand, which hands them to the Executor configured on the provider.
+type Executor interface {
+	// Run executes a command with stdin as its input and returns its stdout and stderr. done is false if the
+	// command timed out.
+	Run(command string, stdin string, timeout time.Duration) (stdout string, stderr string, done bool, err error)
+}
+
+// CommandNotStartedError is returned by an Executor for a command which never ran on the host, e.g. because the
+// connection to it couldn't be established, so it is safe to run it again whatever it does.
+type CommandNotStartedError struct {
+	inner error
+}
+
+func (e *CommandNotStartedError) Error() string {
+	return e.inner.Error()
+}
+
+func (e *CommandNotStartedError) Unwrap() error {
+	return e.inner
+}
+
+// sshExecutor runs commands over ssh.
+type sshExecutor struct {
+	ssh *easyssh.MakeConfig
+}
+
+// Run runs the command in a session of its own. Unlike easyssh's Run, it can feed the command input on stdin, so
+// secrets such as the sudo password don't have to be part of the command, which the host shows in its process list.
+func (e *sshExecutor) Run(command string, stdin string, timeout time.Duration) (string, string, bool, error) {
+	session, client, err := e.ssh.Connect()
+	if err != nil {
+		return "", "", false, &CommandNotStartedError{inner: err}
+	}
+	defer client.Close()
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = strings.NewReader(stdin)
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Start(command); err != nil {
+		return "", "", false, &CommandNotStartedError{inner: err}
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- session.Wait() }()
+
+	select {
+	case err := <-result:
+		return joinOutputLines(stdout.String()), joinOutputLines(stderr.String()), true, err
+	case <-time.After(timeout):
+		// Closing the connection ends Wait, after which the output is no longer written to.
+		client.Close()
+		<-result
+		return joinOutputLines(stdout.String()), joinOutputLines(stderr.String()), false, fmt.Errorf("command timed out after %s", timeout)
+	}
+}
+
+// joinOutputLines drops the empty lines of the output of a command and ends every other line with a newline, like
+// easyssh does, which the parsers of the output were written against.
+func joinOutputLines(output string) string {
+	var joined strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			joined.WriteString(line + "\n")
+		}
+	}
+	return joined.String()
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeResponse struct {
+	prefix string
+	stdout string
+	stderr string
+}
+
+// fakeExecutor records the commands it is asked to run, and answers them with canned output
+// from the first response whose prefix matches. Commands without a response fail.
+type fakeExecutor struct {
+	mu        sync.Mutex
+	commands  []string
+	responses []fakeResponse
+}
+
+func (f *fakeExecutor) on(prefix string, stdout string) *fakeExecutor {
+	f.responses = append(f.responses, fakeResponse{prefix: prefix, stdout: stdout})
+	return f
+}
+
+func (f *fakeExecutor) fail(prefix string, stderr string) *fakeExecutor {
+	f.responses = append(f.responses, fakeResponse{prefix: prefix, stderr: stderr})
+	return f
+}
+
+func (f *fakeExecutor) Run(command string, stdin string, timeout time.Duration) (string, string, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	command = strings.TrimSpace(command)
+	f.commands = append(f.commands, command)
+
+	for _, response := range f.responses {
+		if strings.HasPrefix(command, response.prefix) {
+			return response.stdout, response.stderr, true, nil
+		}
+	}
+	return "", "unexpected command: " + command, true, nil
+}
+
+// ran reports whether a command starting with prefix was run.
+func (f *fakeExecutor) ran(prefix string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, command := range f.commands {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func newFakeConfig(executor *fakeExecutor) *Config {
+	return &Config{
+		json_output: JsonOutputNever,
+		platform:    PlatformLinux,
+		secrets:     newSecretSet(),
+		executor:    executor,
+	}
+}
+
+// TestJoinOutputLines verifies the output of commands is trimmed of empty lines the way easyssh trims it.
+func TestJoinOutputLines(t *testing.T) {
+	cases := map[string]string{
+		"":                  "",
+		"tank\n":            "tank\n",
+		"tank\n\ntank/data": "tank\ntank/data\n",
+		"\n0\n--\n":         "0\n--\n",
+	}
+	for output, expected := range cases {
+		if joined := joinOutputLines(output); joined != expected {
+			t.Fatalf("joinOutputLines(%q): expected %q, got %q", output, expected, joined)
+		}
+	}
+}
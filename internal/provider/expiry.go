@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// expiresAtProperty is the user property holding the expiry time of a dataset.
+const expiresAtProperty = "terraform:expires_at"
+
+var expiresAtSchema = schema.Schema{
+	Description:      "Time after which the dataset may be destroyed by `zfs_expired_dataset_cleanup`, in RFC 3339 format, e.g. `2024-01-31T00:00:00Z`. Stored in the `terraform:expires_at` user property.",
+	Type:             schema.TypeString,
+	Optional:         true,
+	ValidateDiagFunc: validation.ToDiagFunc(validation.IsRFC3339Time),
+}
+
+type ExpiringDataset struct {
+	name      string
+	expiresAt time.Time
+}
+
+// parseExpiringDatasets parses the name and value of the expiry property of each dataset. Datasets with
+// an expiry which can't be parsed are skipped, so they are never destroyed by accident.
+func parseExpiringDatasets(output string) ([]ExpiringDataset, error) {
+	datasets := make([]ExpiringDataset, 0)
+
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.Comma = '\t'
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if line[1] == "-" {
+			continue
+		}
+
+		expiresAt, err := time.Parse(time.RFC3339, line[1])
+		if err != nil {
+			log.Printf("[WARN] ignoring invalid %s of %s: %s", expiresAtProperty, line[0], err)
+			continue
+		}
+
+		datasets = append(datasets, ExpiringDataset{name: line[0], expiresAt: expiresAt})
+	}
+
+	return datasets, nil
+}
+
+// listExpiringDatasets lists the datasets below parent which have an expiry set, or all datasets if parent is empty.
+// Only local values are listed, as descendents inherit the expiry of their parent.
+func listExpiringDatasets(config *Config, parent string) ([]ExpiringDataset, error) {
+	target := ""
+	if parent != "" {
+		target = "-r " + shellescape.Quote(parent)
+	}
+
+	stdout, err := callSshCommand(config, "zfs get -H -s local -t filesystem,volume -o name,value %s %s", expiresAtProperty, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseExpiringDatasets(stdout)
+}
+
+// expiredDatasets returns the datasets which expired at or before now, sorted by name.
+func expiredDatasets(datasets []ExpiringDataset, now time.Time) []ExpiringDataset {
+	expired := make([]ExpiringDataset, 0)
+	for _, dataset := range datasets {
+		if !dataset.expiresAt.After(now) {
+			expired = append(expired, dataset)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].name < expired[j].name })
+	return expired
+}
+
+// outermostDatasets drops the datasets which are descendents of another dataset in the list, since
+// destroying the ancestor recursively destroys them as well. The names must be sorted.
+func outermostDatasets(names []string) []string {
+	outermost := make([]string, 0, len(names))
+	for _, name := range names {
+		if len(outermost) > 0 && strings.HasPrefix(name, outermost[len(outermost)-1]+"/") {
+			continue
+		}
+		outermost = append(outermost, name)
+	}
+	return outermost
+}
+
+// addExpiresAtProperty adds the configured expiry to a set of properties.
+func addExpiresAtProperty(d *schema.ResourceData, properties map[string]string) {
+	if expiresAt := d.Get("expires_at").(string); expiresAt != "" {
+		properties[expiresAtProperty] = expiresAt
+	}
+}
+
+// resetExpiresAtProperty removes the expiry property from a dataset once expires_at is removed from the configuration.
+func resetExpiresAtProperty(config *Config, d *schema.ResourceData, datasetName string) error {
+	oldValue, newValue := d.GetChange("expires_at")
+	if oldValue.(string) == "" || newValue.(string) != "" {
+		return nil
+	}
+
+	_, err := callSshCommand(config, "zfs inherit %s %s", expiresAtProperty, datasetName)
+	return err
+}
+
+func updateExpiresAtInState(d *schema.ResourceData, properties map[string]Property) error {
+	expiresAt := ""
+	if property, ok := properties[expiresAtProperty]; ok && property.source == SourceLocal {
+		expiresAt = property.value
+	}
+	return d.Set("expires_at", expiresAt)
+}
@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestExpiredDatasets verifies that only datasets with a valid expiry in the past are reported, sorted by name.
+func TestExpiredDatasets(t *testing.T) {
+	datasets, err := parseExpiringDatasets("tank/ci/b\t2023-10-01T00:00:00Z\n" +
+		"tank/ci/a\t2023-10-15T12:00:00+02:00\n" +
+		"tank/ci/c\t2023-11-01T00:00:00Z\n" +
+		"tank/ci/d\tnext tuesday\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(datasets) != 3 {
+		t.Fatalf("expected the invalid expiry to be skipped, got %v", datasets)
+	}
+
+	names := make([]string, 0)
+	for _, dataset := range expiredDatasets(datasets, time.Date(2023, 10, 15, 10, 0, 0, 0, time.UTC)) {
+		names = append(names, dataset.name)
+	}
+	if expected := []string{"tank/ci/a", "tank/ci/b"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+}
+
+// TestOutermostDatasets verifies that descendents of listed datasets are dropped, but not datasets sharing a name prefix.
+func TestOutermostDatasets(t *testing.T) {
+	names := outermostDatasets([]string{"tank/ci", "tank/ci/a", "tank/ci/a/b", "tank/ci2", "tank/scratch"})
+	if expected := []string{"tank/ci", "tank/ci2", "tank/scratch"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+}
+
+// TestResourceExpiredDatasetCleanupCreate verifies that expired descendents are destroyed before their ancestor.
+func TestResourceExpiredDatasetCleanupCreate(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -H -s local -t filesystem,volume -o name,value terraform:expires_at -r tank/ci",
+			"tank/ci/job\t2000-01-01T00:00:00Z\ntank/ci/job/cache\t2000-01-01T00:00:00Z\ntank/ci/next\t2999-01-01T00:00:00Z\n").
+		on("zfs destroy", "")
+
+	d := schema.TestResourceDataRaw(t, resourceExpiredDatasetCleanup().Schema, map[string]interface{}{"parent": "tank/ci"})
+	if diags := resourceExpiredDatasetCleanupCreate(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	destroyed := []interface{}{"tank/ci/job/cache", "tank/ci/job"}
+	if !reflect.DeepEqual(d.Get("destroyed").([]interface{}), destroyed) {
+		t.Fatalf("expected %v to be destroyed, got %v", destroyed, d.Get("destroyed"))
+	}
+	if executor.ran("zfs destroy tank/ci/next") {
+		t.Fatalf("destroyed a dataset which has not expired yet")
+	}
+}
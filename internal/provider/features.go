@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// bootPoolCompatibility is the compatibility file used for pools created with boot_pool, which
+// limits features to those grub can read. zfsbootmenu can read these pools as well.
+const bootPoolCompatibility = "grub2"
+
+// compatibilityDirectories are searched for compatibility files, in the same order zpool does.
+var compatibilityDirectories = []string{"/etc/zfs/compatibility.d", "/usr/share/zfs/compatibility.d"}
+
+// parseCompatibilityFile returns the features listed in a compatibility file. Features are separated
+// by whitespace or commas, and anything after a # is a comment.
+func parseCompatibilityFile(content string) []string {
+	features := make([]string, 0)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.SplitN(line, "#", 2)[0]
+		for _, feature := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// readCompatibilityFeatures reads the features allowed by the compatibility property of a pool. The
+// property can list several files separated by commas, in which case only features in all of them are
+// allowed. ok is false when the property doesn't restrict features, i.e. it is "off" or "legacy".
+func readCompatibilityFeatures(config *Config, compatibility string) ([]string, bool, error) {
+	if compatibility == "off" || compatibility == "legacy" || compatibility == "" {
+		return nil, false, nil
+	}
+
+	var allowed []string
+	for _, name := range strings.Split(compatibility, ",") {
+		features, err := readCompatibilityFile(config, name)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if allowed == nil {
+			allowed = features
+			continue
+		}
+
+		intersection := make([]string, 0)
+		for _, feature := range allowed {
+			if contains(features, feature) {
+				intersection = append(intersection, feature)
+			}
+		}
+		allowed = intersection
+	}
+	return allowed, true, nil
+}
+
+func readCompatibilityFile(config *Config, name string) ([]string, error) {
+	for _, directory := range compatibilityDirectories {
+		stdout, err := callSshCommand(config, "cat %s/%s 2>/dev/null || true", directory, shellescape.Quote(name))
+		if err != nil {
+			return nil, err
+		}
+		if stdout != "" {
+			return parseCompatibilityFile(stdout), nil
+		}
+	}
+	return nil, fmt.Errorf("compatibility file %s not found in %s", name, strings.Join(compatibilityDirectories, " or "))
+}
+
+// incompatibleFeatures returns the enabled or active features of a pool which are not in allowed.
+func incompatibleFeatures(properties map[string]Property, allowed []string) []string {
+	incompatible := make([]string, 0)
+	for name, property := range properties {
+		feature := strings.TrimPrefix(name, "feature@")
+		if feature == name || property.value == "disabled" {
+			continue
+		}
+		if !contains(allowed, feature) {
+			incompatible = append(incompatible, feature)
+		}
+	}
+	sort.Strings(incompatible)
+	return incompatible
+}
+
+// Modes of feature_upgrade, which decide whether features of an existing pool may be enabled.
+const (
+	FeatureUpgradeNone   = "none"
+	FeatureUpgradeListed = "listed"
+	FeatureUpgradeAll    = "all"
+)
+
+var featureUpgradeModes = []string{FeatureUpgradeNone, FeatureUpgradeListed, FeatureUpgradeAll}
+
+// featureStatePattern matches the states a feature can be configured with.
+var featureStatePattern = regexp.MustCompile(`^(enabled|disabled)$`)
+
+// featureStates returns the state of every feature of a pool, i.e. disabled, enabled or active, by feature name.
+func featureStates(properties map[string]Property) map[string]string {
+	states := make(map[string]string)
+	for name, property := range properties {
+		if feature := strings.TrimPrefix(name, "feature@"); feature != name {
+			states[feature] = property.value
+		}
+	}
+	return states
+}
+
+// configuredFeatureStates returns the state of the configured features, in the terms of the features attribute:
+// active features are enabled features which are in use, so they are reported as enabled. Features this version
+// of zfs doesn't know about are left out.
+func configuredFeatureStates(configured map[string]interface{}, states map[string]string) map[string]string {
+	result := make(map[string]string)
+	for feature := range configured {
+		state, ok := states[feature]
+		if !ok {
+			continue
+		}
+		if state == "active" {
+			state = "enabled"
+		}
+		result[feature] = state
+	}
+	return result
+}
+
+// upgradableFeatures returns the disabled features of a pool which zpool upgrade would enable, i.e. those
+// allowed by its compatibility setting.
+func upgradableFeatures(properties map[string]Property, allowed []string, restricted bool) []string {
+	upgradable := make([]string, 0)
+	for feature, state := range featureStates(properties) {
+		if state == "disabled" && (!restricted || contains(allowed, feature)) {
+			upgradable = append(upgradable, feature)
+		}
+	}
+	sort.Strings(upgradable)
+	return upgradable
+}
+
+// checkFeatureChanges returns an error if a change of the features attribute of an existing pool can't be applied.
+// Features can never be disabled once enabled, and are only enabled when feature_upgrade allows it.
+func checkFeatureChanges(oldFeatures map[string]interface{}, newFeatures map[string]interface{}, mode string) error {
+	features := make([]string, 0, len(newFeatures))
+	for feature := range newFeatures {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+
+	for _, feature := range features {
+		oldState, _ := oldFeatures[feature].(string)
+		switch newFeatures[feature].(string) {
+		case "disabled":
+			if oldState == "enabled" {
+				return fmt.Errorf("feature %s is enabled on the pool, e.g. by zpool upgrade, and features can't be disabled again. Set it to enabled instead", feature)
+			}
+			if mode == FeatureUpgradeAll {
+				return fmt.Errorf("feature %s is configured as disabled, but feature_upgrade = \"all\" enables every feature", feature)
+			}
+		case "enabled":
+			if oldState != "enabled" && mode == FeatureUpgradeNone {
+				return fmt.Errorf("enabling feature %s on an existing pool can't be undone, so it requires feature_upgrade to be \"listed\" or \"all\"", feature)
+			}
+		}
+	}
+	return nil
+}
+
+// enableFeatures enables features of an existing pool. This can't be undone, and may make the pool unimportable
+// by older versions of zfs or bootloaders.
+func enableFeatures(ctx context.Context, config *Config, poolName string, features []string) error {
+	for _, feature := range features {
+		if _, err := callSshCommandContext(ctx, config, "zpool set %s=enabled %s", shellescape.Quote("feature@"+feature), poolName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradePool enables every feature of a pool allowed by its compatibility setting.
+func upgradePool(ctx context.Context, config *Config, poolName string) error {
+	_, err := callSshCommandContext(ctx, config, "zpool upgrade %s", poolName)
+	return err
+}
+
+// newlyEnabledFeatures returns the features which the features attribute enables, but which weren't enabled before.
+func newlyEnabledFeatures(oldFeatures map[string]interface{}, newFeatures map[string]interface{}) []string {
+	enabled := make([]string, 0)
+	for feature, state := range newFeatures {
+		if state.(string) == "enabled" && oldFeatures[feature] != "enabled" {
+			enabled = append(enabled, feature)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
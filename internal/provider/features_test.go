@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// TestParseCompatibilityFile verifies that features are read from compatibility files, skipping comments.
+func TestParseCompatibilityFile(t *testing.T) {
+	content := `# Features supported by GRUB
+async_destroy
+bookmarks, embedded_data
+empty_bpobj # trailing comment
+`
+
+	expected := []string{"async_destroy", "bookmarks", "embedded_data", "empty_bpobj"}
+	if features := parseCompatibilityFile(content); !reflect.DeepEqual(features, expected) {
+		t.Fatalf("expected %v, got %v", expected, features)
+	}
+}
+
+// TestIncompatibleFeatures verifies that only enabled or active features outside the allowed set are reported.
+func TestIncompatibleFeatures(t *testing.T) {
+	properties := map[string]Property{
+		"feature@async_destroy": {value: "enabled"},
+		"feature@encryption":    {value: "active"},
+		"feature@zstd_compress": {value: "enabled"},
+		"feature@draid":         {value: "disabled"},
+		"compatibility":         {value: "grub2"},
+	}
+
+	expected := []string{"encryption", "zstd_compress"}
+	if incompatible := incompatibleFeatures(properties, []string{"async_destroy"}); !reflect.DeepEqual(incompatible, expected) {
+		t.Fatalf("expected %v, got %v", expected, incompatible)
+	}
+}
+
+// TestReadCompatibilityFeatures verifies that several compatibility files only allow the features they have in common.
+func TestReadCompatibilityFeatures(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("cat /etc/zfs/compatibility.d/grub2", "").
+		on("cat /usr/share/zfs/compatibility.d/grub2", "async_destroy\nbookmarks\nlz4_compress").
+		on("cat /etc/zfs/compatibility.d/custom", "bookmarks lz4_compress zstd_compress")
+
+	allowed, restricted, err := readCompatibilityFeatures(newFakeConfig(executor), "grub2,custom")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{"bookmarks", "lz4_compress"}
+	if !restricted || !reflect.DeepEqual(allowed, expected) {
+		t.Fatalf("expected %v, got %v (restricted: %t)", expected, allowed, restricted)
+	}
+
+	if _, restricted, _ := readCompatibilityFeatures(newFakeConfig(executor), "off"); restricted {
+		t.Fatalf("expected compatibility=off not to restrict features")
+	}
+}
+
+// TestUpgradableFeatures verifies that only disabled features allowed by the compatibility setting are upgradable.
+func TestUpgradableFeatures(t *testing.T) {
+	properties := map[string]Property{
+		"feature@async_destroy": {value: "enabled"},
+		"feature@encryption":    {value: "disabled"},
+		"feature@zstd_compress": {value: "disabled"},
+		"feature@block_cloning": {value: "disabled"},
+	}
+
+	expected := []string{"block_cloning", "encryption", "zstd_compress"}
+	if upgradable := upgradableFeatures(properties, nil, false); !reflect.DeepEqual(upgradable, expected) {
+		t.Fatalf("expected %v, got %v", expected, upgradable)
+	}
+
+	expected = []string{"zstd_compress"}
+	if upgradable := upgradableFeatures(properties, []string{"async_destroy", "zstd_compress"}, true); !reflect.DeepEqual(upgradable, expected) {
+		t.Fatalf("expected %v, got %v", expected, upgradable)
+	}
+}
+
+// TestConfiguredFeatureStates verifies that active features are reported as enabled, and unknown features are left out.
+func TestConfiguredFeatureStates(t *testing.T) {
+	configured := map[string]interface{}{"encryption": "enabled", "block_cloning": "disabled", "unknown": "enabled"}
+	states := map[string]string{"encryption": "active", "block_cloning": "disabled", "async_destroy": "enabled"}
+
+	expected := map[string]string{"encryption": "enabled", "block_cloning": "disabled"}
+	if result := configuredFeatureStates(configured, states); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+}
+
+// TestCheckFeatureChanges verifies that features are only enabled when feature_upgrade allows it, and never disabled.
+func TestCheckFeatureChanges(t *testing.T) {
+	disabled := map[string]interface{}{"encryption": "disabled"}
+	enabled := map[string]interface{}{"encryption": "enabled"}
+
+	for _, test := range []struct {
+		old   map[string]interface{}
+		new   map[string]interface{}
+		mode  string
+		valid bool
+	}{
+		{disabled, enabled, FeatureUpgradeNone, false},
+		{disabled, enabled, FeatureUpgradeListed, true},
+		{disabled, enabled, FeatureUpgradeAll, true},
+		{enabled, disabled, FeatureUpgradeListed, false},
+		{disabled, disabled, FeatureUpgradeAll, false},
+		{enabled, enabled, FeatureUpgradeNone, true},
+	} {
+		err := checkFeatureChanges(test.old, test.new, test.mode)
+		if (err == nil) != test.valid {
+			t.Fatalf("checkFeatureChanges(%v, %v, %s): expected valid=%t, got %v", test.old, test.new, test.mode, test.valid, err)
+		}
+	}
+}
+
+// TestEnableListedFeatures verifies that only features which weren't enabled yet are set.
+func TestEnableListedFeatures(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zpool set", "")
+
+	features := newlyEnabledFeatures(
+		map[string]interface{}{"encryption": "enabled", "zstd_compress": "disabled"},
+		map[string]interface{}{"encryption": "enabled", "zstd_compress": "enabled", "block_cloning": "enabled"},
+	)
+	if err := enableFeatures(context.Background(), newFakeConfig(executor), "tank", features); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{"zpool set feature@block_cloning=enabled tank", "zpool set feature@zstd_compress=enabled tank"}
+	if !reflect.DeepEqual(executor.commands, expected) {
+		t.Fatalf("expected %v, got %v", expected, executor.commands)
+	}
+}
@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// ProviderFunction is a provider-defined function, callable from configurations as provider::zfs::<name>.
+// Arguments are passed in the order and with the types of the parameters of its definition.
+type ProviderFunction struct {
+	definition *tfprotov5.Function
+	call       func(arguments []tftypes.Value) (tftypes.Value, *tfprotov5.FunctionError)
+}
+
+var providerFunctions = map[string]ProviderFunction{
+	"parse_size": {
+		definition: &tfprotov5.Function{
+			Summary:         "Parse a size into bytes",
+			Description:     "Parses a zfs style size such as `1.5T`, `512K` or `100G` into a number of bytes. Units are powers of 1024, and an optional trailing `B` or `iB` is accepted.",
+			DescriptionKind: tfprotov5.StringKindMarkdown,
+			Parameters: []*tfprotov5.FunctionParameter{
+				{Name: "size", Type: tftypes.String, Description: "The size to parse, e.g. `1.5T`."},
+			},
+			Return: &tfprotov5.FunctionReturn{Type: tftypes.Number},
+		},
+		call: callParseSize,
+	},
+	"format_size": {
+		definition: &tfprotov5.Function{
+			Summary:         "Format a number of bytes as a size",
+			Description:     "Formats a number of bytes as a zfs style size such as `1.5T`, using the largest unit which keeps the value at least 1, rounded to two decimals. The result can be used as the value of size properties such as `quota` or `volsize`.",
+			DescriptionKind: tfprotov5.StringKindMarkdown,
+			Parameters: []*tfprotov5.FunctionParameter{
+				{Name: "bytes", Type: tftypes.Number, Description: "The number of bytes to format."},
+			},
+			Return: &tfprotov5.FunctionReturn{Type: tftypes.String},
+		},
+		call: callFormatSize,
+	},
+	"snapshot_name": {
+		definition: &tfprotov5.Function{
+			Summary:         "Build a snapshot name from a timestamp",
+			Description:     "Builds the full name of a snapshot of `dataset`, named after `timestamp` formatted with `format`. The timestamp is an RFC 3339 timestamp as returned by `timestamp()` or `plantimestamp()`. The format uses strftime style directives: `%Y`, `%m`, `%d`, `%H`, `%M`, `%S`, `%y`, `%j`, `%s`, `%F` (`%Y-%m-%d`), `%T` (`%H:%M:%S`) and `%%`, e.g. `auto-%Y-%m-%d_%H-%M`.",
+			DescriptionKind: tfprotov5.StringKindMarkdown,
+			Parameters: []*tfprotov5.FunctionParameter{
+				{Name: "dataset", Type: tftypes.String, Description: "Name of the dataset, e.g. `tank/data`."},
+				{Name: "timestamp", Type: tftypes.String, Description: "RFC 3339 timestamp, e.g. `2023-10-15T12:00:00Z`."},
+				{Name: "format", Type: tftypes.String, Description: "Format of the snapshot name after the `@`."},
+			},
+			Return: &tfprotov5.FunctionReturn{Type: tftypes.String},
+		},
+		call: callSnapshotName,
+	},
+}
+
+// functionArgumentError is an error about the argument at the given position.
+func functionArgumentError(position int64, format string, args ...interface{}) *tfprotov5.FunctionError {
+	return &tfprotov5.FunctionError{Text: fmt.Sprintf(format, args...), FunctionArgument: &position}
+}
+
+func callParseSize(arguments []tftypes.Value) (tftypes.Value, *tfprotov5.FunctionError) {
+	var size string
+	if err := arguments[0].As(&size); err != nil {
+		return tftypes.Value{}, functionArgumentError(0, "%s", err)
+	}
+
+	bytes, err := parseSize(size)
+	if err != nil {
+		return tftypes.Value{}, functionArgumentError(0, "%s", err)
+	}
+	return tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(bytes)), nil
+}
+
+func callFormatSize(arguments []tftypes.Value) (tftypes.Value, *tfprotov5.FunctionError) {
+	var bytes big.Float
+	if err := arguments[0].As(&bytes); err != nil {
+		return tftypes.Value{}, functionArgumentError(0, "%s", err)
+	}
+
+	value, _ := bytes.Float64()
+	if value < 0 {
+		return tftypes.Value{}, functionArgumentError(0, "expected a number of bytes of at least 0, got %s", bytes.String())
+	}
+	return tftypes.NewValue(tftypes.String, formatSize(value)), nil
+}
+
+func callSnapshotName(arguments []tftypes.Value) (tftypes.Value, *tfprotov5.FunctionError) {
+	values := make([]string, len(arguments))
+	for i, argument := range arguments {
+		if err := argument.As(&values[i]); err != nil {
+			return tftypes.Value{}, functionArgumentError(int64(i), "%s", err)
+		}
+	}
+	dataset, timestamp, format := values[0], values[1], values[2]
+
+	if dataset == "" || strings.ContainsAny(dataset, "@#") {
+		return tftypes.Value{}, functionArgumentError(0, "expected the name of a filesystem or volume, got %q", dataset)
+	}
+
+	at, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return tftypes.Value{}, functionArgumentError(1, "expected an RFC 3339 timestamp, got %q", timestamp)
+	}
+
+	name, err := formatStrftime(format, at)
+	if err != nil {
+		return tftypes.Value{}, functionArgumentError(2, "%s", err)
+	}
+	if !snapshotPrefixPattern.MatchString(name) {
+		return tftypes.Value{}, functionArgumentError(2, "snapshot name %q may only contain letters, digits and the characters _.:-", name)
+	}
+	return tftypes.NewValue(tftypes.String, dataset+"@"+name), nil
+}
+
+// sizeUnits are the units of formatSize, each 1024 times the previous.
+var sizeUnits = []string{"", "K", "M", "G", "T", "P", "E"}
+
+// formatSize formats a number of bytes the way parseSize parses them, e.g. 1649267441664 as "1.5T".
+func formatSize(bytes float64) string {
+	unit := 0
+	for bytes >= 1024 && unit < len(sizeUnits)-1 {
+		bytes /= 1024
+		unit++
+	}
+	value := strconv.FormatFloat(bytes, 'f', 2, 64)
+	value = strings.TrimRight(strings.TrimRight(value, "0"), ".")
+	return value + sizeUnits[unit]
+}
+
+// formatStrftime formats a time with a strftime style format, supporting the directives which make sense in snapshot names.
+func formatStrftime(format string, t time.Time) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+		if i+1 == len(format) {
+			return "", fmt.Errorf("format %q ends with an incomplete directive", format)
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			out.WriteString(t.Format("2006"))
+		case 'm':
+			out.WriteString(t.Format("01"))
+		case 'd':
+			out.WriteString(t.Format("02"))
+		case 'H':
+			out.WriteString(t.Format("15"))
+		case 'M':
+			out.WriteString(t.Format("04"))
+		case 'S':
+			out.WriteString(t.Format("05"))
+		case 'y':
+			out.WriteString(t.Format("06"))
+		case 'j':
+			out.WriteString(t.Format("002"))
+		case 's':
+			out.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'F':
+			out.WriteString(t.Format("2006-01-02"))
+		case 'T':
+			out.WriteString(t.Format("15:04:05"))
+		case '%':
+			out.WriteByte('%')
+		default:
+			return "", fmt.Errorf("unsupported directive %%%c in format %q", format[i], format)
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// callTestFunction calls a provider function through the protocol server, like Terraform does.
+func callTestFunction(t *testing.T, name string, returnType tftypes.Type, arguments ...tftypes.Value) (tftypes.Value, *tfprotov5.FunctionError) {
+	dynamicArguments := make([]*tfprotov5.DynamicValue, 0, len(arguments))
+	for _, argument := range arguments {
+		value, err := tfprotov5.NewDynamicValue(argument.Type(), argument)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		dynamicArguments = append(dynamicArguments, &value)
+	}
+
+	resp, err := ProviderServer("dev")().CallFunction(context.Background(), &tfprotov5.CallFunctionRequest{Name: name, Arguments: dynamicArguments})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resp.Error != nil {
+		return tftypes.Value{}, resp.Error
+	}
+
+	result, err := resp.Result.Unmarshal(returnType)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return result, nil
+}
+
+// TestFunctionParseSize verifies sizes are parsed into bytes, and invalid sizes point at the argument.
+func TestFunctionParseSize(t *testing.T) {
+	result, funcErr := callTestFunction(t, "parse_size", tftypes.Number, tftypes.NewValue(tftypes.String, "1.5T"))
+	if funcErr != nil {
+		t.Fatalf("unexpected error: %s", funcErr.Text)
+	}
+	var bytes big.Float
+	if err := result.As(&bytes); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if value, _ := bytes.Int64(); value != 1649267441664 {
+		t.Fatalf("unexpected result %s", bytes.String())
+	}
+
+	_, funcErr = callTestFunction(t, "parse_size", tftypes.Number, tftypes.NewValue(tftypes.String, "lots"))
+	if funcErr == nil || funcErr.FunctionArgument == nil || *funcErr.FunctionArgument != 0 {
+		t.Fatalf("expected an error about the first argument, got %#v", funcErr)
+	}
+}
+
+// TestFormatSize verifies sizes are formatted with the largest fitting unit, and parse back into the same size.
+func TestFormatSize(t *testing.T) {
+	for bytes, expected := range map[float64]string{0: "0", 512: "512", 1536: "1.5K", 1649267441664: "1.5T", 10 * (1 << 30): "10G"} {
+		if got := formatSize(bytes); got != expected {
+			t.Fatalf("formatSize(%v): expected %q, got %q", bytes, expected, got)
+		}
+		if parsed, err := parseSize(expected); err != nil || float64(parsed) != bytes {
+			t.Fatalf("parseSize(%q): expected %v, got %v, %v", expected, bytes, parsed, err)
+		}
+	}
+}
+
+// TestFunctionSnapshotName verifies snapshot names are built from strftime style formats, and rejected
+// when the format produces characters which aren't allowed in snapshot names.
+func TestFunctionSnapshotName(t *testing.T) {
+	result, funcErr := callTestFunction(t, "snapshot_name", tftypes.String,
+		tftypes.NewValue(tftypes.String, "tank/data"),
+		tftypes.NewValue(tftypes.String, "2023-10-15T12:34:56Z"),
+		tftypes.NewValue(tftypes.String, "auto-%F_%H-%M"),
+	)
+	if funcErr != nil {
+		t.Fatalf("unexpected error: %s", funcErr.Text)
+	}
+	var name string
+	if err := result.As(&name); err != nil || name != "tank/data@auto-2023-10-15_12-34" {
+		t.Fatalf("unexpected result %q, %v", name, err)
+	}
+
+	_, funcErr = callTestFunction(t, "snapshot_name", tftypes.String,
+		tftypes.NewValue(tftypes.String, "tank/data"),
+		tftypes.NewValue(tftypes.String, "2023-10-15T12:34:56Z"),
+		tftypes.NewValue(tftypes.String, "daily %Y"),
+	)
+	if funcErr == nil || *funcErr.FunctionArgument != 2 {
+		t.Fatalf("expected an error about the format, got %#v", funcErr)
+	}
+}
+
+// TestFormatStrftime verifies the supported directives and that unsupported ones are rejected.
+func TestFormatStrftime(t *testing.T) {
+	at := time.Date(2023, 2, 3, 4, 5, 6, 0, time.UTC)
+	got, err := formatStrftime("%Y%m%d-%T-%j-%s-%%", at)
+	if err != nil || got != "20230203-04:05:06-034-1675397106-%" {
+		t.Fatalf("unexpected result %q, %v", got, err)
+	}
+
+	if _, err := formatStrftime("%Q", at); err == nil {
+		t.Fatalf("expected an error for an unsupported directive")
+	}
+}
@@ -1,42 +1,204 @@
 package provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
+// callSshCommand runs a command without a deadline. It logs through the context the provider was configured with, as
+// most callers have no context of their own.
 func callSshCommand(config *Config, cmd string, args ...interface{}) (string, error) {
+	ctx := config.log_context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return callSshCommandContext(ctx, config, cmd, args...)
+}
+
+// callSshCommandContext runs a command, retrying transient failures such as busy pools or datasets
+// up to retry_max_attempts times, with a backoff which doubles after every attempt. Retries stop
+// early once the context is done, e.g. because the timeout of the resource operation has passed.
+func callSshCommandContext(ctx context.Context, config *Config, cmd string, args ...interface{}) (string, error) {
 	cmd = fmt.Sprintf(cmd, args...)
-	log.Printf("[DEBUG] ssh command: %s %s", config.command_prefix, cmd)
-	stdout, stderr, done, err := config.ssh.Run(config.command_prefix+" "+cmd, 60*time.Second)
+	backoff := config.retry_backoff
+
+	for attempt := 1; ; attempt++ {
+		queued := time.Now()
+		release, err := config.limiter.acquire(ctx, cmd)
+		if err != nil {
+			return "", err
+		}
+		started := time.Now()
+		stdout, err := runSshCommand(ctx, config, cmd)
+		release()
+		config.metrics.record(cmd, started.Sub(queued), time.Since(started), err)
+		if pool := commandPool(cmd); pool != "" {
+			config.property_cache.invalidate(pool)
+		}
+		if err == nil || !isTransientError(err) || attempt >= config.retry_max_attempts {
+			return stdout, err
+		}
+
+		log.Printf("[DEBUG] attempt %d of %d failed, retrying in %s: %s", attempt, config.retry_max_attempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// defaultCommandTimeout bounds commands run without a deadline, e.g. through callSshCommand.
+const defaultCommandTimeout = 60 * time.Second
+
+// minCommandTimeout is the least time a command gets, so a command started just before the deadline can still finish.
+const minCommandTimeout = 5 * time.Second
+
+// errCommandTimedOut is the inner error of a SshConnectError for a command which didn't finish in time. Unlike other
+// connection errors it isn't retried, as the command may still be running on the host.
+var errCommandTimedOut = errors.New("command timed out")
+
+// commandTimeout is how long a command may run: until the deadline of the context, which is the timeout of the resource
+// operation, so that e.g. a zpool create may take as long as the create timeout allows.
+func commandTimeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultCommandTimeout
+	}
+	if remaining := time.Until(deadline); remaining > minCommandTimeout {
+		return remaining
+	}
+	return minCommandTimeout
+}
+
+func runSshCommand(ctx context.Context, config *Config, cmd string) (string, error) {
+	log.Printf("[DEBUG] ssh command: %s %s", config.command_prefix, redactCommand(config, cmd))
+	started := time.Now()
+	stdout, stderr, done, err := config.executor.Run(config.command_prefix+" "+privilegedCommand(config, localizedCommand(config, cmd)), privilegedInput(config), commandTimeout(ctx))
+
+	record := newCommandRecord(config, cmd, time.Since(started), stdout, stderr, done, err)
+	logCommand(ctx, record)
+	if err := config.audit_log.record(record, time.Now()); err != nil {
+		log.Printf("[WARN] failed to write %s to the audit log: %s", record.command, err)
+	}
 
 	if stderr != "" {
-		if strings.Contains(stderr, "dataset does not exist") {
-			return "", &DatasetError{errmsg: "dataset does not exist"}
-		} else if strings.Contains(stderr, "no such pool") {
-			return "", &PoolError{errmsg: "zpool does not exist"}
-		} else {
-			return "", &StderrError{stderr: stderr}
+		switch classifyStderr(stderr).kind {
+		case ErrorKindNoSuchDataset:
+			return "", &DatasetError{errmsg: "dataset does not exist", stderr: stderr, command: redactCommand(config, cmd)}
+		case ErrorKindNoSuchPool:
+			return "", &PoolError{errmsg: "zpool does not exist", stderr: stderr, command: redactCommand(config, cmd)}
+		default:
+			return "", &StderrError{stderr: stderr, command: redactCommand(config, cmd)}
 		}
 	}
 
 	if err != nil {
-		return "", &SshConnectError{inner: err}
+		return "", &SshConnectError{inner: err, command: redactCommand(config, cmd)}
 	}
 
 	if !done {
-		return "", &SshConnectError{inner: errors.New("command timed out")}
+		return "", &SshConnectError{inner: errCommandTimedOut, command: redactCommand(config, cmd)}
 	}
 
 	return strings.TrimSuffix(stdout, "\n"), nil
 }
 
+// redactCommand hides the secrets of the provider configuration and the values of sensitive properties in a command,
+// so it can be logged and shown in diagnostics.
+func redactCommand(config *Config, cmd string) string {
+	for _, secret := range append([]string{config.sudo_password}, config.secrets.list()...) {
+		if secret != "" {
+			cmd = strings.ReplaceAll(cmd, secret, "<redacted>")
+		}
+	}
+	return cmd
+}
+
+// transientErrors are fragments of error messages which usually go away when the command is retried
+// shortly after, e.g. while a pool is busy or a hotplugged device is still settling.
+var transientErrors = []string{
+	"is busy",
+	"Device or resource busy",
+	"Resource temporarily unavailable",
+}
+
+func isTransientError(err error) bool {
+	// A command which never started is retried. One whose connection failed while it ran may already have changed the
+	// host, so it is only retried if it only reads, and never if it ran and failed, or may still be running.
+	if connectErr, ok := err.(*SshConnectError); ok {
+		var notStarted *CommandNotStartedError
+		if errors.As(connectErr.inner, &notStarted) {
+			return true
+		}
+		var exit interface{ ExitStatus() int }
+		return connectErr.inner != errCommandTimedOut && !errors.As(connectErr.inner, &exit) && isReadOnlyCommand(connectErr.command)
+	}
+
+	stderrErr, ok := err.(*StderrError)
+	if !ok {
+		return false
+	}
+
+	for _, fragment := range transientErrors {
+		if strings.Contains(stderrErr.stderr, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// localePattern matches locale names such as C, C.UTF-8, de_DE.UTF-8 or sr_RS@latin, or nothing at all.
+var localePattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]*$`)
+
+// LocaleHost keeps the locale of the host for the commands run on it.
+const LocaleHost = "host"
+
+// localizedCommand runs a command in a shell with LC_ALL set to the configured locale, so that pipes and redirections
+// use it too. The output of commands is parsed, and e.g. zfs prints sizes such as "1,5G" in a German locale.
+func localizedCommand(config *Config, cmd string) string {
+	if config.locale == "" || config.locale == LocaleHost {
+		return cmd
+	}
+	return fmt.Sprintf("env LC_ALL=%s sh -c %s", config.locale, shellescape.Quote(cmd))
+}
+
+// privilegedCommand wraps a command in sudo when use_sudo is set. The whole command runs in a shell under
+// sudo, so that redirections and pipes are privileged too. With a password, sudo reads it from stdin.
+func privilegedCommand(config *Config, cmd string) string {
+	if !config.use_sudo {
+		return cmd
+	}
+
+	if config.sudo_password == "" {
+		return "sudo -n sh -c " + shellescape.Quote(cmd)
+	}
+	return "sudo -S -p '' sh -c " + shellescape.Quote(cmd)
+}
+
+// privilegedInput is the input of a command wrapped by privilegedCommand: the sudo password, if any. It is sent on
+// the stdin of the session rather than as part of the command, as sshd runs the command through a shell whose
+// arguments every user of the host can read in the process list.
+func privilegedInput(config *Config) string {
+	if !config.use_sudo || config.sudo_password == "" {
+		return ""
+	}
+	return config.sudo_password + "\n"
+}
+
 type Ownership struct {
 	userName  string
 	groupName string
@@ -45,7 +207,15 @@ type Ownership struct {
 }
 
 func getFileOwnership(config *Config, path string) (*Ownership, error) {
-	output, err := callSshCommand(config, "stat -c '%%U,%%G,%%u,%%g' '%s'", path)
+	command := "stat -c '%%U,%%G,%%u,%%g' '%s'"
+	switch hostPlatform(config) {
+	case PlatformFreeBSD:
+		command = "stat -f '%%Su,%%Sg,%%u,%%g' '%s'"
+	case PlatformIllumos:
+		// The stat of illumos has no format option, but the distributions ship GNU coreutils.
+		command = "/usr/gnu/bin/stat -c '%%U,%%G,%%u,%%g' '%s'"
+	}
+	output, err := callSshCommand(config, command, path)
 
 	if err != nil {
 		return nil, err
@@ -71,41 +241,72 @@ func getFileOwnership(config *Config, path string) (*Ownership, error) {
 	}, nil
 }
 
-func parseVdevSpecification(mirrors interface{}, devices interface{}) string {
+func parseVdevSpecification(mirrors interface{}, devices interface{}, logs interface{}, caches interface{}) string {
 	vdevs := ""
-	if mirrors != nil {
-		for _, mirror := range mirrors.([]interface{}) {
-			devices := mirror.(map[string]interface{})["device"]
-			vdevs = vdevs + " mirror"
-			for _, device := range devices.([]interface{}) {
-				path := device.(map[string]interface{})["path"].(string)
-				vdevs = vdevs + " " + path
-			}
-		}
+	for _, mirror := range expandMirrors(mirrors) {
+		vdevs = vdevs + " mirror " + strings.Join(mirror, " ")
 	}
 
-	if devices != nil {
-		for _, device := range devices.([]interface{}) {
-			path := device.(map[string]interface{})["path"].(string)
-			vdevs = vdevs + " " + path
-		}
+	if paths := expandDevices(devices); len(paths) > 0 {
+		vdevs = vdevs + " " + strings.Join(paths, " ")
+	}
+
+	if paths := expandDevices(logs); len(paths) > 0 {
+		vdevs = vdevs + " log " + strings.Join(paths, " ")
+	}
+
+	if paths := expandDevices(caches); len(paths) > 0 {
+		vdevs = vdevs + " cache " + strings.Join(paths, " ")
 	}
 
 	log.Printf("[DEBUG] vdev specification: %s", vdevs)
 	return vdevs
 }
 
+// expandDevices converts a list of device blocks into their paths, resolving cloud volume references.
+func expandDevices(devices interface{}) []string {
+	paths := make([]string, 0)
+	if devices == nil {
+		return paths
+	}
+
+	for _, device := range devices.([]interface{}) {
+		paths = append(paths, resolveDevicePath(device.(map[string]interface{})["path"].(string)))
+	}
+	return paths
+}
+
+// parsePropertyBlocks returns the values of the property blocks, leaving out those which inherit the property.
 func parsePropertyBlocks(options []interface{}) map[string]string {
 	properties := make(map[string]string)
 
 	for _, option := range options {
 		property := option.(map[string]interface{})
-		properties[property["name"].(string)] = property["value"].(string)
+		if inherit, _ := property["inherit"].(bool); inherit {
+			continue
+		}
+		value, _ := property["value"].(string)
+		properties[property["name"].(string)] = value
 	}
 
 	return properties
 }
 
+// parseInheritBlocks returns the names of the properties whose blocks set inherit.
+func parseInheritBlocks(options []interface{}) []string {
+	names := make([]string, 0)
+
+	for _, option := range options {
+		property := option.(map[string]interface{})
+		if inherit, _ := property["inherit"].(bool); inherit {
+			names = append(names, property["name"].(string))
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
 func mapKeys[T interface{}](value map[string]T) []string {
 	keys := make([]string, 0)
 	for key := range value {
@@ -122,3 +323,135 @@ func getPropertyNames(d *schema.ResourceData) []string {
 	}
 	return names
 }
+
+// importStateWithDefaults wraps an importer so that attributes with a default get it in the imported state.
+// Attributes which are never read back from zfs (e.g. force_destroy) would otherwise be null after an import,
+// and show up as changes in the first plan. Attributes which are read back are overwritten by Read afterwards.
+func importStateWithDefaults(resource func() *schema.Resource, importer schema.StateContextFunc) schema.StateContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+		for key, attribute := range resource().Schema {
+			if attribute.Default == nil {
+				continue
+			}
+			if err := d.Set(key, attribute.Default); err != nil {
+				return nil, err
+			}
+		}
+		return importer(ctx, d, meta)
+	}
+}
+
+func expandStringSet(set *schema.Set) []string {
+	values := make([]string, 0, set.Len())
+	for _, value := range set.List() {
+		values = append(values, value.(string))
+	}
+	return values
+}
+
+func expandStringList(list []interface{}) []string {
+	values := make([]string, 0, len(list))
+	for _, value := range list {
+		values = append(values, value.(string))
+	}
+	return values
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// expandMirrors converts the mirror blocks of a pool into lists of device paths.
+func expandMirrors(mirrors interface{}) [][]string {
+	out := make([][]string, 0)
+	if mirrors == nil {
+		return out
+	}
+
+	for _, mirror := range mirrors.([]interface{}) {
+		out = append(out, expandDevices(mirror.(map[string]interface{})["device"]))
+	}
+	return out
+}
+
+// hasPrefix reports whether values starts with all of prefix, in order.
+func hasPrefix(values []string, prefix []string) bool {
+	if len(prefix) > len(values) {
+		return false
+	}
+	for i := range prefix {
+		if values[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDecimal parses a number printed by zfs, zpool or another tool on the host. Numbers are printed with a decimal
+// comma rather than a point in locales such as de_DE or fr_FR, which are accepted in case the locale isn't forced to C.
+func parseDecimal(value string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+}
+
+// parseSize parses a zfs style size such as "1.5T", "512K" or "100G" into bytes.
+// Units are powers of 1024, and an optional trailing "B" or "iB" is accepted.
+func parseSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := float64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		case 'P':
+			multiplier = 1 << 50
+		case 'E':
+			multiplier = 1 << 60
+		}
+		if multiplier != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+
+	number, err := parseDecimal(value)
+	if err != nil || number < 0 || number*multiplier >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return int64(number * multiplier), nil
+}
+
+// validateDuration checks that an attribute is a duration such as "30s" or "5m".
+var validateDuration = validation.ToDiagFunc(func(i interface{}, k string) ([]string, []error) {
+	value, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		return nil, []error{fmt.Errorf("expected %s to be a duration such as 30s or 5m, got %s", k, value)}
+	}
+	return nil, nil
+})
+
+// validateSize checks that an attribute is a size such as "512K" or "1.5T".
+var validateSize = validation.ToDiagFunc(func(i interface{}, k string) ([]string, []error) {
+	value, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if _, err := parseSize(value); err != nil {
+		return nil, []error{fmt.Errorf("expected %s to be a size such as 512K or 1.5T, got %s", k, value)}
+	}
+	return nil, nil
+})
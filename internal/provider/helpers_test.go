@@ -0,0 +1,267 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestParseSize verifies zfs style sizes are converted to bytes.
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"0":       0,
+		"512":     512,
+		"1K":      1024,
+		"1.5T":    1649267441664,
+		"100G":    107374182400,
+		"2MiB":    2097152,
+		"4gb":     4294967296,
+		" 1E ":    1152921504606846976,
+		"0.5k":    512,
+		"1048576": 1048576,
+	}
+
+	for input, expected := range cases {
+		got, err := parseSize(input)
+		if err != nil {
+			t.Fatalf("parseSize(%q) returned error: %v", input, err)
+		}
+		if got != expected {
+			t.Fatalf("parseSize(%q): expected %d, got %d", input, expected, got)
+		}
+	}
+
+	for _, input := range []string{"", "G", "-1G", "ten", "8E"} {
+		if _, err := parseSize(input); err == nil {
+			t.Fatalf("expected parseSize(%q) to fail", input)
+		}
+	}
+}
+
+// TestPrivilegedCommand verifies that commands are only wrapped in sudo when use_sudo is set, and that the password is
+// sent on stdin rather than being part of the command.
+func TestPrivilegedCommand(t *testing.T) {
+	cases := []struct {
+		config   *Config
+		expected string
+	}{
+		{&Config{}, "zpool list -H"},
+		{&Config{use_sudo: true}, "sudo -n sh -c 'zpool list -H'"},
+		{&Config{use_sudo: true, sudo_password: "it's secret"}, "sudo -S -p '' sh -c 'zpool list -H'"},
+	}
+
+	for _, c := range cases {
+		if command := privilegedCommand(c.config, "zpool list -H"); command != c.expected {
+			t.Fatalf("expected %s, got %s", c.expected, command)
+		}
+	}
+
+	executor := &flakyExecutor{}
+	config := &Config{executor: executor, use_sudo: true, sudo_password: "it's secret"}
+	if _, err := callSshCommand(config, "zpool list -H"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(executor.command, "secret") || executor.stdin != "it's secret\n" {
+		t.Fatalf("expected the password on stdin only, ran %q with input %q", executor.command, executor.stdin)
+	}
+}
+
+// TestLocalizedCommand verifies that commands run with LC_ALL set, inside sudo and after the command prefix.
+func TestLocalizedCommand(t *testing.T) {
+	executor := (&fakeExecutor{}).on("sudo", "")
+	config := newFakeConfig(executor)
+	config.command_prefix = "sudo"
+	config.locale = "C"
+
+	if _, err := callSshCommand(config, "zpool list -H | head -n 1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "sudo env LC_ALL=C sh -c 'zpool list -H | head -n 1'"; executor.commands[0] != expected {
+		t.Fatalf("expected %s, got %s", expected, executor.commands[0])
+	}
+
+	config = &Config{use_sudo: true, locale: "C.UTF-8"}
+	if command := privilegedCommand(config, localizedCommand(config, "zpool list -H")); command != `sudo -n sh -c 'env LC_ALL=C.UTF-8 sh -c '"'"'zpool list -H'"'"''` {
+		t.Fatalf("unexpected command %s", command)
+	}
+
+	config.locale = LocaleHost
+	if command := localizedCommand(config, "zpool list -H"); command != "zpool list -H" {
+		t.Fatalf("expected the locale of the host to be kept, got %s", command)
+	}
+}
+
+// TestParseDecimalLocales verifies that numbers printed with a decimal comma, as in German or French locales, are parsed.
+func TestParseDecimalLocales(t *testing.T) {
+	cases := map[string]float64{
+		"1.50": 1.5,
+		"1,50": 1.5,
+		"4,88": 4.88,
+		"12":   12,
+	}
+	for input, expected := range cases {
+		if got, err := parseDecimal(input); err != nil || got != expected {
+			t.Fatalf("parseDecimal(%q): expected %f, got %f (%v)", input, expected, got, err)
+		}
+	}
+
+	if got, err := parseSize("1,5T"); err != nil || got != 1649267441664 {
+		t.Fatalf("parseSize(\"1,5T\"): expected 1649267441664, got %d (%v)", got, err)
+	}
+	if got, err := parseErrorCount("1,2K"); err != nil || got != 1200 {
+		t.Fatalf("parseErrorCount(\"1,2K\"): expected 1200, got %d (%v)", got, err)
+	}
+	if usage, err := parsePoolUsage("10737418240\t4831838208\t5905580032\t45\t12\t1,50x"); err != nil || usage.dedupRatio != 1.5 {
+		t.Fatalf("unexpected usage %+v (%v)", usage, err)
+	}
+}
+
+// flakyExecutor fails with stderr or err for the first failures calls, and succeeds after that. It records the
+// command, input and timeout of the last call.
+type flakyExecutor struct {
+	failures int
+	stderr   string
+	err      error
+	calls    int
+	command  string
+	stdin    string
+	timeout  time.Duration
+}
+
+func (f *flakyExecutor) Run(command string, stdin string, timeout time.Duration) (string, string, bool, error) {
+	f.calls++
+	f.command, f.stdin, f.timeout = command, stdin, timeout
+	if f.calls <= f.failures {
+		return "", f.stderr, true, f.err
+	}
+	return "ok\n", "", true, nil
+}
+
+// TestCallSshCommandRetries verifies that transient errors are retried up to the maximum number of attempts, and others are not.
+func TestCallSshCommandRetries(t *testing.T) {
+	executor := &flakyExecutor{failures: 2, stderr: "cannot destroy 'tank': pool is busy"}
+	config := &Config{executor: executor, retry_max_attempts: 3, retry_backoff: time.Millisecond}
+	if stdout, err := callSshCommand(config, "zpool destroy tank"); err != nil || stdout != "ok" {
+		t.Fatalf("expected the command to succeed on the third attempt, got %q, %v", stdout, err)
+	}
+
+	executor = &flakyExecutor{failures: 3, stderr: "cannot destroy 'tank': pool is busy"}
+	config.executor = executor
+	if _, err := callSshCommand(config, "zpool destroy tank"); err == nil {
+		t.Fatalf("expected the command to fail after 3 attempts")
+	}
+	if executor.calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", executor.calls)
+	}
+
+	executor = &flakyExecutor{failures: 1, stderr: "invalid vdev specification"}
+	config.executor = executor
+	if _, err := callSshCommand(config, "zpool create tank"); err == nil || executor.calls != 1 {
+		t.Fatalf("expected a permanent error not to be retried, got %v after %d attempts", err, executor.calls)
+	}
+}
+
+// TestCallSshCommandRetriesConnectionErrors verifies that commands which never started are retried, that commands whose
+// connection dropped are only retried if they only read, and that commands which ran and failed are not retried.
+func TestCallSshCommandRetriesConnectionErrors(t *testing.T) {
+	executor := &flakyExecutor{failures: 1, err: &CommandNotStartedError{inner: errors.New("ssh: handshake failed: EOF")}}
+	config := &Config{executor: executor, retry_max_attempts: 3, retry_backoff: time.Millisecond}
+	if stdout, err := callSshCommand(config, "zpool create tank /dev/sda"); err != nil || stdout != "ok" || executor.calls != 2 {
+		t.Fatalf("expected the command to succeed on the second attempt, got %q, %v after %d attempts", stdout, err, executor.calls)
+	}
+
+	executor = &flakyExecutor{failures: 1, err: errors.New("wait: remote command exited without exit status or exit signal")}
+	config.executor = executor
+	if stdout, err := callSshCommand(config, "zpool list -H | head -n 1"); err != nil || stdout != "ok" || executor.calls != 2 {
+		t.Fatalf("expected a read to be retried, got %q, %v after %d attempts", stdout, err, executor.calls)
+	}
+
+	executor = &flakyExecutor{failures: 1, err: errors.New("wait: remote command exited without exit status or exit signal")}
+	config.executor = executor
+	if _, err := callSshCommand(config, "zfs destroy -r tank/data"); err == nil || executor.calls != 1 {
+		t.Fatalf("expected a destroy whose connection dropped not to be retried, got %v after %d attempts", err, executor.calls)
+	}
+
+	executor = &flakyExecutor{failures: 1, err: &fakeExitError{status: 1}}
+	config.executor = executor
+	if _, err := callSshCommand(config, "zpool create tank"); err == nil || executor.calls != 1 {
+		t.Fatalf("expected a command which exited with an error not to be retried, got %v after %d attempts", err, executor.calls)
+	}
+
+	if isTransientError(&SshConnectError{inner: errCommandTimedOut}) {
+		t.Fatalf("expected a command which timed out not to be retried, as it may still be running")
+	}
+}
+
+// TestCommandTimeout verifies that commands may run until the deadline of the resource operation.
+func TestCommandTimeout(t *testing.T) {
+	executor := &flakyExecutor{}
+	config := &Config{executor: executor, retry_max_attempts: 1}
+
+	if _, err := callSshCommand(config, "zpool list"); err != nil || executor.timeout != defaultCommandTimeout {
+		t.Fatalf("expected the default timeout without a deadline, got %s, %v", executor.timeout, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+	if _, err := callSshCommandContext(ctx, config, "zpool create tank"); err != nil || executor.timeout < time.Hour {
+		t.Fatalf("expected the timeout to follow the deadline, got %s, %v", executor.timeout, err)
+	}
+
+	if timeout := commandTimeout(context.Background()); timeout != defaultCommandTimeout {
+		t.Fatalf("unexpected timeout %s", timeout)
+	}
+	short, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if timeout := commandTimeout(short); timeout != minCommandTimeout {
+		t.Fatalf("expected at least %s, got %s", minCommandTimeout, timeout)
+	}
+}
+
+// TestImportStateWithDefaults verifies that imported resources get the defaults of attributes which aren't read back.
+func TestImportStateWithDefaults(t *testing.T) {
+	d := resourceFilesystem().TestResourceData()
+	d.SetId("1234")
+
+	importer := importStateWithDefaults(resourceFilesystem, schema.ImportStatePassthroughContext)
+	if _, err := importer(context.Background(), d, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if value, ok := d.GetOkExists("force_destroy"); !ok || value.(bool) {
+		t.Fatalf("expected force_destroy to default to false, got %v", value)
+	}
+	if d.Get("metadata_property").(string) != defaultMetadataProperty || d.Get("property_mode").(string) != "defined" {
+		t.Fatalf("unexpected defaults %v, %v", d.Get("metadata_property"), d.Get("property_mode"))
+	}
+}
+
+// TestCallSshCommandErrors verifies that stderr output is classified into the provider's error types.
+func TestCallSshCommandErrors(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		fail("zfs list missing", "cannot open 'missing': dataset does not exist").
+		fail("zpool list missing", "cannot open 'missing': no such pool")
+	config := newFakeConfig(executor)
+
+	if _, err := callSshCommand(config, "zfs list missing"); err == nil {
+		t.Fatalf("expected an error")
+	} else if _, ok := err.(*DatasetError); !ok {
+		t.Fatalf("expected a DatasetError, got %T", err)
+	}
+
+	if _, err := callSshCommand(config, "zpool list missing"); err == nil {
+		t.Fatalf("expected an error")
+	} else if _, ok := err.(*PoolError); !ok {
+		t.Fatalf("expected a PoolError, got %T", err)
+	}
+
+	if _, err := callSshCommand(config, "zfs frobnicate"); err == nil {
+		t.Fatalf("expected an error")
+	} else if _, ok := err.(*StderrError); !ok {
+		t.Fatalf("expected a StderrError, got %T", err)
+	}
+}
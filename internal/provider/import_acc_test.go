@@ -0,0 +1,193 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// The import acceptance tests create a pool on file-backed vdevs, so they only need a host with zfs installed.
+// ZFS_PROVIDER_TEST_VDEV_DIR is where the vdev files are created, and ZFS_PROVIDER_TEST_POOL the name of the pool.
+
+func testAccSkipWithoutHost(t *testing.T) {
+	if os.Getenv("ZFS_PROVIDER_HOSTNAME") == "" {
+		t.Skip("ZFS_PROVIDER_HOSTNAME must be set to run the import acceptance tests")
+	}
+}
+
+func testAccEnv(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func testAccPoolName() string {
+	return testAccEnv("ZFS_PROVIDER_TEST_POOL", "tfacc")
+}
+
+func testAccVdevs() []string {
+	dir := testAccEnv("ZFS_PROVIDER_TEST_VDEV_DIR", "/var/tmp")
+	return []string{path.Join(dir, "tfacc-vdev0.img"), path.Join(dir, "tfacc-vdev1.img")}
+}
+
+// testAccConfig configures the provider from the environment, for tests which run commands outside of terraform.
+func testAccConfig(t *testing.T) *Config {
+	p := New("dev")()
+	if diags := p.Configure(context.Background(), terraform.NewResourceConfigRaw(nil)); diags.HasError() {
+		t.Fatalf("failed to configure the provider: %v", diags)
+	}
+	return p.Meta().(*Config)
+}
+
+// testAccCreateVdevs creates the sparse files the test pool is built on.
+func testAccCreateVdevs(t *testing.T) {
+	for _, vdev := range testAccVdevs() {
+		if _, err := callSshCommand(testAccConfig(t), "truncate -s 256M %s", vdev); err != nil {
+			t.Fatalf("failed to create vdev %s: %s", vdev, err)
+		}
+	}
+}
+
+// testAccProviderConfig is set by the tests before CheckDestroy runs.
+var testAccProviderConfig *Config
+
+func testAccCheckPoolDestroyed(s *terraform.State) error {
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "zfs_pool" {
+			continue
+		}
+		pool, err := findImportedPool(testAccProviderConfig, rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+		if pool != nil {
+			return fmt.Errorf("pool %s still exists", pool.name)
+		}
+	}
+	return nil
+}
+
+func testAccImportConfig() string {
+	vdevs := testAccVdevs()
+	return fmt.Sprintf(`
+resource "zfs_pool" "test" {
+  name          = %[1]q
+  force_destroy = true
+
+  mirror {
+    device {
+      path = %[2]q
+    }
+    device {
+      path = %[3]q
+    }
+  }
+
+  property {
+    name  = "autotrim"
+    value = "on"
+  }
+}
+
+resource "zfs_filesystem" "test" {
+  name          = "${zfs_pool.test.name}/data"
+  force_destroy = true
+  expires_at    = "2099-01-01T00:00:00Z"
+
+  metadata = {
+    owner = "tfacc"
+  }
+
+  property {
+    name  = "compression"
+    value = "lz4"
+  }
+}
+
+resource "zfs_volume" "test" {
+  name          = "${zfs_pool.test.name}/volume"
+  volsize       = "64M"
+  sparse        = true
+  force_destroy = true
+
+  property {
+    name  = "volblocksize"
+    value = "16K"
+  }
+}
+
+resource "zfs_snapshot" "test" {
+  dataset = zfs_filesystem.test.name
+  name    = "tfacc"
+}
+`, testAccPoolName(), vdevs[0], vdevs[1])
+}
+
+// testAccImportVerifyIgnore lists the attributes which only exist in terraform, so they can't be imported and are
+// reset to their defaults by importStateWithDefaults. sparse isn't read back, as the refreservation of a sparse
+// volume can't be told apart from one which was set to none later on.
+var testAccImportVerifyIgnore = []string{"force_destroy", "sparse"}
+
+// TestAccImportRoundTrip verifies that importing the pool, filesystem, volume and snapshot resources results in the same
+// state they were created with, so that the first plan after an import is empty.
+func TestAccImportRoundTrip(t *testing.T) {
+	testAccSkipWithoutHost(t)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck: func() {
+			testAccPreCheck(t)
+			testAccProviderConfig = testAccConfig(t)
+			testAccCreateVdevs(t)
+		},
+		ProviderFactories: providerFactories,
+		CheckDestroy:      testAccCheckPoolDestroyed,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccImportConfig(),
+			},
+			{
+				ResourceName:            "zfs_pool.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: testAccImportVerifyIgnore,
+			},
+			{
+				// Pools can be imported by name as well as by guid.
+				ResourceName:            "zfs_pool.test",
+				ImportState:             true,
+				ImportStateId:           testAccPoolName(),
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: testAccImportVerifyIgnore,
+			},
+			{
+				ResourceName:            "zfs_filesystem.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: testAccImportVerifyIgnore,
+			},
+			{
+				ResourceName:            "zfs_volume.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: testAccImportVerifyIgnore,
+			},
+			{
+				ResourceName:      "zfs_snapshot.test",
+				ImportState:       true,
+				ImportStateId:     testAccPoolName() + "/data@tfacc",
+				ImportStateVerify: true,
+			},
+			{
+				// Nothing may change once the imported state is refreshed either.
+				Config:   testAccImportConfig(),
+				PlanOnly: true,
+			},
+		},
+	})
+}
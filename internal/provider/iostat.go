@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// iostatColumns are the columns zpool iostat -H prints for every pool and vdev, in order.
+var iostatColumns = []string{"alloc", "free", "read_ops", "write_ops", "read_bytes", "write_bytes"}
+
+// iostatLatencyColumns are the average latencies zpool iostat -l prints after iostatColumns, in nanoseconds.
+// OpenZFS before 2.0 has no rebuild column, in which case it is zero.
+var iostatLatencyColumns = []string{
+	"total_wait_read_ns",
+	"total_wait_write_ns",
+	"disk_wait_read_ns",
+	"disk_wait_write_ns",
+	"syncq_wait_read_ns",
+	"syncq_wait_write_ns",
+	"asyncq_wait_read_ns",
+	"asyncq_wait_write_ns",
+	"scrub_wait_ns",
+	"trim_wait_ns",
+	"rebuild_wait_ns",
+}
+
+// iostatClasses are the rows zpool iostat -v prints above the vdevs of an allocation class, without statistics.
+var iostatClasses = []string{"logs", "cache", "spares", "special", "dedup"}
+
+// VdevIostat is a sample of the statistics of the pool itself or one of its vdevs. Missing values, such as the
+// allocated space of a disk, are zero.
+type VdevIostat struct {
+	name   string
+	values map[string]int64
+}
+
+// parseIostatValue parses a value of zpool iostat -p, which is "-" where it doesn't apply. Rates may be fractional.
+func parseIostatValue(value string) (int64, error) {
+	if value == "-" {
+		return 0, nil
+	}
+	parsed, err := parseDecimal(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid zpool iostat value %q: %s", value, err)
+	}
+	return int64(parsed), nil
+}
+
+// parseIostat parses the output of zpool iostat -H -p, e.g.
+//
+//	tank	1099511627776	2199023255552	12	340	49152	13926400	98304	1048576	...
+//	mirror-0	1099511627776	2199023255552	12	340	49152	13926400	98304	1048576	...
+//	/dev/sda	-	-	6	170	24576	6963200	98304	1048576	...
+//
+// With an interval and count, every report starts with the row of the pool, and only the last one is returned.
+func parseIostat(poolName string, output string) ([]VdevIostat, error) {
+	columns := append(append([]string{}, iostatColumns...), iostatLatencyColumns...)
+
+	var report []VdevIostat
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) == 0 || strings.TrimSpace(fields[0]) == "" {
+			continue
+		}
+
+		name := strings.TrimSpace(fields[0])
+		if contains(iostatClasses, name) {
+			continue
+		}
+		if len(fields)-1 < len(iostatColumns) {
+			return nil, fmt.Errorf("expected at least %d zpool iostat columns, got %q", len(iostatColumns)+1, line)
+		}
+
+		if name == poolName {
+			report = make([]VdevIostat, 0)
+		} else if report == nil {
+			return nil, fmt.Errorf("zpool iostat output doesn't start with pool %s: %q", poolName, line)
+		}
+
+		vdev := VdevIostat{name: name, values: make(map[string]int64, len(columns))}
+		for i, column := range columns {
+			if i+1 >= len(fields) {
+				break
+			}
+			value, err := parseIostatValue(strings.TrimSpace(fields[i+1]))
+			if err != nil {
+				return nil, err
+			}
+			vdev.values[column] = value
+		}
+		report = append(report, vdev)
+	}
+
+	if report == nil {
+		return nil, fmt.Errorf("zpool iostat printed no statistics for pool %s", poolName)
+	}
+	return report, nil
+}
+
+// readIostat samples the statistics of a pool over interval seconds, or since it was imported if interval is zero.
+func readIostat(config *Config, poolName string, interval int, verbose bool, latency bool) ([]VdevIostat, error) {
+	flags := "-HpP"
+	if verbose {
+		flags += "v"
+	}
+	if latency {
+		flags += "l"
+	}
+
+	command := fmt.Sprintf("zpool iostat %s %s", flags, shellescape.Quote(poolName))
+	if interval > 0 {
+		// -y skips the report of the statistics since the pool was imported.
+		command = fmt.Sprintf("zpool iostat %sy %s %d 1", flags, shellescape.Quote(poolName), interval)
+	}
+
+	stdout, err := callSshCommand(config, "%s", command)
+	if err != nil {
+		return nil, err
+	}
+	return parseIostat(poolName, stdout)
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const testIostat = "tank\t1099511627776\t2199023255552\t12\t340\t49152\t13926400\t98304\t1048576\t65536\t917504\t-\t-\t4096\t131072\t-\t-\t-\n" +
+	"mirror-0\t1099511627776\t2199023255552\t12\t340\t49152\t13926400\t98304\t1048576\t65536\t917504\t-\t-\t4096\t131072\t-\t-\t-\n" +
+	"/dev/sda\t-\t-\t6\t170\t24576\t6963200\t98304\t1048576\t65536\t917504\t-\t-\t4096\t131072\t-\t-\t-\n" +
+	"logs\t-\t-\t-\t-\t-\t-\t-\t-\t-\t-\t-\t-\t-\t-\t-\t-\t-\n" +
+	"/dev/nvme0n1\t4194304\t1069547520\t0\t12.5\t0\t65536\t-\t8192\t-\t4096\t-\t-\t-\t-\t-\t-\t-\n"
+
+// TestParseIostat verifies that the pool and its vdevs are parsed, skipping allocation class rows.
+func TestParseIostat(t *testing.T) {
+	report, err := parseIostat("tank", testIostat)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(report) != 4 || report[0].name != "tank" || report[3].name != "/dev/nvme0n1" {
+		t.Fatalf("unexpected report %#v", report)
+	}
+	if report[0].values["write_bytes"] != 13926400 || report[0].values["disk_wait_write_ns"] != 917504 || report[0].values["rebuild_wait_ns"] != 0 {
+		t.Fatalf("unexpected pool statistics %#v", report[0].values)
+	}
+	if report[2].values["alloc"] != 0 || report[3].values["write_ops"] != 12 {
+		t.Fatalf("unexpected device statistics %#v, %#v", report[2].values, report[3].values)
+	}
+}
+
+// TestParseIostatReports verifies that only the last report is returned, and that statistics without -l are accepted.
+func TestParseIostatReports(t *testing.T) {
+	report, err := parseIostat("tank", "tank\t1\t2\t3\t4\t5\t6\n/dev/sda\t-\t-\t3\t4\t5\t6\ntank\t1\t2\t7\t8\t9\t10\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(report) != 1 || report[0].values["read_ops"] != 7 {
+		t.Fatalf("unexpected report %#v", report)
+	}
+
+	if _, err := parseIostat("tank", "/dev/sda\t-\t-\t3\t4\t5\t6\n"); err == nil {
+		t.Fatalf("expected an error for output without the pool")
+	}
+}
+
+// TestDataSourcePoolIostatRead verifies that a sample is taken over the interval, without the averages since import.
+func TestDataSourcePoolIostatRead(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zpool iostat -HpPly tank 5 1", "tank\t1099511627776\t2199023255552\t12\t340\t49152\t13926400\t98304\t1048576\n")
+
+	d := schema.TestResourceDataRaw(t, dataSourcePoolIostat().Schema, map[string]interface{}{"pool": "tank", "interval": 5})
+	if diags := dataSourcePoolIostatRead(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	if d.Get("write_ops").(int) != 340 || d.Get("vdev.0.total_wait_write_ns").(int) != 1048576 {
+		t.Fatalf("unexpected state %v, %v", d.Get("write_ops"), d.Get("vdev"))
+	}
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// iscsiLoginWaitTimeout is how long to wait for the devices of a freshly logged in target to appear,
+// unless the device sets its own wait_for_device_timeout.
+const iscsiLoginWaitTimeout = "30s"
+
+var iscsiReferencePattern = regexp.MustCompile(`^iscsi:([^/]+)/([^/]+)/(\d+)$`)
+
+type IscsiTarget struct {
+	portal string
+	iqn    string
+}
+
+// parseIscsiReference parses a device reference of the form iscsi:<portal>/<iqn>/<lun>, e.g.
+// iscsi:10.0.0.5/iqn.2003-01.org.example:storage/1. The portal port defaults to 3260.
+func parseIscsiReference(reference string) (*IscsiTarget, string, bool) {
+	match := iscsiReferencePattern.FindStringSubmatch(reference)
+	if match == nil {
+		return nil, "", false
+	}
+
+	portal := match[1]
+	if !strings.Contains(portal, ":") {
+		portal = portal + ":3260"
+	}
+	return &IscsiTarget{portal: portal, iqn: match[2]}, match[3], true
+}
+
+// iscsiDevicePath is the path udev creates for a LUN of a logged in target.
+func iscsiDevicePath(target IscsiTarget, lun string) string {
+	return fmt.Sprintf("/dev/disk/by-path/ip-%s-iscsi-%s-lun-%s", target.portal, target.iqn, lun)
+}
+
+// iscsiTargets returns the distinct targets referenced by the given devices.
+func iscsiTargets(devices map[string]Device) []IscsiTarget {
+	targets := make([]IscsiTarget, 0)
+	for _, device := range devices {
+		target, _, ok := parseIscsiReference(device.path)
+		if !ok {
+			continue
+		}
+
+		seen := false
+		for _, existing := range targets {
+			if existing == *target {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			targets = append(targets, *target)
+		}
+	}
+	return targets
+}
+
+// parseIscsiSessions parses the output of `iscsiadm -m session`, e.g.
+//
+//	tcp: [1] 10.0.0.5:3260,1 iqn.2003-01.org.example:storage (non-flash)
+func parseIscsiSessions(output string) []IscsiTarget {
+	sessions := make([]IscsiTarget, 0)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		portal := strings.SplitN(fields[2], ",", 2)[0]
+		sessions = append(sessions, IscsiTarget{portal: portal, iqn: fields[3]})
+	}
+	return sessions
+}
+
+// readIscsiSessions lists the targets the host is logged in to. iscsiadm complains on stderr
+// when there are no sessions at all, which is not an error here.
+func readIscsiSessions(config *Config) ([]IscsiTarget, error) {
+	stdout, err := callSshCommand(config, "iscsiadm -m session 2>/dev/null || true")
+	if err != nil {
+		return nil, err
+	}
+	return parseIscsiSessions(stdout), nil
+}
+
+// missingIscsiSessions returns the targets among the given ones which the host isn't logged in to.
+func missingIscsiSessions(config *Config, targets []IscsiTarget) ([]IscsiTarget, error) {
+	if len(targets) == 0 {
+		return targets, nil
+	}
+
+	sessions, err := readIscsiSessions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]IscsiTarget, 0)
+	for _, target := range targets {
+		found := false
+		for _, session := range sessions {
+			if session == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, target)
+		}
+	}
+	return missing, nil
+}
+
+// loginIscsiTargets discovers and logs in to every target referenced by the given devices which doesn't
+// have a session yet. Devices on targets which were logged in to are given time to appear.
+func loginIscsiTargets(config *Config, devices map[string]Device) error {
+	missing, err := missingIscsiSessions(config, iscsiTargets(devices))
+	if err != nil {
+		return err
+	}
+
+	for _, target := range missing {
+		log.Printf("[DEBUG] logging in to iscsi target %s on %s", target.iqn, target.portal)
+		if _, err := callSshCommand(config, "iscsiadm -m discovery -t sendtargets -p %s", shellescape.Quote(target.portal)); err != nil {
+			return err
+		}
+		if _, err := callSshCommand(config, "iscsiadm -m node -T %s -p %s --login", shellescape.Quote(target.iqn), shellescape.Quote(target.portal)); err != nil {
+			return err
+		}
+
+		for path, device := range devices {
+			if deviceTarget, _, ok := parseIscsiReference(device.path); ok && *deviceTarget == target && device.waitTimeout == "" {
+				device.waitTimeout = iscsiLoginWaitTimeout
+				devices[path] = device
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"testing"
+)
+
+// TestParseIscsiReference verifies that iSCSI references are split into target and LUN, with the default port added.
+func TestParseIscsiReference(t *testing.T) {
+	target, lun, ok := parseIscsiReference("iscsi:10.0.0.5/iqn.2003-01.org.example:storage/1")
+	if !ok {
+		t.Fatalf("expected the reference to parse")
+	}
+	if *target != (IscsiTarget{portal: "10.0.0.5:3260", iqn: "iqn.2003-01.org.example:storage"}) || lun != "1" {
+		t.Fatalf("unexpected target %+v and lun %s", target, lun)
+	}
+
+	if path := resolveDevicePath("iscsi:10.0.0.5:3261/iqn.2003-01.org.example:storage/0"); path != "/dev/disk/by-path/ip-10.0.0.5:3261-iscsi-iqn.2003-01.org.example:storage-lun-0" {
+		t.Fatalf("unexpected device path %s", path)
+	}
+
+	if _, _, ok := parseIscsiReference("/dev/sda"); ok {
+		t.Fatalf("expected a plain path not to parse")
+	}
+}
+
+// TestLoginIscsiTargets verifies that only targets without a session are logged in to.
+func TestLoginIscsiTargets(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("iscsiadm -m session", "tcp: [1] 10.0.0.5:3260,1 iqn.2003-01.org.example:a (non-flash)").
+		on("iscsiadm -m discovery", "10.0.0.6:3260,1 iqn.2003-01.org.example:b").
+		on("iscsiadm -m node", "Login to [iface: default, target: iqn.2003-01.org.example:b, portal: 10.0.0.6,3260] successful.")
+
+	devices := make(map[string]Device)
+	for _, reference := range []string{"iscsi:10.0.0.5/iqn.2003-01.org.example:a/0", "iscsi:10.0.0.6/iqn.2003-01.org.example:b/0"} {
+		devices[resolveDevicePath(reference)] = Device{path: reference}
+	}
+
+	if err := loginIscsiTargets(newFakeConfig(executor), devices); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if executor.ran("iscsiadm -m node -T iqn.2003-01.org.example:a") {
+		t.Fatalf("expected no login to a target with a session")
+	}
+	if !executor.ran("iscsiadm -m node -T iqn.2003-01.org.example:b") {
+		t.Fatalf("expected a login to the target without a session, ran %v", executor.commands)
+	}
+	if devices[resolveDevicePath("iscsi:10.0.0.6/iqn.2003-01.org.example:b/0")].waitTimeout != iscsiLoginWaitTimeout {
+		t.Fatalf("expected devices on the new session to be waited for")
+	}
+}
@@ -0,0 +1,265 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Values of the json_output provider setting.
+const (
+	JsonOutputAuto   = "auto"
+	JsonOutputAlways = "always"
+	JsonOutputNever  = "never"
+)
+
+var jsonOutputModes = []string{JsonOutputAuto, JsonOutputAlways, JsonOutputNever}
+
+// useJsonOutput reports whether zfs and zpool output should be requested as JSON. In auto mode,
+// support is detected once per provider instance, as JSON output was introduced in OpenZFS 2.3.
+func useJsonOutput(config *Config) bool {
+	switch config.json_output {
+	case JsonOutputAlways:
+		return true
+	case JsonOutputNever:
+		return false
+	}
+
+	config.json_once.Do(func() {
+		stdout, err := callSshCommand(config, "zfs version -j 2>/dev/null || true")
+		config.json_supported = err == nil && strings.HasPrefix(strings.TrimSpace(stdout), "{")
+		log.Printf("[DEBUG] json output supported: %t", config.json_supported)
+	})
+	return config.json_supported
+}
+
+type jsonPropertySource struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+type jsonProperty struct {
+	Value  string             `json:"value"`
+	Source jsonPropertySource `json:"source"`
+}
+
+type jsonPropertyHolder struct {
+	Properties map[string]jsonProperty `json:"properties"`
+}
+
+// jsonGetOutput is the part of `zfs get -j`, `zpool get -j`, `zfs list -j` and `zpool list -j` output the provider uses.
+type jsonGetOutput struct {
+	Datasets map[string]jsonPropertyHolder `json:"datasets"`
+	Pools    map[string]jsonPropertyHolder `json:"pools"`
+}
+
+// parseJsonProperties extracts the properties of a single dataset or pool from JSON output.
+func parseJsonProperties(output string, resourceName string) (map[string]jsonProperty, error) {
+	var parsed jsonGetOutput
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse json output: %s", err)
+	}
+
+	if holder, ok := parsed.Datasets[resourceName]; ok {
+		return holder.Properties, nil
+	}
+	if holder, ok := parsed.Pools[resourceName]; ok {
+		return holder.Properties, nil
+	}
+	return nil, fmt.Errorf("json output does not contain %s", resourceName)
+}
+
+// parseJsonPropertySource converts a JSON source type such as "LOCAL" to a PropertySource.
+func parseJsonPropertySource(source jsonPropertySource) (PropertySource, error) {
+	if strings.EqualFold(source.Type, "none") {
+		return SourceNone, nil
+	}
+	return parsePropertySource(strings.ToLower(source.Type))
+}
+
+// parseJsonResources extracts the properties of every dataset and pool from JSON output.
+func parseJsonResources(output string) (map[string]map[string]jsonProperty, error) {
+	var parsed jsonGetOutput
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse json output: %s", err)
+	}
+
+	resources := make(map[string]map[string]jsonProperty)
+	for name, holder := range parsed.Datasets {
+		resources[name] = holder.Properties
+	}
+	for name, holder := range parsed.Pools {
+		resources[name] = holder.Properties
+	}
+	return resources, nil
+}
+
+// parseJsonPropertyOutput is the JSON counterpart of parsePropertyOutput, combining the formatted and the
+// parsable values of every dataset or pool.
+func parseJsonPropertyOutput(formattedOutput string, rawOutput string) (map[string]map[string]Property, error) {
+	formatted, err := parseJsonResources(formattedOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := parseJsonResources(rawOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make(map[string]map[string]Property)
+	for resourceName, values := range formatted {
+		properties := make(map[string]Property)
+		for name, value := range values {
+			source, err := parseJsonPropertySource(value.Source)
+			if err != nil {
+				return nil, fmt.Errorf("Error in property %s: %s", name, err)
+			}
+			property := Property{
+				source:   source,
+				value:    value.Value,
+				rawValue: raw[resourceName][name].Value,
+			}
+			if source == SourceInherited {
+				property.inheritedFrom = value.Source.Data
+			}
+			properties[name] = property
+		}
+		resources[resourceName] = properties
+	}
+	return resources, nil
+}
+
+// jsonVdev is a vdev in `zpool status -j` output. Leaf vdevs have a path, the others have vdevs of their own.
+type jsonVdev struct {
+	Name     string    `json:"name"`
+	VdevType string    `json:"vdev_type"`
+	Class    string    `json:"class"`
+	Path     string    `json:"path"`
+	Vdevs    jsonVdevs `json:"vdevs"`
+}
+
+// jsonVdevs keeps the order of the vdevs in the object zpool prints them in, which is the order of the layout.
+type jsonVdevs []jsonVdev
+
+func (vdevs *jsonVdevs) UnmarshalJSON(data []byte) error {
+	*vdevs = nil
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if token != json.Delim('{') {
+		return fmt.Errorf("expected an object of vdevs, got %v", token)
+	}
+	for decoder.More() {
+		// The key is the name of the vdev, which is repeated in the vdev itself.
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		var vdev jsonVdev
+		if err := decoder.Decode(&vdev); err != nil {
+			return err
+		}
+		*vdevs = append(*vdevs, vdev)
+	}
+	return nil
+}
+
+// leaves returns the devices of a vdev. Devices being replaced and spares in use are grouped under vdevs of their
+// own, which aren't part of the layout, so their devices count towards the vdev they are in.
+func (vdev jsonVdev) leaves() []Device {
+	if len(vdev.Vdevs) == 0 {
+		path := vdev.Path
+		if path == "" {
+			path = vdev.Name
+		}
+		return []Device{{path: path}}
+	}
+
+	devices := make([]Device, 0)
+	for _, child := range vdev.Vdevs {
+		devices = append(devices, child.leaves()...)
+	}
+	return devices
+}
+
+type jsonPoolStatus struct {
+	Vdevs   jsonVdevs `json:"vdevs"`
+	Logs    jsonVdevs `json:"logs"`
+	L2cache jsonVdevs `json:"l2cache"`
+}
+
+// jsonStatusOutput is the part of `zpool status -j` output the provider uses.
+type jsonStatusOutput struct {
+	Pools map[string]jsonPoolStatus `json:"pools"`
+}
+
+// parseJsonPoolLayout is the JSON counterpart of parsePoolLayout, reading the layout from `zpool status -j -P`.
+func parseJsonPoolLayout(output string, poolName string) (*PoolLayout, error) {
+	var parsed jsonStatusOutput
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse json output: %s", err)
+	}
+
+	status, ok := parsed.Pools[poolName]
+	if !ok || len(status.Vdevs) == 0 {
+		return nil, &PoolError{errmsg: "failed to read pool layout"}
+	}
+
+	layout := PoolLayout{
+		mirrors: make([]Mirror, 0),
+		raidz:   make([]Raidz, 0),
+		striped: make([]Device, 0),
+		logs:    make([]Device, 0),
+		caches:  make([]Device, 0),
+	}
+
+	// The root vdev is named after the pool, and holds the top-level vdevs.
+	for _, vdev := range status.Vdevs[0].Vdevs {
+		switch {
+		case vdev.Class == "log":
+			layout.logs = append(layout.logs, vdev.leaves()...)
+		case vdev.Class != "" && vdev.Class != "normal":
+			log.Printf("[DEBUG] ignoring %s vdev %s", vdev.Class, vdev.Name)
+		case vdev.VdevType == "mirror":
+			layout.mirrors = append(layout.mirrors, Mirror{devices: vdev.leaves()})
+		case vdev.VdevType == "raidz":
+			parity := 1
+			if _, err := fmt.Sscanf(vdev.Name, "raidz%d-", &parity); err != nil {
+				log.Printf("[DEBUG] assuming single parity for %s", vdev.Name)
+			}
+			layout.raidz = append(layout.raidz, Raidz{parity: parity, devices: vdev.leaves()})
+		default:
+			layout.striped = append(layout.striped, vdev.leaves()...)
+		}
+	}
+
+	for _, vdev := range status.Logs {
+		layout.logs = append(layout.logs, vdev.leaves()...)
+	}
+	for _, vdev := range status.L2cache {
+		layout.caches = append(layout.caches, vdev.leaves()...)
+	}
+
+	return &layout, nil
+}
+
+// findJsonResourceByGuid returns the name of the dataset or pool with the given guid in `zfs list -j` or
+// `zpool list -j` output, or "" if there is none.
+func findJsonResourceByGuid(output string, guid string) (string, error) {
+	resources, err := parseJsonResources(output)
+	if err != nil {
+		return "", err
+	}
+	for name, properties := range resources {
+		if properties["guid"].Value == guid {
+			return name, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseJsonProperties verifies that properties and their sources are read from zfs get -j output.
+func TestParseJsonProperties(t *testing.T) {
+	output := `{"output_version":{"command":"zfs get","vers_major":0,"vers_minor":1},"datasets":{"tank/data":{"name":"tank/data","type":"FILESYSTEM","pool":"tank","createtxg":"12","properties":{` +
+		`"compression":{"value":"lz4","source":{"type":"INHERITED","data":"tank"}},` +
+		`"recordsize":{"value":"128K","source":{"type":"LOCAL","data":"-"}},` +
+		`"used":{"value":"96K","source":{"type":"NONE","data":"-"}}}}}}`
+
+	properties, err := parseJsonProperties(output, "tank/data")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]PropertySource{
+		"compression": SourceInherited,
+		"recordsize":  SourceLocal,
+		"used":        SourceNone,
+	}
+	for name, source := range expected {
+		parsed, err := parseJsonPropertySource(properties[name].Source)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", name, err)
+		}
+		if parsed != source {
+			t.Fatalf("expected %s to have source %s, got %s", name, source, parsed)
+		}
+	}
+
+	if properties["recordsize"].Value != "128K" {
+		t.Fatalf("unexpected recordsize %s", properties["recordsize"].Value)
+	}
+}
+
+// TestParseJsonPoolProperties verifies that pool properties are read from zpool list -j output.
+func TestParseJsonPoolProperties(t *testing.T) {
+	output := `{"output_version":{"command":"zpool list","vers_major":0,"vers_minor":1},"pools":{"tank":{"name":"tank","type":"POOL","state":"ONLINE","properties":{` +
+		`"size":{"value":"10737418240","source":{"type":"NONE","data":"-"}},` +
+		`"expandsize":{"value":"-","source":{"type":"NONE","data":"-"}}}}}}`
+
+	properties, err := parseJsonProperties(output, "tank")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	size, expandSize, err := parsePoolSize(properties["size"].Value + "\t" + properties["expandsize"].Value)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if size != 10737418240 || expandSize != 0 {
+		t.Fatalf("unexpected sizes %d, %d", size, expandSize)
+	}
+
+	if _, err := parseJsonProperties(output, "missing"); err == nil {
+		t.Fatalf("expected an error for a pool missing from the output")
+	}
+}
+
+// TestParseJsonPropertyOutput verifies the formatted and parsable values of every dataset in the output are combined.
+func TestParseJsonPropertyOutput(t *testing.T) {
+	formatted := `{"datasets":{"tank":{"properties":{"quota":{"value":"none","source":{"type":"DEFAULT","data":"-"}}}},` +
+		`"tank/a":{"properties":{"quota":{"value":"10G","source":{"type":"LOCAL","data":"-"}}}}}}`
+	raw := `{"datasets":{"tank":{"properties":{"quota":{"value":"0","source":{"type":"DEFAULT","data":"-"}}}},` +
+		`"tank/a":{"properties":{"quota":{"value":"10737418240","source":{"type":"LOCAL","data":"-"}}}}}}`
+
+	resources, err := parseJsonPropertyOutput(formatted, raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := Property{source: SourceLocal, value: "10G", rawValue: "10737418240"}
+	if resources["tank/a"]["quota"] != expected {
+		t.Fatalf("expected %#v, got %#v", expected, resources["tank/a"]["quota"])
+	}
+	if resources["tank"]["quota"].rawValue != "0" {
+		t.Fatalf("unexpected properties of tank: %#v", resources["tank"])
+	}
+}
+
+// TestParseJsonPoolLayout verifies that the layout is read from zpool status -j output in the order of the vdevs,
+// with devices being replaced counted towards their mirror, and log and cache devices separated.
+func TestParseJsonPoolLayout(t *testing.T) {
+	leaf := func(name string) string {
+		return `"` + name + `":{"name":"` + name + `","vdev_type":"disk","class":"normal","path":"` + name + `","state":"ONLINE"}`
+	}
+	output := `{"output_version":{"command":"zpool status","vers_major":0,"vers_minor":1},"pools":{"tank":{"name":"tank","state":"ONLINE","vdevs":{` +
+		`"tank":{"name":"tank","vdev_type":"root","class":"normal","state":"ONLINE","vdevs":{` +
+		`"mirror-1":{"name":"mirror-1","vdev_type":"mirror","class":"normal","state":"ONLINE","vdevs":{` + leaf("/dev/sdc1") + `,` +
+		`"replacing-1":{"name":"replacing-1","vdev_type":"replacing","class":"normal","state":"DEGRADED","vdevs":{` + leaf("/dev/sdd1") + `,` + leaf("/dev/sde1") + `}}}},` +
+		`"mirror-0":{"name":"mirror-0","vdev_type":"mirror","class":"normal","state":"ONLINE","vdevs":{` + leaf("/dev/sda1") + `,` + leaf("/dev/sdb1") + `}},` +
+		`"raidz2-2":{"name":"raidz2-2","vdev_type":"raidz","class":"normal","state":"ONLINE","vdevs":{` + leaf("/dev/sdf1") + `,` + leaf("/dev/sdg1") + `,` + leaf("/dev/sdh1") + `,` + leaf("/dev/sdi1") + `}},` +
+		`"special-3":{"name":"mirror-3","vdev_type":"mirror","class":"special","state":"ONLINE","vdevs":{` + leaf("/dev/nvme2n1") + `}}}}},` +
+		`"logs":{` + leaf("/dev/nvme0n1") + `},"l2cache":{` + leaf("/dev/nvme1n1") + `}}}}`
+
+	layout, err := parseJsonPoolLayout(output, "tank")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := PoolLayout{
+		mirrors: []Mirror{
+			{devices: []Device{{path: "/dev/sdc1"}, {path: "/dev/sdd1"}, {path: "/dev/sde1"}}},
+			{devices: []Device{{path: "/dev/sda1"}, {path: "/dev/sdb1"}}},
+		},
+		raidz:   []Raidz{{parity: 2, devices: []Device{{path: "/dev/sdf1"}, {path: "/dev/sdg1"}, {path: "/dev/sdh1"}, {path: "/dev/sdi1"}}}},
+		striped: []Device{},
+		logs:    []Device{{path: "/dev/nvme0n1"}},
+		caches:  []Device{{path: "/dev/nvme1n1"}},
+	}
+	if !reflect.DeepEqual(*layout, expected) {
+		t.Fatalf("unexpected layout %+v", *layout)
+	}
+
+	if _, err := parseJsonPoolLayout(output, "other"); err == nil {
+		t.Fatalf("expected an error for a pool which isn't in the output")
+	}
+}
+
+// TestGetResourceNameByGuidJson verifies that datasets are looked up by guid in zfs list -j output.
+func TestGetResourceNameByGuidJson(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -H -o value guid tank/old", "1111\n").
+		on("zfs list -j -t filesystem,volume -o name,guid -r tank", `{"output_version":{"command":"zfs list","vers_major":0,"vers_minor":1},"datasets":{`+
+			`"tank":{"name":"tank","type":"FILESYSTEM","properties":{"guid":{"value":"1111","source":{"type":"NONE","data":"-"}}}},`+
+			`"tank/new":{"name":"tank/new","type":"FILESYSTEM","properties":{"guid":{"value":"2222","source":{"type":"NONE","data":"-"}}}}}}`)
+	config := newFakeConfig(executor)
+	config.json_output = JsonOutputAlways
+
+	name, err := getDatasetNameByGuid(config, "tank/old", "2222")
+	if err != nil || *name != "tank/new" {
+		t.Fatalf("expected tank/new, got %v, %v", name, err)
+	}
+
+	if _, err := getDatasetNameByGuid(config, "tank/old", "3333"); err == nil {
+		t.Fatalf("expected an error for a guid which doesn't exist")
+	} else if _, ok := err.(*DatasetError); !ok {
+		t.Fatalf("expected a DatasetError, got %T", err)
+	}
+}
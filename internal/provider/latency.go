@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// latencyColumns are the histograms printed by zpool iostat -w, named after their header, e.g. "disk_wait_read".
+// Older versions of OpenZFS print fewer of them, in which case the missing ones are zero.
+var latencyColumns = []string{
+	"total_wait_read",
+	"total_wait_write",
+	"disk_wait_read",
+	"disk_wait_write",
+	"syncq_wait_read",
+	"syncq_wait_write",
+	"asyncq_wait_read",
+	"asyncq_wait_write",
+	"scrub",
+	"trim",
+	"rebuild",
+}
+
+// LatencyBucket is a row of a latency histogram, counting the I/Os which took up to latency nanoseconds.
+type LatencyBucket struct {
+	latency int64
+	counts  map[string]int64
+}
+
+// VdevLatency is the latency histogram of the pool itself or one of its vdevs.
+type VdevLatency struct {
+	name    string
+	buckets []LatencyBucket
+}
+
+// latencyUnits are the suffixes of the bucket labels which zpool iostat -w prints without -p.
+var latencyUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"ns", 1},
+	{"us", 1000},
+	{"ms", 1000 * 1000},
+	{"s", 1000 * 1000 * 1000},
+}
+
+// parseLatency parses a histogram bucket label, which is a number of nanoseconds with -p, or e.g. "15ns", "2us" or "1s" without.
+func parseLatency(label string) (int64, bool) {
+	if value, err := strconv.ParseInt(label, 10, 64); err == nil {
+		return value, true
+	}
+	for _, unit := range latencyUnits {
+		if !strings.HasSuffix(label, unit.suffix) {
+			continue
+		}
+		value, err := strconv.ParseInt(strings.TrimSuffix(label, unit.suffix), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return value * unit.multiplier, true
+	}
+	return 0, false
+}
+
+// parseLatencyHeader names the columns of a histogram from its two header lines, e.g.
+//
+//	tank         total_wait     disk_wait    syncq_wait    asyncq_wait
+//	latency      read  write   read  write   read  write   read  write  scrub   trim  rebuild
+//
+// Every read and write column belongs to the next group of the first line, the remaining columns stand alone.
+func parseLatencyHeader(groups []string, columns []string) []string {
+	names := make([]string, 0, len(columns))
+	group := -1
+	for _, column := range columns {
+		if column == "read" {
+			group++
+		}
+		if (column == "read" || column == "write") && group >= 0 && group < len(groups) {
+			names = append(names, groups[group]+"_"+column)
+		} else {
+			names = append(names, column)
+		}
+	}
+	return names
+}
+
+// parseLatencyHistograms parses the output of zpool iostat -w, which prints a histogram for the pool and,
+// with -v, for every vdev below it, e.g.
+//
+//	tank         total_wait     disk_wait    syncq_wait    asyncq_wait
+//	latency      read  write   read  write   read  write   read  write  scrub   trim  rebuild
+//	----------  -----  -----  -----  -----  -----  -----  -----  -----  -----  -----  -----
+//	1ns             0      0      0      0      0      0      0      0      0      0      0
+//	...
+//	137s            0      0      0      0      0      0      0      0      0      0      0
+//	---------------------------------------------------------------------------------------
+func parseLatencyHistograms(output string) ([]VdevLatency, error) {
+	histograms := make([]VdevLatency, 0)
+
+	previous := []string{}
+	var columns []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "---") {
+			continue
+		}
+
+		if fields[0] == "latency" && len(previous) > 0 {
+			columns = parseLatencyHeader(previous[1:], fields[1:])
+			histograms = append(histograms, VdevLatency{name: previous[0], buckets: make([]LatencyBucket, 0)})
+			continue
+		}
+		previous = fields
+
+		latency, ok := parseLatency(fields[0])
+		if !ok || columns == nil {
+			continue
+		}
+		if len(fields)-1 != len(columns) {
+			return nil, fmt.Errorf("expected %d latency histogram columns, got %q", len(columns), line)
+		}
+
+		bucket := LatencyBucket{latency: latency, counts: make(map[string]int64, len(columns))}
+		for i, column := range columns {
+			count, err := parseErrorCount(fields[i+1])
+			if err != nil {
+				return nil, err
+			}
+			bucket.counts[column] = count
+		}
+		current := &histograms[len(histograms)-1]
+		current.buckets = append(current.buckets, bucket)
+	}
+
+	return histograms, nil
+}
+
+func readLatencyHistograms(config *Config, poolName string) ([]VdevLatency, error) {
+	output, err := callSshCommand(config, "zpool iostat -pPvw %s", poolName)
+	if err != nil {
+		return nil, err
+	}
+	return parseLatencyHistograms(output)
+}
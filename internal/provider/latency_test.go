@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"testing"
+)
+
+const testLatencyHistograms = `tank         total_wait     disk_wait    syncq_wait    asyncq_wait
+latency      read  write   read  write   read  write   read  write  scrub   trim  rebuild
+----------  -----  -----  -----  -----  -----  -----  -----  -----  -----  -----  -----
+1ns             0      0      0      0      0      0      0      0      0      0      0
+1us             3      1      3      1      0      0      0      0      0      0      0
+1s              0      2      0      2      0      0      0      0      0      0      0
+--------------------------------------------------------------------------------------
+
+/dev/sda     total_wait     disk_wait    syncq_wait    asyncq_wait
+latency      read  write   read  write   read  write   read  write  scrub   trim  rebuild
+----------  -----  -----  -----  -----  -----  -----  -----  -----  -----  -----  -----
+1ns             0      0      0      0      0      0      0      0      0      0      0
+1us             3      1      3      1      0      0      0      0      0      0      0
+1s              0   1.5K      0      2      0      0      0      0      0      0      0
+--------------------------------------------------------------------------------------`
+
+// TestParseLatencyHistograms verifies a histogram is parsed for the pool and each vdev, with the columns named after the headers.
+func TestParseLatencyHistograms(t *testing.T) {
+	histograms, err := parseLatencyHistograms(testLatencyHistograms)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(histograms) != 2 || histograms[0].name != "tank" || histograms[1].name != "/dev/sda" {
+		t.Fatalf("unexpected histograms %#v", histograms)
+	}
+
+	buckets := histograms[1].buckets
+	if len(buckets) != 3 || buckets[1].latency != 1000 || buckets[2].latency != 1000000000 {
+		t.Fatalf("unexpected buckets %#v", buckets)
+	}
+	if buckets[2].counts["total_wait_write"] != 1500 || buckets[2].counts["disk_wait_write"] != 2 || buckets[2].counts["rebuild"] != 0 {
+		t.Fatalf("unexpected counts %#v", buckets[2].counts)
+	}
+}
+
+// TestParseLatencyHistograms_OlderColumns verifies histograms without the trim and rebuild columns of newer versions are parsed.
+func TestParseLatencyHistograms_OlderColumns(t *testing.T) {
+	histograms, err := parseLatencyHistograms(`tank         total_wait     disk_wait    syncq_wait    asyncq_wait
+latency      read  write   read  write   read  write   read  write  scrub
+----------  -----  -----  -----  -----  -----  -----  -----  -----  -----
+1023            5      0      5      0      0      0      0      0      7`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	bucket := histograms[0].buckets[0]
+	if bucket.latency != 1023 || bucket.counts["total_wait_read"] != 5 || bucket.counts["scrub"] != 7 {
+		t.Fatalf("unexpected bucket %#v", bucket)
+	}
+}
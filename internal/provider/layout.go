@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+type Redundancy string
+
+const (
+	RedundancyStripe Redundancy = "stripe"
+	RedundancyMirror Redundancy = "mirror"
+	RedundancyRaidz1 Redundancy = "raidz1"
+	RedundancyRaidz2 Redundancy = "raidz2"
+	RedundancyRaidz3 Redundancy = "raidz3"
+)
+
+var redundancies = []string{
+	string(RedundancyStripe),
+	string(RedundancyMirror),
+	string(RedundancyRaidz1),
+	string(RedundancyRaidz2),
+	string(RedundancyRaidz3),
+}
+
+// parity returns the number of devices per vdev which don't contribute to usable capacity.
+func (r Redundancy) parity(width int) int {
+	switch r {
+	case RedundancyMirror:
+		return width - 1
+	case RedundancyRaidz1:
+		return 1
+	case RedundancyRaidz2:
+		return 2
+	case RedundancyRaidz3:
+		return 3
+	}
+	return 0
+}
+
+// defaultWidth is the number of devices per vdev used when none is given.
+func (r Redundancy) defaultWidth() int {
+	switch r {
+	case RedundancyMirror:
+		return 2
+	case RedundancyRaidz1:
+		return 3
+	case RedundancyRaidz2:
+		return 6
+	case RedundancyRaidz3:
+		return 8
+	}
+	return 1
+}
+
+type DeviceSize struct {
+	path string
+	size int64
+}
+
+type CapacitySpec struct {
+	redundancy Redundancy
+	width      int
+	targetSize int64
+	devices    []DeviceSize
+}
+
+// planCapacityLayout picks devices, in the order given, and groups them into vdevs of the requested
+// redundancy until the usable capacity reaches the target. Usable capacity is estimated from the
+// smallest device in each vdev and does not account for metadata or slop space.
+func planCapacityLayout(spec CapacitySpec) ([][]string, int64, error) {
+	width := spec.width
+	if width == 0 {
+		width = spec.redundancy.defaultWidth()
+	}
+
+	parity := spec.redundancy.parity(width)
+	if width <= parity || (spec.redundancy == RedundancyMirror && width < 2) {
+		return nil, 0, fmt.Errorf("a vdev width of %d is too narrow for %s", width, spec.redundancy)
+	}
+
+	vdevs := make([][]string, 0)
+	usable := int64(0)
+	for start := 0; usable < spec.targetSize; start += width {
+		if start+width > len(spec.devices) {
+			return nil, usable, fmt.Errorf(
+				"the %d candidate devices only allow for %d bytes of usable %s capacity, but %d bytes were requested",
+				len(spec.devices), usable, spec.redundancy, spec.targetSize,
+			)
+		}
+
+		group := spec.devices[start : start+width]
+		smallest := group[0].size
+		paths := make([]string, 0, width)
+		for _, device := range group {
+			if device.size < smallest {
+				smallest = device.size
+			}
+			paths = append(paths, device.path)
+		}
+
+		vdevs = append(vdevs, paths)
+		usable += int64(width-parity) * smallest
+	}
+
+	return vdevs, usable, nil
+}
+
+// serializeCapacityLayout formats a planned layout as a zpool create vdev specification.
+func serializeCapacityLayout(redundancy Redundancy, vdevs [][]string) string {
+	out := make([]string, 0)
+	for _, vdev := range vdevs {
+		if redundancy != RedundancyStripe {
+			out = append(out, string(redundancy))
+		}
+		out = append(out, vdev...)
+	}
+	return strings.Join(out, " ")
+}
+
+// readDeviceSizes looks up the size in bytes of each of the given block devices.
+func readDeviceSizes(config *Config, paths []string) ([]DeviceSize, error) {
+	quoted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		quoted = append(quoted, shellescape.Quote(path))
+	}
+
+	command := "lsblk -b -d -n -o SIZE %s"
+	switch hostPlatform(config) {
+	case PlatformFreeBSD:
+		command = "diskinfo %s | awk '{print $3}'"
+	case PlatformIllumos:
+		return nil, unsupportedOnPlatform(config, "reading device sizes")
+	}
+	stdout, err := callSshCommand(config, command, strings.Join(quoted, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := strings.Fields(stdout)
+	if len(sizes) != len(paths) {
+		return nil, fmt.Errorf("expected %d device sizes, got %d", len(paths), len(sizes))
+	}
+
+	devices := make([]DeviceSize, 0, len(paths))
+	for i, path := range paths {
+		size, err := strconv.ParseInt(sizes[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size %s for device %s: %s", sizes[i], path, err)
+		}
+		devices = append(devices, DeviceSize{path: path, size: size})
+	}
+	return devices, nil
+}
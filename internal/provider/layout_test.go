@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testDevices(size int64, paths ...string) []DeviceSize {
+	devices := make([]DeviceSize, 0, len(paths))
+	for _, path := range paths {
+		devices = append(devices, DeviceSize{path: path, size: size})
+	}
+	return devices
+}
+
+// TestPlanCapacityLayout_Mirror verifies that only as many mirrors as needed
+// to reach the target capacity are planned.
+func TestPlanCapacityLayout_Mirror(t *testing.T) {
+	vdevs, usable, err := planCapacityLayout(CapacitySpec{
+		redundancy: RedundancyMirror,
+		targetSize: 150,
+		devices:    testDevices(100, "/dev/sda", "/dev/sdb", "/dev/sdc", "/dev/sdd", "/dev/sde", "/dev/sdf"),
+	})
+	if err != nil {
+		t.Fatalf("planCapacityLayout returned error: %v", err)
+	}
+
+	expected := [][]string{{"/dev/sda", "/dev/sdb"}, {"/dev/sdc", "/dev/sdd"}}
+	if !reflect.DeepEqual(vdevs, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, vdevs)
+	}
+	if usable != 200 {
+		t.Fatalf("expected 200 usable bytes, got %d", usable)
+	}
+
+	if got := serializeCapacityLayout(RedundancyMirror, vdevs); got != "mirror /dev/sda /dev/sdb mirror /dev/sdc /dev/sdd" {
+		t.Fatalf("unexpected vdev specification %q", got)
+	}
+}
+
+// TestPlanCapacityLayout_Raidz2 verifies that parity devices don't count
+// towards usable capacity, and that the smallest device in a vdev is used.
+func TestPlanCapacityLayout_Raidz2(t *testing.T) {
+	devices := testDevices(100, "/dev/sda", "/dev/sdb", "/dev/sdc", "/dev/sdd", "/dev/sde")
+	devices = append(devices, DeviceSize{path: "/dev/sdf", size: 50})
+
+	vdevs, usable, err := planCapacityLayout(CapacitySpec{
+		redundancy: RedundancyRaidz2,
+		targetSize: 200,
+		devices:    devices,
+	})
+	if err != nil {
+		t.Fatalf("planCapacityLayout returned error: %v", err)
+	}
+
+	if len(vdevs) != 1 || len(vdevs[0]) != 6 {
+		t.Fatalf("expected a single 6-wide vdev, got %#v", vdevs)
+	}
+	if usable != 200 {
+		t.Fatalf("expected 200 usable bytes, got %d", usable)
+	}
+}
+
+// TestPlanCapacityLayout_NotEnoughDevices verifies that an unreachable target is an error.
+func TestPlanCapacityLayout_NotEnoughDevices(t *testing.T) {
+	_, _, err := planCapacityLayout(CapacitySpec{
+		redundancy: RedundancyMirror,
+		targetSize: 500,
+		devices:    testDevices(100, "/dev/sda", "/dev/sdb", "/dev/sdc"),
+	})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+// TestParsePoolLayout_Raidz verifies that raidz vdevs are recognized along with their parity.
+func TestParsePoolLayout_Raidz(t *testing.T) {
+	output := "tank\t300G\t1.2M\t300G\t-\t-\t0%\t0%\t1.00x\tONLINE\t-\n" +
+		"\traidz2-0\t300G\t1.2M\t300G\t-\t-\t0%\t0.00%\t-\tONLINE\n" +
+		"\t/dev/sda\t-\t-\t-\t-\t-\t-\t-\t-\tONLINE\n" +
+		"\t/dev/sdb\t-\t-\t-\t-\t-\t-\t-\t-\tONLINE\n" +
+		"\t/dev/sdc\t-\t-\t-\t-\t-\t-\t-\t-\tONLINE\n" +
+		"\t/dev/sdd\t-\t-\t-\t-\t-\t-\t-\t-\tONLINE"
+
+	layout, err := parsePoolLayout(output)
+	if err != nil {
+		t.Fatalf("parsePoolLayout returned error: %v", err)
+	}
+
+	if len(layout.raidz) != 1 || layout.raidz[0].parity != 2 || len(layout.raidz[0].devices) != 4 {
+		t.Fatalf("unexpected raidz layout: %#v", layout.raidz)
+	}
+	if got := serializeDataVdevs(*layout); got != "raidz2 /dev/sda /dev/sdb /dev/sdc /dev/sdd" {
+		t.Fatalf("unexpected data vdevs %q", got)
+	}
+}
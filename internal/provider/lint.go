@@ -0,0 +1,286 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// Identifiers of the layout lint rules, used to suppress individual warnings.
+const (
+	LintVdevWidth     = "vdev_width"
+	LintParityRatio   = "parity_ratio"
+	LintMixedVdevs    = "mixed_vdevs"
+	LintMixedMedia    = "mixed_media"
+	LintSlogPowerLoss = "slog_power_loss"
+	LintCacheSize     = "cache_size"
+)
+
+const (
+	lintPenalty        = 15
+	maxRaidzWidth      = 12
+	largeRaidz1Device  = int64(4) << 40
+	maxCacheToArcRatio = 5
+)
+
+var lintRules = []string{
+	LintVdevWidth,
+	LintParityRatio,
+	LintMixedVdevs,
+	LintMixedMedia,
+	LintSlogPowerLoss,
+	LintCacheSize,
+}
+
+type VdevGroup struct {
+	class   string
+	kind    string
+	devices []string
+}
+
+type LintWarning struct {
+	rule    string
+	message string
+}
+
+type LintInput struct {
+	vdevs             []VdevGroup
+	devices           map[string]DeviceInfo
+	arcSize           int64
+	slogPowerLossSafe bool
+	suppressed        []string
+}
+
+type DeviceInfo struct {
+	size       int64
+	rotational bool
+}
+
+// parseVdevSpec splits a zpool create style vdev specification into vdev groups,
+// e.g. "mirror a b mirror c d log e cache f" becomes two data mirrors, a log and a cache group.
+func parseVdevSpec(spec string) []VdevGroup {
+	groups := make([]VdevGroup, 0)
+	class := "data"
+	var current *VdevGroup
+
+	for _, word := range strings.Fields(spec) {
+		switch {
+		case word == "log" || word == "cache" || word == "spare" || word == "special" || word == "dedup":
+			class = word
+			current = nil
+		case word == "mirror" || strings.HasPrefix(word, "raidz") || strings.HasPrefix(word, "draid"):
+			if word == "raidz" {
+				word = "raidz1"
+			}
+			groups = append(groups, VdevGroup{class: class, kind: word, devices: make([]string, 0)})
+			current = &groups[len(groups)-1]
+		default:
+			if current == nil || current.kind == "stripe" {
+				// Devices outside a mirror or raidz group are individual top-level vdevs.
+				groups = append(groups, VdevGroup{class: class, kind: "stripe", devices: []string{word}})
+				current = &groups[len(groups)-1]
+			} else {
+				current.devices = append(current.devices, word)
+			}
+		}
+	}
+	return groups
+}
+
+func raidzParity(kind string) int {
+	parity, err := strconv.Atoi(strings.TrimPrefix(kind, "raidz"))
+	if err != nil {
+		return 0
+	}
+	return parity
+}
+
+// lintLayout checks a proposed pool layout against common best practices. It returns the warnings
+// which haven't been suppressed, and a score from 0 to 100 which drops with every warning.
+func lintLayout(input LintInput) ([]LintWarning, int) {
+	warnings := make([]LintWarning, 0)
+	warn := func(rule string, format string, args ...interface{}) {
+		if !contains(input.suppressed, rule) {
+			warnings = append(warnings, LintWarning{rule: rule, message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	dataKinds := make(map[string]bool)
+	dataWidths := make(map[int]bool)
+	cacheSize := int64(0)
+	hasLog := false
+
+	for _, vdev := range input.vdevs {
+		switch vdev.class {
+		case "data":
+			dataKinds[vdev.kind] = true
+			dataWidths[len(vdev.devices)] = true
+		case "log":
+			hasLog = true
+		case "cache":
+			for _, device := range vdev.devices {
+				cacheSize += input.devices[device].size
+			}
+		}
+
+		if parity := raidzParity(vdev.kind); parity > 0 {
+			width := len(vdev.devices)
+			if width > maxRaidzWidth {
+				warn(LintVdevWidth, "%s vdev with %d devices is wider than %d, which makes resilvering slow", vdev.kind, width, maxRaidzWidth)
+			}
+			if width < parity+2 {
+				warn(LintVdevWidth, "%s vdev with %d devices spends at least half its capacity on parity, consider a mirror instead", vdev.kind, width)
+			}
+			if parity == 1 {
+				for _, device := range vdev.devices {
+					if input.devices[device].size >= largeRaidz1Device {
+						warn(LintParityRatio, "raidz1 vdev contains %s, which is large enough that a second failure during resilver is likely. Consider raidz2", device)
+						break
+					}
+				}
+				if width > 6 {
+					warn(LintParityRatio, "raidz1 vdev with %d devices has a single parity device, consider raidz2", width)
+				}
+			}
+		}
+
+		rotational, solidState := false, false
+		for _, device := range vdev.devices {
+			if info, ok := input.devices[device]; ok {
+				if info.rotational {
+					rotational = true
+				} else {
+					solidState = true
+				}
+			}
+		}
+		if rotational && solidState {
+			warn(LintMixedMedia, "%s vdev %s mixes rotational and solid state devices, so it will perform like the slowest device", vdev.class, strings.Join(vdev.devices, " "))
+		}
+	}
+
+	if len(dataKinds) > 1 || len(dataWidths) > 1 {
+		warn(LintMixedVdevs, "data vdevs have different types or widths, which gives uneven performance and redundancy")
+	}
+
+	if hasLog && !input.slogPowerLossSafe {
+		warn(LintSlogPowerLoss, "log devices should have power-loss protection, otherwise synchronous writes can be lost on power failure. Set the power-loss protection hint once this is verified")
+	}
+
+	if input.arcSize > 0 && cacheSize > maxCacheToArcRatio*input.arcSize {
+		warn(LintCacheSize, "cache devices total %d bytes, more than %d times the maximum ARC size of %d bytes. L2ARC headers are kept in ARC, so this may hurt performance", cacheSize, maxCacheToArcRatio, input.arcSize)
+	}
+
+	score := 100 - lintPenalty*len(warnings)
+	if score < 0 {
+		score = 0
+	}
+	return warnings, score
+}
+
+// readDeviceInfo looks up the size and rotational flag of each of the given block devices.
+// Devices which can't be found are left out rather than failing the lint.
+func readDeviceInfo(config *Config, paths []string) (map[string]DeviceInfo, error) {
+	devices := make(map[string]DeviceInfo)
+	if len(paths) == 0 {
+		return devices, nil
+	}
+
+	quoted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		quoted = append(quoted, shellescape.Quote(path))
+	}
+
+	command := "lsblk -b -d -n -o SIZE,ROTA %s 2>/dev/null || true"
+	switch hostPlatform(config) {
+	case PlatformFreeBSD:
+		// diskinfo doesn't tell spinning disks apart, so they are all treated as solid state.
+		command = "diskinfo %s 2>/dev/null | awk '{print $3, 0}' || true"
+	case PlatformIllumos:
+		return devices, nil
+	}
+	stdout, err := callSshCommand(config, command, strings.Join(quoted, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(stdout, "\n")
+	if len(lines) != len(paths) {
+		// lsblk skips devices it can't find, so there's no way to match up lines with paths.
+		return devices, nil
+	}
+
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		devices[paths[i]] = DeviceInfo{size: size, rotational: fields[1] == "1"}
+	}
+	return devices, nil
+}
+
+// readArcMaxSize reads the maximum ARC size in bytes, or 0 if it's not available.
+func readArcMaxSize(config *Config) (int64, error) {
+	// The other platforms expose the arcstats as kstats, which are printed like the Linux arcstats file.
+	command := "cat /proc/spl/kstat/zfs/arcstats 2>/dev/null || true"
+	switch hostPlatform(config) {
+	case PlatformFreeBSD:
+		command = "sysctl -n kstat.zfs.misc.arcstats.c_max 2>/dev/null | awk '{print \"c_max 4\", $1}' || true"
+	case PlatformIllumos:
+		command = "kstat -p zfs:0:arcstats:c_max 2>/dev/null | awk '{print \"c_max 4\", $2}' || true"
+	}
+	stdout, err := callSshCommand(config, "%s", command)
+	if err != nil {
+		return 0, err
+	}
+	return parseArcMaxSize(stdout), nil
+}
+
+func parseArcMaxSize(arcstats string) int64 {
+	for _, line := range strings.Split(arcstats, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "c_max" {
+			size, err := strconv.ParseInt(fields[2], 10, 64)
+			if err == nil {
+				return size
+			}
+		}
+	}
+	return 0
+}
+
+// lintVdevSpec gathers device information from the host and lints the given vdev specification.
+func lintVdevSpec(config *Config, spec string, slogPowerLossSafe bool, suppressed []string) ([]LintWarning, int, error) {
+	vdevs := parseVdevSpec(spec)
+
+	paths := make([]string, 0)
+	for _, vdev := range vdevs {
+		paths = append(paths, vdev.devices...)
+	}
+
+	devices, err := readDeviceInfo(config, paths)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	arcSize, err := readArcMaxSize(config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	warnings, score := lintLayout(LintInput{
+		vdevs:             vdevs,
+		devices:           devices,
+		arcSize:           arcSize,
+		slogPowerLossSafe: slogPowerLossSafe,
+		suppressed:        suppressed,
+	})
+	return warnings, score, nil
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func lintRulesOf(warnings []LintWarning) []string {
+	rules := make([]string, 0)
+	for _, warning := range warnings {
+		rules = append(rules, warning.rule)
+	}
+	return rules
+}
+
+// TestParseVdevSpec verifies that vdev specifications are split into groups per class.
+func TestParseVdevSpec(t *testing.T) {
+	groups := parseVdevSpec(" mirror a b raidz c d e f log g cache h i")
+
+	expected := []VdevGroup{
+		{class: "data", kind: "mirror", devices: []string{"a", "b"}},
+		{class: "data", kind: "raidz1", devices: []string{"c", "d", "e", "f"}},
+		{class: "log", kind: "stripe", devices: []string{"g"}},
+		{class: "cache", kind: "stripe", devices: []string{"h"}},
+		{class: "cache", kind: "stripe", devices: []string{"i"}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, groups)
+	}
+}
+
+// TestLintLayout_Clean verifies that a sensible layout scores 100.
+func TestLintLayout_Clean(t *testing.T) {
+	warnings, score := lintLayout(LintInput{
+		vdevs: parseVdevSpec("mirror a b mirror c d"),
+		devices: map[string]DeviceInfo{
+			"a": {size: 1 << 40, rotational: true},
+			"b": {size: 1 << 40, rotational: true},
+			"c": {size: 1 << 40, rotational: true},
+			"d": {size: 1 << 40, rotational: true},
+		},
+	})
+
+	if len(warnings) != 0 || score != 100 {
+		t.Fatalf("expected no warnings, got %d (%#v)", score, warnings)
+	}
+}
+
+// TestLintLayout_Findings verifies that each rule triggers on a problematic layout.
+func TestLintLayout_Findings(t *testing.T) {
+	input := LintInput{
+		vdevs: parseVdevSpec("raidz a b c d e f g mirror h i log j cache k"),
+		devices: map[string]DeviceInfo{
+			"a": {size: 8 << 40, rotational: true},
+			"h": {size: 1 << 40, rotational: true},
+			"i": {size: 1 << 40, rotational: false},
+			"k": {size: 100 << 30},
+		},
+		arcSize: 8 << 30,
+	}
+
+	warnings, score := lintLayout(input)
+	expected := []string{LintParityRatio, LintParityRatio, LintMixedMedia, LintMixedVdevs, LintSlogPowerLoss, LintCacheSize}
+	if !reflect.DeepEqual(lintRulesOf(warnings), expected) {
+		t.Fatalf("expected %v, got %v", expected, lintRulesOf(warnings))
+	}
+	if score != 10 {
+		t.Fatalf("expected score 10, got %d", score)
+	}
+
+	input.suppressed = []string{LintParityRatio, LintCacheSize}
+	input.slogPowerLossSafe = true
+	warnings, _ = lintLayout(input)
+	if !reflect.DeepEqual(lintRulesOf(warnings), []string{LintMixedMedia, LintMixedVdevs}) {
+		t.Fatalf("expected suppressed rules to be left out, got %v", lintRulesOf(warnings))
+	}
+}
+
+// TestParseArcMaxSize verifies that c_max is extracted from arcstats.
+func TestParseArcMaxSize(t *testing.T) {
+	arcstats := "13 1 0x01 123 33456 1234 5678\nname                            type data\nc_min                           4    520093696\nc_max                           4    8321499136\n"
+	if got := parseArcMaxSize(arcstats); got != 8321499136 {
+		t.Fatalf("expected 8321499136, got %d", got)
+	}
+	if got := parseArcMaxSize(""); got != 0 {
+		t.Fatalf("expected 0, got %d", got)
+	}
+}
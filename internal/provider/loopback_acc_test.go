@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// The loopback acceptance tests build their pools on loop devices, which are backed by sparse files in a temporary
+// directory below ZFS_PROVIDER_TEST_VDEV_DIR on the test host. Unlike plain file vdevs, loop devices behave like
+// disks, so device handling is tested as well. Everything is torn down when the test ends, whether it passed or not.
+
+// testAccLoopback is a set of loop devices on the test host, and the pools created on them.
+type testAccLoopback struct {
+	config  *Config
+	dir     string
+	devices []string
+	pools   []string
+}
+
+// testAccCreateLoopback creates count loop devices of the given size, e.g. "256M". Loop devices need a Linux host.
+func testAccCreateLoopback(t *testing.T, count int, size string) *testAccLoopback {
+	config := testAccConfig(t)
+	if platform := hostPlatform(config); platform != PlatformLinux {
+		t.Skipf("loop devices require a linux host, the test host runs %s", platform)
+	}
+
+	dir, err := callSshCommand(config, "mktemp -d %s/tfacc.XXXXXX", testAccEnv("ZFS_PROVIDER_TEST_VDEV_DIR", "/var/tmp"))
+	if err != nil {
+		t.Fatalf("failed to create a directory for the loop devices: %s", err)
+	}
+
+	loopback := &testAccLoopback{config: config, dir: strings.TrimSpace(dir)}
+	t.Cleanup(func() { loopback.destroy(t) })
+
+	for i := 0; i < count; i++ {
+		file := path.Join(loopback.dir, fmt.Sprintf("vdev%d.img", i))
+		if _, err := callSshCommand(config, "truncate -s %s %s", size, file); err != nil {
+			t.Fatalf("failed to create %s: %s", file, err)
+		}
+
+		device, err := callSshCommand(config, "losetup --find --show %s", file)
+		if err != nil {
+			t.Fatalf("failed to attach %s to a loop device: %s", file, err)
+		}
+		loopback.devices = append(loopback.devices, strings.TrimSpace(device))
+	}
+	return loopback
+}
+
+// pool returns the name of a pool for the test, which is destroyed on teardown if the test leaves it behind.
+func (l *testAccLoopback) pool(suffix string) string {
+	name := testAccPoolName() + suffix
+	l.pools = append(l.pools, name)
+	return name
+}
+
+// destroy tears down the pools, loop devices and files. Failures are logged rather than failing the test, so that
+// the remaining steps still run.
+func (l *testAccLoopback) destroy(t *testing.T) {
+	for _, pool := range l.pools {
+		if _, err := callSshCommand(l.config, "zpool list -H -o name %s", pool); err != nil {
+			continue
+		}
+		t.Logf("destroying pool %s left behind by the test", pool)
+		if _, err := callSshCommand(l.config, "zpool destroy -f %s", pool); err != nil {
+			t.Logf("failed to destroy pool %s: %s", pool, err)
+		}
+	}
+
+	for _, device := range l.devices {
+		if _, err := callSshCommand(l.config, "losetup -d %s", device); err != nil {
+			t.Logf("failed to detach loop device %s: %s", device, err)
+		}
+	}
+
+	if _, err := callSshCommand(l.config, "rm -rf %s", l.dir); err != nil {
+		t.Logf("failed to remove %s: %s", l.dir, err)
+	}
+}
+
+// testAccCheckDatasetExists checks that a dataset exists on the test host, outside of the terraform state.
+func testAccCheckDatasetExists(config *Config, name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if _, err := callSshCommand(config, "zfs list -H -o name %s", name); err != nil {
+			return fmt.Errorf("expected %s to exist: %s", name, err)
+		}
+		return nil
+	}
+}
+
+func testAccLoopbackConfig(pool string, devices []string, filesystem string) string {
+	return fmt.Sprintf(`
+resource "zfs_pool" "test" {
+  name          = %[1]q
+  force_destroy = true
+
+  mirror {
+    device {
+      path = %[2]q
+    }
+    device {
+      path = %[3]q
+    }
+  }
+}
+
+resource "zfs_filesystem" "test" {
+  name          = "${zfs_pool.test.name}/%[4]s"
+  force_destroy = true
+
+  property {
+    name  = "compression"
+    value = "lz4"
+  }
+}
+
+resource "zfs_snapshot" "test" {
+  dataset = zfs_filesystem.test.name
+  name    = "tfacc"
+}
+`, pool, devices[0], devices[1], filesystem)
+}
+
+// TestAccLoopbackLifecycle creates a mirrored pool with a filesystem and a snapshot of it, renames the filesystem
+// in place and destroys everything again.
+func TestAccLoopbackLifecycle(t *testing.T) {
+	testAccSkipWithoutHost(t)
+
+	var loopback *testAccLoopback
+	var pool string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck: func() {
+			testAccPreCheck(t)
+			testAccProviderConfig = testAccConfig(t)
+			loopback = testAccCreateLoopback(t, 2, "256M")
+			pool = loopback.pool("-loop")
+		},
+		ProviderFactories: providerFactories,
+		CheckDestroy:      testAccCheckPoolDestroyed,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccLoopbackConfig(pool, loopback.devices, "data"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("zfs_pool.test", "mirror.0.device.#", "2"),
+					resource.TestCheckResourceAttr("zfs_filesystem.test", "properties.compression", "lz4"),
+					resource.TestCheckResourceAttr("zfs_snapshot.test", "snapshot", pool+"/data@tfacc"),
+					resource.TestCheckResourceAttrSet("zfs_snapshot.test", "guid"),
+					testAccCheckDatasetExists(loopback.config, pool+"/data@tfacc"),
+				),
+			},
+			{
+				// Renaming keeps the filesystem, so its snapshot is carried along under the new name.
+				Config: testAccLoopbackConfig(pool, loopback.devices, "renamed"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("zfs_filesystem.test", "name", pool+"/renamed"),
+					testAccCheckDatasetExists(loopback.config, pool+"/renamed"),
+					testAccCheckDatasetExists(loopback.config, pool+"/renamed@tfacc"),
+				),
+			},
+			{
+				Config:   testAccLoopbackConfig(pool, loopback.devices, "renamed"),
+				PlanOnly: true,
+			},
+		},
+	})
+}
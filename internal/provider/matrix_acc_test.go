@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// The acceptance tests run against every OpenZFS release in the test matrix, one host per release. Tests for
+// features which older releases lack check the version of the host, and either skip or expect the feature to be
+// rejected. ZFS_PROVIDER_TEST_ZFS_VERSION is the release the host is expected to run, e.g. 2.2, so that a
+// misconfigured matrix fails instead of quietly testing the same release twice.
+
+// testAccFeatureVersions are the OpenZFS releases which introduced the features that tests are gated on.
+var testAccFeatureVersions = map[string]ZfsVersion{
+	"raw_send":    {major: 0, minor: 8},
+	"draid":       {major: 2, minor: 1},
+	"json_output": {major: 2, minor: 3},
+}
+
+// testAccHostVersion returns the OpenZFS version of the test host, and checks it against ZFS_PROVIDER_TEST_ZFS_VERSION.
+func testAccHostVersion(t *testing.T) ZfsVersion {
+	version := hostZfsVersion(testAccConfig(t))
+	if version == nil {
+		t.Fatalf("failed to read the zfs version of the test host")
+	}
+
+	if expected := os.Getenv("ZFS_PROVIDER_TEST_ZFS_VERSION"); expected != "" {
+		if actual := fmt.Sprintf("%d.%d", version.major, version.minor); actual != expected {
+			t.Fatalf("expected the test host to run OpenZFS %s, but it runs %s", expected, version)
+		}
+	}
+	return *version
+}
+
+// testAccSupports reports whether the test host supports a feature of testAccFeatureVersions.
+func testAccSupports(t *testing.T, feature string) bool {
+	minimum, ok := testAccFeatureVersions[feature]
+	if !ok {
+		t.Fatalf("unknown feature %q", feature)
+	}
+	return testAccHostVersion(t).atLeast(minimum)
+}
+
+// testAccSkipUnlessSupported skips a test on hosts which don't support a feature of testAccFeatureVersions.
+func testAccSkipUnlessSupported(t *testing.T, feature string) {
+	if !testAccSupports(t, feature) {
+		t.Skipf("%s requires OpenZFS %s, the test host runs %s", feature, testAccFeatureVersions[feature], testAccHostVersion(t))
+	}
+}
+
+// TestAccHostVersion verifies the test host runs the OpenZFS release the matrix expects.
+func TestAccHostVersion(t *testing.T) {
+	testAccSkipWithoutHost(t)
+
+	t.Logf("test host runs OpenZFS %s", testAccHostVersion(t))
+}
+
+// TestAccJsonOutputDetection verifies that JSON output is detected on exactly the releases which support it.
+func TestAccJsonOutputDetection(t *testing.T) {
+	testAccSkipWithoutHost(t)
+
+	config := testAccConfig(t)
+	config.json_output = JsonOutputAuto
+	if supported, expected := useJsonOutput(config), testAccSupports(t, "json_output"); supported != expected {
+		t.Fatalf("expected json output support to be %t, detected %t", expected, supported)
+	}
+}
+
+// TestAccDraid verifies that draid vdevs are accepted by releases which support them, and rejected by older ones.
+// The pool is only created as a dry run, so nothing is left behind.
+func TestAccDraid(t *testing.T) {
+	testAccSkipWithoutHost(t)
+
+	testAccCreateVdevs(t)
+	vdevs := testAccVdevs()
+	_, err := callSshCommand(testAccConfig(t), "zpool create -n %s-draid draid1:1d:2c:0s %s %s", testAccPoolName(), vdevs[0], vdevs[1])
+
+	if testAccSupports(t, "draid") && err != nil {
+		t.Fatalf("expected a draid pool to be accepted, got %s", err)
+	}
+	if !testAccSupports(t, "draid") && err == nil {
+		t.Fatalf("expected a draid pool to be rejected by OpenZFS %s", testAccHostVersion(t))
+	}
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const defaultMetadataProperty = "terraform:metadata"
+
+var metadataSchema = schema.Schema{
+	Description: "Arbitrary metadata such as an owner, ticket or expiry date, stored as a single JSON object in the user property named by `metadata_property`.",
+	Type:        schema.TypeMap,
+	Optional:    true,
+	Elem:        &schema.Schema{Type: schema.TypeString},
+}
+
+var metadataPropertySchema = schema.Schema{
+	Description:      "Name of the user property holding `metadata`. User property names must contain a colon. Defaults to `terraform:metadata`.",
+	Type:             schema.TypeString,
+	Optional:         true,
+	Default:          defaultMetadataProperty,
+	ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(userPropertyPattern, "must be a user property name, e.g. com.example:metadata")),
+}
+
+func serializeMetadata(metadata map[string]interface{}) (string, error) {
+	// Maps are marshalled with sorted keys, so the same metadata always gives the same value.
+	serialized, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	return string(serialized), nil
+}
+
+// parseMetadata parses the JSON object stored in a metadata property. Values which aren't strings,
+// e.g. when the property was written by another tool, are kept as their JSON representation.
+func parseMetadata(value string) (map[string]string, error) {
+	var parsed map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, fmt.Errorf("metadata is not a JSON object: %s", err)
+	}
+
+	metadata := make(map[string]string)
+	for key, raw := range parsed {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			metadata[key] = text
+		} else {
+			metadata[key] = string(raw)
+		}
+	}
+	return metadata, nil
+}
+
+// addMetadataProperty adds the serialized metadata to a set of properties, if any metadata is configured.
+func addMetadataProperty(d *schema.ResourceData, properties map[string]string) error {
+	metadata := d.Get("metadata").(map[string]interface{})
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	serialized, err := serializeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	properties[d.Get("metadata_property").(string)] = serialized
+	return nil
+}
+
+// resetMetadataProperty inherits the previous metadata property when metadata is removed, or moves to another property.
+func resetMetadataProperty(config *Config, d *schema.ResourceData, datasetName string) error {
+	oldProperty, newProperty := d.GetChange("metadata_property")
+	oldMetadata, newMetadata := d.GetChange("metadata")
+
+	if len(oldMetadata.(map[string]interface{})) == 0 {
+		return nil
+	}
+	if oldProperty == newProperty && len(newMetadata.(map[string]interface{})) > 0 {
+		return nil
+	}
+
+	_, err := callSshCommand(config, "zfs inherit %s %s", shellescape.Quote(oldProperty.(string)), datasetName)
+	return err
+}
+
+// updateMetadataInState reads the metadata back from the dataset properties. Metadata which can't be
+// parsed is treated as empty, so the next apply overwrites it.
+func updateMetadataInState(d *schema.ResourceData, properties map[string]Property) error {
+	metadata := make(map[string]string)
+	if property, ok := properties[d.Get("metadata_property").(string)]; ok && property.value != "-" {
+		parsed, err := parseMetadata(property.value)
+		if err != nil {
+			log.Printf("[WARN] ignoring metadata of %s: %s", d.Get("name"), err)
+		} else {
+			metadata = parsed
+		}
+	}
+	return d.Set("metadata", metadata)
+}
@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSerializeMetadata verifies that metadata is stored as a JSON object with sorted keys.
+func TestSerializeMetadata(t *testing.T) {
+	serialized, err := serializeMetadata(map[string]interface{}{"ticket": "OPS-123", "owner": "storage"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := `{"owner":"storage","ticket":"OPS-123"}`; serialized != expected {
+		t.Fatalf("expected %s, got %s", expected, serialized)
+	}
+}
+
+// TestParseMetadata verifies that metadata is parsed back, keeping non-string values as JSON.
+func TestParseMetadata(t *testing.T) {
+	metadata, err := parseMetadata(`{"owner":"storage","retain":30,"tags":["a","b"]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]string{"owner": "storage", "retain": "30", "tags": `["a","b"]`}
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Fatalf("expected %v, got %v", expected, metadata)
+	}
+
+	if _, err := parseMetadata("not json"); err == nil {
+		t.Fatalf("expected an error for invalid metadata")
+	}
+}
+
+// TestUserPropertyPattern verifies the user property name check used for metadata_property.
+func TestUserPropertyPattern(t *testing.T) {
+	if !userPropertyPattern.MatchString("terraform:metadata") || userPropertyPattern.MatchString("metadata") {
+		t.Fatalf("unexpected user property pattern match")
+	}
+}
@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandMetrics counts the commands run by the provider and how long they took, per operation such as
+// "zfs list", so that slow refreshes and applies can be quantified. The summary is written to metrics_path
+// after every command, as the provider can't tell when terraform is done with it. Every plan or apply starts
+// a new provider process, so the file holds the summary of the latest one. A nil CommandMetrics records nothing.
+type CommandMetrics struct {
+	mu         sync.Mutex
+	path       string
+	started    time.Time
+	operations map[string]*OperationMetrics
+}
+
+type OperationMetrics struct {
+	Count         int     `json:"count"`
+	Errors        int     `json:"errors"`
+	TotalSeconds  float64 `json:"total_seconds"`
+	MaxSeconds    float64 `json:"max_seconds"`
+	WaitedSeconds float64 `json:"waited_seconds"`
+}
+
+type metricsSummary struct {
+	StartedAt    string                       `json:"started_at"`
+	Commands     int                          `json:"commands"`
+	TotalSeconds float64                      `json:"total_seconds"`
+	Operations   map[string]*OperationMetrics `json:"operations"`
+}
+
+func newCommandMetrics(path string) *CommandMetrics {
+	if path == "" {
+		return nil
+	}
+	return &CommandMetrics{
+		path:       path,
+		started:    time.Now(),
+		operations: make(map[string]*OperationMetrics),
+	}
+}
+
+// commandOperation names the operation of a command by the zfs or zpool subcommand it runs, e.g. "zpool status"
+// for "zpool status -pP tank", or by the name of the program otherwise.
+func commandOperation(cmd string) string {
+	fields := strings.Fields(cmd)
+	for i, field := range fields {
+		if (field == "zfs" || field == "zpool") && i+1 < len(fields) {
+			return field + " " + fields[i+1]
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// record adds a command, which waited for the concurrency limiter and then ran for the given durations.
+func (metrics *CommandMetrics) record(cmd string, waited time.Duration, took time.Duration, err error) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	name := commandOperation(cmd)
+	operation, ok := metrics.operations[name]
+	if !ok {
+		operation = &OperationMetrics{}
+		metrics.operations[name] = operation
+	}
+
+	operation.Count++
+	if err != nil {
+		operation.Errors++
+	}
+	operation.TotalSeconds += took.Seconds()
+	operation.WaitedSeconds += waited.Seconds()
+	if took.Seconds() > operation.MaxSeconds {
+		operation.MaxSeconds = took.Seconds()
+	}
+
+	if err := metrics.write(); err != nil {
+		log.Printf("[WARN] failed to write the command metrics to %s: %s", metrics.path, err)
+	}
+}
+
+func (metrics *CommandMetrics) summary() metricsSummary {
+	summary := metricsSummary{
+		StartedAt:  metrics.started.UTC().Format(time.RFC3339),
+		Operations: metrics.operations,
+	}
+	for _, operation := range metrics.operations {
+		summary.Commands += operation.Count
+		summary.TotalSeconds += operation.TotalSeconds
+	}
+	return summary
+}
+
+// write replaces the metrics file with the current summary. It is written to a temporary file first, so that
+// readers never see a partial summary.
+func (metrics *CommandMetrics) write() error {
+	output, err := json.MarshalIndent(metrics.summary(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temporary, err := os.CreateTemp(filepath.Dir(metrics.path), filepath.Base(metrics.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+
+	if _, err := temporary.Write(append(output, '\n')); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), metrics.path)
+}
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCommandOperation verifies that commands are grouped by their zfs or zpool subcommand.
+func TestCommandOperation(t *testing.T) {
+	for cmd, expected := range map[string]string{
+		"zfs list -H -o name tank":             "zfs list",
+		"zpool status -pP tank":                "zpool status",
+		"printf '%s' 'x' | zfs program tank -": "zfs program",
+		"udevadm settle":                       "udevadm",
+		"":                                     "",
+	} {
+		if got := commandOperation(cmd); got != expected {
+			t.Fatalf("commandOperation(%q): expected %q, got %q", cmd, expected, got)
+		}
+	}
+}
+
+// TestCommandMetrics verifies that commands run through the provider are summarized in the metrics file.
+func TestCommandMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	executor := (&fakeExecutor{}).on("zfs list", "tank\n").fail("zfs destroy", "cannot destroy 'tank/data': permission denied")
+	config := newFakeConfig(executor)
+	config.retry_max_attempts = 1
+	config.metrics = newCommandMetrics(path)
+
+	_, _ = callSshCommand(config, "zfs list -H -o name")
+	_, _ = callSshCommand(config, "zfs list -H -o name tank")
+	_, _ = callSshCommand(config, "zfs destroy tank/data")
+
+	output, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var summary metricsSummary
+	if err := json.Unmarshal(output, &summary); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if summary.Commands != 3 || summary.Operations["zfs list"].Count != 2 || summary.Operations["zfs destroy"].Errors != 1 {
+		t.Fatalf("unexpected summary %s", output)
+	}
+}
+
+// TestCommandMetricsDisabled verifies that nothing is recorded without a metrics path.
+func TestCommandMetricsDisabled(t *testing.T) {
+	metrics := newCommandMetrics("")
+	metrics.record("zfs list", 0, time.Second, errors.New("failed"))
+	if metrics != nil {
+		t.Fatalf("expected no metrics without a path")
+	}
+}
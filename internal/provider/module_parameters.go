@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// moduleParametersDirectory is where Linux exposes the tunables of the zfs kernel module.
+const moduleParametersDirectory = "/sys/module/zfs/parameters/"
+
+var moduleParameterPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// moduleParameterSysctl returns the sysctl FreeBSD exposes a module parameter as, which is its Linux name with the
+// zfs_ prefix replaced by vfs.zfs., e.g. vfs.zfs.arc_max for zfs_arc_max.
+func moduleParameterSysctl(name string) string {
+	return "vfs.zfs." + strings.TrimPrefix(name, "zfs_")
+}
+
+func readModuleParameter(config *Config, name string) (string, error) {
+	command := fmt.Sprintf("cat %s%s", moduleParametersDirectory, name)
+	switch hostPlatform(config) {
+	case PlatformFreeBSD:
+		command = fmt.Sprintf("sysctl -n %s", moduleParameterSysctl(name))
+	case PlatformIllumos:
+		return "", unsupportedOnPlatform(config, "setting module parameters")
+	}
+
+	stdout, err := callSshCommand(config, "%s", command)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// writeModuleParameter changes a tunable of the running zfs module. The change is lost when the module is reloaded.
+func writeModuleParameter(config *Config, name string, value string) error {
+	command := fmt.Sprintf("echo %s > %s%s", shellescape.Quote(value), moduleParametersDirectory, name)
+	switch hostPlatform(config) {
+	case PlatformFreeBSD:
+		command = fmt.Sprintf("sysctl %s=%s >/dev/null", moduleParameterSysctl(name), shellescape.Quote(value))
+	case PlatformIllumos:
+		return unsupportedOnPlatform(config, "setting module parameters")
+	}
+
+	_, err := callSshCommand(config, "%s", command)
+	return err
+}
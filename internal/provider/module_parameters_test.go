@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestModuleParameterRestore verifies the original value of a module parameter is restored on destroy.
+func TestModuleParameterRestore(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("cat /sys/module/zfs/parameters/zfs_bclone_enabled", "0\n").
+		on("echo", "")
+	config := newFakeConfig(executor)
+
+	d := schema.TestResourceDataRaw(t, resourceModuleParameter().Schema, map[string]interface{}{
+		"name":  "zfs_bclone_enabled",
+		"value": "1",
+	})
+
+	if diags := resourceModuleParameterCreate(context.Background(), d, config); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Get("original_value").(string) != "0" {
+		t.Fatalf("expected original value 0, got %q", d.Get("original_value"))
+	}
+	if !executor.ran("echo 1 > /sys/module/zfs/parameters/zfs_bclone_enabled") {
+		t.Fatalf("expected the parameter to be set, ran %v", executor.commands)
+	}
+
+	if diags := resourceModuleParameterDelete(context.Background(), d, config); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if !executor.ran("echo 0 > /sys/module/zfs/parameters/zfs_bclone_enabled") {
+		t.Fatalf("expected the parameter to be restored, ran %v", executor.commands)
+	}
+}
+
+// TestModuleParameterFreeBSD verifies that module parameters are read and set through their sysctl on FreeBSD.
+func TestModuleParameterFreeBSD(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("sysctl -n vfs.zfs.bclone_enabled", "0\n").
+		on("sysctl vfs.zfs.bclone_enabled=", "")
+	config := newFakeConfig(executor)
+	config.platform = PlatformFreeBSD
+
+	d := schema.TestResourceDataRaw(t, resourceModuleParameter().Schema, map[string]interface{}{
+		"name":  "zfs_bclone_enabled",
+		"value": "1",
+	})
+
+	if diags := resourceModuleParameterCreate(context.Background(), d, config); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Get("original_value").(string) != "0" {
+		t.Fatalf("expected original value 0, got %q", d.Get("original_value"))
+	}
+	if !executor.ran("sysctl vfs.zfs.bclone_enabled=1") {
+		t.Fatalf("expected the parameter to be set, ran %v", executor.commands)
+	}
+}
@@ -0,0 +1,188 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// OriginEntry is a dataset or snapshot as listed by readOriginGraph.
+type OriginEntry struct {
+	name string
+	// origin is the snapshot a clone was created from, empty for datasets which aren't clones and for snapshots.
+	origin string
+	// clones are the datasets cloned from a snapshot.
+	clones []string
+	// userrefs is the number of holds on a snapshot.
+	userrefs int64
+}
+
+// OriginGraph links the datasets and snapshots of a pool through their origin and clones properties.
+type OriginGraph struct {
+	entries map[string]*OriginEntry
+}
+
+// DependentClone is a clone which depends on a snapshot of a dataset, directly or through other clones.
+type DependentClone struct {
+	name   string
+	origin string
+	// depth is 1 for clones of the snapshots of the dataset itself, 2 for clones of the snapshots of those, and so on.
+	depth int
+}
+
+type SnapshotHold struct {
+	snapshot string
+	tag      string
+}
+
+// parseOriginList parses the output of zfs list -H -p -o name,origin,clones,userrefs. Properties which don't apply
+// to a type of dataset are listed as -, and a snapshot without clones may list an empty value.
+func parseOriginList(output string) (*OriginGraph, error) {
+	graph := &OriginGraph{entries: make(map[string]*OriginEntry)}
+
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected zfs list output %q", line)
+		}
+
+		entry := &OriginEntry{name: fields[0], clones: make([]string, 0)}
+		if fields[1] != "-" {
+			entry.origin = fields[1]
+		}
+		if fields[2] != "-" && fields[2] != "" {
+			entry.clones = strings.Split(fields[2], ",")
+			sort.Strings(entry.clones)
+		}
+		if fields[3] != "-" {
+			userrefs, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected userrefs in zfs list output %q", line)
+			}
+			entry.userrefs = userrefs
+		}
+		graph.entries[entry.name] = entry
+	}
+
+	return graph, nil
+}
+
+// readOriginGraph lists every dataset and snapshot in the pool of a dataset. Clones always live in the pool of their
+// origin, so this covers the whole ancestry and all dependents.
+func readOriginGraph(config *Config, datasetName string) (*OriginGraph, error) {
+	stdout, err := callSshCommand(config, "zfs list -H -p -r -t filesystem,volume,snapshot -o name,origin,clones,userrefs %s", shellescape.Quote(poolOf(datasetName)))
+	if err != nil {
+		return nil, err
+	}
+	return parseOriginList(stdout)
+}
+
+// inTree reports whether a dataset or snapshot is the given dataset, one of its snapshots, or one of its descendants.
+func inTree(name string, datasetName string) bool {
+	return name == datasetName || strings.HasPrefix(name, datasetName+"@") || strings.HasPrefix(name, datasetName+"/")
+}
+
+// ancestry returns the origin snapshots a dataset was cloned from, nearest first: the origin of the dataset, then the
+// origin of the dataset that snapshot belongs to, and so on.
+func (graph *OriginGraph) ancestry(datasetName string) ([]string, error) {
+	entry, ok := graph.entries[datasetName]
+	if !ok {
+		return nil, fmt.Errorf("dataset %s does not exist", datasetName)
+	}
+
+	chain := make([]string, 0)
+	for entry.origin != "" {
+		if contains(chain, entry.origin) {
+			return nil, fmt.Errorf("the origins of %s form a cycle: %s", datasetName, strings.Join(chain, ", "))
+		}
+		chain = append(chain, entry.origin)
+
+		parent, ok := graph.entries[strings.SplitN(entry.origin, "@", 2)[0]]
+		if !ok {
+			break
+		}
+		entry = parent
+	}
+	return chain, nil
+}
+
+// snapshots returns the snapshots of a dataset and its descendants, which zfs destroy -r destroys along with it.
+func (graph *OriginGraph) snapshots(datasetName string) []*OriginEntry {
+	snapshots := make([]*OriginEntry, 0)
+	for name, entry := range graph.entries {
+		if strings.Contains(name, "@") && inTree(name, datasetName) {
+			snapshots = append(snapshots, entry)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].name < snapshots[j].name })
+	return snapshots
+}
+
+// dependentClones returns the clones outside of a dataset and its descendants which depend on its snapshots, followed by
+// the clones depending on those in turn. Destroying the dataset requires destroying all of them first.
+func (graph *OriginGraph) dependentClones(datasetName string) []DependentClone {
+	dependents := make([]DependentClone, 0)
+	seen := map[string]bool{}
+
+	level := []string{datasetName}
+	for depth := 1; len(level) > 0; depth++ {
+		next := make([]string, 0)
+		for _, tree := range level {
+			for _, snapshot := range graph.snapshots(tree) {
+				for _, clone := range snapshot.clones {
+					if inTree(clone, datasetName) || seen[clone] {
+						continue
+					}
+					seen[clone] = true
+					dependents = append(dependents, DependentClone{name: clone, origin: snapshot.name, depth: depth})
+					next = append(next, clone)
+				}
+			}
+		}
+		level = next
+	}
+	return dependents
+}
+
+// parseHolds parses the output of zfs holds -H, e.g.
+//
+//	tank/data@monday	keep	Mon Jan  1 00:00 2024
+func parseHolds(output string) ([]SnapshotHold, error) {
+	holds := make([]SnapshotHold, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("unexpected zfs holds output %q", line)
+		}
+		holds = append(holds, SnapshotHold{snapshot: fields[0], tag: fields[1]})
+	}
+	return holds, nil
+}
+
+// readHolds lists the holds on the given snapshots. Only snapshots with holds need to be given, which saves the
+// command entirely in the common case of none.
+func readHolds(config *Config, snapshots []string) ([]SnapshotHold, error) {
+	if len(snapshots) == 0 {
+		return make([]SnapshotHold, 0), nil
+	}
+
+	quoted := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		quoted = append(quoted, shellescape.Quote(snapshot))
+	}
+	stdout, err := callSshCommand(config, "zfs holds -H %s", strings.Join(quoted, " "))
+	if err != nil {
+		return nil, err
+	}
+	return parseHolds(stdout)
+}
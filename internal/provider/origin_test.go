@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+// originListOutput is a golden image with two generations of clones, and a clone of a child of the image.
+const originListOutput = "tank\t-\t-\t-\n" +
+	"tank/golden\t-\t-\t-\n" +
+	"tank/golden@2024\t-\ttank/images/base\t0\n" +
+	"tank/images/base\ttank/golden@2024\t-\t-\n" +
+	"tank/images/base@v3\t-\ttank/vms/web01,tank/vms/web02\t1\n" +
+	"tank/images/base/home\t-\t-\t-\n" +
+	"tank/images/base/home@v3\t-\ttank/vms/web01-home\t0\n" +
+	"tank/images/base@v4\t-\t\t0\n" +
+	"tank/vms/web01\ttank/images/base@v3\t-\t-\n" +
+	"tank/vms/web01@pre-upgrade\t-\ttank/vms/web01-test\t0\n" +
+	"tank/vms/web01-test\ttank/vms/web01@pre-upgrade\t-\t-\n" +
+	"tank/vms/web01-home\ttank/images/base/home@v3\t-\t-\n" +
+	"tank/vms/web02\ttank/images/base@v3\t-\t-\n"
+
+// TestOriginGraphAncestry verifies that the origins of clones are followed back to a dataset which isn't a clone.
+func TestOriginGraphAncestry(t *testing.T) {
+	graph, err := parseOriginList(originListOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ancestry, err := graph.ancestry("tank/vms/web01-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(ancestry, []string{"tank/vms/web01@pre-upgrade", "tank/images/base@v3", "tank/golden@2024"}) {
+		t.Fatalf("unexpected ancestry %v", ancestry)
+	}
+
+	if ancestry, err := graph.ancestry("tank/golden"); err != nil || len(ancestry) != 0 {
+		t.Fatalf("expected no ancestry, got %v, %v", ancestry, err)
+	}
+	if _, err := graph.ancestry("tank/missing"); err == nil {
+		t.Fatalf("expected an error for a missing dataset")
+	}
+}
+
+// TestOriginGraphDependentClones verifies that clones of the snapshots of descendants are included, and that clones of
+// clones are found at the next depth.
+func TestOriginGraphDependentClones(t *testing.T) {
+	graph, err := parseOriginList(originListOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []DependentClone{
+		{name: "tank/vms/web01-home", origin: "tank/images/base/home@v3", depth: 1},
+		{name: "tank/vms/web01", origin: "tank/images/base@v3", depth: 1},
+		{name: "tank/vms/web02", origin: "tank/images/base@v3", depth: 1},
+		{name: "tank/vms/web01-test", origin: "tank/vms/web01@pre-upgrade", depth: 2},
+	}
+	if dependents := graph.dependentClones("tank/images/base"); !reflect.DeepEqual(dependents, expected) {
+		t.Fatalf("unexpected dependent clones %+v", dependents)
+	}
+
+	// Nothing was cloned from the snapshots of the newest clone.
+	if dependents := graph.dependentClones("tank/vms/web01-test"); len(dependents) != 0 {
+		t.Fatalf("expected no dependent clones, got %+v", dependents)
+	}
+
+	snapshots := graph.snapshots("tank/images/base")
+	names := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.name)
+	}
+	if !reflect.DeepEqual(names, []string{"tank/images/base/home@v3", "tank/images/base@v3", "tank/images/base@v4"}) {
+		t.Fatalf("unexpected snapshots %v", names)
+	}
+}
+
+// TestReadHolds verifies that holds are only listed for the given snapshots, and not at all without any.
+func TestReadHolds(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zfs holds -H", "tank/images/base@v3\tkeep\tMon Jan  1 00:00 2024\n")
+	config := newFakeConfig(executor)
+
+	if holds, err := readHolds(config, nil); err != nil || len(holds) != 0 || len(executor.commands) != 0 {
+		t.Fatalf("unexpected result %v, %v, commands %v", holds, err, executor.commands)
+	}
+
+	holds, err := readHolds(config, []string{"tank/images/base@v3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(holds, []SnapshotHold{{snapshot: "tank/images/base@v3", tag: "keep"}}) {
+		t.Fatalf("unexpected holds %+v", holds)
+	}
+}
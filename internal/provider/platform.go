@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Operating systems the provider knows the commands and device paths of. OpenZFS behaves the same on all of them,
+// but the tools around it don't, e.g. lsblk and /dev/disk/by-id only exist on Linux.
+const (
+	PlatformAuto    = "auto"
+	PlatformLinux   = "linux"
+	PlatformFreeBSD = "freebsd"
+	PlatformIllumos = "illumos"
+)
+
+var platformModes = []string{PlatformAuto, PlatformLinux, PlatformFreeBSD, PlatformIllumos}
+
+// parsePlatform maps the output of uname -s to a platform. TrueNAS CORE reports FreeBSD, and illumos
+// distributions such as OmniOS and SmartOS report SunOS.
+func parsePlatform(uname string) (string, error) {
+	switch strings.TrimSpace(uname) {
+	case "Linux":
+		return PlatformLinux, nil
+	case "FreeBSD":
+		return PlatformFreeBSD, nil
+	case "SunOS":
+		return PlatformIllumos, nil
+	default:
+		return "", fmt.Errorf("unsupported operating system %q", strings.TrimSpace(uname))
+	}
+}
+
+// hostPlatform returns the platform of the host, which is detected once per provider instance unless it is
+// configured. Hosts which can't be told are assumed to run Linux, like the provider always did.
+func hostPlatform(config *Config) string {
+	if config.platform != "" && config.platform != PlatformAuto {
+		return config.platform
+	}
+
+	config.platform_once.Do(func() {
+		config.detected_platform = PlatformLinux
+
+		stdout, err := callSshCommand(config, "uname -s")
+		if err != nil {
+			log.Printf("[DEBUG] failed to detect the platform, assuming linux: %s", err)
+			return
+		}
+		platform, err := parsePlatform(stdout)
+		if err != nil {
+			log.Printf("[DEBUG] %s, assuming linux", err)
+			return
+		}
+		log.Printf("[DEBUG] platform: %s", platform)
+		config.detected_platform = platform
+	})
+	return config.detected_platform
+}
+
+// unsupportedOnPlatform is the error of operations which rely on tools the host's platform lacks.
+func unsupportedOnPlatform(config *Config, operation string) error {
+	return fmt.Errorf("%s is not supported on %s hosts", operation, hostPlatform(config))
+}
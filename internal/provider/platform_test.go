@@ -0,0 +1,69 @@
+package provider
+
+import "testing"
+
+// TestParsePlatform verifies that uname output is mapped to the supported platforms.
+func TestParsePlatform(t *testing.T) {
+	cases := map[string]string{
+		"Linux\n":   PlatformLinux,
+		"FreeBSD\n": PlatformFreeBSD,
+		"SunOS\n":   PlatformIllumos,
+	}
+	for uname, expected := range cases {
+		platform, err := parsePlatform(uname)
+		if err != nil {
+			t.Fatalf("parsePlatform(%q) returned error: %v", uname, err)
+		}
+		if platform != expected {
+			t.Fatalf("expected %s for %q, got %s", expected, uname, platform)
+		}
+	}
+
+	if _, err := parsePlatform("Darwin\n"); err == nil {
+		t.Fatalf("expected an error for an unsupported operating system")
+	}
+}
+
+// TestHostPlatform verifies that the platform is detected once, and that undetectable hosts are assumed to run Linux.
+func TestHostPlatform(t *testing.T) {
+	executor := (&fakeExecutor{}).on("uname -s", "FreeBSD\n")
+	config := newFakeConfig(executor)
+	config.platform = PlatformAuto
+
+	for i := 0; i < 2; i++ {
+		if platform := hostPlatform(config); platform != PlatformFreeBSD {
+			t.Fatalf("expected freebsd, got %s", platform)
+		}
+	}
+	if len(executor.commands) != 1 {
+		t.Fatalf("expected the platform to be detected once, ran %v", executor.commands)
+	}
+
+	config = newFakeConfig((&fakeExecutor{}).fail("uname -s", "uname: not found"))
+	config.platform = PlatformAuto
+	if platform := hostPlatform(config); platform != PlatformLinux {
+		t.Fatalf("expected linux as fallback, got %s", platform)
+	}
+}
+
+// TestCheckDeviceReferencesSupported verifies that cloud volume and iSCSI references are rejected outside Linux.
+func TestCheckDeviceReferencesSupported(t *testing.T) {
+	devices := map[string]Device{
+		"/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol0123456789abcdef0": {path: "aws:vol-0123456789abcdef0"},
+		"/dev/ada1": {path: "/dev/ada1"},
+	}
+
+	config := newFakeConfig(&fakeExecutor{})
+	if err := checkDeviceReferencesSupported(config, devices); err != nil {
+		t.Fatalf("unexpected error on linux: %v", err)
+	}
+
+	config.platform = PlatformFreeBSD
+	if err := checkDeviceReferencesSupported(config, devices); err == nil {
+		t.Fatalf("expected an error on freebsd")
+	}
+	delete(devices, "/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol0123456789abcdef0")
+	if err := checkDeviceReferencesSupported(config, devices); err != nil {
+		t.Fatalf("unexpected error for plain devices: %v", err)
+	}
+}
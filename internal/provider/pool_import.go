@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+type PoolImport struct {
+	pool        string
+	newName     string
+	directories []string
+	force       bool
+	altroot     string
+	readonly    bool
+}
+
+// PoolReference is the name and guid of an imported pool.
+type PoolReference struct {
+	name string
+	guid string
+}
+
+// findImportedPool looks up an imported pool by name or guid. It returns nil if the pool isn't imported.
+func findImportedPool(config *Config, pool string) (*PoolReference, error) {
+	stdout, err := callSshCommand(config, "zpool list -H -o name,guid")
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(strings.NewReader(stdout))
+	reader.Comma = '\t'
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if line[0] == pool || line[1] == pool {
+			return &PoolReference{name: line[0], guid: line[1]}, nil
+		}
+	}
+	return nil, nil
+}
+
+func importPoolCommand(spec PoolImport) string {
+	options := ""
+	for _, directory := range spec.directories {
+		options += " -d " + shellescape.Quote(directory)
+	}
+	if spec.force {
+		options += " -f"
+	}
+	if spec.altroot != "" {
+		options += " -R " + shellescape.Quote(spec.altroot)
+	}
+	if spec.readonly {
+		options += " -o readonly=on"
+	}
+
+	command := fmt.Sprintf("zpool import%s %s", options, shellescape.Quote(spec.pool))
+	if spec.newName != "" {
+		command += " " + shellescape.Quote(spec.newName)
+	}
+	return command
+}
+
+// importPool imports an exported pool, unless it is imported already, and returns the name and guid it is imported as.
+func importPool(ctx context.Context, config *Config, spec PoolImport) (*PoolReference, error) {
+	pool, err := findImportedPool(config, spec.pool)
+	if err != nil {
+		return nil, err
+	}
+	if pool != nil {
+		return pool, nil
+	}
+
+	if _, err := callSshCommandContext(ctx, config, "%s", importPoolCommand(spec)); err != nil {
+		return nil, err
+	}
+
+	name := spec.pool
+	if spec.newName != "" {
+		name = spec.newName
+	}
+	pool, err = findImportedPool(config, name)
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		return nil, &PoolError{errmsg: fmt.Sprintf("pool %s was not found after importing it", name)}
+	}
+	return pool, nil
+}
@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"context"
+	"testing"
+)
+
+// TestImportPoolCommand verifies that the options of an import are passed to zpool import.
+func TestImportPoolCommand(t *testing.T) {
+	command := importPoolCommand(PoolImport{
+		pool:        "1234567890",
+		newName:     "recovered",
+		directories: []string{"/dev/disk/by-id", "/mnt/images"},
+		force:       true,
+		altroot:     "/mnt/recovery",
+		readonly:    true,
+	})
+	expected := "zpool import -d /dev/disk/by-id -d /mnt/images -f -R /mnt/recovery -o readonly=on 1234567890 recovered"
+	if command != expected {
+		t.Fatalf("expected %q, got %q", expected, command)
+	}
+}
+
+// TestImportPool verifies that exported pools are imported, and that imported pools are left alone.
+func TestImportPool(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zpool list -H -o name,guid", "rpool\t1111\n").
+		on("zpool import", "")
+	config := newFakeConfig(executor)
+
+	pool, err := importPool(context.Background(), config, PoolImport{pool: "1111"})
+	if err != nil || pool.name != "rpool" {
+		t.Fatalf("unexpected result %v, %v", pool, err)
+	}
+	if executor.ran("zpool import") {
+		t.Fatalf("expected an imported pool to be left alone, ran %v", executor.commands)
+	}
+
+	if _, err := importPool(context.Background(), config, PoolImport{pool: "tank"}); err == nil {
+		t.Fatalf("expected an error when the pool doesn't show up after importing it")
+	}
+	if !executor.ran("zpool import tank") {
+		t.Fatalf("expected tank to be imported, ran %v", executor.commands)
+	}
+}
@@ -0,0 +1,139 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// PoolUsage is the space usage of a pool, as reported by zpool list. Sizes are in bytes.
+type PoolUsage struct {
+	size          int64
+	allocated     int64
+	free          int64
+	capacity      int64
+	fragmentation int64
+	dedupRatio    float64
+}
+
+var poolSizeSchema = schema.Schema{
+	Description: "Total size of the pool in bytes.",
+	Type:        schema.TypeInt,
+	Computed:    true,
+}
+
+var poolAllocatedSchema = schema.Schema{
+	Description: "Space allocated in the pool in bytes.",
+	Type:        schema.TypeInt,
+	Computed:    true,
+}
+
+var poolFreeSchema = schema.Schema{
+	Description: "Space not allocated in the pool in bytes.",
+	Type:        schema.TypeInt,
+	Computed:    true,
+}
+
+var poolCapacityPercentSchema = schema.Schema{
+	Description: "Percentage of the pool which is allocated.",
+	Type:        schema.TypeInt,
+	Computed:    true,
+}
+
+var poolFragmentationSchema = schema.Schema{
+	Description: "Percentage of fragmentation of the free space in the pool. -1 if unknown.",
+	Type:        schema.TypeInt,
+	Computed:    true,
+}
+
+var poolDedupRatioSchema = schema.Schema{
+	Description: "Deduplication ratio of the pool, e.g. `1.5` when deduplication saves a third of the space.",
+	Type:        schema.TypeFloat,
+	Computed:    true,
+}
+
+// poolUsageColumns are the zpool list columns (and pool properties) parsed by parsePoolUsage, in order.
+var poolUsageColumns = []string{"size", "allocated", "free", "capacity", "fragmentation", "dedupratio"}
+
+// poolUsageFromProperties takes the usage from the (parsable) pool properties, which hold the same values as zpool list.
+func poolUsageFromProperties(properties map[string]Property) (*PoolUsage, error) {
+	values := make([]string, 0, len(poolUsageColumns))
+	for _, column := range poolUsageColumns {
+		value := properties[column].rawValue
+		if value == "" {
+			value = "-"
+		}
+		values = append(values, value)
+	}
+	return parsePoolUsage(strings.Join(values, "\t"))
+}
+
+// parsePoolUsage parses a line of `zpool list -Hp -o size,allocated,free,capacity,fragmentation,dedupratio`.
+// Fragmentation is reported as "-" when it is unknown, which is returned as -1. An unknown dedup ratio is returned as 1.
+func parsePoolUsage(output string) (*PoolUsage, error) {
+	fields := strings.Fields(output)
+	if len(fields) != len(poolUsageColumns) {
+		return nil, fmt.Errorf("unexpected zpool list output %q", output)
+	}
+
+	integers := make([]int64, 5)
+	for i, field := range fields[:5] {
+		field = strings.TrimSuffix(field, "%")
+		if field == "-" {
+			integers[i] = -1
+			continue
+		}
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %s", poolUsageColumns[i], field, err)
+		}
+		integers[i] = value
+	}
+
+	dedupRatio := float64(1)
+	if fields[5] != "-" {
+		var err error
+		if dedupRatio, err = parseDecimal(strings.TrimSuffix(fields[5], "x")); err != nil {
+			return nil, fmt.Errorf("invalid dedupratio %q: %s", fields[5], err)
+		}
+	}
+
+	return &PoolUsage{
+		size:          integers[0],
+		allocated:     integers[1],
+		free:          integers[2],
+		capacity:      integers[3],
+		fragmentation: integers[4],
+		dedupRatio:    dedupRatio,
+	}, nil
+}
+
+// setPoolUsage sets the usage attributes shared by the zfs_pool resource and data source.
+func setPoolUsage(d *schema.ResourceData, usage PoolUsage) error {
+	values := map[string]interface{}{
+		"size":             int(usage.size),
+		"allocated":        int(usage.allocated),
+		"free":             int(usage.free),
+		"capacity_percent": int(usage.capacity),
+		"fragmentation":    int(usage.fragmentation),
+		"dedup_ratio":      usage.dedupRatio,
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPoolUsage reads the usage of a pool with zpool list, bypassing the property cache.
+func readPoolUsage(config *Config, poolName string) (*PoolUsage, error) {
+	stdout, err := callSshCommand(config, "zpool list -Hp -o %s %s", strings.Join(poolUsageColumns, ","), shellescape.Quote(poolName))
+	if err != nil {
+		return nil, err
+	}
+	return parsePoolUsage(stdout)
+}
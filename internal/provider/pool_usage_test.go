@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestParsePoolUsage verifies that the usage columns of zpool list are parsed into numbers.
+func TestParsePoolUsage(t *testing.T) {
+	usage, err := parsePoolUsage("10737418240\t4831838208\t5905580032\t45\t12\t1.50\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := PoolUsage{size: 10737418240, allocated: 4831838208, free: 5905580032, capacity: 45, fragmentation: 12, dedupRatio: 1.5}
+	if *usage != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *usage)
+	}
+
+	usage, err = parsePoolUsage("10737418240\t0\t10737418240\t0%\t-\t1.00x")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if usage.fragmentation != -1 || usage.dedupRatio != 1 {
+		t.Fatalf("unexpected fragmentation %d or dedup ratio %f", usage.fragmentation, usage.dedupRatio)
+	}
+
+	if _, err := parsePoolUsage("10737418240\t-"); err == nil {
+		t.Fatalf("expected an error for malformed output")
+	}
+}
+
+// TestPoolUsageFromProperties verifies that the usage is taken from the raw pool properties.
+func TestPoolUsageFromProperties(t *testing.T) {
+	usage, err := poolUsageFromProperties(map[string]Property{
+		"size":       {rawValue: "1000"},
+		"allocated":  {rawValue: "250"},
+		"free":       {rawValue: "750"},
+		"capacity":   {rawValue: "25"},
+		"dedupratio": {rawValue: "1.00"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := PoolUsage{size: 1000, allocated: 250, free: 750, capacity: 25, fragmentation: -1, dedupRatio: 1}
+	if *usage != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *usage)
+	}
+}
+
+// TestForecastCapacity verifies the linear projection of the allocated space up to the threshold.
+func TestForecastCapacity(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	from := CapacitySample{allocated: 400, at: start}
+
+	forecast := forecastCapacity(1000, 80, from, CapacitySample{allocated: 500, at: start.Add(48 * time.Hour)})
+	if forecast.growthPerDay != 50 || forecast.daysUntilFull != 6 || !forecast.fullAt.Equal(start.Add(8*24*time.Hour)) {
+		t.Fatalf("unexpected forecast %+v", forecast)
+	}
+
+	forecast = forecastCapacity(1000, 100, from, CapacitySample{allocated: 300, at: start.Add(24 * time.Hour)})
+	if forecast.growthPerDay != -100 || forecast.daysUntilFull != -1 || !forecast.fullAt.IsZero() {
+		t.Fatalf("expected a shrinking pool to never be full, got %+v", forecast)
+	}
+
+	forecast = forecastCapacity(1000, 30, from, from)
+	if forecast.daysUntilFull != 0 || !forecast.fullAt.Equal(start) {
+		t.Fatalf("expected a pool past the threshold to be full, got %+v", forecast)
+	}
+}
+
+// TestDataSourcePoolCapacityForecastBaseline verifies that the growth is measured since the baseline, without sampling.
+func TestDataSourcePoolCapacityForecastBaseline(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zpool list -Hp -o size,allocated,free,capacity,fragmentation,dedupratio tank", "1000\t500\t500\t50\t0\t1.00")
+
+	d := schema.TestResourceDataRaw(t, dataSourcePoolCapacityForecast().Schema, map[string]interface{}{
+		"pool": "tank",
+		"baseline": []interface{}{map[string]interface{}{
+			"allocated":  400,
+			"sampled_at": time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339),
+		}},
+	})
+	if diags := dataSourcePoolCapacityForecastRead(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	if len(executor.commands) != 1 {
+		t.Fatalf("expected a single sample, ran %v", executor.commands)
+	}
+	if growth := d.Get("growth_bytes_per_day").(float64); growth < 49 || growth > 51 {
+		t.Fatalf("unexpected growth %f", growth)
+	}
+	if days := d.Get("days_until_full").(float64); days < 9.9 || days > 10.1 || d.Get("full_at").(string) == "" {
+		t.Fatalf("unexpected forecast %f, %s", days, d.Get("full_at"))
+	}
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// ProjectAssignment is the project a directory is accounted to, as listed by zfs project.
+type ProjectAssignment struct {
+	id int
+	// inherit is the inherit flag, which gives files and directories created below the directory its project.
+	inherit bool
+}
+
+// parseProjectAssignment parses the output of zfs project -d, e.g.
+//
+//	100 P /tank/www/example.com
+//
+// where P is the inherit flag, or - when it isn't set.
+func parseProjectAssignment(output string) (*ProjectAssignment, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("unexpected zfs project output %q", output)
+	}
+
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected project id %q", fields[0])
+	}
+	return &ProjectAssignment{id: id, inherit: fields[1] == "P"}, nil
+}
+
+func readProjectAssignment(config *Config, path string) (*ProjectAssignment, error) {
+	stdout, err := callSshCommand(config, "zfs project -d %s", shellescape.Quote(path))
+	if err != nil {
+		return nil, err
+	}
+	return parseProjectAssignment(stdout)
+}
+
+// assignProject accounts a directory, and optionally everything below it, to a project. The inherit flag is set
+// along with it, so files created later are accounted to the project too.
+func assignProject(config *Config, path string, id int, recursive bool) error {
+	options := ""
+	if recursive {
+		options = " -r"
+	}
+	_, err := callSshCommand(config, "zfs project%s -s -p %d %s", options, id, shellescape.Quote(path))
+	return err
+}
+
+// clearProject clears the inherit flag and accounts the directory back to project 0.
+func clearProject(config *Config, path string, recursive bool) error {
+	options := ""
+	if recursive {
+		options = " -r"
+	}
+	_, err := callSshCommand(config, "zfs project%s -C %s", options, shellescape.Quote(path))
+	return err
+}
+
+// datasetOfPath returns the filesystem a path on the host belongs to.
+func datasetOfPath(config *Config, path string) (string, error) {
+	stdout, err := callSshCommand(config, "zfs list -H -o name %s", shellescape.Quote(path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(stdout), nil
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestParseProjectAssignment verifies that the project id and inherit flag are read from zfs project -d.
+func TestParseProjectAssignment(t *testing.T) {
+	cases := []struct {
+		output  string
+		id      int
+		inherit bool
+	}{
+		{"   100 P /tank/www/example.com\n", 100, true},
+		{"     0 - /tank/www/with space\n", 0, false},
+	}
+
+	for _, c := range cases {
+		assignment, err := parseProjectAssignment(c.output)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", c.output, err)
+		}
+		if assignment.id != c.id || assignment.inherit != c.inherit {
+			t.Fatalf("unexpected assignment %+v for %q", assignment, c.output)
+		}
+	}
+
+	if _, err := parseProjectAssignment("zfs project: not a directory"); err == nil {
+		t.Fatalf("expected an error for unexpected output")
+	}
+}
+
+func projectExecutor() *fakeExecutor {
+	return (&fakeExecutor{}).
+		on("zfs list -H -o name /tank/www/example.com", "tank/www\n").
+		on("zfs project -d /tank/www/example.com", "   100 P /tank/www/example.com\n").
+		on("zfs project -", "").
+		on("zfs set", "").
+		on("zfs projectspace -H ", "100\t1.00G\t10G\t12\tnone\n").
+		on("zfs projectspace -Hp", "100\t1073741824\t10737418240\t12\tnone\n")
+}
+
+// TestResourceProjectCreate verifies that the directory is accounted to the project with the inherit flag set, and
+// that only the configured quotas are set.
+func TestResourceProjectCreate(t *testing.T) {
+	executor := projectExecutor()
+	d := schema.TestResourceDataRaw(t, resourceProject().Schema, map[string]interface{}{
+		"path":       "/tank/www/example.com",
+		"project_id": 100,
+		"quota":      "10G",
+	})
+
+	if diags := resourceProjectCreate(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	if !executor.ran("zfs project -r -s -p 100 /tank/www/example.com") {
+		t.Fatalf("expected the project to be assigned recursively, ran %v", executor.commands)
+	}
+	if !executor.ran("zfs set projectquota@100=10G tank/www") {
+		t.Fatalf("expected the quota to be set, ran %v", executor.commands)
+	}
+	if executor.ran("zfs set projectobjquota@100") {
+		t.Fatalf("the object quota was set without being configured")
+	}
+	if d.Get("quota") != "10G" || d.Get("object_quota") != "" || d.Get("used") != "1073741824" || d.Get("dataset") != "tank/www" {
+		t.Fatalf("unexpected state quota=%v object_quota=%v used=%v dataset=%v", d.Get("quota"), d.Get("object_quota"), d.Get("used"), d.Get("dataset"))
+	}
+}
+
+// TestResourceProjectDelete verifies that the quotas set by the resource are removed along with the project.
+func TestResourceProjectDelete(t *testing.T) {
+	executor := projectExecutor()
+	d := schema.TestResourceDataRaw(t, resourceProject().Schema, map[string]interface{}{
+		"path":       "/tank/www/example.com",
+		"project_id": 100,
+		"quota":      "10G",
+		"dataset":    "tank/www",
+	})
+	d.SetId("/tank/www/example.com")
+
+	if diags := resourceProjectDelete(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	if !executor.ran("zfs set projectquota@100=none tank/www") || executor.ran("zfs set projectobjquota@100") {
+		t.Fatalf("expected only the configured quota to be removed, ran %v", executor.commands)
+	}
+	if !executor.ran("zfs project -r -C /tank/www/example.com") {
+		t.Fatalf("expected the project to be cleared, ran %v", executor.commands)
+	}
+}
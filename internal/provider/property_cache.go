@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// propertyCacheTTL is how long properties read in a batch are used, bounding how long changes made outside
+// of terraform go unnoticed during a long apply.
+const propertyCacheTTL = time.Minute
+
+// PropertyCache holds the properties of every filesystem, volume and pool, read in one batch per pool the first time
+// one of them is read. This turns the hundreds of zfs get calls of a refresh into one per pool.
+//
+// Commands which change a pool evict its entries, after which its datasets are read one by one again until the
+// TTL has passed, as reading the whole pool after every change would be slower than reading single datasets
+// when applying many changes.
+//
+// mu only guards the maps and is never held while running a command. Each pool has a lock of its own in loading,
+// held while its batch is read, so parallel reads of a pool wait for a single batch while other pools are read at the
+// same time.
+type PropertyCache struct {
+	mu          sync.Mutex
+	loading     map[string]*sync.Mutex
+	loaded      map[string]time.Time
+	generations map[string]int
+	entries     map[string]map[string]Property
+}
+
+func newPropertyCache() *PropertyCache {
+	return &PropertyCache{
+		loading:     make(map[string]*sync.Mutex),
+		loaded:      make(map[string]time.Time),
+		generations: make(map[string]int),
+		entries:     make(map[string]map[string]Property),
+	}
+}
+
+// poolOf returns the pool a dataset, snapshot or bookmark is part of.
+func poolOf(name string) string {
+	return strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '@' || r == '#' })[0]
+}
+
+// batchCommandOptions return the options which make zfs or zpool get read the whole pool.
+var batchCommandOptions = map[string]func(config *Config) string{
+	"zfs":   datasetListOptions,
+	"zpool": func(config *Config) string { return "" },
+}
+
+// datasetListOptions are the options of zfs list and zfs get to include the descendants of a dataset, up to
+// max_list_depth levels below it. Snapshots are left out explicitly, as pools with listsnapshots=on list them too.
+func datasetListOptions(config *Config) string {
+	if config.max_list_depth > 0 {
+		return fmt.Sprintf(" -d %d -t filesystem,volume", config.max_list_depth)
+	}
+	return " -r -t filesystem,volume"
+}
+
+// lookup returns all properties of a dataset or pool, reading the properties of its whole pool first if they
+// weren't read within the TTL. ok is false when the properties have to be read directly, e.g. because they
+// were evicted or the resource is a snapshot. A nil cache is always empty.
+func (cache *PropertyCache) lookup(config *Config, baseCommand string, resourceName string) (map[string]Property, bool) {
+	batchOptions, ok := batchCommandOptions[baseCommand]
+	if cache == nil || !ok || resourceName == "" {
+		return nil, false
+	}
+	options := batchOptions(config)
+	pool := poolOf(resourceName)
+
+	cache.mu.Lock()
+	poolKey := baseCommand + " " + pool
+	loading, ok := cache.loading[poolKey]
+	if !ok {
+		loading = &sync.Mutex{}
+		cache.loading[poolKey] = loading
+	}
+	cache.mu.Unlock()
+
+	loading.Lock()
+	cache.load(config, baseCommand, options, pool)
+	loading.Unlock()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cached, ok := cache.entries[baseCommand+" "+resourceName]
+	if !ok {
+		return nil, false
+	}
+
+	// Callers add to the properties they are given, so hand out a copy.
+	properties := make(map[string]Property, len(cached))
+	for name, property := range cached {
+		properties[name] = property
+	}
+	return properties, true
+}
+
+// load reads the properties of a whole pool, unless they were read within the TTL. The caller must hold the loading
+// lock of the pool, but not mu. Properties read while a command changed the pool are thrown away, as they may be
+// older than the change.
+func (cache *PropertyCache) load(config *Config, baseCommand string, options string, pool string) {
+	poolKey := baseCommand + " " + pool
+
+	cache.mu.Lock()
+	if time.Since(cache.loaded[poolKey]) <= propertyCacheTTL {
+		cache.mu.Unlock()
+		return
+	}
+	cache.loaded[poolKey] = time.Now()
+	cache.evict(baseCommand, pool)
+	generation := cache.generations[pool]
+	cache.mu.Unlock()
+
+	stdout, err := callSshCommand(config, "%s", propertyGetCommand(config, baseCommand, options, "all", pool))
+	if err != nil {
+		log.Printf("[DEBUG] failed to read the properties of %s in a batch, reading them one by one: %s", pool, err)
+		return
+	}
+	resources, err := parsePropertyOutput(config, stdout)
+	if err != nil {
+		log.Printf("[DEBUG] failed to parse the properties of %s, reading them one by one: %s", pool, err)
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.generations[pool] != generation {
+		log.Printf("[DEBUG] %s changed while its properties were read, reading them one by one", pool)
+		return
+	}
+	for name, properties := range resources {
+		cache.entries[baseCommand+" "+name] = properties
+	}
+}
+
+// evict drops the cached properties of a pool and its datasets. The caller must hold the lock.
+func (cache *PropertyCache) evict(baseCommand string, pool string) {
+	for key := range cache.entries {
+		name := strings.TrimPrefix(key, baseCommand+" ")
+		if name != key && poolOf(name) == pool {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// invalidate drops the cached properties of a pool after a command changed it.
+func (cache *PropertyCache) invalidate(pool string) {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.generations[pool]++
+	for baseCommand := range batchCommandOptions {
+		cache.evict(baseCommand, pool)
+	}
+}
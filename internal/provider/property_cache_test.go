@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBatchProperties = "tank\tcompression\tlocal\ton\ntank/a\tcompression\tinherited from tank\ton\ntank/a\tquota\tlocal\t10G\n" +
+	propertyOutputSeparator + "\ntank\tcompression\ton\ntank/a\tcompression\ton\ntank/a\tquota\t10737418240"
+
+// TestParsePropertyOutput verifies the formatted and parsable values of several datasets are combined.
+func TestParsePropertyOutput(t *testing.T) {
+	resources, err := parsePropertyOutput(newFakeConfig(&fakeExecutor{}), testBatchProperties)
+	if err != nil {
+		t.Fatalf("parsePropertyOutput returned error: %v", err)
+	}
+
+	expected := Property{source: SourceLocal, value: "10G", rawValue: "10737418240"}
+	if resources["tank/a"]["quota"] != expected {
+		t.Fatalf("expected %#v, got %#v", expected, resources["tank/a"]["quota"])
+	}
+	if resources["tank/a"]["compression"].source != SourceInherited || len(resources["tank"]) != 1 {
+		t.Fatalf("unexpected properties %#v", resources)
+	}
+}
+
+// TestPropertyCache verifies the datasets of a pool are read in one batch, and read directly once the pool changed.
+func TestPropertyCache(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -r -t filesystem,volume -H -o name,property,source,value all tank ", testBatchProperties).
+		on("zfs set", "").
+		on("zfs get -H -o name,property,source,value all tank/a ", "tank/a\tquota\tlocal\t20G\n"+propertyOutputSeparator+"\ntank/a\tquota\t21474836480")
+	config := newFakeConfig(executor)
+	config.property_cache = newPropertyCache()
+
+	for _, name := range []string{"tank", "tank/a"} {
+		properties := make(map[string]Property)
+		if err := readAllProperties(config, "zfs", name, nil, properties); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if properties["compression"].value != "on" {
+			t.Fatalf("unexpected properties of %s: %#v", name, properties)
+		}
+	}
+	if len(executor.commands) != 1 {
+		t.Fatalf("expected a single batch read, ran %v", executor.commands)
+	}
+
+	if _, err := callSshCommand(config, "zfs set quota=20G tank/a"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	properties := make(map[string]Property)
+	if err := readAllProperties(config, "zfs", "tank/a", nil, properties); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if properties["quota"].value != "20G" {
+		t.Fatalf("expected the changed quota to be read, got %#v", properties["quota"])
+	}
+	if last := executor.commands[len(executor.commands)-1]; !strings.HasPrefix(last, "zfs get -H") {
+		t.Fatalf("expected a direct read after the change, ran %q", last)
+	}
+}
+
+// TestPropertyCache_Snapshot verifies that snapshots, which aren't part of the batch, are read directly.
+func TestPropertyCache_Snapshot(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -r -t filesystem,volume", testBatchProperties)
+	config := newFakeConfig(executor)
+	config.property_cache = newPropertyCache()
+
+	if _, ok := config.property_cache.lookup(config, "zfs", "tank/a@daily"); ok {
+		t.Fatalf("expected no cached properties for a snapshot")
+	}
+	if _, ok := config.property_cache.lookup(config, "zfs", "tank/a"); !ok {
+		t.Fatalf("expected the dataset to be cached by the earlier batch")
+	}
+	if len(executor.commands) != 1 {
+		t.Fatalf("expected a single batch read, ran %v", executor.commands)
+	}
+}
+
+// TestPropertyCache_MaxListDepth verifies the batch read stops at max_list_depth, and deeper datasets are read directly.
+func TestPropertyCache_MaxListDepth(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -d 1 -t filesystem,volume", testBatchProperties)
+	config := newFakeConfig(executor)
+	config.property_cache = newPropertyCache()
+	config.max_list_depth = 1
+
+	if _, ok := config.property_cache.lookup(config, "zfs", "tank/a"); !ok {
+		t.Fatalf("expected the dataset to be part of the batch, ran %v", executor.commands)
+	}
+	if _, ok := config.property_cache.lookup(config, "zfs", "tank/a/b"); ok {
+		t.Fatalf("expected a dataset below the depth to be left out of the batch")
+	}
+}
+
+// TestDatasetListingsExcludeSnapshots verifies that listings of datasets never include snapshots, which would
+// make them explode on pools with listsnapshots=on.
+func TestDatasetListingsExcludeSnapshots(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		fail("zfs get -H -o value guid", "cannot open 'tank/old': dataset does not exist").
+		on("zfs list", "tank\t1111\n").
+		on("zfs get", testBatchProperties)
+	config := newFakeConfig(executor)
+	config.property_cache = newPropertyCache()
+
+	_, _ = getDatasetNameByGuid(config, "tank/old", "1111")
+	config.property_cache.lookup(config, "zfs", "tank/a")
+
+	for _, command := range executor.commands {
+		listing := strings.HasPrefix(command, "zfs list") || (strings.HasPrefix(command, "zfs get") && strings.Contains(command, " -r"))
+		if listing && !strings.Contains(command, "-t filesystem,volume") {
+			t.Fatalf("expected %q to list only filesystems and volumes", command)
+		}
+	}
+}
+
+// blockingExecutor holds the batch read of tank until released, and answers everything else right away.
+type blockingExecutor struct {
+	started  chan struct{}
+	released chan struct{}
+}
+
+func (e *blockingExecutor) Run(command string, stdin string, timeout time.Duration) (string, string, bool, error) {
+	if strings.Contains(command, " all tank ") {
+		close(e.started)
+		<-e.released
+	}
+	return testBatchProperties, "", true, nil
+}
+
+// TestPropertyCache_Parallel verifies that reading one pool in a batch doesn't hold up reads of other pools or
+// commands changing the pool, and that a batch read while the pool changed is thrown away.
+func TestPropertyCache_Parallel(t *testing.T) {
+	executor := &blockingExecutor{started: make(chan struct{}), released: make(chan struct{})}
+	config := &Config{json_output: JsonOutputNever, executor: executor, property_cache: newPropertyCache()}
+
+	done := make(chan bool)
+	go func() {
+		_, ok := config.property_cache.lookup(config, "zfs", "tank/a")
+		done <- ok
+	}()
+	<-executor.started
+
+	other := make(chan struct{})
+	go func() {
+		config.property_cache.lookup(config, "zfs", "other/a")
+		config.property_cache.invalidate("tank")
+		close(other)
+	}()
+	select {
+	case <-other:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("reading another pool waited for the batch read of tank")
+	}
+
+	close(executor.released)
+	if ok := <-done; ok {
+		t.Fatalf("expected the batch read while tank changed to be thrown away")
+	}
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"math"
+	"sort"
+)
+
+// quotaReservationPairs are the limits and the reservations which must stay below them.
+var quotaReservationPairs = [][2]string{{"quota", "reservation"}, {"refquota", "refreservation"}}
+
+// propertySize parses a size property for ordering purposes. "none" means no quota at all, or no reservation.
+func propertySize(name string, value string) (int64, bool) {
+	if value == "none" || value == "" {
+		if name == "quota" || name == "refquota" {
+			return math.MaxInt64, true
+		}
+		return 0, true
+	}
+	size, err := parseSize(value)
+	return size, err == nil
+}
+
+// shrinks reports whether a property is being lowered from its current value. Values which can't be
+// compared count as growing.
+func shrinks(name string, desired map[string]string, actual map[string]Property) bool {
+	current, ok := propertySize(name, actual[name].rawValue)
+	if !ok {
+		return false
+	}
+	target, ok := propertySize(name, desired[name])
+	return ok && target < current
+}
+
+// propertyDependencies returns, for each property, the properties which have to be set before it:
+//
+//   - canmount before mountpoint, so the filesystem is mounted at the new mountpoint if it becomes mountable
+//   - a reservation which shrinks before its quota, and a quota which grows before its reservation
+//   - reservations before a volsize which shrinks, and a volsize which grows before refreservation
+func propertyDependencies(desired map[string]string, actual map[string]Property) map[string][]string {
+	dependencies := make(map[string][]string)
+	before := func(first string, second string) {
+		_, hasFirst := desired[first]
+		_, hasSecond := desired[second]
+		if hasFirst && hasSecond {
+			dependencies[second] = append(dependencies[second], first)
+		}
+	}
+
+	before("canmount", "mountpoint")
+
+	for _, pair := range quotaReservationPairs {
+		if shrinks(pair[1], desired, actual) {
+			before(pair[1], pair[0])
+		} else {
+			before(pair[0], pair[1])
+		}
+	}
+
+	if shrinks("volsize", desired, actual) {
+		before("refreservation", "volsize")
+		before("reservation", "volsize")
+	} else {
+		before("volsize", "refreservation")
+	}
+
+	return dependencies
+}
+
+// orderPropertyChanges returns the names of the desired properties in the order they should be set in. Properties
+// without dependencies between them are ordered by name, so the commands run are the same on every apply.
+func orderPropertyChanges(desired map[string]string, actual map[string]Property) []string {
+	names := mapKeys(desired)
+	sort.Strings(names)
+
+	dependencies := propertyDependencies(desired, actual)
+	ordered := make([]string, 0, len(names))
+	visited := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, dependency := range dependencies[name] {
+			visit(dependency)
+		}
+		ordered = append(ordered, name)
+	}
+
+	for _, name := range names {
+		visit(name)
+	}
+	return ordered
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestOrderPropertyChanges verifies that dependent properties are set in an order zfs accepts.
+func TestOrderPropertyChanges(t *testing.T) {
+	cases := []struct {
+		desired  map[string]string
+		actual   map[string]Property
+		expected []string
+	}{
+		{
+			desired:  map[string]string{"mountpoint": "/srv", "canmount": "on", "atime": "off"},
+			expected: []string{"atime", "canmount", "mountpoint"},
+		},
+		{
+			// Lowering the quota below the current reservation fails, so the reservation goes first.
+			desired:  map[string]string{"quota": "5G", "reservation": "1G"},
+			actual:   map[string]Property{"quota": {rawValue: "10737418240"}, "reservation": {rawValue: "8589934592"}},
+			expected: []string{"reservation", "quota"},
+		},
+		{
+			desired:  map[string]string{"quota": "20G", "reservation": "15G"},
+			actual:   map[string]Property{"quota": {rawValue: "10737418240"}, "reservation": {rawValue: "8589934592"}},
+			expected: []string{"quota", "reservation"},
+		},
+		{
+			desired:  map[string]string{"volsize": "5G", "refreservation": "none"},
+			actual:   map[string]Property{"volsize": {rawValue: "10737418240"}, "refreservation": {rawValue: "11811160064"}},
+			expected: []string{"refreservation", "volsize"},
+		},
+		{
+			desired:  map[string]string{"volsize": "20G", "refreservation": "21G"},
+			actual:   map[string]Property{"volsize": {rawValue: "10737418240"}, "refreservation": {rawValue: "11811160064"}},
+			expected: []string{"volsize", "refreservation"},
+		},
+	}
+
+	for _, c := range cases {
+		if order := orderPropertyChanges(c.desired, c.actual); !reflect.DeepEqual(order, c.expected) {
+			t.Fatalf("expected %v for %v, got %v", c.expected, c.desired, order)
+		}
+	}
+}
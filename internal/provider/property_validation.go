@@ -0,0 +1,393 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+var userPropertyPattern = regexp.MustCompile(`^[a-z0-9_.-]*:[a-z0-9_.:-]*$`)
+
+// propertyValidator checks the value of a property, returning nil if it is valid.
+type propertyValidator func(value string) error
+
+func oneOf(values ...string) propertyValidator {
+	return func(value string) error {
+		if contains(values, value) {
+			return nil
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+}
+
+func matches(pattern string, description string) propertyValidator {
+	expression := regexp.MustCompile("^(?:" + pattern + ")$")
+	return func(value string) error {
+		if expression.MatchString(value) {
+			return nil
+		}
+		return fmt.Errorf("must be %s", description)
+	}
+}
+
+func intBetween(min int, max int, allowed ...int) propertyValidator {
+	return func(value string) error {
+		number, err := strconv.Atoi(value)
+		if err == nil && (contains(intsToStrings(allowed), value) || (number >= min && number <= max)) {
+			return nil
+		}
+		return fmt.Errorf("must be a number from %d to %d", min, max)
+	}
+}
+
+func intsToStrings(values []int) []string {
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		out = append(out, strconv.Itoa(value))
+	}
+	return out
+}
+
+// sizeOrNone accepts sizes such as 10G, and "none" where a limit can be removed.
+func sizeOrNone(allowNone bool) propertyValidator {
+	return func(value string) error {
+		if allowNone && value == "none" {
+			return nil
+		}
+		if _, err := parseSize(value); err != nil {
+			if allowNone {
+				return fmt.Errorf("must be a size such as 10G, or none")
+			}
+			return fmt.Errorf("must be a size such as 128K")
+		}
+		return nil
+	}
+}
+
+// anyValue is used for properties whose values can't reasonably be checked, e.g. sharenfs options.
+func anyValue(value string) error {
+	return nil
+}
+
+var onOff = oneOf("on", "off")
+
+var checksumAlgorithms = "fletcher2|fletcher4|sha256|sha512|skein|edonr|blake3"
+
+// settablePoolProperties are the pool properties which can be set on create or afterwards. Feature flags are handled separately.
+var settablePoolProperties = map[string]propertyValidator{
+	"altroot":       anyValue,
+	"ashift":        intBetween(9, 16, 0),
+	"autoexpand":    onOff,
+	"autoreplace":   onOff,
+	"autotrim":      onOff,
+	"bootfs":        anyValue,
+	"cachefile":     anyValue,
+	"comment":       anyValue,
+	"compatibility": anyValue,
+	"delegation":    onOff,
+	"failmode":      oneOf("wait", "continue", "panic"),
+	"listsnapshots": onOff,
+	"multihost":     onOff,
+	"readonly":      onOff,
+	"version":       anyValue,
+}
+
+// settableDatasetProperties are the native dataset properties which can be set on create or afterwards.
+var settableDatasetProperties = map[string]propertyValidator{
+	"aclinherit":           oneOf("discard", "noallow", "restricted", "passthrough", "passthrough-x"),
+	"aclmode":              oneOf("discard", "groupmask", "passthrough", "restricted"),
+	"acltype":              oneOf("off", "noacl", "nfsv4", "posix", "posixacl"),
+	"atime":                onOff,
+	"canmount":             oneOf("on", "off", "noauto"),
+	"casesensitivity":      oneOf("sensitive", "insensitive", "mixed"),
+	"checksum":             matches("on|off|noparity|"+checksumAlgorithms, "on, off, noparity or one of "+strings.ReplaceAll(checksumAlgorithms, "|", ", ")),
+	"compression":          matches("on|off|lzjb|lz4|zle|gzip|gzip-[1-9]|zstd|zstd-(?:[1-9]|1[0-9])|zstd-fast|zstd-fast-(?:[1-9]|10|[2-9]0|100|500|1000)", "one of on, off, lzjb, lz4, zle, gzip, gzip-N, zstd, zstd-N or zstd-fast-N"),
+	"context":              anyValue,
+	"copies":               oneOf("1", "2", "3"),
+	"direct":               oneOf("disabled", "standard", "always"),
+	"dedup":                matches("on|off|verify|(?:"+checksumAlgorithms+")(?:,verify)?", "on, off, verify, or a checksum algorithm optionally followed by ,verify"),
+	"defcontext":           anyValue,
+	"devices":              onOff,
+	"dnodesize":            oneOf("legacy", "auto", "1k", "2k", "4k", "8k", "16k"),
+	"encryption":           oneOf("off", "on", "aes-128-ccm", "aes-192-ccm", "aes-256-ccm", "aes-128-gcm", "aes-192-gcm", "aes-256-gcm"),
+	"exec":                 onOff,
+	"filesystem_limit":     matches("none|[0-9]+", "a number or none"),
+	"fscontext":            anyValue,
+	"jailed":               onOff,
+	"keyformat":            oneOf("raw", "hex", "passphrase"),
+	"keylocation":          matches("prompt|file://.+|https?://.+", "prompt, or a file://, http:// or https:// URL"),
+	"logbias":              oneOf("latency", "throughput"),
+	"mlslabel":             anyValue,
+	"mountpoint":           matches("none|legacy|/.*", "an absolute path, none or legacy"),
+	"nbmand":               onOff,
+	"normalization":        oneOf("none", "formC", "formD", "formKC", "formKD"),
+	"overlay":              onOff,
+	"pbkdf2iters":          matches("[0-9]+", "a number"),
+	"prefetch":             oneOf("all", "none", "metadata"),
+	"primarycache":         oneOf("all", "none", "metadata"),
+	"quota":                sizeOrNone(true),
+	"readonly":             onOff,
+	"recordsize":           sizeOrNone(false),
+	"redundant_metadata":   oneOf("all", "most", "some", "none"),
+	"refquota":             sizeOrNone(true),
+	"refreservation":       matches("none|auto|[0-9.]+[KMGTPEkmgtpe]?(?:i?[Bb])?", "a size such as 10G, none or auto"),
+	"relatime":             onOff,
+	"reservation":          sizeOrNone(true),
+	"rootcontext":          anyValue,
+	"secondarycache":       oneOf("all", "none", "metadata"),
+	"setuid":               onOff,
+	"sharenfs":             anyValue,
+	"sharesmb":             anyValue,
+	"snapdev":              oneOf("hidden", "visible"),
+	"snapdir":              oneOf("hidden", "visible", "disabled"),
+	"snapshot_limit":       matches("none|[0-9]+", "a number or none"),
+	"special_small_blocks": sizeOrNone(false),
+	"sync":                 oneOf("standard", "always", "disabled"),
+	"utf8only":             onOff,
+	"version":              matches("current|[0-9]+", "a number or current"),
+	"volblocksize":         sizeOrNone(false),
+	"volmode":              oneOf("default", "full", "geom", "dev", "none"),
+	"volsize":              sizeOrNone(false),
+	"vscan":                onOff,
+	"xattr":                oneOf("on", "off", "sa", "dir"),
+	"zoned":                onOff,
+}
+
+// propertyMinimumVersions are the OpenZFS releases which introduced newer properties, so they can be rejected at
+// plan time on older hosts instead of failing halfway through an apply.
+var propertyMinimumVersions = map[string]ZfsVersion{
+	"direct":   {major: 2, minor: 3},
+	"prefetch": {major: 2, minor: 2},
+}
+
+// checkPropertyVersions returns an error for each property which the OpenZFS version of the host doesn't support.
+// The host is only asked for its version if such properties are used, and hosts whose version can't be told
+// are left to zfs itself.
+func checkPropertyVersions(config *Config, properties map[string]string) error {
+	names := make([]string, 0)
+	for name := range properties {
+		if _, ok := propertyMinimumVersions[name]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	version := hostZfsVersion(config)
+	if version == nil {
+		return nil
+	}
+
+	sort.Strings(names)
+	errs := make([]error, 0)
+	for _, name := range names {
+		if minimum := propertyMinimumVersions[name]; !version.atLeast(minimum) {
+			errs = append(errs, fmt.Errorf("%s requires OpenZFS %d.%d or later, but the host runs %s", name, minimum.major, minimum.minor, version))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// quotaPropertyPrefixes are dataset properties which are named after a user, group or project, e.g. userquota@alice.
+var quotaPropertyPrefixes = []string{"userquota@", "groupquota@", "projectquota@", "userobjquota@", "groupobjquota@", "projectobjquota@"}
+
+// validateProperty checks a single property. Pool properties are only accepted when allowPool is set,
+// user properties (which contain a colon) are never checked.
+func validateProperty(name string, value string, allowPool bool) error {
+	if strings.Contains(name, ":") {
+		return nil
+	}
+
+	validator, isDataset := settableDatasetProperties[name]
+	if !isDataset {
+		for _, prefix := range quotaPropertyPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				validator, isDataset = sizeOrNone(true), true
+			}
+		}
+	}
+
+	if allowPool {
+		if poolValidator, ok := settablePoolProperties[name]; ok {
+			validator = poolValidator
+		} else if strings.HasPrefix(name, "feature@") {
+			validator = oneOf("enabled", "disabled")
+		} else if !isDataset {
+			validator = nil
+		}
+	} else if validator == nil && (isPoolProperty(name) || strings.HasPrefix(name, "feature@")) {
+		return fmt.Errorf("%s is a pool property and can't be set on a dataset", name)
+	}
+
+	if validator == nil {
+		if contains(poolProperties, name) || contains(readOnlyDatasetProperties, name) {
+			return fmt.Errorf("%s is read-only", name)
+		}
+		return fmt.Errorf("%s is not a known property. User properties must contain a colon, e.g. com.example:%s", name, name)
+	}
+
+	if err := validator(value); err != nil {
+		return fmt.Errorf("invalid value %q for %s: %s", value, name, err)
+	}
+	return nil
+}
+
+// readOnlyDatasetProperties are reported by zfs get, but can't be set.
+var readOnlyDatasetProperties = []string{
+	"available", "compressratio", "createtxg", "creation", "clones", "defer_destroy", "encryptionroot", "filesystem_count",
+	"guid", "keystatus", "logicalreferenced", "logicalused", "mounted", "objsetid", "origin", "receive_resume_token",
+	"redact_snaps", "referenced", "refcompressratio", "snapshot_count", "snapshots_changed", "type", "used",
+	"usedbychildren", "usedbydataset", "usedbyrefreservation", "usedbysnapshots", "userrefs", "written",
+}
+
+// validatePropertyBlocks checks all property blocks of a resource at plan time, reporting every invalid
+// property at once. Values which aren't known yet are checked on apply by zfs itself.
+func validatePropertyBlocks(d *schema.ResourceDiff, allowPool bool) error {
+	if !d.NewValueKnown("property") {
+		return nil
+	}
+
+	errs := make([]error, 0)
+	for _, block := range d.Get("property").(*schema.Set).List() {
+		property := block.(map[string]interface{})
+		name, value := property["name"].(string), property["value"].(string)
+		if property["inherit"].(bool) {
+			if value != "" {
+				errs = append(errs, fmt.Errorf("%s can't have both a value and inherit set", name))
+			} else if err := validateInheritable(name); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := validateProperty(name, value, allowPool); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateInheritable checks that a property can be reset with zfs inherit.
+func validateInheritable(name string) error {
+	if isPoolProperty(name) {
+		return fmt.Errorf("%s is a pool property and can't be inherited", name)
+	}
+	if isCreateOnlyProperty(name) {
+		return fmt.Errorf("%s can only be set on creation and can't be inherited", name)
+	}
+	for _, prefix := range quotaPropertyPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("%s can't be inherited", name)
+		}
+	}
+	return nil
+}
+
+// createOnlyProperties can only be set when a pool or dataset is created.
+var createOnlyProperties = []string{
+	"ashift",
+	"casesensitivity",
+	"encryption",
+	"normalization",
+	"utf8only",
+	"volblocksize",
+}
+
+func isCreateOnlyProperty(name string) bool {
+	return contains(createOnlyProperties, name)
+}
+
+// sameValue compares property values, treating sizes such as 16K and 16384 as equal.
+func sameValue(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	sizeA, errA := parseSize(a)
+	sizeB, errB := parseSize(b)
+	return errA == nil && errB == nil && sizeA == sizeB
+}
+
+// forceNewOnCreateOnlyProperties marks the resource for replacement when a property which can only be
+// set on creation differs from its current value, rather than letting zfs set fail halfway through an apply.
+func forceNewOnCreateOnlyProperties(d *schema.ResourceDiff) error {
+	if d.Id() == "" || !d.HasChange("property") || !d.NewValueKnown("property") {
+		return nil
+	}
+
+	current := d.Get("properties").(map[string]interface{})
+	oldBlocks, _ := d.GetChange("property")
+	previous := parsePropertyBlocks(oldBlocks.(*schema.Set).List())
+
+	for name, value := range parsePropertyBlocks(d.Get("property").(*schema.Set).List()) {
+		if !isCreateOnlyProperty(name) {
+			continue
+		}
+
+		actual, ok := current[name].(string)
+		if !ok {
+			actual, ok = previous[name]
+		}
+		if ok && !sameValue(actual, value) {
+			log.Printf("[WARN] %s can only be set on creation, changing it from %s to %s replaces %s", name, actual, value, d.Id())
+			return d.ForceNew("property")
+		}
+	}
+	return nil
+}
+
+// validatePropertyVersions checks the property blocks of a resource against the OpenZFS version of the host.
+func validatePropertyVersions(d *schema.ResourceDiff, meta interface{}) error {
+	config, ok := meta.(*Config)
+	if !ok || !d.NewValueKnown("property") {
+		return nil
+	}
+	return checkPropertyVersions(config, parsePropertyBlocks(d.Get("property").(*schema.Set).List()))
+}
+
+// dedicatedProperties are set through attributes of their own on filesystems and volumes, rather than property blocks.
+var dedicatedProperties = []string{"mountpoint", "canmount", "volsize"}
+
+// validateDedicatedProperties rejects property blocks for properties with a dedicated attribute, which would
+// otherwise fight over the value of the property.
+func validateDedicatedProperties(d *schema.ResourceDiff) error {
+	if !d.NewValueKnown("property") {
+		return nil
+	}
+
+	errs := make([]error, 0)
+	for _, block := range d.Get("property").(*schema.Set).List() {
+		if name := block.(map[string]interface{})["name"].(string); contains(dedicatedProperties, name) {
+			errs = append(errs, fmt.Errorf("don't set '%s' as a property block, use the dedicated attribute instead", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func resourceDatasetCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if err := validatePropertyBlocks(d, false); err != nil {
+		return err
+	}
+	if err := validateDedicatedProperties(d); err != nil {
+		return err
+	}
+	if err := validatePropertyVersions(d, meta); err != nil {
+		return err
+	}
+	if err := validateSensitiveProperties(d); err != nil {
+		return err
+	}
+	if err := validateDriftDetection(d); err != nil {
+		return err
+	}
+	if err := forceNewOnNameChange(d); err != nil {
+		return err
+	}
+	return forceNewOnCreateOnlyProperties(d)
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// TestValidateProperty verifies that property names and values are checked against the known pool and dataset properties.
+func TestValidateProperty(t *testing.T) {
+	cases := []struct {
+		name      string
+		value     string
+		allowPool bool
+		valid     bool
+	}{
+		{"compression", "lz4", false, true},
+		{"compression", "zstd-19", false, true},
+		{"compression", "zstd-fast-500", false, true},
+		{"compression", "zstd-20", false, false},
+		{"compresion", "lz4", false, false},
+		{"recordsize", "1M", false, true},
+		{"recordsize", "big", false, false},
+		{"quota", "none", false, true},
+		{"userquota@alice", "10G", false, true},
+		{"atime", "yes", false, false},
+		{"dedup", "sha256,verify", false, true},
+		{"mountpoint", "data", false, false},
+		{"com.example:owner", "anything goes", false, true},
+		{"used", "10G", false, false},
+		{"ashift", "12", true, true},
+		{"ashift", "17", true, false},
+		{"ashift", "12", false, false},
+		{"feature@zstd_compress", "enabled", true, true},
+		{"feature@zstd_compress", "active", true, false},
+		{"size", "10G", true, false},
+		{"compression", "lz4", true, true},
+		{"autotrim", "on", true, true},
+	}
+
+	for _, c := range cases {
+		err := validateProperty(c.name, c.value, c.allowPool)
+		if c.valid && err != nil {
+			t.Fatalf("expected %s=%s to be valid, got %s", c.name, c.value, err)
+		}
+		if !c.valid && err == nil {
+			t.Fatalf("expected %s=%s to be invalid (pool: %t)", c.name, c.value, c.allowPool)
+		}
+	}
+}
+
+// TestCreateOnlyProperties verifies that create-only properties are compared by value and never reset.
+func TestCreateOnlyProperties(t *testing.T) {
+	if !sameValue("16K", "16384") || !sameValue("16k", "16K") || sameValue("8K", "16K") || sameValue("on", "off") {
+		t.Fatalf("unexpected comparison of property values")
+	}
+
+	if _, ok := getResetCommand("casesensitivity"); ok {
+		t.Fatalf("expected casesensitivity not to be reset")
+	}
+	if _, ok := getResetCommand("compression"); !ok {
+		t.Fatalf("expected compression to be reset")
+	}
+}
+
+// TestValidateInheritable verifies that only properties zfs inherit can reset are accepted in inherit blocks.
+func TestValidateInheritable(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"compression":     true,
+		"com.example:tag": true,
+		"autotrim":        false,
+		"volblocksize":    false,
+		"userquota@alice": false,
+	} {
+		if err := validateInheritable(name); (err == nil) != valid {
+			t.Fatalf("validateInheritable(%s): expected valid to be %t, got %v", name, valid, err)
+		}
+	}
+}
+
+// TestValidateDedicatedProperties verifies that property blocks for canmount and mountpoint are rejected at plan time,
+// and that an unconfigured canmount keeps the value of the filesystem instead of planning a change.
+func TestValidateDedicatedProperties(t *testing.T) {
+	config := map[string]interface{}{
+		"name":     "tank/data",
+		"property": []interface{}{map[string]interface{}{"name": "canmount", "value": "noauto"}},
+	}
+	if _, err := resourceFilesystem().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), nil); err == nil {
+		t.Fatalf("expected an error for a canmount property block")
+	}
+
+	state := &terraform.InstanceState{
+		ID: "1234",
+		Attributes: map[string]string{
+			"id":         "1234",
+			"name":       "tank/ROOT/default",
+			"mountpoint": "none",
+			"canmount":   "noauto",
+		},
+	}
+	diff, err := resourceFilesystem().Diff(context.Background(), state, terraform.NewResourceConfigRaw(map[string]interface{}{"name": "tank/ROOT/default"}), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff != nil && diff.Attributes["canmount"] != nil {
+		t.Fatalf("expected canmount to be left alone, got %+v", diff.Attributes["canmount"])
+	}
+}
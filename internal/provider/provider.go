@@ -2,10 +2,12 @@ package provider
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 
 	"github.com/appleboy/easyssh-proxy"
 )
@@ -27,8 +29,29 @@ func init() {
 }
 
 type Config struct {
-	command_prefix string
-	ssh            *easyssh.MakeConfig
+	command_prefix     string
+	use_sudo           bool
+	retry_max_attempts int
+	retry_backoff      time.Duration
+	sudo_password      string
+	json_output        string
+	json_once          sync.Once
+	json_supported     bool
+	version_once       sync.Once
+	zfs_version        *ZfsVersion
+	executor           Executor
+	limiter            *CommandLimiter
+	max_list_depth     int
+	property_cache     *PropertyCache
+	metrics            *CommandMetrics
+	platform           string
+	platform_once      sync.Once
+	detected_platform  string
+	locale             string
+	secrets            *SecretSet
+	audit_log          *AuditLog
+	// log_context carries the logger of the provider, for commands run without a context of their own.
+	log_context context.Context
 }
 
 func New(version string) func() *schema.Provider {
@@ -76,16 +99,126 @@ func New(version string) func() *schema.Provider {
 					Optional:    true,
 					DefaultFunc: schema.EnvDefaultFunc("ZFS_PROVIDER_COMMAND_PREFIX", nil),
 				},
+				"use_sudo": {
+					Description: "Run all commands on the target host through sudo, so the provider can connect as a non-root user. Without a `sudo_password`, sudo must be configured to not ask for a password. Defaults to `false`",
+					Type:        schema.TypeBool,
+					Optional:    true,
+					DefaultFunc: schema.EnvDefaultFunc("ZFS_PROVIDER_USE_SUDO", false),
+				},
+				"sudo_password": {
+					Description: "Password to give sudo when `use_sudo` is set. It is sent to sudo on the input of each command, never as part of the command",
+					Type:        schema.TypeString,
+					Optional:    true,
+					Sensitive:   true,
+					DefaultFunc: schema.EnvDefaultFunc("ZFS_PROVIDER_SUDO_PASSWORD", nil),
+				},
+				"retry_max_attempts": {
+					Description:      "How many times to run a command which fails with a transient error, such as a busy pool or dataset, or a failed connection. A command whose connection fails while it runs is only run again if it only reads. Defaults to `3`",
+					Type:             schema.TypeInt,
+					Optional:         true,
+					DefaultFunc:      schema.EnvDefaultFunc("ZFS_PROVIDER_RETRY_MAX_ATTEMPTS", 3),
+					ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(1)),
+				},
+				"retry_backoff": {
+					Description:      "How long to wait before the first retry of a failed command, e.g. `2s`. The wait doubles after every attempt. Defaults to `2s`",
+					Type:             schema.TypeString,
+					Optional:         true,
+					DefaultFunc:      schema.EnvDefaultFunc("ZFS_PROVIDER_RETRY_BACKOFF", "2s"),
+					ValidateDiagFunc: validateDuration,
+				},
+				"json_output": {
+					Description:      "Whether to read zfs and zpool output as JSON, which is available from OpenZFS 2.3. One of `auto`, `always` or `never`. JSON is used for properties, for pool layouts (`zpool status -j`) and for looking datasets and pools up by guid (`zfs list -j`, `zpool list -j`). The health, errors and scrub progress of pools are still parsed from text output. With `auto` the provider checks whether the host supports it, and falls back to parsing text output otherwise. Defaults to `auto`",
+					Type:             schema.TypeString,
+					Optional:         true,
+					DefaultFunc:      schema.EnvDefaultFunc("ZFS_PROVIDER_JSON_OUTPUT", JsonOutputAuto),
+					ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(jsonOutputModes, false)),
+				},
+				"max_concurrent_commands": {
+					Description:      "How many commands to run on the host at once, across all resources. Commands which change the same pool always run one at a time, regardless of this setting. `0` means no limit. Defaults to `0`",
+					Type:             schema.TypeInt,
+					Optional:         true,
+					DefaultFunc:      schema.EnvDefaultFunc("ZFS_PROVIDER_MAX_CONCURRENT_COMMANDS", 0),
+					ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(0)),
+				},
+				"max_list_depth": {
+					Description:      "How many levels of datasets below a pool to read in one go when refreshing, e.g. `2` for `tank/a/b`. Deeper datasets are read one by one. Lowering it keeps refreshes fast on pools with very many datasets. `0` means no limit. Defaults to `0`",
+					Type:             schema.TypeInt,
+					Optional:         true,
+					DefaultFunc:      schema.EnvDefaultFunc("ZFS_PROVIDER_MAX_LIST_DEPTH", 0),
+					ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(0)),
+				},
+				"platform": {
+					Description:      "Operating system of the host, which decides how devices, file ownership and module parameters are read. One of `auto`, `linux`, `freebsd` (including TrueNAS CORE) or `illumos`. With `auto` it is detected with `uname`. Note that the syntax of `sharenfs` follows the NFS server of the host, e.g. `-maproot=root -network 10.0.0.0/8` on FreeBSD rather than `rw=@10.0.0.0/8,no_root_squash` on Linux. Defaults to `auto`",
+					Type:             schema.TypeString,
+					Optional:         true,
+					DefaultFunc:      schema.EnvDefaultFunc("ZFS_PROVIDER_PLATFORM", PlatformAuto),
+					ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(platformModes, false)),
+				},
+				"locale": {
+					Description:      "Locale to run commands on the host with, set through `LC_ALL`. The output of zfs, zpool and other tools is parsed, which relies on it being in English with decimal points, so this should only be changed for hosts without the `C` locale. Set it to `host` to keep the locale of the host. Defaults to `C`",
+					Type:             schema.TypeString,
+					Optional:         true,
+					DefaultFunc:      schema.EnvDefaultFunc("ZFS_PROVIDER_LOCALE", "C"),
+					ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(localePattern, "must be a locale name such as C, C.UTF-8 or en_US.UTF-8")),
+				},
+				"metrics_path": {
+					Description: "Path of a local file to write a summary of the commands run on the host to, with their count, failures and durations per operation such as `zfs list`, in JSON. The file is rewritten after every command, and holds the summary of the latest plan or apply. Nothing is recorded when not set",
+					Type:        schema.TypeString,
+					Optional:    true,
+					DefaultFunc: schema.EnvDefaultFunc("ZFS_PROVIDER_METRICS_PATH", nil),
+				},
+				"audit_log_path": {
+					Description: "Path of a local file to append a JSON line to for every command which changes a pool, such as `zfs set` or `zpool offline`, with the time, host, user, command, duration, exit code and errors, as evidence of the changes made. Secrets and sensitive properties are redacted. Failed commands are recorded too. Nothing is recorded when not set",
+					Type:        schema.TypeString,
+					Optional:    true,
+					DefaultFunc: schema.EnvDefaultFunc("ZFS_PROVIDER_AUDIT_LOG_PATH", nil),
+				},
 			},
 			DataSourcesMap: map[string]*schema.Resource{
-				"zfs_pool":       dataSourcePool(),
-				"zfs_filesystem": dataSourceFilesystem(),
-				"zfs_volume":     dataSourceVolume(),
+				"zfs_pool":                   dataSourcePool(),
+				"zfs_filesystem":             dataSourceFilesystem(),
+				"zfs_volume":                 dataSourceVolume(),
+				"zfs_replication_health":     dataSourceReplicationHealth(),
+				"zfs_expired_datasets":       dataSourceExpiredDatasets(),
+				"zfs_layout_lint":            dataSourceLayoutLint(),
+				"zfs_pool_status":            dataSourcePoolStatus(),
+				"zfs_pool_ddt":               dataSourcePoolDdt(),
+				"zfs_pool_latency":           dataSourcePoolLatency(),
+				"zfs_disk":                   dataSourceDisk(),
+				"zfs_channel_program":        dataSourceChannelProgram(),
+				"zfs_snapshot_diff":          dataSourceSnapshotDiff(),
+				"zfs_pool_iostat":            dataSourcePoolIostat(),
+				"zfs_pool_capacity_forecast": dataSourcePoolCapacityForecast(),
+				"zfs_origin_chain":           dataSourceOriginChain(),
+				"zfs_compression_estimate":   dataSourceCompressionEstimate(),
 			},
 			ResourcesMap: map[string]*schema.Resource{
-				"zfs_filesystem": resourceFilesystem(),
-				"zfs_volume":     resourceVolume(),
-				"zfs_pool":       resourcePool(),
+				"zfs_filesystem":              resourceFilesystem(),
+				"zfs_volume":                  resourceVolume(),
+				"zfs_pool":                    resourcePool(),
+				"zfs_permission":              resourcePermission(),
+				"zfs_user_quota":              resourceUserQuota(),
+				"zfs_group_quota":             resourceGroupQuota(),
+				"zfs_project_quota":           resourceProjectQuota(),
+				"zfs_scrub":                   resourceScrub(),
+				"zfs_trim":                    resourceTrim(),
+				"zfs_module_parameter":        resourceModuleParameter(),
+				"zfs_rewrite":                 resourceRewrite(),
+				"zfs_channel_program":         resourceChannelProgram(),
+				"zfs_pool_resize":             resourcePoolResize(),
+				"zfs_root_layout":             resourceRootLayout(),
+				"zfs_snapshot":                resourceSnapshot(),
+				"zfs_rollback":                resourceRollback(),
+				"zfs_snapshot_policy":         resourceSnapshotPolicy(),
+				"zfs_expired_dataset_cleanup": resourceExpiredDatasetCleanup(),
+				"zfs_scratch_dataset":         resourceScratchDataset(),
+				"zfs_pool_import":             resourcePoolImport(),
+				"zfs_stage_verification":      resourceStageVerification(),
+				"zfs_snapshot_mount":          resourceSnapshotMount(),
+				"zfs_pool_checkpoint":         resourcePoolCheckpoint(),
+				"zfs_received_dataset":        resourceReceivedDataset(),
+				"zfs_pool_device_state":       resourcePoolDeviceState(),
+				"zfs_project":                 resourceProject(),
 			},
 		}
 
@@ -97,9 +230,28 @@ func New(version string) func() *schema.Provider {
 
 func configure(version string, p *schema.Provider) func(context.Context, *schema.ResourceData) (interface{}, diag.Diagnostics) {
 	return func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+		backoff, err := time.ParseDuration(d.Get("retry_backoff").(string))
+		if err != nil {
+			return nil, diagFromErr(err)
+		}
+
 		return &Config{
-			command_prefix: d.Get("command_prefix").(string),
-			ssh: &easyssh.MakeConfig{
+			command_prefix:     d.Get("command_prefix").(string),
+			use_sudo:           d.Get("use_sudo").(bool),
+			sudo_password:      d.Get("sudo_password").(string),
+			retry_max_attempts: d.Get("retry_max_attempts").(int),
+			retry_backoff:      backoff,
+			json_output:        d.Get("json_output").(string),
+			limiter:            newCommandLimiter(d.Get("max_concurrent_commands").(int)),
+			max_list_depth:     d.Get("max_list_depth").(int),
+			property_cache:     newPropertyCache(),
+			metrics:            newCommandMetrics(d.Get("metrics_path").(string)),
+			platform:           d.Get("platform").(string),
+			locale:             d.Get("locale").(string),
+			secrets:            newSecretSet(),
+			audit_log:          newAuditLog(d.Get("audit_log_path").(string), d.Get("host").(string), d.Get("user").(string)),
+			log_context:        context.WithoutCancel(ctx),
+			executor: &sshExecutor{ssh: &easyssh.MakeConfig{
 				Server:     d.Get("host").(string),
 				Port:       d.Get("port").(string),
 				User:       d.Get("user").(string),
@@ -108,7 +260,7 @@ func configure(version string, p *schema.Provider) func(context.Context, *schema
 				Password:   d.Get("password").(string),
 				Passphrase: d.Get("key_passphrase").(string),
 				Timeout:    60 * time.Second,
-			},
+			}},
 		}, nil
 	}
 }
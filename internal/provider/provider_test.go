@@ -1,9 +1,11 @@
 package provider
 
 import (
+	"context"
 	"os"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
@@ -25,6 +27,17 @@ func TestProvider(t *testing.T) {
 	}
 }
 
+// TestProviderServer verifies that the protocol server serves the schemas of the SDKv2 resources.
+func TestProviderServer(t *testing.T) {
+	resp, err := ProviderServer("dev")().GetProviderSchema(context.Background(), &tfprotov5.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := resp.ResourceSchemas["zfs_pool"]; !ok {
+		t.Fatalf("expected a schema for zfs_pool, got %v", mapKeys(resp.ResourceSchemas))
+	}
+}
+
 func testAccPreCheck(t *testing.T) {
 	// You can add code here to run prior to any test case execution, for example assertions
 	// about the appropriate environment variables being set are common to see in a pre-check
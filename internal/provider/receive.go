@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// receiveLogDirectory holds the output of receives running in the background, as they outlive the ssh session. Each
+// job gets a private directory in it, as the receive runs as root and the directory is writable by anyone.
+const receiveLogDirectory = "/var/tmp"
+
+// receiveJobPrefix starts the names of the directories of receive jobs.
+const receiveJobPrefix = "terraform-zfs-receive"
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ReceiveSource is where the stream of a zfs_received_dataset comes from. Exactly one of file, url and command is set.
+type ReceiveSource struct {
+	file    string
+	url     string
+	command string
+	// checksum is the SHA-256 of the stream, which is verified before anything is received.
+	checksum string
+}
+
+// ReceiveJob is a zfs receive running in the background on the host. Its errors are written to <logPath>.err and
+// its exit code to <logPath>.exit once it has finished, both in the private directory of the job.
+type ReceiveJob struct {
+	directory string
+	target    string
+	force     bool
+	mount     bool
+	source    ReceiveSource
+}
+
+func (job ReceiveJob) logPath() string {
+	return path.Join(job.directory, "receive")
+}
+
+// createJobDirectory creates a directory only the user running the commands can access, so the files of a job
+// running in the background can't be replaced by symlinks or created ahead of it by other users of the host.
+func createJobDirectory(config *Config, parent string, prefix string) (string, error) {
+	stdout, err := callSshCommand(config, "mktemp -d %s", shellescape.Quote(path.Join(parent, prefix+".XXXXXXXX")))
+	if err != nil {
+		return "", err
+	}
+
+	directory := strings.TrimSpace(stdout)
+	if !isJobDirectory(directory, parent, prefix) {
+		return "", fmt.Errorf("mktemp returned unexpected directory %q", directory)
+	}
+	return directory, nil
+}
+
+// isJobDirectory guards the removal of job directories, which are removed recursively.
+func isJobDirectory(directory string, parent string, prefix string) bool {
+	return path.Dir(directory) == parent && strings.HasPrefix(path.Base(directory), prefix+".") && path.Clean(directory) == directory
+}
+
+func (job ReceiveJob) receiveCommand() string {
+	options := ""
+	if job.force {
+		options += " -F"
+	}
+	if !job.mount {
+		options += " -u"
+	}
+	return fmt.Sprintf("zfs receive%s %s", options, shellescape.Quote(job.target))
+}
+
+// verifyCommand checks the SHA-256 of a file, failing with a message which doesn't drown in the output of sha256sum.
+func verifyCommand(file string, checksum string) string {
+	return fmt.Sprintf("{ echo %s | sha256sum -c --status || { echo %s >&2; false; }; }",
+		shellescape.Quote(checksum+"  "+file), shellescape.Quote("the checksum of the stream doesn't match"))
+}
+
+// command returns the script receiving the stream. A stream from a URL with a checksum is downloaded next to the
+// log first, as it can only be verified once it is complete, and a partially received stream would otherwise have
+// to be cleaned up.
+func (job ReceiveJob) command() string {
+	source := job.source
+	switch {
+	case source.file != "":
+		receive := fmt.Sprintf("%s < %s", job.receiveCommand(), shellescape.Quote(source.file))
+		if source.checksum != "" {
+			return verifyCommand(source.file, source.checksum) + " && " + receive
+		}
+		return receive
+	case source.url != "" && source.checksum != "":
+		stream := job.logPath() + ".stream"
+		return fmt.Sprintf("curl -fsSL -o %s %s && %s && %s < %s; rc=$?; rm -f %s; exit $rc",
+			stream, shellescape.Quote(source.url), verifyCommand(stream, source.checksum), job.receiveCommand(), stream, stream)
+	case source.url != "":
+		return fmt.Sprintf("curl -fsSL %s | %s", shellescape.Quote(source.url), job.receiveCommand())
+	default:
+		return fmt.Sprintf("{ %s; } | %s", source.command, job.receiveCommand())
+	}
+}
+
+// startReceive runs the job in the background, so it isn't bound by the timeout of a single command.
+func startReceive(config *Config, job ReceiveJob) error {
+	logPath := job.logPath()
+	script := fmt.Sprintf("(%s) 2> %s.err; echo $? > %s.exit", job.command(), logPath, logPath)
+	_, err := callSshCommand(config, "nohup sh -c %s > /dev/null 2>&1 &", shellescape.Quote(script))
+	return err
+}
+
+// ReceiveProgress is whether a receive job has finished, and the errors it reported.
+type ReceiveProgress struct {
+	finished bool
+	failed   bool
+	errors   string
+}
+
+// parseReceiveProgress parses the output of readReceiveProgress: the exit code (empty while running) and the errors,
+// separated by a line containing only "--".
+func parseReceiveProgress(output string) (*ReceiveProgress, error) {
+	parts := strings.SplitN(output, "\n--\n", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("unexpected receive progress output %q", output)
+	}
+
+	progress := &ReceiveProgress{errors: strings.TrimSpace(parts[1])}
+	switch exitCode := strings.TrimSpace(parts[0]); exitCode {
+	case "":
+	case "0":
+		progress.finished = true
+	default:
+		progress.finished = true
+		progress.failed = true
+	}
+	return progress, nil
+}
+
+func readReceiveProgress(config *Config, job ReceiveJob) (*ReceiveProgress, error) {
+	logPath := job.logPath()
+	stdout, err := callSshCommand(config, "cat %s.exit 2>/dev/null; echo --; tail -n 5 %s.err 2>/dev/null || true", logPath, logPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseReceiveProgress(stdout)
+}
+
+// removeReceiveLogs removes the directory of the job, along with its logs and any stream left behind.
+func removeReceiveLogs(config *Config, job ReceiveJob) error {
+	if !isJobDirectory(job.directory, receiveLogDirectory, receiveJobPrefix) {
+		return fmt.Errorf("refusing to remove %q, which isn't the directory of a receive", job.directory)
+	}
+	_, err := callSshCommand(config, "rm -rf %s", shellescape.Quote(job.directory))
+	return err
+}
+
+// parseStreamVersion picks the version of a stream from the headers printed by curl -sIL, preferring the ETag over
+// Last-Modified. Only the headers of the last response count, as redirects print the headers of every hop.
+func parseStreamVersion(headers string) string {
+	etag, lastModified := "", ""
+	for _, line := range strings.Split(headers, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "HTTP/") {
+			etag, lastModified = "", ""
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(name) {
+		case "etag":
+			etag = strings.TrimSpace(value)
+		case "last-modified":
+			lastModified = strings.TrimSpace(value)
+		}
+	}
+	if etag != "" {
+		return etag
+	}
+	return lastModified
+}
+
+// readStreamVersion returns a value which changes along with the stream, so a changed stream is received again:
+// the size and modification time of a file, or the ETag or Last-Modified header of a URL. Streams from a command have
+// no version, they are only received again when triggers change.
+func readStreamVersion(config *Config, source ReceiveSource) (string, error) {
+	switch {
+	case source.file != "":
+		command := "stat -c '%%s-%%Y' %s"
+		switch hostPlatform(config) {
+		case PlatformFreeBSD:
+			command = "stat -f '%%z-%%m' %s"
+		case PlatformIllumos:
+			command = "/usr/gnu/bin/stat -c '%%s-%%Y' %s"
+		}
+		stdout, err := callSshCommand(config, command, shellescape.Quote(source.file))
+		return strings.TrimSpace(stdout), err
+	case source.url != "":
+		stdout, err := callSshCommand(config, "curl -fsIL %s", shellescape.Quote(source.url))
+		if err != nil {
+			return "", err
+		}
+		return parseStreamVersion(stdout), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestReceiveJobCommand verifies the stream is piped into zfs receive from every kind of source, and that streams with
+// a checksum are verified before they are received.
+func TestReceiveJobCommand(t *testing.T) {
+	job := ReceiveJob{directory: "/var/tmp/terraform-zfs-receive.Ab12Cd34", target: "tank/images/base", mount: true}
+	checksum := strings.Repeat("ab", 32)
+
+	cases := []struct {
+		source   ReceiveSource
+		force    bool
+		expected string
+	}{
+		{ReceiveSource{file: "/srv/base.zfs"}, false, "zfs receive tank/images/base < /srv/base.zfs"},
+		{ReceiveSource{url: "https://images.example.com/base.zfs"}, true, "curl -fsSL https://images.example.com/base.zfs | zfs receive -F tank/images/base"},
+		{ReceiveSource{command: "ssh build zfs send images/base@v3"}, false, "{ ssh build zfs send images/base@v3; } | zfs receive tank/images/base"},
+		{
+			ReceiveSource{file: "/srv/base.zfs", checksum: checksum}, false,
+			"{ echo '" + checksum + "  /srv/base.zfs' | sha256sum -c --status || { echo 'the checksum of the stream doesn'\"'\"'t match' >&2; false; }; } && zfs receive tank/images/base < /srv/base.zfs",
+		},
+	}
+
+	for _, c := range cases {
+		job.source, job.force = c.source, c.force
+		if command := job.command(); command != c.expected {
+			t.Fatalf("unexpected command for %+v:\n%s\nexpected:\n%s", c.source, command, c.expected)
+		}
+	}
+
+	// A download is removed again whether or not it was received.
+	job.source = ReceiveSource{url: "https://images.example.com/base.zfs", checksum: checksum}
+	command := job.command()
+	stream := job.logPath() + ".stream"
+	if !strings.HasPrefix(command, "curl -fsSL -o "+stream) || !strings.HasSuffix(command, "rm -f "+stream+"; exit $rc") {
+		t.Fatalf("unexpected command %s", command)
+	}
+}
+
+// TestParseReceiveProgress verifies running, finished and failed receives are told apart.
+func TestParseReceiveProgress(t *testing.T) {
+	for output, expected := range map[string]ReceiveProgress{
+		"\n--\n":  {},
+		"0\n--\n": {finished: true},
+		"1\n--\ncannot receive new filesystem stream: destination 'tank/images/base' exists": {finished: true, failed: true, errors: "cannot receive new filesystem stream: destination 'tank/images/base' exists"},
+	} {
+		progress, err := parseReceiveProgress(output)
+		if err != nil {
+			t.Fatalf("parseReceiveProgress(%q) returned error: %v", output, err)
+		}
+		if *progress != expected {
+			t.Fatalf("parseReceiveProgress(%q): expected %#v, got %#v", output, expected, *progress)
+		}
+	}
+
+	if _, err := parseReceiveProgress("garbage"); err == nil {
+		t.Fatalf("expected an error for unexpected output")
+	}
+}
+
+// TestParseStreamVersion verifies the ETag of the last response wins over Last-Modified, and that the headers of
+// redirects are ignored.
+func TestParseStreamVersion(t *testing.T) {
+	cases := map[string]string{
+		"HTTP/1.1 302 Found\r\nETag: \"redirect\"\r\nLocation: /v3\r\n\r\nHTTP/1.1 200 OK\r\nETag: \"abc123\"\r\nLast-Modified: Mon, 01 Jan 2024 00:00:00 GMT\r\n": "\"abc123\"",
+		"HTTP/2 200\r\nlast-modified: Mon, 01 Jan 2024 00:00:00 GMT\r\n":                                                                                           "Mon, 01 Jan 2024 00:00:00 GMT",
+		"HTTP/2 200\r\ncontent-length: 42\r\n": "",
+	}
+
+	for headers, expected := range cases {
+		if version := parseStreamVersion(headers); version != expected {
+			t.Fatalf("parseStreamVersion(%q): expected %q, got %q", headers, expected, version)
+		}
+	}
+}
+
+// TestReadStreamVersion verifies the version of a file is its size and modification time, using the stat of the host, or
+// GNU stat on illumos.
+func TestReadStreamVersion(t *testing.T) {
+	executor := (&fakeExecutor{}).on("stat -c '%s-%Y' /srv/base.zfs", "1048576-1700000000\n")
+	config := newFakeConfig(executor)
+
+	version, err := readStreamVersion(config, ReceiveSource{file: "/srv/base.zfs"})
+	if err != nil || version != "1048576-1700000000" {
+		t.Fatalf("unexpected version %q, %v", version, err)
+	}
+
+	if version, err := readStreamVersion(config, ReceiveSource{command: "cat /srv/base.zfs"}); err != nil || version != "" {
+		t.Fatalf("expected no version for a command, got %q, %v", version, err)
+	}
+
+	illumos := (&fakeExecutor{}).on("/usr/gnu/bin/stat -c '%s-%Y' /srv/base.zfs", "1048576-1700000000\n")
+	config = newFakeConfig(illumos)
+	config.platform = PlatformIllumos
+	if version, err := readStreamVersion(config, ReceiveSource{file: "/srv/base.zfs"}); err != nil || version != "1048576-1700000000" {
+		t.Fatalf("unexpected version on illumos %q, %v", version, err)
+	}
+}
+
+// TestResourceReceivedDatasetRead verifies that only a dataset which is gone removes the resource from the state, so a
+// failed connection doesn't receive the stream again over live data.
+func TestResourceReceivedDatasetRead(t *testing.T) {
+	cases := []struct {
+		executor *fakeExecutor
+		gone     bool
+	}{
+		{(&fakeExecutor{}).on("zfs get -H -o value guid", "999\n").on("zfs list", "tank/other\t999\n"), true},
+		{(&fakeExecutor{}).fail("zfs get -H -o value guid", "ssh: handshake failed").fail("zfs list", "ssh: handshake failed"), false},
+	}
+
+	for _, c := range cases {
+		d := schema.TestResourceDataRaw(t, resourceReceivedDataset().Schema, map[string]interface{}{"name": "tank/image", "file": "/srv/image.zfs"})
+		d.SetId("1234")
+
+		diags := resourceReceivedDatasetRead(context.Background(), d, newFakeConfig(c.executor))
+		if c.gone && (diags.HasError() || d.Id() != "") {
+			t.Fatalf("expected a missing dataset to be removed from the state, got %v", diags)
+		}
+		if !c.gone && (!diags.HasError() || d.Id() == "") {
+			t.Fatalf("expected a failed refresh to keep the resource and fail, got %v", diags)
+		}
+	}
+}
+
+// TestReceiveJobDirectory verifies each job gets a private directory from mktemp, and that only such directories are
+// removed afterwards.
+func TestReceiveJobDirectory(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("mktemp -d /var/tmp/terraform-zfs-receive.XXXXXXXX", "/var/tmp/terraform-zfs-receive.Ab12Cd34\n").
+		on("rm -rf", "")
+	config := newFakeConfig(executor)
+
+	directory, err := createJobDirectory(config, receiveLogDirectory, receiveJobPrefix)
+	if err != nil || directory != "/var/tmp/terraform-zfs-receive.Ab12Cd34" {
+		t.Fatalf("unexpected directory %q, %v", directory, err)
+	}
+
+	if err := removeReceiveLogs(config, ReceiveJob{directory: directory}); err != nil || !executor.ran("rm -rf /var/tmp/terraform-zfs-receive.Ab12Cd34") {
+		t.Fatalf("expected the directory to be removed, got %v", err)
+	}
+
+	for _, directory := range []string{"", "/", "/var/tmp", "/var/tmp/terraform-zfs-receive.Ab12Cd34/..", "/etc/terraform-zfs-receive.Ab12Cd34"} {
+		if err := removeReceiveLogs(config, ReceiveJob{directory: directory}); err == nil {
+			t.Fatalf("expected %q not to be removed", directory)
+		}
+	}
+
+	bad := (&fakeExecutor{}).on("mktemp", "/tmp/evil\n")
+	if _, err := createJobDirectory(newFakeConfig(bad), receiveLogDirectory, receiveJobPrefix); err == nil {
+		t.Fatalf("expected an error for a directory outside of %s", receiveLogDirectory)
+	}
+}
+
+// TestResourceReceivedDatasetDelete verifies a freshly received dataset is destroyed with its snapshot by default, so
+// a changed stream can replace it.
+func TestResourceReceivedDatasetDelete(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -H -o value guid", "1234\n").
+		on("zfs list -H -p -r -t all", "tank/image\tfilesystem\t2147483648\ntank/image@v3\tsnapshot\t2147483648\n").
+		on("zfs destroy", "")
+
+	d := schema.TestResourceDataRaw(t, resourceReceivedDataset().Schema, map[string]interface{}{"name": "tank/image", "file": "/srv/image.zfs"})
+	d.SetId("1234")
+
+	if diags := resourceReceivedDatasetDelete(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if !executor.ran("zfs destroy -r tank/image") {
+		t.Fatalf("expected the dataset to be destroyed, ran %v", executor.commands)
+	}
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceChannelProgram() *schema.Resource {
+	fields := channelProgramFields(true)
+	fields["triggers"] = &schema.Schema{
+		Description: "Arbitrary values which run the program again when changed.",
+		Type:        schema.TypeMap,
+		Optional:    true,
+		ForceNew:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+	}
+
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Runs a ZFS channel program, a Lua script executed atomically by `zfs program`, when created. This allows operations the provider doesn't model, such as snapshotting many datasets in a single transaction. Changing any argument or `triggers` runs the program again. Destroying the resource does not undo what the program did.",
+
+		CreateContext: resourceChannelProgramCreate,
+		ReadContext:   resourceChannelProgramRead,
+		DeleteContext: resourceChannelProgramDelete,
+
+		Schema: fields,
+	}
+}
+
+func resourceChannelProgramCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	program := expandChannelProgram(d)
+	result, err := runChannelProgram(config, program)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("result", result); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s:%d", program.pool, time.Now().Unix()))
+
+	return resourceChannelProgramRead(ctx, d, meta)
+}
+
+func resourceChannelProgramRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	// The result is what the program returned when it ran, there's nothing on the host to refresh it from.
+	return diags
+}
+
+func resourceChannelProgramDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	return diags
+}
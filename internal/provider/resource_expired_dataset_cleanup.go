@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceExpiredDatasetCleanup() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Destroys the datasets whose `expires_at` has passed on every apply. Only datasets with a locally set `terraform:expires_at` user property are considered, " +
+			"and expired descendents of an expired dataset are destroyed along with it. Destroying the resource leaves all datasets in place.",
+
+		CreateContext: resourceExpiredDatasetCleanupCreate,
+		ReadContext:   resourceExpiredDatasetCleanupRead,
+		UpdateContext: resourceExpiredDatasetCleanupUpdate,
+		DeleteContext: resourceExpiredDatasetCleanupDelete,
+
+		CustomizeDiff: resourceExpiredDatasetCleanupCustomizeDiff,
+
+		Schema: map[string]*schema.Schema{
+			"parent": {
+				Description: "Only clean up this dataset and its descendents. Defaults to all datasets on the host.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"recursive": {
+				Description: "Also destroy the snapshots and descendents of expired datasets, which otherwise cause the cleanup to fail. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"destroyed": {
+				Description: "Names of the datasets destroyed by the last apply.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// resourceExpiredDatasetCleanupCustomizeDiff marks the destroyed datasets as unknown on every plan, so that
+// every apply runs the cleanup.
+func resourceExpiredDatasetCleanupCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" {
+		return nil
+	}
+	return d.SetNewComputed("destroyed")
+}
+
+func resourceExpiredDatasetCleanupCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	d.SetId(d.Get("parent").(string))
+	if d.Id() == "" {
+		d.SetId("*")
+	}
+	return resourceExpiredDatasetCleanupUpdate(ctx, d, meta)
+}
+
+func resourceExpiredDatasetCleanupRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+	return diags
+}
+
+func resourceExpiredDatasetCleanupUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	datasets, err := listExpiringDatasets(config, d.Get("parent").(string))
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	names := make([]string, 0)
+	for _, dataset := range expiredDatasets(datasets, time.Now()) {
+		names = append(names, dataset.name)
+	}
+
+	// Recursive destroys take expired descendents along with their ancestor, otherwise descendents
+	// are destroyed first so their ancestor can be destroyed after them.
+	flags := ""
+	if d.Get("recursive").(bool) {
+		flags = "-r "
+		names = outermostDatasets(names)
+	} else {
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	}
+
+	destroyed := make([]string, 0)
+	for _, name := range names {
+		log.Printf("[DEBUG] destroying expired dataset %s", name)
+		if _, err := callSshCommandContext(ctx, config, "zfs destroy %s%s", flags, shellescape.Quote(name)); err != nil {
+			// Record what was destroyed so far, the remaining datasets are retried on the next apply.
+			_ = d.Set("destroyed", destroyed)
+			return diagFromErr(err)
+		}
+		destroyed = append(destroyed, name)
+	}
+
+	if err := d.Set("destroyed", destroyed); err != nil {
+		return diagFromErr(err)
+	}
+
+	return nil
+}
+
+func resourceExpiredDatasetCleanupDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+	return diags
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 func resourceFilesystem() *schema.Resource {
@@ -20,9 +22,18 @@ func resourceFilesystem() *schema.Resource {
 		DeleteContext: resourceFilesystemDelete,
 
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: importStateWithDefaults(resourceFilesystem, schema.ImportStatePassthroughContext),
 		},
 
+		// Retries of transient errors such as busy pools stop once the timeout of the operation has passed.
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		CustomizeDiff: resourceDatasetCustomizeDiff,
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				// This description is used by the documentation generator and the language server.
@@ -36,6 +47,19 @@ func resourceFilesystem() *schema.Resource {
 				Optional:    true,
 				Default:     "none",
 			},
+			"canmount": {
+				Description:      "Whether the filesystem can be mounted, one of `on`, `off` or `noauto`. With `noauto` it is only mounted explicitly, e.g. through `mounted`. When not set, the value zfs gives the filesystem is left alone.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{"on", "off", "noauto"}, false)),
+			},
+			"mounted": {
+				Description: "Whether the filesystem should be mounted. When set, the filesystem is mounted or unmounted to match, and unmounting it outside of terraform shows up as a change. When not set, this reflects whether it is currently mounted.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Computed:    true,
+			},
 			"owner": {
 				Description:   "Set owner of the mountpoint. Must be a valid username",
 				Type:          schema.TypeString,
@@ -64,10 +88,24 @@ func resourceFilesystem() *schema.Resource {
 				ConflictsWith: []string{"group"},
 				RequiredWith:  []string{"mountpoint"},
 			},
-			"property":       &propertySchema,
-			"property_mode":  &propertyModeSchema,
-			"properties":     &propertiesSchema,
-			"raw_properties": &rawPropertiesSchema,
+			"force_destroy":              &forceDestroySchema,
+			"create_parents":             &createParentsSchema,
+			"allow_external_rename":      &allowExternalRenameSchema,
+			"rename_on_name_change":      &renameOnNameChangeSchema,
+			"force_unmount_on_rename":    &forceUnmountOnRenameSchema,
+			"current_name":               &currentNameSchema,
+			"expires_at":                 &expiresAtSchema,
+			"metadata":                   &metadataSchema,
+			"metadata_property":          &metadataPropertySchema,
+			"property":                   &propertySchema,
+			"property_mode":              &propertyModeSchema,
+			"drift_detection":            &driftDetectionSchema,
+			"sensitive_properties":       &sensitivePropertiesSchema,
+			"sensitive_property_storage": &sensitivePropertyStorageSchema,
+			"properties":                 &propertiesSchema,
+			"raw_properties":             &rawPropertiesSchema,
+			"properties_numeric":         &numericPropertiesSchema,
+			"property_sources":           &propertySourcesSchema,
 		},
 	}
 }
@@ -90,28 +128,39 @@ func resourceFilesystemCreate(ctx context.Context, d *schema.ResourceData, meta
 			{
 				if err.errmsg != "dataset does not exist" {
 					log.Printf("[DEBUG] zfs err: %s", err.Error())
-					return diag.FromErr(err)
+					return diagFromErr(err)
 				}
 			}
 		default:
 			{
 				log.Printf("[DEBUG] zfs err: %s", err.Error())
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 	}
 
 	mountpoint := d.Get("mountpoint").(string)
 	properties := parsePropertyBlocks(d.Get("property").(*schema.Set).List())
-	filesystem, err = createDataset(config, &CreateDataset{
-		dsType:     FilesystemType,
-		name:       filesystemName,
-		mountpoint: mountpoint,
-		properties: properties,
+	if err := addMetadataProperty(d, properties); err != nil {
+		return diagFromErr(err)
+	}
+	addExpiresAtProperty(d, properties)
+	for name, value := range sensitivePropertyValues(config, d.Get("sensitive_properties")) {
+		properties[name] = value
+	}
+	if canmount := d.GetRawConfig().GetAttr("canmount"); !canmount.IsNull() && canmount.IsKnown() {
+		properties["canmount"] = canmount.AsString()
+	}
+	filesystem, err = createDataset(ctx, config, &CreateDataset{
+		dsType:        FilesystemType,
+		name:          filesystemName,
+		mountpoint:    mountpoint,
+		createParents: d.Get("create_parents").(bool),
+		properties:    properties,
 	})
 
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	// We're setting the ID here because the filesystem DOES exist, even if the mountpoint
@@ -119,28 +168,34 @@ func resourceFilesystemCreate(ctx context.Context, d *schema.ResourceData, meta
 	log.Printf("[DEBUG] committing guid: %s", filesystem.guid)
 	d.SetId(filesystem.guid)
 
+	if mounted := d.GetRawConfig().GetAttr("mounted"); !mounted.IsNull() {
+		if err := setMounted(ctx, config, filesystemName, mounted.True()); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
 	if mountpoint != "none" && mountpoint != "legacy" {
 		if uid, ok := d.GetOk("uid"); ok {
 			if _, err = callSshCommand(config, "chown '%d' '%s'", uid.(int), mountpoint); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if gid, ok := d.GetOk("gid"); ok {
 			if _, err = callSshCommand(config, "chgrp '%d' '%s'", gid.(int), mountpoint); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if owner, ok := d.GetOk("owner"); ok {
 			if _, err = callSshCommand(config, "chown '%s' '%s'", owner.(string), mountpoint); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if group, ok := d.GetOk("group"); ok {
 			if _, err = callSshCommand(config, "chgrp '%s' '%s'", group.(string), mountpoint); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 	}
@@ -153,81 +208,106 @@ func resourceFilesystemRead(ctx context.Context, d *schema.ResourceData, meta in
 
 	config := meta.(*Config)
 
-	filesystemName := d.Get("name").(string)
+	filesystemName := currentDatasetName(d)
 	if id := d.Id(); id != "" {
 		// If we have a Resource ID, then use that to lookup the real name
 		// of the zfs resource, in case the name has changed.
-		real_name, err := getDatasetNameByGuid(config, id)
+		real_name, err := getDatasetNameByGuid(config, filesystemName, id)
 		if err != nil {
-			return diag.FromErr(fmt.Errorf("the filesystem %s identified by guid %s could not be found. It was likely deleted on the server outside of terraform", filesystemName, id))
+			return diagFromErr(fmt.Errorf("the filesystem %s identified by guid %s could not be found. It was likely deleted on the server outside of terraform", filesystemName, id))
 		}
 		filesystemName = *real_name
 	}
 
-	if err := d.Set("name", filesystemName); err != nil {
-		return diag.FromErr(err)
+	if err := reconcileDatasetName(d, filesystemName); err != nil {
+		return diagFromErr(err)
 	}
 
-	filesystem, err := describeDataset(config, filesystemName, getPropertyNames(d))
+	if !isNewOrFullRead(d) {
+		return diags
+	}
+
+	filesystem, err := describeDataset(config, filesystemName, append(getPropertyNames(d), sensitivePropertyNames(d)...))
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
+	sensitive := takeSensitiveProperties(config, d, filesystem.properties)
 
 	if err = d.Set("mountpoint", filesystem.mountpoint); err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+
+	if err = d.Set("canmount", filesystem.properties["canmount"].value); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err = d.Set("mounted", filesystem.properties["mounted"].value == "yes"); err != nil {
+		return diagFromErr(err)
 	}
 
 	if filesystem.mountpoint != "none" && filesystem.mountpoint != "legacy" {
 		log.Println("[DEBUG] Fetching filesystem mountpoint ownership information")
 		ownership, err := getFileOwnership(config, filesystem.mountpoint)
 		if err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		// Ignore any values not explicitly tracked by terraform
 		if _, ok := d.GetOk("owner"); ok {
 			if err = d.Set("owner", ownership.userName); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if _, ok := d.GetOk("group"); ok {
 			if err = d.Set("group", ownership.groupName); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if _, ok := d.GetOk("gid"); ok {
 			if err = d.Set("gid", ownership.gid); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if _, ok := d.GetOk("uid"); ok {
 			if err = d.Set("uid", ownership.uid); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 	} else {
 		if err = d.Set("owner", nil); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		if err = d.Set("group", nil); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		if err = d.Set("gid", nil); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 
 		if err = d.Set("uid", nil); err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 	}
 
-	if err := updatePropertiesInState(d, filesystem.properties, []string{"mountpoint"}); err != nil {
-		return diag.FromErr(err)
+	if err := updateExpiresAtInState(d, filesystem.properties); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := updateMetadataInState(d, filesystem.properties); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := updateSensitivePropertiesInState(d, sensitive); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := updatePropertiesInState(d, driftProperties(d, filesystem.properties, []string{"mountpoint", "canmount", "mounted", expiresAtProperty, d.Get("metadata_property").(string)}), []string{"mountpoint", "canmount", expiresAtProperty, d.Get("metadata_property").(string)}); err != nil {
+		return diagFromErr(err)
 	}
 
 	d.SetId(filesystem.guid)
@@ -236,52 +316,83 @@ func resourceFilesystemRead(ctx context.Context, d *schema.ResourceData, meta in
 
 func resourceFilesystemUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	config := meta.(*Config)
-	old_name, err := getDatasetNameByGuid(config, d.Id())
+	old_name, err := getDatasetNameByGuid(config, currentDatasetName(d), d.Id())
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
-	filesystemName := d.Get("name").(string)
-	// Rename the filesystem
-	if filesystemName != *old_name {
-		if err := renameDataset(config, *old_name, filesystemName); err != nil {
-			return diag.FromErr(err)
+	filesystemName := *old_name
+	// Rename the filesystem, unless only its name in the state differs because an external rename was adopted
+	if d.HasChange("name") && d.Get("name").(string) != *old_name {
+		filesystemName = d.Get("name").(string)
+		if err := renameDataset(ctx, config, *old_name, filesystemName, d.Get("create_parents").(bool), d.Get("force_unmount_on_rename").(bool)); err != nil {
+			return diagFromErr(err)
 		}
 	}
 
-	filesystem, err := describeDataset(config, filesystemName, getPropertyNames(d))
+	filesystem, err := describeDataset(config, filesystemName, append(getPropertyNames(d), sensitivePropertyNames(d)...))
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+	sensitive := takeSensitiveProperties(config, d, filesystem.properties)
+
+	overrideProperties := map[string]string{
+		"mountpoint": d.Get("mountpoint").(string),
+	}
+	if !d.GetRawConfig().GetAttr("canmount").IsNull() {
+		overrideProperties["canmount"] = d.Get("canmount").(string)
+	}
+	if err := resetMetadataProperty(config, d, filesystemName); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := resetExpiresAtProperty(config, d, filesystemName); err != nil {
+		return diagFromErr(err)
+	}
+	addExpiresAtProperty(d, overrideProperties)
+
+	if err := addMetadataProperty(d, overrideProperties); err != nil {
+		return diagFromErr(err)
 	}
 
-	overrideProperties := map[string]string{"mountpoint": d.Get("mountpoint").(string)}
 	err = applyPropertyDiff(config, d, filesystemName, filesystem.properties, overrideProperties)
 	if err != nil {
-		return diag.FromErr(err)
+		// Refresh the state first, so it reflects the properties which were applied despite the failures.
+		return append(resourceFilesystemRead(ctx, d, meta), diagFromErr(err)...)
+	}
+
+	if err := applySensitivePropertyDiff(config, d, filesystemName, sensitive); err != nil {
+		return append(resourceFilesystemRead(ctx, d, meta), diagFromErr(err)...)
+	}
+
+	if d.HasChange("mounted") {
+		if err := setMounted(ctx, config, filesystemName, d.Get("mounted").(bool)); err != nil {
+			return diagFromErr(err)
+		}
 	}
 
 	if mountpoint, ok := d.GetOk("mountpoint"); ok {
 		if uid, ok := d.GetOk("uid"); ok && d.HasChange("uid") {
 			if _, err = callSshCommand(config, "chown '%d' '%s'", uid.(int), mountpoint.(string)); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if gid, ok := d.GetOk("gid"); ok && d.HasChange("gid") {
 			if _, err = callSshCommand(config, "chgrp '%d' '%s'", gid.(int), mountpoint.(string)); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if owner, ok := d.GetOk("owner"); ok && d.HasChange("owner") {
 			if _, err = callSshCommand(config, "chown '%s' '%s'", owner.(string), mountpoint.(string)); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 
 		if group, ok := d.GetOk("group"); ok && d.HasChange("group") {
 			if _, err = callSshCommand(config, "chgrp '%s' '%s'", group.(string), mountpoint.(string)); err != nil {
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 	}
@@ -292,10 +403,14 @@ func resourceFilesystemUpdate(ctx context.Context, d *schema.ResourceData, meta
 func resourceFilesystemDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 	config := meta.(*Config)
-	filesystemName := d.Get("name").(string)
+	filesystemName := currentDatasetName(d)
+
+	if err := checkDestroySafe(config, filesystemName, d.Get("force_destroy").(bool)); err != nil {
+		return diagFromErr(err)
+	}
 
-	if err := destroyDataset(config, filesystemName); err != nil {
-		return diag.FromErr(err)
+	if err := destroyDataset(ctx, config, filesystemName); err != nil {
+		return diagFromErr(err)
 	}
 
 	d.SetId("")
@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceModuleParameter() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "A tunable of the zfs kernel module, such as `zfs_bclone_enabled` or `zfs_arc_max`, set through `/sys/module/zfs/parameters` on Linux, or the matching `vfs.zfs.` sysctl on FreeBSD, e.g. `vfs.zfs.arc_max`. illumos is not supported, as its tunables are set in `/etc/system`. The value applies to the running module only, so it has to be reapplied after a reboot, e.g. by a later apply.",
+
+		CreateContext: resourceModuleParameterCreate,
+		ReadContext:   resourceModuleParameterRead,
+		UpdateContext: resourceModuleParameterUpdate,
+		DeleteContext: resourceModuleParameterDelete,
+
+		Importer: &schema.ResourceImporter{
+			StateContext: importStateWithDefaults(resourceModuleParameter, resourceModuleParameterImport),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Description:      "Name of the module parameter, e.g. `zfs_bclone_enabled`.",
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(moduleParameterPattern, "must be the name of a zfs module parameter")),
+			},
+			"value": {
+				Description: "Value of the module parameter, e.g. `1`.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"restore_on_destroy": {
+				Description: "Restore the value the parameter had before it was managed when the resource is destroyed. Defaults to `true`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"original_value": {
+				Description: "The value the parameter had before it was managed.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceModuleParameterCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	name := d.Get("name").(string)
+	original, err := readModuleParameter(config, name)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := writeModuleParameter(config, name, d.Get("value").(string)); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(name)
+
+	if err := d.Set("original_value", original); err != nil {
+		return diagFromErr(err)
+	}
+
+	return resourceModuleParameterRead(ctx, d, meta)
+}
+
+func resourceModuleParameterRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	value, err := readModuleParameter(config, d.Id())
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("name", d.Id()); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("value", value); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceModuleParameterUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	if d.HasChange("value") {
+		if err := writeModuleParameter(config, d.Id(), d.Get("value").(string)); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return resourceModuleParameterRead(ctx, d, meta)
+}
+
+func resourceModuleParameterDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	original := d.Get("original_value").(string)
+	if d.Get("restore_on_destroy").(bool) && original != "" {
+		log.Printf("[DEBUG] restoring module parameter %s to %s", d.Id(), original)
+		if err := writeModuleParameter(config, d.Id(), original); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	d.SetId("")
+	return diags
+}
+
+// resourceModuleParameterImport treats the current value of an imported parameter as its original value.
+func resourceModuleParameterImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	config := meta.(*Config)
+
+	if !moduleParameterPattern.MatchString(d.Id()) {
+		return nil, fmt.Errorf("%q is not the name of a zfs module parameter", d.Id())
+	}
+
+	value, err := readModuleParameter(config, d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.Set("original_value", value); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
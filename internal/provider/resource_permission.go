@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourcePermission() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Delegated administration permissions on a dataset, managed through `zfs allow` and `zfs unallow`.",
+
+		CreateContext: resourcePermissionCreate,
+		ReadContext:   resourcePermissionRead,
+		UpdateContext: resourcePermissionUpdate,
+		DeleteContext: resourcePermissionDelete,
+
+		Importer: &schema.ResourceImporter{
+			StateContext: resourcePermissionImport,
+		},
+
+		Schema: map[string]*schema.Schema{
+			"dataset": {
+				Description: "Name of the filesystem or volume to delegate permissions on.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"user": {
+				Description:  "Name of the user to grant permissions to.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: []string{"user", "group", "everyone"},
+			},
+			"group": {
+				Description:  "Name of the group to grant permissions to.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: []string{"user", "group", "everyone"},
+			},
+			"everyone": {
+				Description:  "Grant the permissions to everyone.",
+				Type:         schema.TypeBool,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: []string{"user", "group", "everyone"},
+			},
+			"scope": {
+				Description: `
+					Where the permissions apply.
+
+					"local+descendent" applies the permissions to the dataset and all of its descendents. This is the default.
+
+					"local" applies the permissions to the dataset only.
+
+					"descendent" applies the permissions to the descendents of the dataset, but not the dataset itself.
+				`,
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				Default:          string(PermissionScopeLocalDescendent),
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(permissionScopes, false)),
+			},
+			"permissions": {
+				Description: "Permissions, permission sets (`@name`) or properties to grant, e.g. `snapshot`, `mount`, `send`, `receive` or `create`.",
+				Type:        schema.TypeSet,
+				Required:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// getPermissionPrincipal returns the principal type and name configured on the resource.
+func getPermissionPrincipal(d *schema.ResourceData) (PermissionPrincipal, string) {
+	if user, ok := d.GetOk("user"); ok {
+		return PrincipalUser, user.(string)
+	}
+	if group, ok := d.GetOk("group"); ok {
+		return PrincipalGroup, group.(string)
+	}
+	return PrincipalEveryone, ""
+}
+
+func permissionId(dataset string, principal PermissionPrincipal, name string, scope PermissionScope) string {
+	return strings.Join([]string{dataset, string(principal), name, string(scope)}, "|")
+}
+
+func resourcePermissionCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	dataset := d.Get("dataset").(string)
+	principal, name := getPermissionPrincipal(d)
+	scope := PermissionScope(d.Get("scope").(string))
+	permissions := expandStringSet(d.Get("permissions").(*schema.Set))
+
+	if err := allowPermissions(config, dataset, principal, name, scope, permissions); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(permissionId(dataset, principal, name, scope))
+
+	return resourcePermissionRead(ctx, d, meta)
+}
+
+func resourcePermissionRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	dataset := d.Get("dataset").(string)
+	principal, name := getPermissionPrincipal(d)
+	scope := PermissionScope(d.Get("scope").(string))
+
+	allowed, err := describePermissions(config, dataset)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	granted := allowed.granted(principal, name, scope)
+	if len(granted) == 0 {
+		log.Printf("[DEBUG] no permissions found for %s %s on %s, removing from state", principal, name, dataset)
+		d.SetId("")
+		return diags
+	}
+
+	if err := d.Set("permissions", granted); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourcePermissionUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	dataset := d.Get("dataset").(string)
+	principal, name := getPermissionPrincipal(d)
+	scope := PermissionScope(d.Get("scope").(string))
+
+	if d.HasChange("permissions") {
+		oldPermissions, newPermissions := d.GetChange("permissions")
+		revoked := expandStringSet(oldPermissions.(*schema.Set).Difference(newPermissions.(*schema.Set)))
+		granted := expandStringSet(newPermissions.(*schema.Set).Difference(oldPermissions.(*schema.Set)))
+
+		if len(revoked) > 0 {
+			if err := unallowPermissions(config, dataset, principal, name, scope, revoked); err != nil {
+				return diagFromErr(err)
+			}
+		}
+
+		if len(granted) > 0 {
+			if err := allowPermissions(config, dataset, principal, name, scope, granted); err != nil {
+				return diagFromErr(err)
+			}
+		}
+	}
+
+	return resourcePermissionRead(ctx, d, meta)
+}
+
+func resourcePermissionDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	dataset := d.Get("dataset").(string)
+	principal, name := getPermissionPrincipal(d)
+	scope := PermissionScope(d.Get("scope").(string))
+	permissions := expandStringSet(d.Get("permissions").(*schema.Set))
+
+	if err := unallowPermissions(config, dataset, principal, name, scope, permissions); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId("")
+	return diags
+}
+
+func resourcePermissionImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.Split(d.Id(), "|")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid import id %q, expected <dataset>|<user|group|everyone>|<name>|<scope>", d.Id())
+	}
+
+	if err := d.Set("dataset", parts[0]); err != nil {
+		return nil, err
+	}
+
+	switch PermissionPrincipal(parts[1]) {
+	case PrincipalUser:
+		if err := d.Set("user", parts[2]); err != nil {
+			return nil, err
+		}
+	case PrincipalGroup:
+		if err := d.Set("group", parts[2]); err != nil {
+			return nil, err
+		}
+	case PrincipalEveryone:
+		if err := d.Set("everyone", true); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid principal type %q, expected one of user, group or everyone", parts[1])
+	}
+
+	if err := d.Set("scope", parts[3]); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testZfsAllowOutput = `---- Permissions on tank/home ----------------------------------------
+Permission sets:
+	@pset create,destroy
+Create time permissions:
+	create,destroy
+Local permissions:
+	group staff snapshot
+Local+Descendent permissions:
+	user cindys create,destroy,mount,snapshot
+	everyone send
+---- Permissions on tank ---------------------------------------------
+Local+Descendent permissions:
+	user cindys receive`
+
+// TestParsePermissions_OnlyOwnSection verifies that permissions inherited from
+// ancestors are not attributed to the dataset itself.
+func TestParsePermissions_OnlyOwnSection(t *testing.T) {
+	permissions := parsePermissions(testZfsAllowOutput, "tank/home")
+
+	if got := permissions.granted(PrincipalUser, "cindys", PermissionScopeLocalDescendent); !reflect.DeepEqual(got, []string{"create", "destroy", "mount", "snapshot"}) {
+		t.Fatalf("unexpected permissions for cindys: %#v", got)
+	}
+
+	if got := permissions.granted(PrincipalGroup, "staff", PermissionScopeLocal); !reflect.DeepEqual(got, []string{"snapshot"}) {
+		t.Fatalf("unexpected permissions for staff: %#v", got)
+	}
+
+	if got := permissions.granted(PrincipalEveryone, "", PermissionScopeLocalDescendent); !reflect.DeepEqual(got, []string{"send"}) {
+		t.Fatalf("unexpected permissions for everyone: %#v", got)
+	}
+
+	if len(permissions) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %#v", len(permissions), permissions)
+	}
+}
+
+// TestParsePermissions_Ancestor verifies that a dataset's own section is found
+// even when it isn't the first one in the output.
+func TestParsePermissions_Ancestor(t *testing.T) {
+	permissions := parsePermissions(testZfsAllowOutput, "tank")
+
+	if got := permissions.granted(PrincipalUser, "cindys", PermissionScopeLocalDescendent); !reflect.DeepEqual(got, []string{"receive"}) {
+		t.Fatalf("unexpected permissions for cindys: %#v", got)
+	}
+}
+
+// TestSerializePermissionTarget verifies the flags passed to zfs allow/unallow.
+func TestSerializePermissionTarget(t *testing.T) {
+	cases := []struct {
+		principal PermissionPrincipal
+		name      string
+		scope     PermissionScope
+		expected  string
+	}{
+		{PrincipalUser, "cindys", PermissionScopeLocalDescendent, "-u cindys"},
+		{PrincipalGroup, "staff", PermissionScopeLocal, "-l -g staff"},
+		{PrincipalEveryone, "", PermissionScopeDescendent, "-d -e"},
+	}
+
+	for _, c := range cases {
+		if got := serializePermissionTarget(c.principal, c.name, c.scope); got != c.expected {
+			t.Fatalf("expected %q, got %q", c.expected, got)
+		}
+	}
+}
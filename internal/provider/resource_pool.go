@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
@@ -14,9 +17,14 @@ var vdevSchema = &schema.Resource{
 	Schema: map[string]*schema.Schema{
 		"path": {
 			Type:        schema.TypeString,
-			Description: "Device path of the vdev to add",
+			Description: "Device path of the vdev to add. Cloud volumes can be referenced by AWS EBS volume ID (`vol-0123abcd`), GCP device name (`gcp:name`), Azure LUN (`azure:lun0`) or iSCSI LUN (`iscsi:<portal>/<iqn>/<lun>`), which are resolved to their stable device paths on apply. The host is logged in to iSCSI targets with iscsiadm as needed",
 			Required:    true,
-			ForceNew:    true,
+		},
+		"wait_for_device_timeout": {
+			Description:      "How long to wait for the device to appear before using it, e.g. `5m` for a volume which is attached in the same apply. By default the device must already exist",
+			Type:             schema.TypeString,
+			Optional:         true,
+			ValidateDiagFunc: validateDuration,
 		},
 	},
 }
@@ -27,17 +35,49 @@ var mirrorSchema = &schema.Resource{
 			Description: "Device(s) which make up the mirror. Repeat the block for multiple devices",
 			Type:        schema.TypeList,
 			Required:    true,
-			ForceNew:    true,
 			Elem:        vdevSchema,
 			MinItems:    2,
 		},
 	},
 }
 
+var capacitySchema = &schema.Resource{
+	Schema: map[string]*schema.Schema{
+		"redundancy": {
+			Description:      "Type of vdev to build, one of `stripe`, `mirror`, `raidz1`, `raidz2` or `raidz3`",
+			Type:             schema.TypeString,
+			Required:         true,
+			ForceNew:         true,
+			ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(redundancies, false)),
+		},
+		"size": {
+			Description: "Minimum usable capacity of the pool, e.g. `10T`. Parity and mirror copies are excluded, metadata overhead is not",
+			Type:        schema.TypeString,
+			Required:    true,
+			ForceNew:    true,
+		},
+		"devices": {
+			Description: "Candidate device paths or cloud volume references, in order of preference. Only as many devices as needed to reach `size` are used",
+			Type:        schema.TypeList,
+			Required:    true,
+			ForceNew:    true,
+			MinItems:    1,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+		},
+		"vdev_width": {
+			Description: "Number of devices per vdev. Defaults to 2 for `mirror`, 3 for `raidz1`, 6 for `raidz2`, 8 for `raidz3` and 1 for `stripe`",
+			Type:        schema.TypeInt,
+			Optional:    true,
+			ForceNew:    true,
+		},
+	},
+}
+
 var propertySchema = schema.Schema{
-	Description: "Propert(y/ies) to set",
-	Type:        schema.TypeSet,
-	Optional:    true,
+	Description: "Propert(y/ies) to set. Changing a property which can only be set on creation (`" + strings.Join(createOnlyProperties, "`, `") + "`) " +
+		"to a value other than its current one replaces the resource, which destroys it along with its data",
+	Type:     schema.TypeSet,
+	Optional: true,
 	Elem: &schema.Resource{
 		Schema: map[string]*schema.Schema{
 			"name": {
@@ -46,9 +86,15 @@ var propertySchema = schema.Schema{
 				Required:    true,
 			},
 			"value": {
-				Description: "Value of the property",
+				Description: "Value of the property. Leave it out when `inherit` is set",
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
+			},
+			"inherit": {
+				Description: "Keep the property inherited from the parent dataset (or at its default), resetting it with `zfs inherit` whenever it is set locally or received. Pool properties can't be inherited. Defaults to `false`",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
 			},
 		},
 	},
@@ -68,9 +114,13 @@ var propertyModeSchema = schema.Schema{
 		recognize as some tools might use user properties to track information important for that tool to work properly
 		with a given resource.
 
-		Note that some properties don't have a default that they can be compared/reset to (notably most of the zpool
-		properties). These properties will only ever be managed when explicitly defined, and will be left as they are when
-		they stop being defined.
+		Removing a property block resets the property: dataset properties are inherited with "zfs inherit", and zpool
+		properties with a known default (autoexpand, autoreplace, autotrim, cachefile, comment, delegation, failmode,
+		listsnapshots and multihost) are set back to it with "zpool set".
+
+		Note that some properties don't have a default that they can be compared/reset to (notably the remaining zpool
+		properties and properties which can only be set on creation). These properties will only ever be managed when
+		explicitly defined, and will be left as they are when they stop being defined.
 	`,
 	Type:             schema.TypeString,
 	Default:          "defined",
@@ -92,10 +142,27 @@ var rawPropertiesSchema = schema.Schema{
 	Elem:        schema.TypeString,
 }
 
+var propertySourcesSchema = schema.Schema{
+	Description: "Where the value of each zfs property comes from, as reported by zfs get: `local`, `default`, `inherited from <dataset>`, `received`, `temporary` or `-` for read-only properties.",
+	Type:        schema.TypeMap,
+	Computed:    true,
+	Elem:        schema.TypeString,
+}
+
+var numericPropertiesSchema = schema.Schema{
+	Description: "Numeric zfs properties as numbers, e.g. sizes in bytes, percentages such as `capacity` and ratios such as `compressratio`. Properties which are unset (`-` or `none`) or not numbers are left out, as are identifiers such as `guid`, which don't fit a number exactly.",
+	Type:        schema.TypeMap,
+	Computed:    true,
+	Elem: &schema.Schema{
+		Type: schema.TypeFloat,
+	},
+}
+
 func resourcePool() *schema.Resource {
-	return &schema.Resource{
+	resource := &schema.Resource{
 		// This description is used by the documentation generator and the language server.
-		Description: "zfs pool resource.",
+		Description: "zfs pool resource. Changing a `property` which can only be set when the pool is created, such as `ashift`, replaces the pool " +
+			"in the plan. With the default `destroy_behavior`, this destroys the pool along with all its data before it is created anew.",
 
 		CreateContext: resourcePoolCreate,
 		ReadContext:   resourcePoolRead,
@@ -103,9 +170,18 @@ func resourcePool() *schema.Resource {
 		DeleteContext: resourcePoolDelete,
 
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: importStateWithDefaults(resourcePool, resourcePoolImportState),
+		},
+
+		// Retries of transient errors such as busy pools stop once the timeout of the operation has passed.
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
 		},
 
+		CustomizeDiff: resourcePoolCustomizeDiff,
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Description: "Name of the zpool.",
@@ -123,19 +199,231 @@ func resourcePool() *schema.Resource {
 				Type:        schema.TypeList,
 				Optional:    true,
 				AtLeastOneOf: []string{
-					"device", "mirror",
+					"device", "mirror", "capacity",
 				},
 				ConflictsWith: []string{
-					"mirror",
+					"mirror", "capacity",
 				},
 				Elem: vdevSchema,
 			},
-			"property":       &propertySchema,
-			"property_mode":  &propertyModeSchema,
-			"properties":     &propertiesSchema,
-			"raw_properties": &rawPropertiesSchema,
+			"capacity": {
+				Description: "Derive the data vdevs from a desired redundancy and usable capacity instead of listing them with `mirror` or `device` blocks. The layout is computed from the candidate devices when the pool is created, and exposed through `data_vdevs`",
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				MaxItems:    1,
+				ConflictsWith: []string{
+					"mirror", "device",
+				},
+				Elem: capacitySchema,
+			},
+			"status": {
+				Description: "Health of the pool and its vdevs, as reported by zpool status",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: poolStatusFields(),
+				},
+			},
+			"data_vdevs": {
+				Description: "The data vdevs of the pool, formatted as they would be passed to `zpool create`",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"log": {
+				Description: "Defines a separate intent log (SLOG) device. Log devices can be added to and removed from an existing pool",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        vdevSchema,
+			},
+			"cache": {
+				Description: "Defines a cache (L2ARC) device. Cache devices can be added to and removed from an existing pool",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        vdevSchema,
+			},
+			"replace_device": {
+				Description: "When a device path within a mirror changes, use `zpool replace` to swap the old device for the new one, instead of attaching the new device and detaching the old one. Defaults to `false`",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"slog_power_loss_protection": {
+				Description: "Hint that the log devices have power-loss protection, which silences the `slog_power_loss` layout warning. Defaults to `false`",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"layout_warnings": {
+				Description: "Warnings of the layout linter about the layout the pool is created with, as `rule: message`. They are worked out when a new pool is planned, so they show up in the plan, and are reported as warnings when it is created. Layouts whose devices aren't known or present at plan time are only linted when the pool is created. Use `lint_suppress` to silence rules",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"bootfs": {
+				Description: "Dataset to boot from, e.g. `rpool/ROOT/default`. It must exist and be usable by the configured `bootloader` before it is set, so it is usually set after the pool's datasets have been created. When not configured, this reflects the current value",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+			},
+			"compatibility": {
+				Description: "Compatibility files limiting which features can be enabled, e.g. `grub2`, `openzfs-2.1-linux` or `freebsd-12.0`, separated by commas. Both files bundled with OpenZFS and custom files in `/etc/zfs/compatibility.d` can be used. `off` allows all features and `legacy` none. When not configured, this reflects the current value",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+			},
+			"incompatible_features": {
+				Description: "Features which are enabled even though `compatibility` doesn't allow them, e.g. because they were enabled outside of terraform. Any are reported as a warning when the pool is read",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"features": {
+				Description:      "Feature flags to enable or disable when the pool is created, e.g. `{ encryption = \"enabled\", block_cloning = \"disabled\" }`. Features which are enabled outside of terraform show up as a change, which can't be applied since features can't be disabled again. Enabling a feature of an existing pool requires `feature_upgrade`",
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Elem:             &schema.Schema{Type: schema.TypeString},
+				ValidateDiagFunc: validation.MapValueMatch(featureStatePattern, "must be either enabled or disabled"),
+			},
+			"feature_upgrade": {
+				Description:      "Which features of an existing pool may be enabled, which can't be undone: `none`, `listed` to enable the features set to `enabled` in `features`, or `all` to run zpool upgrade, enabling every feature `compatibility` allows. Defaults to `none`",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          FeatureUpgradeNone,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(featureUpgradeModes, false)),
+			},
+			"upgradable_features": {
+				Description: "Disabled features which zpool upgrade would enable, i.e. those allowed by `compatibility`",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"destroy_behavior": {
+				Description:      "What to do with the pool when the resource is destroyed: `destroy` runs zpool destroy, `export` runs zpool export and `abandon` only removes the pool from the terraform state. Defaults to `destroy`",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          DestroyBehaviorDestroy,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(destroyBehaviors, false)),
+			},
+			"require_by_id_paths": {
+				Description: "Reject device paths which can change between boots at plan time, such as `/dev/sda`. Stable paths are those under `/dev/disk/by-id/` on Linux, " +
+					"under `/dev/diskid/`, `/dev/gpt/` or `/dev/gptid/` on FreeBSD, and disk names containing the WWN of the disk, such as `/dev/dsk/c0t5000C500A1B2C3D4d0`, on illumos. Cloud volume and iSCSI references, as well as file vdevs, are accepted. Defaults to `false`",
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"force_destroy": &forceDestroySchema,
+			"stage": {
+				Description:      "Stage of evacuating one pool into another which the pool takes part in: `create` for the target and `destroy` for the source. A pool in the `destroy` stage is only destroyed once a `zfs_stage_verification` has verified its replication, which is checked again right before destroying it, and `force_destroy` isn't needed for it",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(poolStages, false)),
+			},
+			"boot_pool": {
+				Description: "Create the pool with `compatibility=grub2` unless `compatibility` is set, so only features bootloaders can read are enabled. Warns when the pool's compatibility doesn't restrict features. Defaults to `false`",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+			"bootloader": {
+				Description:      "Bootloader which reads `bootfs`, one of `none`, `grub` or `zfsbootmenu`. Used to reject boot environments the bootloader can't read, e.g. encrypted datasets with grub. Defaults to `none`",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          BootloaderNone,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(bootloaders, false)),
+			},
+			"size":               &poolSizeSchema,
+			"allocated":          &poolAllocatedSchema,
+			"free":               &poolFreeSchema,
+			"capacity_percent":   &poolCapacityPercentSchema,
+			"fragmentation":      &poolFragmentationSchema,
+			"dedup_ratio":        &poolDedupRatioSchema,
+			"block_cloning":      &blockCloningSchema,
+			"bclone_used":        &bcloneUsedSchema,
+			"bclone_saved":       &bcloneSavedSchema,
+			"bclone_ratio":       &bcloneRatioSchema,
+			"lint_suppress":      &lintSuppressSchema,
+			"property":           &propertySchema,
+			"property_mode":      &propertyModeSchema,
+			"drift_detection":    &driftDetectionSchema,
+			"properties":         &propertiesSchema,
+			"raw_properties":     &rawPropertiesSchema,
+			"properties_numeric": &numericPropertiesSchema,
+			"property_sources":   &propertySourcesSchema,
 		},
 	}
+
+	for key, field := range poolHealthFields() {
+		resource.Schema[key] = field
+	}
+	return resource
+}
+
+// resourcePoolCustomizeDiff rejects layout changes which can't be applied to an existing pool.
+// New mirrors and striped devices can be added with zpool add, and devices can be attached to and
+// detached from existing mirrors, but top-level data vdevs can never be removed again.
+func resourcePoolCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if err := validatePropertyBlocks(d, true); err != nil {
+		return err
+	}
+
+	if err := validateDriftDetection(d); err != nil {
+		return err
+	}
+
+	if err := validatePropertyVersions(d, meta); err != nil {
+		return err
+	}
+
+	if d.Get("require_by_id_paths").(bool) {
+		platform := PlatformLinux
+		if config, ok := meta.(*Config); ok {
+			platform = hostPlatform(config)
+		}
+		if err := checkByIdPaths(platform, configuredDevices(d)); err != nil {
+			return err
+		}
+	}
+
+	if err := forceNewOnCreateOnlyProperties(d); err != nil {
+		return err
+	}
+
+	if d.Id() == "" {
+		return planLayoutWarnings(d, meta)
+	}
+
+	mode := d.Get("feature_upgrade").(string)
+	if d.HasChanges("features", "feature_upgrade") {
+		oldFeatures, newFeatures := d.GetChange("features")
+		if err := checkFeatureChanges(oldFeatures.(map[string]interface{}), newFeatures.(map[string]interface{}), mode); err != nil {
+			return err
+		}
+	}
+
+	// zpool upgrade has to run whenever there are features left to enable, even if nothing else changed.
+	if mode == FeatureUpgradeAll && len(d.Get("upgradable_features").([]interface{})) > 0 {
+		if err := d.SetNewComputed("upgradable_features"); err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("device") {
+		oldDevices, newDevices := d.GetChange("device")
+		if !hasPrefix(expandDevices(newDevices), expandDevices(oldDevices)) {
+			return fmt.Errorf("striped devices can only be appended to an existing pool, removing or changing %v is not supported by zfs. Recreate the pool instead", expandDevices(oldDevices))
+		}
+	}
+
+	if d.HasChange("mirror") {
+		oldMirrors, newMirrors := d.GetChange("mirror")
+		if len(expandMirrors(newMirrors)) < len(expandMirrors(oldMirrors)) {
+			return fmt.Errorf("mirrors can only be appended to an existing pool, removing a mirror is not supported by zfs. Recreate the pool instead")
+		}
+	}
+
+	return nil
 }
 
 func resourcePoolCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -143,12 +431,12 @@ func resourcePoolCreate(ctx context.Context, d *schema.ResourceData, meta interf
 
 	config := meta.(*Config)
 
-	pool, err := describePool(config, poolName, getPropertyNames(d))
+	pool, err := describePool(config, poolName, getPropertyNames(d), false)
 	if pool != nil {
 		log.Printf("[DEBUG] zpool %s already exists!", poolName)
 	}
 
-	log.Printf("[DEBUG] check: %s, %s", pool, err)
+	log.Printf("[DEBUG] check: %v, %v", pool, err)
 
 	if err != nil {
 		switch err := err.(type) {
@@ -156,29 +444,72 @@ func resourcePoolCreate(ctx context.Context, d *schema.ResourceData, meta interf
 			{
 				if err.errmsg != "zpool does not exist" {
 					log.Printf("[DEBUG] zfs err: %s", err.Error())
-					return diag.FromErr(err)
+					return diagFromErr(err)
 				}
 			}
 		default:
 			{
 				log.Printf("[DEBUG] zfs err: %s", err.Error())
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 	}
 
-	vdev_spec := parseVdevSpecification(d.Get("mirror"), d.Get("device"))
+	devices := configuredDevices(d)
+	if err := checkDeviceReferencesSupported(config, devices); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := loginIscsiTargets(config, devices); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := waitForDevices(ctx, config, devices); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := checkDevicesExist(config, deviceReferences(devices)); err != nil {
+		return diagFromErr(err)
+	}
+
+	vdev_spec, err := poolVdevSpec(config, d)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	// Layout warnings don't stop the pool from being created, but are reported along with the result.
+	warnings, score, err := lintVdevSpec(config, vdev_spec, d.Get("slog_power_loss_protection").(bool), expandStringSet(d.Get("lint_suppress").(*schema.Set)))
+	if err != nil {
+		return diagFromErr(err)
+	}
+	log.Printf("[DEBUG] layout score for %s: %d", poolName, score)
+	if err := d.Set("layout_warnings", formatLintWarnings(warnings)); err != nil {
+		return diagFromErr(err)
+	}
 
 	properties := parsePropertyBlocks(d.Get("property").(*schema.Set).List())
+	if compatibility, ok := d.GetOk("compatibility"); ok {
+		if _, _, err := readCompatibilityFeatures(config, compatibility.(string)); err != nil {
+			return diagFromErr(err)
+		}
+		properties["compatibility"] = compatibility.(string)
+	} else if _, ok := properties["compatibility"]; !ok && d.Get("boot_pool").(bool) {
+		properties["compatibility"] = bootPoolCompatibility
+	}
+	for feature, state := range d.Get("features").(map[string]interface{}) {
+		if _, ok := properties["feature@"+feature]; !ok {
+			properties["feature@"+feature] = state.(string)
+		}
+	}
 
-	pool, err = createPool(config, &CreatePool{
+	pool, err = createPool(ctx, config, &CreatePool{
 		name:       poolName,
 		vdevs:      vdev_spec,
 		properties: properties,
 	})
 
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	// We're setting the ID here because the dataset DOES exist, even if the mountpoint
@@ -186,7 +517,102 @@ func resourcePoolCreate(ctx context.Context, d *schema.ResourceData, meta interf
 	log.Printf("[DEBUG] committing guid: %s", pool.guid)
 	d.SetId(pool.guid)
 
-	return populateResourceDataPool(d, *pool)
+	if bootfs, ok := d.GetOk("bootfs"); ok {
+		if err := validateBootfs(config, poolName, bootfs.(string), d.Get("bootloader").(string)); err != nil {
+			return diagFromErr(err)
+		}
+		if err := setBootfs(config, poolName, bootfs.(string)); err != nil {
+			return diagFromErr(err)
+		}
+		if pool, err = describePool(config, poolName, getPropertyNames(d), refreshesUsage(d)); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	if err := normalizeLayoutDevices(config, &pool.layout, configuredDevices(d)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return append(lintDiagnostics(warnings), populateResourceDataPool(d, *pool)...)
+}
+
+// poolVdevSpec returns the vdev specification a pool is created with, planning the data vdevs of a capacity block.
+func poolVdevSpec(config *Config, d resourceGetter) (string, error) {
+	spec := parseVdevSpecification(d.Get("mirror"), d.Get("device"), d.Get("log"), d.Get("cache"))
+
+	if capacity := d.Get("capacity").([]interface{}); len(capacity) > 0 && capacity[0] != nil {
+		data_vdevs, err := planPoolCapacity(config, capacity[0].(map[string]interface{}))
+		if err != nil {
+			return "", err
+		}
+		spec = " " + data_vdevs + spec
+	}
+	return spec, nil
+}
+
+// layoutAttributes are the attributes the layout warnings of a pool depend on.
+var layoutAttributes = []string{"device", "mirror", "log", "cache", "capacity", "slog_power_loss_protection", "lint_suppress"}
+
+// planLayoutWarnings lints the layout of a new pool while it is planned, so the warnings show up in the plan through
+// layout_warnings, as SDKv2 can't attach warnings to a plan. The lint is best effort: layouts which aren't known yet,
+// or whose devices are only created or attached during the apply, are linted when the pool is created instead.
+func planLayoutWarnings(d *schema.ResourceDiff, meta interface{}) error {
+	config, ok := meta.(*Config)
+	if !ok {
+		return nil
+	}
+
+	raw := d.GetRawConfig()
+	for _, key := range layoutAttributes {
+		if !raw.IsNull() && !raw.GetAttr(key).IsWhollyKnown() {
+			return d.SetNewComputed("layout_warnings")
+		}
+	}
+
+	spec, err := poolVdevSpec(config, d)
+	if err == nil {
+		var warnings []LintWarning
+		if warnings, _, err = lintVdevSpec(config, spec, d.Get("slog_power_loss_protection").(bool), expandStringSet(d.Get("lint_suppress").(*schema.Set))); err == nil {
+			return d.SetNew("layout_warnings", formatLintWarnings(warnings))
+		}
+	}
+
+	log.Printf("[DEBUG] linting the layout of %s when it is created, it can't be linted yet: %s", d.Get("name"), err)
+	return d.SetNewComputed("layout_warnings")
+}
+
+// planPoolCapacity turns a capacity block into a concrete vdev specification for zpool create.
+func planPoolCapacity(config *Config, capacity map[string]interface{}) (string, error) {
+	redundancy := Redundancy(capacity["redundancy"].(string))
+
+	targetSize, err := parseSize(capacity["size"].(string))
+	if err != nil {
+		return "", err
+	}
+
+	paths := make([]string, 0)
+	for _, path := range capacity["devices"].([]interface{}) {
+		paths = append(paths, resolveDevicePath(path.(string)))
+	}
+
+	devices, err := readDeviceSizes(config, paths)
+	if err != nil {
+		return "", err
+	}
+
+	vdevs, usable, err := planCapacityLayout(CapacitySpec{
+		redundancy: redundancy,
+		width:      capacity["vdev_width"].(int),
+		targetSize: targetSize,
+		devices:    devices,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	spec := serializeCapacityLayout(redundancy, vdevs)
+	log.Printf("[DEBUG] planned %d bytes of usable capacity as: %s", usable, spec)
+	return spec, nil
 }
 
 func resourcePoolRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -196,28 +622,105 @@ func resourcePoolRead(ctx context.Context, d *schema.ResourceData, meta interfac
 	if id := d.Id(); id != "" {
 		// If we have a Resource ID, then use that to lookup the real name
 		// of the zfs resource, in case the name has changed.
-		real_name, err := getPoolNameByGuid(config, id)
+		real_name, err := getPoolNameByGuid(config, poolName, id)
 		if err != nil {
-			return diag.FromErr(fmt.Errorf("the zpool %s identified by guid %s could not be found. It was likely deleted on the server outside of terraform", poolName, id))
+			return diagFromErr(fmt.Errorf("the zpool %s identified by guid %s could not be found. It was likely deleted on the server outside of terraform", poolName, id))
 		}
 		poolName = *real_name
 	}
 
 	if err := d.Set("name", poolName); err != nil {
-		diag.FromErr(err)
+		diagFromErr(err)
 	}
 
-	pool, err := describePool(config, poolName, getPropertyNames(d))
+	if !isNewOrFullRead(d) {
+		return nil
+	}
+
+	pool, err := describePool(config, poolName, getPropertyNames(d), refreshesUsage(d))
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	// A pool on iSCSI LUNs degrades when the host loses its sessions, so point out which ones are gone.
+	var diags diag.Diagnostics
+	missing, err := missingIscsiSessions(config, iscsiTargets(configuredDevices(d)))
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+	for _, target := range missing {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "iSCSI session missing",
+			Detail:   fmt.Sprintf("The host is not logged in to %s on %s, which backs devices of %s. They are unavailable until the session is restored.", target.iqn, target.portal, poolName),
+		})
 	}
 
-	return populateResourceDataPool(d, *pool)
+	compatibility := pool.properties["compatibility"].value
+	allowed, restricted, err := readCompatibilityFeatures(config, compatibility)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	incompatible := make([]string, 0)
+	if restricted {
+		incompatible = incompatibleFeatures(pool.properties, allowed)
+	}
+
+	if d.Get("boot_pool").(bool) && !restricted {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Boot pool features are not restricted",
+			Detail:   fmt.Sprintf("%s has compatibility set to %s, so nothing stops features bootloaders can't read from being enabled.", poolName, compatibility),
+		})
+	} else if len(incompatible) > 0 {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Pool has incompatible features",
+			Detail:   fmt.Sprintf("%s has features enabled which are not allowed by its compatibility setting %s, so it may not be importable where that setting is meant for: %s.", poolName, compatibility, strings.Join(incompatible, ", ")),
+		})
+	}
+
+	if err := d.Set("incompatible_features", incompatible); err != nil {
+		return diagFromErr(err)
+	}
+
+	configured := d.Get("features").(map[string]interface{})
+	features := configuredFeatureStates(configured, featureStates(pool.properties))
+	for feature, state := range features {
+		if state == "enabled" && configured[feature] == "disabled" {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Disabled feature was enabled",
+				Detail:   fmt.Sprintf("Feature %s of %s is configured as disabled, but was enabled outside of terraform, e.g. by zpool upgrade. Features can't be disabled again, so set it to enabled.", feature, poolName),
+			})
+		}
+	}
+	if err := d.Set("features", features); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("upgradable_features", upgradableFeatures(pool.properties, allowed, restricted)); err != nil {
+		return diagFromErr(err)
+	}
+
+	// zpool may report the devices under other names than configured, e.g. partitions it created on whole disks.
+	if err := normalizeLayoutDevices(config, &pool.layout, configuredDevices(d)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return append(diags, populateResourceDataPool(d, *pool)...)
 }
 
 func populateResourceDataPool(d *schema.ResourceData, pool Pool) diag.Diagnostics {
 	var diags diag.Diagnostics
 
+	if err := d.Set("data_vdevs", serializeDataVdevs(pool.layout)); err != nil {
+		return diagFromErr(err)
+	}
+
+	restoreDeviceConfiguration(&pool.layout, configuredDevices(d))
+
 	devices := make([]map[string]interface{}, len(pool.layout.striped))
 	for device_id, device := range pool.layout.striped {
 		devices[device_id] = flattenDevice(device)
@@ -228,16 +731,74 @@ func populateResourceDataPool(d *schema.ResourceData, pool Pool) diag.Diagnostic
 		mirrors[mirror_id] = flattenMirror(mirror)
 	}
 
-	if err := d.Set("device", devices); err != nil {
-		return diag.FromErr(err)
+	// When the layout is derived from a capacity block, the data vdevs aren't part of the
+	// configuration, so only report them through data_vdevs.
+	if _, ok := d.GetOk("capacity"); !ok {
+		if err := d.Set("device", devices); err != nil {
+			return diagFromErr(err)
+		}
+
+		if err := d.Set("mirror", mirrors); err != nil {
+			return diagFromErr(err)
+		}
 	}
 
-	if err := d.Set("mirror", mirrors); err != nil {
-		return diag.FromErr(err)
+	if pool.status != nil {
+		if err := d.Set("status", []map[string]interface{}{flattenPoolStatus(*pool.status)}); err != nil {
+			return diagFromErr(err)
+		}
+
+		for key, value := range flattenPoolHealth(*pool.status) {
+			if err := d.Set(key, value); err != nil {
+				return diagFromErr(err)
+			}
+		}
 	}
 
-	if err := updatePropertiesInState(d, pool.properties, []string{}); err != nil {
-		return diag.FromErr(err)
+	logs := make([]map[string]interface{}, len(pool.layout.logs))
+	for device_id, device := range pool.layout.logs {
+		logs[device_id] = flattenDevice(device)
+	}
+
+	if err := d.Set("log", logs); err != nil {
+		return diagFromErr(err)
+	}
+
+	caches := make([]map[string]interface{}, len(pool.layout.caches))
+	for device_id, device := range pool.layout.caches {
+		caches[device_id] = flattenDevice(device)
+	}
+
+	if err := d.Set("cache", caches); err != nil {
+		return diagFromErr(err)
+	}
+
+	if pool.usage != nil && refreshesUsage(d) {
+		if err := setPoolUsage(d, *pool.usage); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	if refreshesUsage(d) {
+		if err := setBlockCloning(d, pool.properties); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	if err := d.Set("compatibility", pool.properties["compatibility"].value); err != nil {
+		return diagFromErr(err)
+	}
+
+	bootfs := pool.properties["bootfs"].value
+	if bootfs == "-" {
+		bootfs = ""
+	}
+	if err := d.Set("bootfs", bootfs); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := updatePropertiesInState(d, driftProperties(d, pool.properties, []string{"compatibility", "bootfs"}), []string{}); err != nil {
+		return diagFromErr(err)
 	}
 
 	d.SetId(pool.guid)
@@ -246,41 +807,186 @@ func populateResourceDataPool(d *schema.ResourceData, pool Pool) diag.Diagnostic
 
 func resourcePoolUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	config := meta.(*Config)
-	old_name, err := getPoolNameByGuid(config, d.Id())
+	previousName, _ := d.GetChange("name")
+	old_name, err := getPoolNameByGuid(config, previousName.(string), d.Id())
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	poolName := d.Get("name").(string)
 	if poolName != *old_name {
-		if err := renamePool(config, *old_name, poolName); err != nil {
-			return diag.FromErr(err)
+		if err := renamePool(ctx, config, *old_name, poolName); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	devices := configuredDevices(d)
+	if err := checkDeviceReferencesSupported(config, devices); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := loginIscsiTargets(config, devices); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := waitForDevices(ctx, config, devices); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := checkDevicesExist(config, deviceReferences(devices)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if d.HasChange("mirror") {
+		oldMirrors_, newMirrors_ := d.GetChange("mirror")
+		oldMirrors := expandMirrors(oldMirrors_)
+		newMirrors := expandMirrors(newMirrors_)
+		replace := d.Get("replace_device").(bool)
+
+		for i := range oldMirrors {
+			changes := diffMirror(oldMirrors[i], newMirrors[i], replace)
+			log.Printf("[DEBUG] mirror %d changes: %+v", i, changes)
+			if err := applyMirrorChanges(ctx, config, poolName, oldMirrors[i], changes); err != nil {
+				return diagFromErr(err)
+			}
+		}
+
+		for _, mirror := range newMirrors[len(oldMirrors):] {
+			if err := addVdevs(ctx, config, poolName, "mirror "+strings.Join(mirror, " ")); err != nil {
+				return diagFromErr(err)
+			}
+		}
+	}
+
+	if d.HasChange("device") {
+		oldDevices, newDevices := d.GetChange("device")
+		if added := expandDevices(newDevices)[len(expandDevices(oldDevices)):]; len(added) > 0 {
+			if err := addVdevs(ctx, config, poolName, strings.Join(added, " ")); err != nil {
+				return diagFromErr(err)
+			}
+		}
+	}
+
+	for _, class := range []string{"log", "cache"} {
+		if !d.HasChange(class) {
+			continue
+		}
+
+		oldDevices_, newDevices_ := d.GetChange(class)
+		oldDevices := expandDevices(oldDevices_)
+		newDevices := expandDevices(newDevices_)
+
+		for _, device := range oldDevices {
+			if !contains(newDevices, device) {
+				if err := removeVdev(ctx, config, poolName, device); err != nil {
+					return diagFromErr(err)
+				}
+			}
+		}
+
+		added := make([]string, 0)
+		for _, device := range newDevices {
+			if !contains(oldDevices, device) {
+				added = append(added, device)
+			}
+		}
+		if len(added) > 0 {
+			if err := addVdevs(ctx, config, poolName, class+" "+strings.Join(added, " ")); err != nil {
+				return diagFromErr(err)
+			}
+		}
+	}
+
+	if d.HasChange("compatibility") {
+		compatibility := d.Get("compatibility").(string)
+		if _, _, err := readCompatibilityFeatures(config, compatibility); err != nil {
+			return diagFromErr(err)
+		}
+		if _, err := callSshCommandContext(ctx, config, "zpool set compatibility=%s %s", shellescape.Quote(compatibility), poolName); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	switch d.Get("feature_upgrade").(string) {
+	case FeatureUpgradeListed:
+		if d.HasChange("features") {
+			oldFeatures, newFeatures := d.GetChange("features")
+			if err := enableFeatures(ctx, config, poolName, newlyEnabledFeatures(oldFeatures.(map[string]interface{}), newFeatures.(map[string]interface{}))); err != nil {
+				return diagFromErr(err)
+			}
+		}
+	case FeatureUpgradeAll:
+		if err := upgradePool(ctx, config, poolName); err != nil {
+			return diagFromErr(err)
 		}
 	}
 
-	pool, err := describePool(config, poolName, getPropertyNames(d))
+	if bootfs := d.Get("bootfs").(string); bootfs != "" && d.HasChanges("bootfs", "bootloader") {
+		if err := validateBootfs(config, poolName, bootfs, d.Get("bootloader").(string)); err != nil {
+			return diagFromErr(err)
+		}
+		if d.HasChange("bootfs") {
+			if err := setBootfs(config, poolName, bootfs); err != nil {
+				return diagFromErr(err)
+			}
+		}
+	}
+
+	pool, err := describePool(config, poolName, getPropertyNames(d), refreshesUsage(d))
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	err = applyPropertyDiff(config, d, poolName, pool.properties, make(map[string]string))
 	if err != nil {
-		return diag.FromErr(err)
+		// Refresh the state first, so it reflects the properties which were applied despite the failures.
+		return append(resourcePoolRead(ctx, d, meta), diagFromErr(err)...)
 	}
 
 	return resourcePoolRead(ctx, d, meta)
 }
 
+// resourcePoolImportState accepts either the name or the guid of a pool. Exported pools are imported
+// into the kernel first, use zfs_pool_import for pools which need options such as -f or an altroot.
+func resourcePoolImportState(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	config := meta.(*Config)
+
+	pool, err := importPool(ctx, config, PoolImport{pool: d.Id()})
+	if err != nil {
+		return nil, err
+	}
+
+	d.SetId(pool.guid)
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourcePoolDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
 	config := meta.(*Config)
 	poolName := d.Get("name").(string)
-	id := d.Get("id")
+	id := d.Id()
 
-	log.Printf("[DEBUG] destroying pool: %s %d", poolName, id)
-	if err := destroyPool(config, poolName); err != nil {
-		return diag.FromErr(err)
+	switch d.Get("destroy_behavior").(string) {
+	case DestroyBehaviorExport:
+		log.Printf("[DEBUG] exporting pool: %s %s", poolName, id)
+		if err := exportPool(ctx, config, poolName); err != nil {
+			return diagFromErr(err)
+		}
+	case DestroyBehaviorAbandon:
+		log.Printf("[DEBUG] abandoning pool: %s %s", poolName, id)
+	default:
+		log.Printf("[DEBUG] destroying pool: %s %s", poolName, id)
+		if d.Get("stage").(string) == StageDestroy {
+			if err := checkStageVerified(config, poolName); err != nil {
+				return diagFromErr(err)
+			}
+		} else if err := checkDestroySafe(config, poolName, d.Get("force_destroy").(bool)); err != nil {
+			return diagFromErr(err)
+		}
+		if err := destroyPool(ctx, config, poolName); err != nil {
+			return diagFromErr(err)
+		}
 	}
 
 	d.SetId("")
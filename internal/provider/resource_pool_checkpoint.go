@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourcePoolCheckpoint() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Takes a checkpoint of a pool, which the whole pool can be rewound to with `zpool import --rewind-to-checkpoint` if a risky change goes wrong. " +
+			"Make the risky resources depend on it, and change `triggers` to take a new checkpoint before each change. A pool has at most one checkpoint, " +
+			"and while it exists devices can't be removed, attached, detached or expanded, and freed space isn't returned. A checkpoint which is discarded outside of terraform is taken again.",
+
+		CreateContext: resourcePoolCheckpointCreate,
+		ReadContext:   resourcePoolCheckpointRead,
+		UpdateContext: resourcePoolCheckpointUpdate,
+		DeleteContext: resourcePoolCheckpointDelete,
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"triggers": {
+				Description: "Arbitrary values which discard the checkpoint and take a new one when changed.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"discard_on_destroy": {
+				Description: "Discard the checkpoint when the resource is destroyed. Set it to `false` to keep the checkpoint around for a rewind after terraform is done. Defaults to `true`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"created": {
+				Description: "Time the checkpoint was taken as reported by zpool status, in the local time of the host, e.g. `Thu Aug 13 15:16:53 2020`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"size": {
+				Description: "Space held by the checkpoint in bytes. It grows as data which existed at the time of the checkpoint is overwritten or freed.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourcePoolCheckpointCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	if err := createCheckpoint(config, poolName); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s:%d", poolName, time.Now().Unix()))
+
+	return resourcePoolCheckpointRead(ctx, d, meta)
+}
+
+func resourcePoolCheckpointRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	checkpoint, err := readCheckpoint(config, poolName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if checkpoint == nil {
+		log.Printf("[WARN] the checkpoint of %s is gone, it was discarded or the pool was rewound outside of terraform", poolName)
+		d.SetId("")
+		return diags
+	}
+
+	if err := d.Set("created", checkpoint.created); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("size", int(checkpoint.size)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourcePoolCheckpointUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// Only discard_on_destroy can change without taking a new checkpoint, and it only matters on destroy.
+	return resourcePoolCheckpointRead(ctx, d, meta)
+}
+
+func resourcePoolCheckpointDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	if !d.Get("discard_on_destroy").(bool) {
+		log.Printf("[DEBUG] keeping the checkpoint of %s", poolName)
+		return diags
+	}
+
+	checkpoint, err := readCheckpoint(config, poolName)
+	if err != nil {
+		if _, ok := err.(*PoolError); ok {
+			// The checkpoint went along with the pool.
+			return diags
+		}
+		return diagFromErr(err)
+	}
+
+	if checkpoint != nil {
+		if err := discardCheckpoint(config, poolName); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return diags
+}
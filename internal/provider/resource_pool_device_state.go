@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"context"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourcePoolDeviceState() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Manages the state of a single device of a pool, e.g. to take a disk offline before it is physically replaced, " +
+			"or to clear its error counters once a cable has been fixed. The device is brought back online when the resource is destroyed. " +
+			"A device which is brought online or taken offline outside of terraform shows up as a change of `offline`.",
+
+		CreateContext: resourcePoolDeviceStateCreate,
+		ReadContext:   resourcePoolDeviceStateRead,
+		UpdateContext: resourcePoolDeviceStateUpdate,
+		DeleteContext: resourcePoolDeviceStateDelete,
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"device": {
+				Description: "Path of the device as configured in the `device` block of the pool, e.g. `/dev/sdb`. A partition zfs created on the disk, such as `/dev/sdb1`, is found by its disk.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"offline": {
+				Description: "Take the device offline, so the pool stops using it. The pool must have enough redundancy to keep going without it. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"temporary": {
+				Description: "Only take the device offline until the host reboots, with `zpool offline -t`. It is taken offline again on the next apply. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"clear_triggers": {
+				Description: "Arbitrary values which clear the error counters of the device with `zpool clear` when changed.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"vdev": {
+				Description: "Path of the device as shown by zpool status, e.g. `/dev/sdb1`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"state": {
+				Description: "State of the device, e.g. `ONLINE`, `OFFLINE`, `DEGRADED` or `FAULTED`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"read_errors": {
+				Description: "Number of read errors of the device since they were last cleared.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"write_errors": {
+				Description: "Number of write errors of the device since they were last cleared.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"checksum_errors": {
+				Description: "Number of checksum errors of the device since they were last cleared.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// applyDeviceState takes the device offline or brings it online as configured, if it isn't already.
+func applyDeviceState(config *Config, d *schema.ResourceData, vdev *VdevStatus) error {
+	poolName := d.Get("pool").(string)
+	offline := d.Get("offline").(bool)
+
+	if offline && vdev.state != "OFFLINE" {
+		return offlineDevice(config, poolName, vdev.name, d.Get("temporary").(bool))
+	}
+	if !offline && vdev.state == "OFFLINE" {
+		return onlineDevice(config, poolName, vdev.name)
+	}
+	return nil
+}
+
+func resourcePoolDeviceStateCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	poolName, device := d.Get("pool").(string), d.Get("device").(string)
+	vdev, err := describeDeviceStatus(config, poolName, device)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	if vdev == nil {
+		return diag.Errorf("%s has no device %s", poolName, device)
+	}
+
+	if err := applyDeviceState(config, d, vdev); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(deviceStateId(poolName, device))
+
+	return resourcePoolDeviceStateRead(ctx, d, meta)
+}
+
+func resourcePoolDeviceStateRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName, device := d.Get("pool").(string), d.Get("device").(string)
+	vdev, err := describeDeviceStatus(config, poolName, device)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if vdev == nil {
+		log.Printf("[WARN] %s is no longer a device of %s, it was replaced or removed outside of terraform", device, poolName)
+		d.SetId("")
+		return diags
+	}
+
+	values := map[string]interface{}{
+		"offline":         vdev.state == "OFFLINE",
+		"vdev":            vdev.name,
+		"state":           vdev.state,
+		"read_errors":     int(vdev.readErrors),
+		"write_errors":    int(vdev.writeErrors),
+		"checksum_errors": int(vdev.checksumErrors),
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return diags
+}
+
+func resourcePoolDeviceStateUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	poolName, device := d.Get("pool").(string), d.Get("device").(string)
+	vdev, err := describeDeviceStatus(config, poolName, device)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	if vdev == nil {
+		return diag.Errorf("%s has no device %s", poolName, device)
+	}
+
+	// Errors are cleared before the device is taken offline, as clearing them brings a faulted device back online.
+	if d.HasChange("clear_triggers") {
+		if err := clearDeviceErrors(config, poolName, vdev.name); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	if err := applyDeviceState(config, d, vdev); err != nil {
+		return diagFromErr(err)
+	}
+
+	return resourcePoolDeviceStateRead(ctx, d, meta)
+}
+
+func resourcePoolDeviceStateDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName, device := d.Get("pool").(string), d.Get("device").(string)
+	vdev, err := describeDeviceStatus(config, poolName, device)
+	if err != nil {
+		if _, ok := err.(*PoolError); ok {
+			// The device went along with the pool.
+			return diags
+		}
+		return diagFromErr(err)
+	}
+
+	if vdev != nil && vdev.state == "OFFLINE" {
+		if err := onlineDevice(config, poolName, vdev.name); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return diags
+}
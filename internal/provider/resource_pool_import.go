@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourcePoolImport() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Imports an exported pool into the kernel with `zpool import`, e.g. to bring up a pool moved from another host in a disaster-recovery workflow. " +
+			"Pools which are imported already are left as they are.",
+
+		CreateContext: resourcePoolImportCreate,
+		ReadContext:   resourcePoolImportRead,
+		UpdateContext: resourcePoolImportUpdate,
+		DeleteContext: resourcePoolImportDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name or numeric guid of the pool to import.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"new_name": {
+				Description: "Import the pool under this name instead of its current one.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"search_directories": {
+				Description: "Directories to search for the devices of the pool, passed as `-d`. Defaults to the default search path of zpool import.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"force": {
+				Description: "Import the pool even if it appears to be in use by another system, passed as `-f`. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+			"altroot": {
+				Description: "Alternate root directory to mount the datasets of the pool under, passed as `-R`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"readonly": {
+				Description: "Import the pool read-only. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+			"export_on_destroy": {
+				Description: "Export the pool again when the resource is destroyed. Defaults to `false`, which leaves the pool imported.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"name": {
+				Description: "Name the pool is imported as.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"guid": {
+				Description: "Guid of the imported pool.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourcePoolImportCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	pool, err := importPool(ctx, config, PoolImport{
+		pool:        d.Get("pool").(string),
+		newName:     d.Get("new_name").(string),
+		directories: expandStringList(d.Get("search_directories").([]interface{})),
+		force:       d.Get("force").(bool),
+		altroot:     d.Get("altroot").(string),
+		readonly:    d.Get("readonly").(bool),
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(pool.guid)
+	return resourcePoolImportRead(ctx, d, meta)
+}
+
+func resourcePoolImportRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	pool, err := findImportedPool(config, d.Id())
+	if err != nil {
+		return diagFromErr(err)
+	}
+	if pool == nil {
+		// The pool was exported outside of terraform, so import it again on the next apply.
+		log.Printf("[WARN] pool with guid %s is no longer imported", d.Id())
+		d.SetId("")
+		return diags
+	}
+
+	if err := d.Set("name", pool.name); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("guid", pool.guid); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+// resourcePoolImportUpdate only has export_on_destroy to update, which is kept in the state.
+func resourcePoolImportUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return resourcePoolImportRead(ctx, d, meta)
+}
+
+func resourcePoolImportDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	if d.Get("export_on_destroy").(bool) {
+		if err := exportPool(ctx, config, shellescape.Quote(d.Get("name").(string))); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	d.SetId("")
+	return diags
+}
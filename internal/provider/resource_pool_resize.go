@@ -0,0 +1,167 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// expandPollInterval is how often the pool size is checked while waiting for an expansion to finish.
+const expandPollInterval = 2 * time.Second
+
+func resourcePoolResize() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Grows a pool in place after its devices have been enlarged, e.g. after resizing cloud volumes, by running `zpool online -e` on each device. Change `triggers` to expand again. Destroying the resource does not affect the pool.",
+
+		CreateContext: resourcePoolResizeCreate,
+		ReadContext:   resourcePoolResizeRead,
+		DeleteContext: resourcePoolResizeDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool to expand.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"devices": {
+				Description:  "Devices which have grown.",
+				Type:         schema.TypeSet,
+				Optional:     true,
+				ForceNew:     true,
+				Elem:         &schema.Schema{Type: schema.TypeString},
+				ExactlyOneOf: []string{"devices", "grow_all"},
+			},
+			"grow_all": {
+				Description:  "Expand every data and log device in the pool.",
+				Type:         schema.TypeBool,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: []string{"devices", "grow_all"},
+			},
+			"triggers": {
+				Description: "Arbitrary values which expand the devices again when changed, e.g. the sizes of the underlying volumes.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"size_before": {
+				Description: "Size of the pool in bytes before expanding.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"size_after": {
+				Description: "Size of the pool in bytes after expanding.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourcePoolResizeCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+
+	devices := expandStringSet(d.Get("devices").(*schema.Set))
+	if d.Get("grow_all").(bool) {
+		layout, err := readPoolLayout(config, poolName)
+		if err != nil {
+			return diagFromErr(err)
+		}
+		devices = leafDevices(*layout)
+	}
+
+	sizeBefore, _, err := readPoolSize(config, poolName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	for _, device := range devices {
+		log.Printf("[DEBUG] expanding %s in %s", device, poolName)
+		if err := expandDevice(config, poolName, device); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	d.SetId(fmt.Sprintf("%s:%d", poolName, time.Now().Unix()))
+
+	// The new space is usually available right away, but give zfs a chance to catch up
+	// before reporting the new size.
+	deadline := time.Now().Add(d.Timeout(schema.TimeoutCreate))
+	sizeAfter := sizeBefore
+	for {
+		size, expandSize, err := readPoolSize(config, poolName)
+		if err != nil {
+			return diagFromErr(err)
+		}
+		sizeAfter = size
+
+		if expandSize == 0 {
+			break
+		}
+
+		if time.Now().Add(expandPollInterval).After(deadline) {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Pool not fully expanded",
+				Detail:   fmt.Sprintf("%s can still be expanded by %d bytes. Check that all of its devices have grown.", poolName, expandSize),
+			})
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return diagFromErr(ctx.Err())
+		case <-time.After(expandPollInterval):
+		}
+	}
+
+	log.Printf("[DEBUG] %s grew from %d to %d bytes", poolName, sizeBefore, sizeAfter)
+
+	if err := d.Set("size_before", int(sizeBefore)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("size_after", int(sizeAfter)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourcePoolResizeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	// The sizes describe the expansion itself, so there is nothing to refresh. Just make sure the pool still exists.
+	config := meta.(*Config)
+	if _, _, err := readPoolSize(config, d.Get("pool").(string)); err != nil {
+		if _, ok := err.(*PoolError); ok {
+			d.SetId("")
+			return diags
+		}
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourcePoolResizeDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+	return diags
+}
@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestResourcePoolResizeCreate verifies that every listed device is expanded and the sizes are recorded.
+func TestResourcePoolResizeCreate(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zpool list -Hp -o size,expandsize tank", "21474836480\t-").
+		on("zpool online -e tank", "")
+
+	d := schema.TestResourceDataRaw(t, resourcePoolResize().Schema, map[string]interface{}{
+		"pool":    "tank",
+		"devices": []interface{}{"/dev/sda", "/dev/sdb"},
+	})
+	if diags := resourcePoolResizeCreate(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	for _, device := range []string{"/dev/sda", "/dev/sdb"} {
+		if !executor.ran("zpool online -e tank " + device) {
+			t.Fatalf("expected %s to be expanded, ran %v", device, executor.commands)
+		}
+	}
+	if d.Get("size_after").(int) != 21474836480 {
+		t.Fatalf("unexpected size %v", d.Get("size_after"))
+	}
+}
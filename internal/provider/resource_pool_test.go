@@ -1,9 +1,14 @@
 package provider
 
 import (
+	"context"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
 // TestPropertyModeSchema_Validation verifies that only valid values
@@ -307,3 +312,288 @@ func TestIsPoolProperty_RecognizesKnownAndFeatureProps(t *testing.T) {
 		}
 	}
 }
+
+// TestDiffMirror_AttachAndDetach verifies that added devices are attached and
+// removed devices are detached when replace_device is not set.
+func TestDiffMirror_AttachAndDetach(t *testing.T) {
+	changes := diffMirror([]string{"/dev/sda", "/dev/sdb"}, []string{"/dev/sda", "/dev/sdc", "/dev/sdd"}, false)
+
+	if !reflect.DeepEqual(changes.attach, []string{"/dev/sdc", "/dev/sdd"}) {
+		t.Fatalf("unexpected attach list: %#v", changes.attach)
+	}
+	if !reflect.DeepEqual(changes.detach, []string{"/dev/sdb"}) {
+		t.Fatalf("unexpected detach list: %#v", changes.detach)
+	}
+	if len(changes.replace) != 0 {
+		t.Fatalf("expected no replacements, got %#v", changes.replace)
+	}
+}
+
+// TestDiffMirror_Replace verifies that changed paths are paired up as
+// replacements when replace_device is set, and leftovers are attached.
+func TestDiffMirror_Replace(t *testing.T) {
+	changes := diffMirror([]string{"/dev/sda", "/dev/sdb"}, []string{"/dev/sda", "/dev/sdc", "/dev/sdd"}, true)
+
+	if !reflect.DeepEqual(changes.replace, [][2]string{{"/dev/sdb", "/dev/sdc"}}) {
+		t.Fatalf("unexpected replacements: %#v", changes.replace)
+	}
+	if !reflect.DeepEqual(changes.attach, []string{"/dev/sdd"}) {
+		t.Fatalf("unexpected attach list: %#v", changes.attach)
+	}
+	if len(changes.detach) != 0 {
+		t.Fatalf("expected no detaches, got %#v", changes.detach)
+	}
+}
+
+// TestDiffMirror_Unchanged verifies that reordering devices is not a change.
+func TestDiffMirror_Unchanged(t *testing.T) {
+	changes := diffMirror([]string{"/dev/sda", "/dev/sdb"}, []string{"/dev/sdb", "/dev/sda"}, true)
+
+	if len(changes.attach) != 0 || len(changes.detach) != 0 || len(changes.replace) != 0 {
+		t.Fatalf("expected no changes, got %#v", changes)
+	}
+}
+
+// TestApplyMirrorChanges verifies that devices are attached to a device which stays in the mirror, and only detached
+// once the resilver onto the new devices has finished.
+func TestApplyMirrorChanges(t *testing.T) {
+	resilvered := "  pool: tank\n state: ONLINE\n  scan: resilvered 1.21M in 00:00:01 with 0 errors on Thu Aug 13 15:16:53 2020\nconfig:\n\nerrors: No known data errors\n"
+	executor := (&fakeExecutor{}).
+		on("zpool replace", "").
+		on("zpool attach", "").
+		on("zpool detach", "").
+		on("zpool status -pP tank", resilvered)
+
+	changes := MirrorChanges{attach: []string{"/dev/sde"}, detach: []string{"/dev/sdc"}, replace: [][2]string{{"/dev/sda", "/dev/sdd"}}}
+	if err := applyMirrorChanges(context.Background(), newFakeConfig(executor), "tank", []string{"/dev/sda", "/dev/sdb", "/dev/sdc"}, changes); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{
+		"zpool replace tank /dev/sda /dev/sdd",
+		"zpool attach tank /dev/sdb /dev/sde",
+		"zpool status -pP tank",
+		"zpool detach tank /dev/sdc",
+	}
+	if !reflect.DeepEqual(executor.commands, expected) {
+		t.Fatalf("expected %q, ran %q", expected, executor.commands)
+	}
+}
+
+// TestApplyMirrorChangesWaitsForResilver verifies that nothing is detached while the new devices are resilvering,
+// and that the wait ends with the context.
+func TestApplyMirrorChangesWaitsForResilver(t *testing.T) {
+	interval := resilverPollInterval
+	resilverPollInterval = time.Millisecond
+	defer func() { resilverPollInterval = interval }()
+
+	resilvering := "  pool: tank\n state: ONLINE\n  scan: resilver in progress since Thu Aug 13 15:16:53 2020\n\t1.21M scanned at 1.21M/s, 1.00M issued at 1.00M/s, 2.00M total\n\t1.00M resilvered, 50.00% done, 00:00:01 to go\nconfig:\n\nerrors: No known data errors\n"
+	executor := (&fakeExecutor{}).
+		on("zpool attach", "").
+		on("zpool detach", "").
+		on("zpool status -pP tank", resilvering)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	changes := MirrorChanges{attach: []string{"/dev/sdc"}, detach: []string{"/dev/sda"}}
+	if err := applyMirrorChanges(ctx, newFakeConfig(executor), "tank", []string{"/dev/sda", "/dev/sdb"}, changes); err == nil {
+		t.Fatalf("expected the wait for the resilver to time out")
+	}
+	if executor.ran("zpool detach") {
+		t.Fatalf("a device was detached while resilvering")
+	}
+}
+
+// TestParsePoolLayout_LogsAndCache verifies that log and cache devices are
+// separated from the data vdevs, including unscripted section headers.
+func TestParsePoolLayout_LogsAndCache(t *testing.T) {
+	output := "tank\t99.5G\t1.2M\t99.5G\t-\t-\t0%\t0%\t1.00x\tONLINE\t-\n" +
+		"\tmirror-0\t99.5G\t1.2M\t99.5G\t-\t-\t0%\t0.00%\t-\tONLINE\n" +
+		"\t/dev/sda\t-\t-\t-\t-\t-\t-\t-\t-\tONLINE\n" +
+		"\treplacing-1\t-\t-\t-\t-\t-\t-\t-\t-\tONLINE\n" +
+		"\t/dev/sdb\t-\t-\t-\t-\t-\t-\t-\t-\tONLINE\n" +
+		"\tlogs\t-\t-\t-\t-\t-\t-\t-\t-\t-\n" +
+		"\t/dev/nvme0n1\t10G\t0\t10G\t-\t-\t0%\t0.00%\t-\tONLINE\n" +
+		"cache      -      -      -        -         -      -      -      -  -\n" +
+		"\t/dev/nvme1n1\t100G\t0\t100G\t-\t-\t0%\t0.00%\t-\tONLINE"
+
+	layout, err := parsePoolLayout(output)
+	if err != nil {
+		t.Fatalf("parsePoolLayout returned error: %v", err)
+	}
+
+	if len(layout.mirrors) != 1 || len(layout.mirrors[0].devices) != 2 {
+		t.Fatalf("expected a single mirror with 2 devices, got %#v", layout.mirrors)
+	}
+	if len(layout.striped) != 0 {
+		t.Fatalf("expected no striped devices, got %#v", layout.striped)
+	}
+	if len(layout.logs) != 1 || layout.logs[0].path != "/dev/nvme0n1" {
+		t.Fatalf("unexpected log devices: %#v", layout.logs)
+	}
+	if len(layout.caches) != 1 || layout.caches[0].path != "/dev/nvme1n1" {
+		t.Fatalf("unexpected cache devices: %#v", layout.caches)
+	}
+}
+
+// TestParseVdevSpecification_Classes verifies that log and cache devices are
+// appended to the data vdevs with their class keyword.
+func TestParseVdevSpecification_Classes(t *testing.T) {
+	mirrors := []interface{}{
+		map[string]interface{}{"device": []interface{}{
+			map[string]interface{}{"path": "/dev/sda"},
+			map[string]interface{}{"path": "/dev/sdb"},
+		}},
+	}
+	logs := []interface{}{map[string]interface{}{"path": "/dev/nvme0n1"}}
+	caches := []interface{}{map[string]interface{}{"path": "/dev/nvme1n1"}}
+
+	got := parseVdevSpecification(mirrors, nil, logs, caches)
+	expected := " mirror /dev/sda /dev/sdb log /dev/nvme0n1 cache /dev/nvme1n1"
+	if got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+// TestHasPrefix verifies the check used to only allow appending striped devices.
+func TestHasPrefix(t *testing.T) {
+	if !hasPrefix([]string{"/dev/sda", "/dev/sdb"}, []string{"/dev/sda"}) {
+		t.Fatalf("expected appended device to be allowed")
+	}
+	if hasPrefix([]string{"/dev/sdb"}, []string{"/dev/sda"}) {
+		t.Fatalf("expected changed device to be rejected")
+	}
+	if hasPrefix([]string{"/dev/sda"}, []string{"/dev/sda", "/dev/sdb"}) {
+		t.Fatalf("expected removed device to be rejected")
+	}
+}
+
+// TestParsePoolSize verifies that the size and expandable space are read from zpool list output.
+func TestParsePoolSize(t *testing.T) {
+	size, expandSize, err := parsePoolSize("10737418240\t5368709120\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if size != 10737418240 || expandSize != 5368709120 {
+		t.Fatalf("unexpected sizes %d, %d", size, expandSize)
+	}
+
+	_, expandSize, err = parsePoolSize("10737418240\t-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expandSize != 0 {
+		t.Fatalf("expected no expandable space, got %d", expandSize)
+	}
+
+	if _, _, err := parsePoolSize("garbage"); err == nil {
+		t.Fatalf("expected an error for malformed output")
+	}
+}
+
+// TestGetResetCommand_PoolDefaults verifies that zpool properties with a known default are reset
+// with zpool set, while other zpool properties are left alone.
+func TestGetResetCommand_PoolDefaults(t *testing.T) {
+	if command, ok := getResetCommand("autotrim"); !ok || command != "zpool set autotrim=off" {
+		t.Fatalf("unexpected reset command %q for autotrim", command)
+	}
+	if command, ok := getResetCommand("comment"); !ok || command != "zpool set comment=''" {
+		t.Fatalf("unexpected reset command %q for comment", command)
+	}
+	if _, ok := getResetCommand("altroot"); ok {
+		t.Fatalf("expected altroot not to be reset")
+	}
+}
+
+// TestUpdatePropertiesInState_ModeAllTracksResettablePoolProperties verifies that in `property_mode = "all"`,
+// locally set pool properties with a known default are reported as drift, while create-only properties are not.
+func TestUpdatePropertiesInState_ModeAllTracksResettablePoolProperties(t *testing.T) {
+	rd := buildResourceDataPool(t)
+
+	if err := rd.Set("property_mode", "all"); err != nil {
+		t.Fatalf("failed to set property_mode: %v", err)
+	}
+
+	props := map[string]Property{
+		"autotrim":   {source: SourceLocal, value: "on", rawValue: "on"},
+		"altroot":    {source: SourceLocal, value: "/mnt", rawValue: "/mnt"},
+		"encryption": {source: SourceLocal, value: "aes-256-gcm", rawValue: "aes-256-gcm"},
+	}
+
+	if err := updatePropertiesInState(rd, props, []string{}); err != nil {
+		t.Fatalf("updatePropertiesInState returned error: %v", err)
+	}
+
+	got := rd.Get("property").(*schema.Set).List()
+	if len(got) != 1 || got[0].(map[string]interface{})["name"] != "autotrim" {
+		t.Fatalf("expected only autotrim to be tracked, got: %#v", got)
+	}
+}
+
+// TestDescribePoolStatus verifies that the status of a pool is only read when it is asked for, as zpool status is
+// skipped by refreshes which don't refresh it.
+func TestDescribePoolStatus(t *testing.T) {
+	for _, withStatus := range []bool{false, true} {
+		executor := (&fakeExecutor{}).
+			on("zpool list -HPv", "tank\t99.5G\t1.2M\t99.5G\t-\t-\t0%\t0%\t1.00x\tONLINE\t-\n\t/dev/sda\t99.5G\t1.2M\t99.5G\t-\t-\t0%\t0.00%\t-\tONLINE\n").
+			on("zfs get", "tank\tcompression\tlocal\tlz4\n--terraform-provider-zfs--\ntank\tcompression\tlz4\n").
+			on("zpool get", "tank\tguid\t-\t1234\n--terraform-provider-zfs--\ntank\tguid\t1234\n").
+			on("zpool status", "  pool: tank\n state: ONLINE\nconfig:\n\n\tNAME        STATE     READ WRITE CKSUM\n\ttank        ONLINE       0     0     0\n\t  /dev/sda  ONLINE       0     0     0\n\nerrors: No known data errors\n")
+		pool, err := describePool(newFakeConfig(executor), "tank", nil, withStatus)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if executor.ran("zpool status") != withStatus || (pool.status != nil) != withStatus {
+			t.Fatalf("expected zpool status to run only with withStatus = %t, ran %v", withStatus, executor.commands)
+		}
+	}
+}
+
+// TestPlanLayoutWarnings verifies that the layout of a new pool is linted while it is planned, so the warnings show up
+// in the plan.
+func TestPlanLayoutWarnings(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("lsblk", "1000204886016 1\n500107862016 0\n").
+		on("cat /proc/spl/kstat/zfs/arcstats", "")
+	config := newFakeConfig(executor)
+
+	raw := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":   "tank",
+		"device": []interface{}{map[string]interface{}{"path": "/dev/sda"}},
+		"log":    []interface{}{map[string]interface{}{"path": "/dev/nvme0n1"}},
+	})
+	diff, err := resourcePool().Diff(context.Background(), nil, raw, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	attribute, ok := diff.Attributes["layout_warnings.0"]
+	if !ok || !strings.HasPrefix(attribute.New, LintSlogPowerLoss+": ") {
+		t.Fatalf("expected the slog_power_loss warning in the plan, got %+v", diff.Attributes)
+	}
+}
+
+// TestResourcePoolDeleteBehavior verifies that pools are only destroyed when destroy_behavior asks for it.
+func TestResourcePoolDeleteBehavior(t *testing.T) {
+	for behavior, expected := range map[string]string{
+		DestroyBehaviorDestroy: "zpool destroy tank",
+		DestroyBehaviorExport:  "zpool export tank",
+		DestroyBehaviorAbandon: "",
+	} {
+		executor := (&fakeExecutor{}).on("zpool destroy", "").on("zpool export", "")
+		d := schema.TestResourceDataRaw(t, resourcePool().Schema, map[string]interface{}{"name": "tank", "destroy_behavior": behavior, "force_destroy": true})
+		d.SetId("1234")
+
+		if diags := resourcePoolDelete(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+			t.Fatalf("unexpected error for %s: %v", behavior, diags)
+		}
+
+		if expected == "" && len(executor.commands) > 0 {
+			t.Fatalf("expected %s to leave the pool alone, ran %v", behavior, executor.commands)
+		}
+		if expected != "" && (len(executor.commands) != 1 || !executor.ran(expected)) {
+			t.Fatalf("expected %s to run %q, ran %v", behavior, expected, executor.commands)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceProject() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Accounts a directory of a filesystem to a project with `zfs project`, so the space and objects below it can be limited with the `projectquota@` and `projectobjquota@` properties, " +
+			"e.g. to give each site of a shared web host its own limit. The inherit flag is set on the directory, so files created below it later are accounted to the project too. " +
+			"The quotas can either be set here, or with `zfs_project_quota`, but not both. The filesystem must have the `project_quota` feature enabled.",
+
+		CreateContext: resourceProjectCreate,
+		ReadContext:   resourceProjectRead,
+		UpdateContext: resourceProjectUpdate,
+		DeleteContext: resourceProjectDelete,
+
+		Schema: map[string]*schema.Schema{
+			"path": {
+				Description: "Path of the directory on the host, e.g. `/srv/www/example.com`.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"project_id": {
+				Description:      "Numeric id of the project. Project 0 is the default every file is accounted to.",
+				Type:             schema.TypeInt,
+				Required:         true,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(1)),
+			},
+			"recursive": {
+				Description: "Account everything which already exists below the directory to the project too, rather than only what is created later. Defaults to `true`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"quota": {
+				Description: "Amount of space the project may consume on the filesystem, e.g. `10G`, set as `projectquota@<project_id>`. Left alone when not set.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"object_quota": {
+				Description: "Number of objects the project may own on the filesystem, set as `projectobjquota@<project_id>`. Left alone when not set.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"dataset": {
+				Description: "Name of the filesystem the directory belongs to.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"used": {
+				Description: "Space currently consumed by the project on the filesystem, in bytes.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"object_used": {
+				Description: "Number of objects currently owned by the project on the filesystem.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// setProjectQuotas sets the configured quotas of a project, skipping those which aren't set.
+func setProjectQuotas(config *Config, dataset string, principal string, quota string, objectQuota string) error {
+	if quota != "" {
+		if err := setQuota(config, dataset, ProjectQuota.quotaProperty(principal), quota); err != nil {
+			return err
+		}
+	}
+	if objectQuota != "" {
+		if err := setQuota(config, dataset, ProjectQuota.objectQuotaProperty(principal), objectQuota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeProjectQuotas removes the quotas which were set by the resource.
+func removeProjectQuotas(config *Config, dataset string, principal string, quota string, objectQuota string) error {
+	if quota != "" {
+		quota = "none"
+	}
+	if objectQuota != "" {
+		objectQuota = "none"
+	}
+	return setProjectQuotas(config, dataset, principal, quota, objectQuota)
+}
+
+func resourceProjectCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	path := d.Get("path").(string)
+	dataset, err := datasetOfPath(config, path)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	id := d.Get("project_id").(int)
+	if err := assignProject(config, path, id, d.Get("recursive").(bool)); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(path)
+
+	if err := setProjectQuotas(config, dataset, strconv.Itoa(id), d.Get("quota").(string), d.Get("object_quota").(string)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return resourceProjectRead(ctx, d, meta)
+}
+
+func resourceProjectRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	path := d.Get("path").(string)
+	assignment, err := readProjectAssignment(config, path)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	if !assignment.inherit {
+		log.Printf("[WARN] the inherit flag of %s was cleared outside of terraform, new files aren't accounted to project %d", path, assignment.id)
+	}
+
+	dataset, err := datasetOfPath(config, path)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	usage, err := describeSpaceUsage(config, ProjectQuota, dataset, strconv.Itoa(assignment.id))
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	values := map[string]interface{}{
+		"project_id":  assignment.id,
+		"dataset":     dataset,
+		"used":        usage.rawUsed,
+		"object_used": usage.rawObjectUsed,
+	}
+
+	// Quotas which aren't configured are left to zfs_project_quota, and keep the configured representation if it
+	// is equivalent to what's on the server, as in the quota resources.
+	if quota := d.Get("quota").(string); quota != "" && quota != usage.rawQuota {
+		values["quota"] = usage.quota
+	}
+	if objectQuota := d.Get("object_quota").(string); objectQuota != "" && objectQuota != usage.rawObjectQuota {
+		values["object_quota"] = usage.objectQuota
+	}
+
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return diags
+}
+
+func resourceProjectUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	path := d.Get("path").(string)
+	dataset := d.Get("dataset").(string)
+
+	if d.HasChange("project_id") {
+		oldId, _ := d.GetChange("project_id")
+		oldQuota, _ := d.GetChange("quota")
+		oldObjectQuota, _ := d.GetChange("object_quota")
+
+		// Files are accounted to the new project before the old quotas go, so they are never left without a limit.
+		if err := assignProject(config, path, d.Get("project_id").(int), d.Get("recursive").(bool)); err != nil {
+			return diagFromErr(err)
+		}
+		if err := setProjectQuotas(config, dataset, strconv.Itoa(d.Get("project_id").(int)), d.Get("quota").(string), d.Get("object_quota").(string)); err != nil {
+			return diagFromErr(err)
+		}
+		if err := removeProjectQuotas(config, dataset, strconv.Itoa(oldId.(int)), oldQuota.(string), oldObjectQuota.(string)); err != nil {
+			return diagFromErr(err)
+		}
+
+		return resourceProjectRead(ctx, d, meta)
+	}
+
+	principal := strconv.Itoa(d.Get("project_id").(int))
+	for _, attribute := range []string{"quota", "object_quota"} {
+		if !d.HasChange(attribute) {
+			continue
+		}
+
+		property := ProjectQuota.quotaProperty(principal)
+		if attribute == "object_quota" {
+			property = ProjectQuota.objectQuotaProperty(principal)
+		}
+
+		// A quota which is no longer configured is removed, as the resource set it.
+		value := d.Get(attribute).(string)
+		if value == "" {
+			value = "none"
+		}
+		if err := setQuota(config, dataset, property, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return resourceProjectRead(ctx, d, meta)
+}
+
+func resourceProjectDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	path := d.Get("path").(string)
+	principal := strconv.Itoa(d.Get("project_id").(int))
+
+	log.Printf("[DEBUG] removing %s from project %s", path, principal)
+	if err := removeProjectQuotas(config, d.Get("dataset").(string), principal, d.Get("quota").(string), d.Get("object_quota").(string)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := clearProject(config, path, d.Get("recursive").(bool)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
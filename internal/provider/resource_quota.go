@@ -0,0 +1,214 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceUserQuota() *schema.Resource {
+	return resourceQuota(UserQuota)
+}
+
+func resourceGroupQuota() *schema.Resource {
+	return resourceQuota(GroupQuota)
+}
+
+func resourceProjectQuota() *schema.Resource {
+	return resourceQuota(ProjectQuota)
+}
+
+// resourceQuota builds the schema shared by the user, group and project quota resources,
+// which only differ in which properties and space accounting command they use.
+func resourceQuota(kind QuotaKind) *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: fmt.Sprintf("Space and object quota for a single %s on a dataset, managed through the `%squota@` and `%sobjquota@` properties.", kind, kind, kind),
+
+		CreateContext: quotaCreate(kind),
+		ReadContext:   quotaRead(kind),
+		UpdateContext: quotaUpdate(kind),
+		DeleteContext: quotaDelete(kind),
+
+		Importer: &schema.ResourceImporter{
+			StateContext: quotaImport(kind),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"dataset": {
+				Description: "Name of the filesystem the quota applies to.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			string(kind): {
+				Description: fmt.Sprintf("Name or numeric id of the %s the quota applies to.", kind),
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"quota": {
+				Description: "Amount of space the principal may consume, e.g. `10G`. Defaults to `none`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "none",
+			},
+			"object_quota": {
+				Description: "Number of objects (files, directories, etc.) the principal may own. Defaults to `none`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "none",
+			},
+			"used": {
+				Description: "Space currently consumed by the principal, in bytes.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"object_used": {
+				Description: "Number of objects currently owned by the principal.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func quotaId(dataset string, principal string) string {
+	return dataset + "|" + principal
+}
+
+func quotaCreate(kind QuotaKind) schema.CreateContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+		config := meta.(*Config)
+
+		dataset := d.Get("dataset").(string)
+		principal := d.Get(string(kind)).(string)
+
+		if err := setQuota(config, dataset, kind.quotaProperty(principal), d.Get("quota").(string)); err != nil {
+			return diagFromErr(err)
+		}
+
+		d.SetId(quotaId(dataset, principal))
+
+		if err := setQuota(config, dataset, kind.objectQuotaProperty(principal), d.Get("object_quota").(string)); err != nil {
+			return diagFromErr(err)
+		}
+
+		return quotaRead(kind)(ctx, d, meta)
+	}
+}
+
+func quotaRead(kind QuotaKind) schema.ReadContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+		var diags diag.Diagnostics
+
+		config := meta.(*Config)
+
+		dataset := d.Get("dataset").(string)
+		principal := d.Get(string(kind)).(string)
+
+		usage, err := describeSpaceUsage(config, kind, dataset, principal)
+		if err != nil {
+			return diagFromErr(err)
+		}
+
+		// Keep the configured representation if it is equivalent to what's on the server,
+		// otherwise report the formatted value so the drift is readable.
+		quota := usage.quota
+		if d.Get("quota").(string) == usage.rawQuota {
+			quota = usage.rawQuota
+		}
+
+		objectQuota := usage.objectQuota
+		if d.Get("object_quota").(string) == usage.rawObjectQuota {
+			objectQuota = usage.rawObjectQuota
+		}
+
+		if err := d.Set("quota", quota); err != nil {
+			return diagFromErr(err)
+		}
+
+		if err := d.Set("object_quota", objectQuota); err != nil {
+			return diagFromErr(err)
+		}
+
+		if err := d.Set("used", usage.rawUsed); err != nil {
+			return diagFromErr(err)
+		}
+
+		if err := d.Set("object_used", usage.rawObjectUsed); err != nil {
+			return diagFromErr(err)
+		}
+
+		return diags
+	}
+}
+
+func quotaUpdate(kind QuotaKind) schema.UpdateContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+		config := meta.(*Config)
+
+		dataset := d.Get("dataset").(string)
+		principal := d.Get(string(kind)).(string)
+
+		if d.HasChange("quota") {
+			if err := setQuota(config, dataset, kind.quotaProperty(principal), d.Get("quota").(string)); err != nil {
+				return diagFromErr(err)
+			}
+		}
+
+		if d.HasChange("object_quota") {
+			if err := setQuota(config, dataset, kind.objectQuotaProperty(principal), d.Get("object_quota").(string)); err != nil {
+				return diagFromErr(err)
+			}
+		}
+
+		return quotaRead(kind)(ctx, d, meta)
+	}
+}
+
+func quotaDelete(kind QuotaKind) schema.DeleteContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+		var diags diag.Diagnostics
+
+		config := meta.(*Config)
+
+		dataset := d.Get("dataset").(string)
+		principal := d.Get(string(kind)).(string)
+
+		log.Printf("[DEBUG] removing %s quotas for %s on %s", kind, principal, dataset)
+		if err := setQuota(config, dataset, kind.quotaProperty(principal), "none"); err != nil {
+			return diagFromErr(err)
+		}
+
+		if err := setQuota(config, dataset, kind.objectQuotaProperty(principal), "none"); err != nil {
+			return diagFromErr(err)
+		}
+
+		d.SetId("")
+		return diags
+	}
+}
+
+func quotaImport(kind QuotaKind) schema.StateContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+		parts := strings.Split(d.Id(), "|")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid import id %q, expected <dataset>|<%s>", d.Id(), kind)
+		}
+
+		if err := d.Set("dataset", parts[0]); err != nil {
+			return nil, err
+		}
+
+		if err := d.Set(string(kind), parts[1]); err != nil {
+			return nil, err
+		}
+
+		return []*schema.ResourceData{d}, nil
+	}
+}
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestQuotaKind_Properties verifies the property names used for each quota kind.
+func TestQuotaKind_Properties(t *testing.T) {
+	if got := UserQuota.quotaProperty("alice"); got != "userquota@alice" {
+		t.Fatalf("unexpected user quota property %q", got)
+	}
+	if got := GroupQuota.objectQuotaProperty("staff"); got != "groupobjquota@staff" {
+		t.Fatalf("unexpected group object quota property %q", got)
+	}
+	if got := ProjectQuota.quotaProperty("100"); got != "projectquota@100" {
+		t.Fatalf("unexpected project quota property %q", got)
+	}
+}
+
+// TestParseSpaceUsage verifies that the row for a given principal is found,
+// and that missing principals are reported as nil.
+func TestParseSpaceUsage(t *testing.T) {
+	output := "root\t1024\tnone\t3\tnone\nalice\t10737418240\t21474836480\t1200\t100000"
+
+	line, err := parseSpaceUsage(output, "alice")
+	if err != nil {
+		t.Fatalf("parseSpaceUsage returned error: %v", err)
+	}
+	if !reflect.DeepEqual(line, []string{"alice", "10737418240", "21474836480", "1200", "100000"}) {
+		t.Fatalf("unexpected line: %#v", line)
+	}
+
+	line, err = parseSpaceUsage(output, "bob")
+	if err != nil {
+		t.Fatalf("parseSpaceUsage returned error: %v", err)
+	}
+	if line != nil {
+		t.Fatalf("expected no line for bob, got %#v", line)
+	}
+}
@@ -0,0 +1,275 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// receivePollInterval is how often a receive running in the background is checked.
+const receivePollInterval = 5 * time.Second
+
+var receiveSources = []string{"file", "url", "command"}
+
+func resourceReceivedDataset() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Materializes a dataset by receiving a `zfs send` stream from a file on the host, a URL or the output of a command, e.g. a golden VM image. " +
+			"The stream is received again, replacing the dataset, when the file or the ETag of the URL changes, or when `triggers` change. " +
+			"A dataset which is destroyed outside of terraform is received again. " +
+			"As its contents can always be received again from the stream, the dataset is destroyed along with its snapshots and children without checking whether it is empty.",
+
+		CreateContext: resourceReceivedDatasetCreate,
+		ReadContext:   resourceReceivedDatasetRead,
+		DeleteContext: resourceReceivedDatasetDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		CustomizeDiff: resourceReceivedDatasetCustomizeDiff,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Description: "Name of the dataset to receive the stream into. Its parent must exist.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"file": {
+				Description:  "Path of a file on the host holding the stream.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: receiveSources,
+			},
+			"url": {
+				Description:  "HTTP(S) URL to download the stream from with curl on the host.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: receiveSources,
+			},
+			"command": {
+				Description:  "Command run on the host which writes the stream to stdout, e.g. `ssh build zfs send images/base@v3`. A command which fails midway leaves a truncated stream, which zfs refuses to receive.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: receiveSources,
+			},
+			"checksum": {
+				Description:      "SHA-256 of the stream, verified with sha256sum before anything is received. A stream from a URL is downloaded below /var/tmp first to verify it.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				ConflictsWith:    []string{"command"},
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(sha256Pattern, "must be a SHA-256 in hexadecimal")),
+			},
+			"force": {
+				Description: "Receive with `-F`, rolling back or destroying an existing dataset of the same name to receive the stream. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+			"mount": {
+				Description: "Mount the received filesystem. Defaults to `true`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     true,
+			},
+			"triggers": {
+				Description: "Arbitrary values which receive the stream again when changed, e.g. the version of the image a command sends.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"stream_version": {
+				Description: "Version of the stream it was received from: the size and modification time of the file, or the ETag or Last-Modified header of the URL. Empty for commands.",
+				Type:        schema.TypeString,
+				Computed:    true,
+				ForceNew:    true,
+			},
+			"snapshot": {
+				Description: "Full name of the snapshot which was received.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"snapshot_guid": {
+				Description: "GUID of the snapshot which was received, which is the same on every host the stream is received on.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func receiveSourceFromData(d interface{ Get(string) interface{} }) ReceiveSource {
+	return ReceiveSource{
+		file:     d.Get("file").(string),
+		url:      d.Get("url").(string),
+		command:  d.Get("command").(string),
+		checksum: d.Get("checksum").(string),
+	}
+}
+
+// resourceReceivedDatasetCustomizeDiff replaces the dataset when the version of its stream changed since it was
+// received. The version can only be read once the provider is configured and the source is known.
+func resourceReceivedDatasetCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || meta == nil {
+		return nil
+	}
+	for _, source := range receiveSources {
+		if !d.NewValueKnown(source) {
+			return nil
+		}
+	}
+
+	version, err := readStreamVersion(meta.(*Config), receiveSourceFromData(d))
+	if err != nil {
+		log.Printf("[WARN] failed to read the version of the stream of %s, assuming it didn't change: %s", d.Get("name"), err)
+		return nil
+	}
+	if version != d.Get("stream_version").(string) {
+		if err := d.SetNew("stream_version", version); err != nil {
+			return err
+		}
+		return d.ForceNew("stream_version")
+	}
+	return nil
+}
+
+func resourceReceivedDatasetCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	datasetName := d.Get("name").(string)
+	source := receiveSourceFromData(d)
+
+	// The version is read before receiving, so a stream which changes while it is received is received again.
+	version, err := readStreamVersion(config, source)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	directory, err := createJobDirectory(config, receiveLogDirectory, receiveJobPrefix)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	job := ReceiveJob{
+		directory: directory,
+		target:    datasetName,
+		force:     d.Get("force").(bool),
+		mount:     d.Get("mount").(bool),
+		source:    source,
+	}
+	if err := startReceive(config, job); err != nil {
+		return diagFromErr(err)
+	}
+
+	deadline := time.Now().Add(d.Timeout(schema.TimeoutCreate))
+	for {
+		select {
+		case <-ctx.Done():
+			return diagFromErr(ctx.Err())
+		case <-time.After(receivePollInterval):
+		}
+
+		progress, err := readReceiveProgress(config, job)
+		if err != nil {
+			return diagFromErr(err)
+		}
+		if progress.failed {
+			return diag.Errorf("receiving %s failed: %s", datasetName, progress.errors)
+		}
+		if progress.finished {
+			break
+		}
+
+		log.Printf("[DEBUG] still receiving %s", datasetName)
+		if time.Now().Add(receivePollInterval).After(deadline) {
+			return diag.Errorf("timed out waiting for %s to be received, the receive continues in the background. Its errors are logged to %s.err", datasetName, job.logPath())
+		}
+	}
+
+	if err := removeReceiveLogs(config, job); err != nil {
+		log.Printf("[WARN] failed to remove the logs of the receive of %s: %s", datasetName, err)
+	}
+
+	dataset, err := describeDataset(config, datasetName, nil)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	d.SetId(dataset.guid)
+
+	snapshots, err := listSnapshots(config, datasetName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	if len(snapshots) == 0 {
+		return diag.Errorf("%s was received without a snapshot", datasetName)
+	}
+	received := snapshots[len(snapshots)-1]
+
+	values := map[string]interface{}{
+		"stream_version": version,
+		"snapshot":       received.name,
+		"snapshot_guid":  received.guid,
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return resourceReceivedDatasetRead(ctx, d, meta)
+}
+
+func resourceReceivedDatasetRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	datasetName := d.Get("name").(string)
+	if _, err := getDatasetNameByGuid(config, datasetName, d.Id()); err != nil {
+		// Anything but a missing dataset, such as a failed connection, must not receive the stream again, as that
+		// may overwrite live data with force.
+		if _, ok := err.(*DatasetError); !ok {
+			return diagFromErr(err)
+		}
+		log.Printf("[WARN] %s identified by guid %s is gone, it will be received again: %s", datasetName, d.Id(), err)
+		d.SetId("")
+		return diags
+	}
+
+	return diags
+}
+
+func resourceReceivedDatasetDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	datasetName, err := getDatasetNameByGuid(config, d.Get("name").(string), d.Id())
+	if err != nil {
+		if _, ok := err.(*DatasetError); !ok {
+			return diagFromErr(err)
+		}
+		log.Printf("[DEBUG] %s is already gone: %s", d.Get("name"), err)
+		return diags
+	}
+
+	// Unlike other datasets there is no force_destroy, the received snapshot alone would make every replacement fail.
+	if err := destroyDataset(ctx, config, *datasetName); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
@@ -0,0 +1,267 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"path"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// rewritePollInterval is how often the progress of a rewrite is checked while waiting for it to finish.
+const rewritePollInterval = 10 * time.Second
+
+func resourceRewrite() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Rewrites the existing data of a filesystem in the background, so changes of properties such as `compression`, `checksum` or `recordsize` apply to blocks written before the change. Change `triggers`, e.g. to the new property values, to rewrite again. Destroying the resource does not stop a running rewrite.",
+
+		CreateContext: resourceRewriteCreate,
+		ReadContext:   resourceRewriteRead,
+		UpdateContext: resourceRewriteUpdate,
+		DeleteContext: resourceRewriteDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"dataset": {
+				Description: "Name of the filesystem to rewrite. It must be mounted.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"path": {
+				Description: "File or directory to rewrite, relative to the mountpoint of the filesystem. Defaults to the whole filesystem, excluding filesystems mounted below it.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     "",
+			},
+			"method": {
+				Description: `
+					How to rewrite the data.
+
+					"rewrite" uses zfs rewrite, which rewrites blocks in place without changing file contents or metadata, and requires OpenZFS 2.4. This is the default.
+
+					"copy" replaces every file by a copy of itself, which works with any version. Copies keep ACLs and extended attributes, which needs GNU cp, so it isn't available on FreeBSD. Files with several hard links are skipped, and files which are written to while they are copied may lose those writes, so only use it for data at rest.
+
+					With either method, blocks still referenced by snapshots are kept, so the space used only shrinks once those snapshots are destroyed.`,
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				Default:          RewriteMethodRewrite,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(rewriteMethods, false)),
+			},
+			"triggers": {
+				Description: "Arbitrary values which start a new rewrite when changed.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"wait_for_completion": {
+				Description: "Wait for the rewrite to finish before completing the apply, up to the create timeout. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"target_path": {
+				Description: "Absolute path of the file or directory being rewritten.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"log_path": {
+				Description: "Path on the host of the log of the rewrite, without the `.log`, `.err` and `.exit` extensions. It is in a directory private to the rewrite, which is removed along with the resource.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"state": {
+				Description: "State of the rewrite, one of `in_progress`, `finished` or `failed`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"files_total": {
+				Description: "Number of files to rewrite, counted when the rewrite started.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"files_rewritten": {
+				Description: "Number of files rewritten so far.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"progress": {
+				Description: "Percentage of the files which have been rewritten.",
+				Type:        schema.TypeFloat,
+				Computed:    true,
+			},
+			"errors": {
+				Description: "The last errors reported by the rewrite, if any.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func rewriteJobFromState(d *schema.ResourceData) RewriteJob {
+	return RewriteJob{
+		logPath: d.Get("log_path").(string),
+		root:    d.Get("target_path").(string),
+		method:  d.Get("method").(string),
+	}
+}
+
+// rewritePercentage is the share of files rewritten, which can't be known exactly as files may be added while rewriting.
+func rewritePercentage(progress RewriteProgress, total int64) float64 {
+	if progress.state == RewriteFinished || total == 0 {
+		return 100
+	}
+	return math.Min(100, float64(progress.rewritten)*100/float64(total))
+}
+
+func resourceRewriteCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	datasetName := d.Get("dataset").(string)
+	method := d.Get("method").(string)
+	if method == RewriteMethodRewrite {
+		supported, err := rewriteSupported(config)
+		if err != nil {
+			return diagFromErr(err)
+		}
+		if !supported {
+			return diag.Errorf("zfs rewrite is not available on the host, it requires OpenZFS 2.4. Set method = \"copy\" to rewrite files by copying them instead")
+		}
+	} else if hostPlatform(config) == PlatformFreeBSD {
+		return diag.Errorf("the copy method needs GNU cp to keep extended attributes, which FreeBSD doesn't have. Use method = \"rewrite\" instead")
+	}
+
+	root, err := rewriteRoot(config, datasetName, d.Get("path").(string))
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	job := RewriteJob{root: root, method: method}
+	total, err := countRewriteFiles(config, job)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	directory, err := createJobDirectory(config, rewriteLogDirectory, rewriteJobPrefix)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	job.logPath = path.Join(directory, "rewrite")
+
+	if err := startRewrite(config, job); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s:%d", datasetName, time.Now().Unix()))
+
+	if err := d.Set("target_path", root); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("log_path", job.logPath); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("files_total", int(total)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if d.Get("wait_for_completion").(bool) {
+		deadline := time.Now().Add(d.Timeout(schema.TimeoutCreate))
+		for {
+			progress, err := readRewriteProgress(config, job)
+			if err != nil {
+				return diagFromErr(err)
+			}
+
+			if progress.state == RewriteFailed {
+				return diag.Errorf("rewrite of %s failed: %s", root, progress.errors)
+			}
+			if progress.state == RewriteFinished {
+				break
+			}
+
+			log.Printf("[DEBUG] rewrite of %s is %.2f%% done", root, rewritePercentage(*progress, total))
+			if time.Now().Add(rewritePollInterval).After(deadline) {
+				return diag.Errorf("timed out waiting for the rewrite of %s to finish, it is %.2f%% done", root, rewritePercentage(*progress, total))
+			}
+
+			select {
+			case <-ctx.Done():
+				return diagFromErr(ctx.Err())
+			case <-time.After(rewritePollInterval):
+			}
+		}
+	}
+
+	return resourceRewriteRead(ctx, d, meta)
+}
+
+func resourceRewriteRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	job := rewriteJobFromState(d)
+	progress, err := readRewriteProgress(config, job)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if progress.state == RewriteFailed {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Rewrite failed",
+			Detail:   fmt.Sprintf("The rewrite of %s failed, so some files may still use the old properties. Change triggers to try again. The last errors were:\n%s", job.root, progress.errors),
+		})
+	}
+
+	if err := d.Set("state", string(progress.state)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("files_rewritten", int(progress.rewritten)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("progress", rewritePercentage(*progress, int64(d.Get("files_total").(int)))); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("errors", progress.errors); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceRewriteUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// Only wait_for_completion can change without starting a new rewrite, and it only matters on create.
+	return resourceRewriteRead(ctx, d, meta)
+}
+
+func resourceRewriteDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	if err := removeRewriteLogs(config, rewriteJobFromState(d)); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId("")
+	return diags
+}
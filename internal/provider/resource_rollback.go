@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceRollback() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Rolls a dataset back to a snapshot when created. Changing any argument or `triggers` rolls it back again. " +
+			"The plan lists the newer snapshots the rollback destroys in `destroyed_snapshots`, and fails if there are any unless `destroy_newer` is set. " +
+			"Destroying the resource does not undo the rollback.",
+
+		CreateContext: resourceRollbackCreate,
+		ReadContext:   resourceRollbackRead,
+		DeleteContext: resourceRollbackDelete,
+
+		CustomizeDiff: resourceRollbackCustomizeDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"dataset": {
+				Description: "Name of the dataset to roll back.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"snapshot": {
+				Description:      "Name of the snapshot to roll back to, i.e. the part after the `@`.",
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(snapshotPrefixPattern, "must only contain letters, digits, dashes, underscores, periods and colons")),
+			},
+			"destroy_newer": {
+				Description: "Destroy the snapshots taken after `snapshot`, like `zfs rollback -r`. Without it, rolling back to any but the latest snapshot fails. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+			"triggers": {
+				Description: "Arbitrary values which roll the dataset back again when changed.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"destroyed_snapshots": {
+				Description: "Full names of the snapshots newer than `snapshot`, which the rollback destroys. These are known when planning, unless the dataset or snapshot don't exist yet.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"rolled_back_at": {
+				Description: "Time of the rollback in RFC 3339 format.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// resourceRollbackCustomizeDiff lists the snapshots which a planned rollback destroys, as a dry run, and fails the
+// plan when the rollback would fail because of them.
+func resourceRollbackCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() != "" && !d.HasChanges("dataset", "snapshot", "destroy_newer", "triggers") {
+		return nil
+	}
+
+	if !d.NewValueKnown("dataset") || !d.NewValueKnown("snapshot") {
+		return d.SetNewComputed("destroyed_snapshots")
+	}
+
+	config := meta.(*Config)
+	snapshotName := fmt.Sprintf("%s@%s", d.Get("dataset").(string), d.Get("snapshot").(string))
+
+	snapshots, err := listSnapshots(config, d.Get("dataset").(string))
+	if err != nil {
+		// The dataset may be created by the same apply.
+		if _, ok := err.(*DatasetError); ok {
+			return d.SetNewComputed("destroyed_snapshots")
+		}
+		return err
+	}
+
+	newer, ok := newerSnapshots(snapshots, snapshotName)
+	if !ok {
+		return d.SetNewComputed("destroyed_snapshots")
+	}
+
+	if len(newer) > 0 && !d.Get("destroy_newer").(bool) {
+		return fmt.Errorf("rolling back to %s requires destroying the newer snapshots %s. Set destroy_newer to destroy them", snapshotName, strings.Join(newer, ", "))
+	}
+
+	log.Printf("[DEBUG] rolling back to %s destroys %d newer snapshots", snapshotName, len(newer))
+	return d.SetNew("destroyed_snapshots", newer)
+}
+
+func resourceRollbackCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	datasetName := d.Get("dataset").(string)
+	snapshotName := fmt.Sprintf("%s@%s", datasetName, d.Get("snapshot").(string))
+
+	snapshots, err := listSnapshots(config, datasetName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	newer, ok := newerSnapshots(snapshots, snapshotName)
+	if !ok {
+		return diagFromErr(fmt.Errorf("snapshot %s does not exist", snapshotName))
+	}
+
+	flags := ""
+	if d.Get("destroy_newer").(bool) {
+		flags = "-r "
+	}
+
+	if _, err := callSshCommandContext(ctx, config, "zfs rollback %s%s", flags, snapshotName); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s:%d", snapshotName, time.Now().Unix()))
+
+	if err := d.Set("destroyed_snapshots", newer); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("rolled_back_at", time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return resourceRollbackRead(ctx, d, meta)
+}
+
+func resourceRollbackRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	// The rollback happened when the resource was created, there's nothing on the host to refresh.
+	return diags
+}
+
+func resourceRollbackDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+	return diags
+}
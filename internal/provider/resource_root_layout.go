@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// defaultVarDatasets are the datasets created below var when var_datasets isn't set.
+var defaultVarDatasets = []string{"log", "spool", "cache"}
+
+func resourceRootLayout() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Creates the conventional dataset layout for booting from ZFS in an existing pool, as used by OS installers: " +
+			"`ROOT` holding boot environments, the boot environment itself mounted at `/`, `home`, `home/root` and datasets below `var`. " +
+			"The pool is usually imported with an `altroot` while provisioning. Destroying the resource leaves the datasets in place.",
+
+		CreateContext: resourceRootLayoutCreate,
+		ReadContext:   resourceRootLayoutRead,
+		UpdateContext: resourceRootLayoutUpdate,
+		DeleteContext: resourceRootLayoutDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool to create the layout in, e.g. `rpool`.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"boot_environment": {
+				Description: "Name of the boot environment dataset below `ROOT`. Defaults to `default`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     "default",
+			},
+			"var_datasets": {
+				Description: "Datasets to create below `var`, which itself is not mounted. Defaults to `log`, `spool` and `cache`.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"mount_boot_environment": {
+				Description: "Mount the boot environment before creating the other datasets, so they are mounted below it. Disable this when the layout is created on a running system. Defaults to `true`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     true,
+			},
+			"set_bootfs": {
+				Description: "Set the `bootfs` property of the pool to the boot environment. Defaults to `true`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"root_dataset": {
+				Description: "Full name of the boot environment dataset.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"datasets": {
+				Description: "Full names of all datasets in the layout which exist.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// planRootLayout returns the datasets of a root layout in the order they have to be created.
+func planRootLayout(pool string, bootEnvironment string, varDatasets []string) []CreateDataset {
+	filesystem := func(name string, properties map[string]string) CreateDataset {
+		return CreateDataset{dsType: FilesystemType, name: pool + "/" + name, properties: properties}
+	}
+
+	datasets := []CreateDataset{
+		filesystem("ROOT", map[string]string{"canmount": "off", "mountpoint": "none"}),
+		filesystem("ROOT/"+bootEnvironment, map[string]string{"canmount": "noauto", "mountpoint": "/"}),
+		filesystem("home", map[string]string{"mountpoint": "/home"}),
+		filesystem("home/root", map[string]string{"mountpoint": "/root"}),
+		filesystem("var", map[string]string{"canmount": "off", "mountpoint": "/var"}),
+	}
+	for _, name := range varDatasets {
+		datasets = append(datasets, filesystem("var/"+name, map[string]string{}))
+	}
+	return datasets
+}
+
+func rootLayoutFromResourceData(d *schema.ResourceData) []CreateDataset {
+	varDatasets := defaultVarDatasets
+	if value, ok := d.GetOk("var_datasets"); ok {
+		varDatasets = make([]string, 0)
+		for _, name := range value.([]interface{}) {
+			varDatasets = append(varDatasets, name.(string))
+		}
+	}
+	return planRootLayout(d.Get("pool").(string), d.Get("boot_environment").(string), varDatasets)
+}
+
+func resourceRootLayoutCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	layout := rootLayoutFromResourceData(d)
+	bootEnvironment := layout[1].name
+
+	for i := range layout {
+		dataset, err := createDataset(ctx, config, &layout[i])
+		if err != nil {
+			return diagFromErr(err)
+		}
+
+		if layout[i].name == bootEnvironment {
+			// The ID is set as soon as the boot environment exists, so a failure further down is recoverable.
+			d.SetId(dataset.guid)
+
+			if d.Get("mount_boot_environment").(bool) {
+				if _, err := callSshCommandContext(ctx, config, "zfs mount %s", bootEnvironment); err != nil {
+					return diagFromErr(err)
+				}
+			}
+		}
+	}
+
+	if d.Get("set_bootfs").(bool) {
+		if err := setBootfs(config, d.Get("pool").(string), bootEnvironment); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return resourceRootLayoutRead(ctx, d, meta)
+}
+
+func resourceRootLayoutRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	stdout, err := callSshCommand(config, "zfs list -H -o name -r -t filesystem,volume %s", d.Get("pool").(string))
+	if err != nil {
+		if _, ok := err.(*DatasetError); ok {
+			d.SetId("")
+			return diags
+		}
+		return diagFromErr(err)
+	}
+	existing := strings.Split(stdout, "\n")
+
+	layout := rootLayoutFromResourceData(d)
+	bootEnvironment := layout[1].name
+	if !contains(existing, bootEnvironment) {
+		log.Printf("[DEBUG] boot environment %s is gone", bootEnvironment)
+		d.SetId("")
+		return diags
+	}
+
+	datasets := make([]string, 0)
+	for _, dataset := range layout {
+		if contains(existing, dataset.name) {
+			datasets = append(datasets, dataset.name)
+		}
+	}
+
+	if err := d.Set("root_dataset", bootEnvironment); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("datasets", datasets); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceRootLayoutUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	// set_bootfs is the only attribute which can change in place. Turning it off leaves bootfs as it is.
+	if d.HasChange("set_bootfs") && d.Get("set_bootfs").(bool) {
+		if err := setBootfs(config, d.Get("pool").(string), fmt.Sprintf("%s/ROOT/%s", d.Get("pool"), d.Get("boot_environment"))); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return resourceRootLayoutRead(ctx, d, meta)
+}
+
+func resourceRootLayoutDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+	return diags
+}
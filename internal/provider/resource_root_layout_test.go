@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"testing"
+)
+
+// TestPlanRootLayout verifies the datasets and mount conventions of the root layout, in creation order.
+func TestPlanRootLayout(t *testing.T) {
+	layout := planRootLayout("rpool", "debian", []string{"log"})
+
+	expected := []struct {
+		name       string
+		canmount   string
+		mountpoint string
+	}{
+		{"rpool/ROOT", "off", "none"},
+		{"rpool/ROOT/debian", "noauto", "/"},
+		{"rpool/home", "", "/home"},
+		{"rpool/home/root", "", "/root"},
+		{"rpool/var", "off", "/var"},
+		{"rpool/var/log", "", ""},
+	}
+
+	if len(layout) != len(expected) {
+		t.Fatalf("expected %d datasets, got %d", len(expected), len(layout))
+	}
+
+	for i, dataset := range expected {
+		if layout[i].name != dataset.name || layout[i].dsType != FilesystemType {
+			t.Fatalf("expected filesystem %s at position %d, got %s", dataset.name, i, layout[i].name)
+		}
+		if layout[i].properties["canmount"] != dataset.canmount || layout[i].properties["mountpoint"] != dataset.mountpoint {
+			t.Fatalf("unexpected properties for %s: %v", dataset.name, layout[i].properties)
+		}
+	}
+}
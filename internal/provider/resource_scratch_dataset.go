@@ -0,0 +1,188 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// scratchBaselineSnapshot is the snapshot a scratch dataset is rolled back to, taken right after it is created.
+const scratchBaselineSnapshot = "tf-scratch-baseline"
+
+func resourceScratchDataset() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "A filesystem which is rolled back to its freshly created state on every apply, e.g. for CI pipelines which need a clean dataset per run. " +
+			"A `" + scratchBaselineSnapshot + "` snapshot is taken after creation, and recycling rolls back to it and destroys all newer snapshots and all child datasets.",
+
+		CreateContext: resourceScratchDatasetCreate,
+		ReadContext:   resourceScratchDatasetRead,
+		UpdateContext: resourceScratchDatasetUpdate,
+		DeleteContext: resourceScratchDatasetDelete,
+
+		CustomizeDiff: resourceScratchDatasetCustomizeDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Description: "Name of the ZFS filesystem.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"mountpoint": {
+				Description: "Mountpoint of the filesystem. Defaults to the mountpoint inherited from its parent.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"recycle": {
+				Description: "Roll the filesystem back to its baseline on every apply. Defaults to `true`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"baseline_snapshot": {
+				Description: "Full name of the snapshot the filesystem is rolled back to.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"recycled_at": {
+				Description: "Time of the last rollback in RFC 3339 format, or of the creation if the filesystem was never recycled.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// resourceScratchDatasetCustomizeDiff marks the recycle time as unknown on every plan while recycling is
+// enabled, so that every apply updates the resource and rolls the filesystem back.
+func resourceScratchDatasetCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.Get("recycle").(bool) {
+		return nil
+	}
+	return d.SetNewComputed("recycled_at")
+}
+
+func resourceScratchDatasetCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	datasetName := d.Get("name").(string)
+	dataset, err := createDataset(ctx, config, &CreateDataset{
+		dsType:     FilesystemType,
+		name:       datasetName,
+		mountpoint: d.Get("mountpoint").(string),
+		properties: make(map[string]string),
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	d.SetId(dataset.guid)
+
+	baseline := fmt.Sprintf("%s@%s", datasetName, scratchBaselineSnapshot)
+	if _, err := callSshCommandContext(ctx, config, "zfs snapshot %s", baseline); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("recycled_at", time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return resourceScratchDatasetRead(ctx, d, meta)
+}
+
+func resourceScratchDatasetRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	datasetName, err := getDatasetNameByGuid(config, d.Get("name").(string), d.Id())
+	if err != nil {
+		return diagFromErr(fmt.Errorf("the scratch dataset %s identified by guid %s could not be found. It was likely deleted on the server outside of terraform", d.Get("name"), d.Id()))
+	}
+
+	if err := d.Set("name", *datasetName); err != nil {
+		return diagFromErr(err)
+	}
+
+	snapshots, err := listSnapshots(config, *datasetName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	baseline := ""
+	for _, snapshot := range snapshots {
+		if snapshot.name == fmt.Sprintf("%s@%s", *datasetName, scratchBaselineSnapshot) {
+			baseline = snapshot.name
+		}
+	}
+	if baseline == "" {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Scratch baseline snapshot missing",
+			Detail:   fmt.Sprintf("%s@%s no longer exists, so %s can't be recycled. Recreate the resource to take a new baseline.", *datasetName, scratchBaselineSnapshot, *datasetName),
+		})
+	}
+
+	if err := d.Set("baseline_snapshot", baseline); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceScratchDatasetUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	if !d.Get("recycle").(bool) {
+		return resourceScratchDatasetRead(ctx, d, meta)
+	}
+
+	datasetName := d.Get("name").(string)
+
+	// Rollbacks leave child datasets alone, so destroy those first.
+	stdout, err := callSshCommand(config, "zfs list -H -o name -d 1 -t filesystem,volume %s", datasetName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	for _, child := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		if child == "" || child == datasetName {
+			continue
+		}
+		if err := destroyDataset(ctx, config, child); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	if _, err := callSshCommandContext(ctx, config, "zfs rollback -r %s@%s", datasetName, scratchBaselineSnapshot); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("recycled_at", time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return resourceScratchDatasetRead(ctx, d, meta)
+}
+
+func resourceScratchDatasetDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+	config := meta.(*Config)
+
+	if err := destroyDataset(ctx, config, d.Get("name").(string)); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId("")
+	return diags
+}
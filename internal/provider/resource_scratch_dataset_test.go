@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestResourceScratchDatasetUpdate verifies that recycling destroys child datasets and rolls back to the baseline.
+func TestResourceScratchDatasetUpdate(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs list -H -o name -d 1 -t filesystem,volume tank/ci", "tank/ci\ntank/ci/job\n").
+		on("zfs destroy -r tank/ci/job", "").
+		on("zfs rollback -r tank/ci@tf-scratch-baseline", "").
+		on("zfs get -H -o value guid tank/ci", "1234\n").
+		on("zfs list -H -p -t snapshot", "tank/ci@tf-scratch-baseline\t5678\t1697371200\n")
+
+	d := schema.TestResourceDataRaw(t, resourceScratchDataset().Schema, map[string]interface{}{"name": "tank/ci"})
+	d.SetId("1234")
+	if diags := resourceScratchDatasetUpdate(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	destroyed := 0
+	for _, command := range executor.commands {
+		if strings.HasPrefix(command, "zfs destroy") {
+			destroyed++
+		}
+	}
+	if destroyed != 1 || !executor.ran("zfs destroy -r tank/ci/job") {
+		t.Fatalf("expected only the child dataset to be destroyed, ran %v", executor.commands)
+	}
+	if !executor.ran("zfs rollback -r tank/ci@tf-scratch-baseline") {
+		t.Fatalf("expected a rollback to the baseline, ran %v", executor.commands)
+	}
+	if d.Get("baseline_snapshot").(string) != "tank/ci@tf-scratch-baseline" || d.Get("recycled_at").(string) == "" {
+		t.Fatalf("unexpected state %v, %v", d.Get("baseline_snapshot"), d.Get("recycled_at"))
+	}
+}
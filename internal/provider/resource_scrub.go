@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// scrubPollInterval is how often zpool status is checked while waiting for a scrub to finish.
+const scrubPollInterval = 10 * time.Second
+
+func resourceScrub() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Starts a scrub of a pool when created, and reports the results of the last scrub. Change `triggers` to start another scrub. Destroying the resource does not affect the pool.",
+
+		CreateContext: resourceScrubCreate,
+		ReadContext:   resourceScrubRead,
+		UpdateContext: resourceScrubUpdate,
+		DeleteContext: resourceScrubDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool to scrub.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"triggers": {
+				Description: "Arbitrary values which start a new scrub when changed.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"wait_for_completion": {
+				Description: "Wait for the scrub to finish before completing the apply, up to the create timeout. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"state": {
+				Description: "State of the last scrub, one of `in_progress`, `finished`, `canceled` or `none`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"progress": {
+				Description: "Percentage of the last scrub which has completed.",
+				Type:        schema.TypeFloat,
+				Computed:    true,
+			},
+			"errors": {
+				Description: "Number of errors found by the last scrub.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"repaired_bytes": {
+				Description: "Number of bytes repaired by the last scrub.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"duration_seconds": {
+				Description: "How long the last finished scrub took.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceScrubCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	if _, err := callSshCommand(config, "zpool scrub %s", poolName); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s:%d", poolName, time.Now().Unix()))
+
+	if d.Get("wait_for_completion").(bool) {
+		deadline := time.Now().Add(d.Timeout(schema.TimeoutCreate))
+		for {
+			scan, err := readScan(config, poolName)
+			if err != nil {
+				return diagFromErr(err)
+			}
+
+			if scan.state != ScanInProgress {
+				break
+			}
+
+			log.Printf("[DEBUG] scrub of %s is %.2f%% done", poolName, scan.progress)
+			if time.Now().Add(scrubPollInterval).After(deadline) {
+				return diag.Errorf("timed out waiting for the scrub of %s to finish, it is %.2f%% done", poolName, scan.progress)
+			}
+
+			select {
+			case <-ctx.Done():
+				return diagFromErr(ctx.Err())
+			case <-time.After(scrubPollInterval):
+			}
+		}
+	}
+
+	return resourceScrubRead(ctx, d, meta)
+}
+
+func readScan(config *Config, poolName string) (*Scan, error) {
+	status, err := readPoolStatus(config, poolName)
+	if err != nil {
+		return nil, err
+	}
+	return parseScan(status)
+}
+
+func resourceScrubRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	scan, err := readScan(config, d.Get("pool").(string))
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	// A resilver replaces the scan results of the last scrub, in which case keep the previous values.
+	if scan.function == "resilver" {
+		return diags
+	}
+
+	if err := d.Set("state", string(scan.state)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("progress", scan.progress); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("errors", int(scan.errors)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("repaired_bytes", int(scan.repaired)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("duration_seconds", int(scan.duration)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceScrubUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// Only wait_for_completion can change without starting a new scrub, and it only matters on create.
+	return resourceScrubRead(ctx, d, meta)
+}
+
+func resourceScrubDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+	return diags
+}
@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestResourceScrubCreate verifies that creating a zfs_scrub starts a scrub and records the scan results.
+func TestResourceScrubCreate(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zpool scrub tank", "").
+		on("zpool status -pP tank", `  pool: tank
+ state: ONLINE
+  scan: scrub repaired 0B in 00:01:02 with 0 errors on Sun Oct 15 12:00:00 2023
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  /dev/sda  ONLINE       0     0     0
+
+errors: No known data errors`)
+
+	d := schema.TestResourceDataRaw(t, resourceScrub().Schema, map[string]interface{}{"pool": "tank"})
+	if diags := resourceScrubCreate(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	if !executor.ran("zpool scrub tank") {
+		t.Fatalf("expected a scrub to be started, ran %v", executor.commands)
+	}
+	if d.Get("state").(string) != string(ScanFinished) || d.Get("duration_seconds").(int) != 62 {
+		t.Fatalf("unexpected scan results %v, %v", d.Get("state"), d.Get("duration_seconds"))
+	}
+}
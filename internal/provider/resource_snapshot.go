@@ -0,0 +1,247 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// snapshotCreateAttempts bounds how often a snapshot is retried under another name when someone else takes a
+// snapshot of the same name between the check for conflicts and zfs snapshot.
+const snapshotCreateAttempts = 3
+
+func resourceSnapshot() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "A single snapshot of a dataset. The snapshot is tracked by its guid, so it is still found when renamed. " +
+			"`on_conflict` decides what happens when a snapshot of the same name already exists, e.g. when a pipeline runs again. " +
+			"Existing snapshots are imported by their full name, `dataset@name`, and destroyed along with the resource like snapshots it took.",
+
+		CreateContext: resourceSnapshotCreate,
+		ReadContext:   resourceSnapshotRead,
+		UpdateContext: resourceSnapshotUpdate,
+		DeleteContext: resourceSnapshotDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: importStateWithDefaults(resourceSnapshot, resourceSnapshotImport),
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"dataset": {
+				Description: "Name of the dataset to snapshot.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"name": {
+				Description:      "Name of the snapshot, i.e. the part after the `@`.",
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(snapshotPrefixPattern, "must only contain letters, digits, dashes, underscores, periods and colons")),
+			},
+			"recursive": {
+				Description: "Snapshot all descendent datasets as well, and destroy their snapshots along with this one. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+			"on_conflict": {
+				Description: "What to do when a snapshot of the same name already exists: `fail`, `adopt` it, or take the snapshot as `<name>-1`, `<name>-2` and so on with `suffix`. " +
+					"Adopted snapshots weren't taken by terraform, so they are left in place when the resource is destroyed. Defaults to `fail`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          SnapshotConflictFail,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{SnapshotConflictFail, SnapshotConflictAdopt, SnapshotConflictSuffix}, false)),
+			},
+			"snapshot": {
+				Description: "Full name of the snapshot. Differs from `dataset@name` when `on_conflict = \"suffix\"` picked another name, or the snapshot was renamed.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"guid": {
+				Description: "Guid of the snapshot, which stays the same when it is sent elsewhere.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"creation": {
+				Description: "Creation time of the snapshot in RFC 3339 format.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"adopted": {
+				Description: "Whether the snapshot already existed and was adopted instead of taken.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceSnapshotCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	datasetName := d.Get("dataset").(string)
+	name := d.Get("name").(string)
+	onConflict := d.Get("on_conflict").(string)
+
+	flags := ""
+	if d.Get("recursive").(bool) {
+		flags = "-r "
+	}
+
+	for attempt := 1; ; attempt++ {
+		snapshots, err := listSnapshots(config, datasetName)
+		if err != nil {
+			return diagFromErr(err)
+		}
+
+		snapshotName, adopted, err := resolveSnapshotConflict(snapshots, datasetName, name, onConflict)
+		if err != nil {
+			return diagFromErr(err)
+		}
+
+		if adopted != nil {
+			log.Printf("[DEBUG] adopting existing snapshot %s", adopted.name)
+			d.SetId(adopted.guid)
+			if err := d.Set("adopted", true); err != nil {
+				return diagFromErr(err)
+			}
+			return resourceSnapshotRead(ctx, d, meta)
+		}
+
+		_, err = callSshCommandContext(ctx, config, "zfs snapshot %s%s", flags, snapshotName)
+		if err != nil {
+			// Someone else took a snapshot of the same name in the meantime, so resolve the conflict again.
+			if isSnapshotExistsError(err) && onConflict != SnapshotConflictFail && attempt < snapshotCreateAttempts {
+				continue
+			}
+			return diagFromErr(err)
+		}
+
+		snapshots, err = listSnapshots(config, datasetName)
+		if err != nil {
+			return diagFromErr(err)
+		}
+
+		snapshot := findSnapshot(snapshots, snapshotName, "")
+		if snapshot == nil {
+			return diagFromErr(fmt.Errorf("snapshot %s could not be found after it was taken", snapshotName))
+		}
+
+		d.SetId(snapshot.guid)
+		if err := d.Set("adopted", false); err != nil {
+			return diagFromErr(err)
+		}
+		return resourceSnapshotRead(ctx, d, meta)
+	}
+}
+
+func resourceSnapshotRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	snapshots, err := listSnapshots(config, d.Get("dataset").(string))
+	if err != nil {
+		if _, ok := err.(*DatasetError); ok {
+			d.SetId("")
+			return diags
+		}
+		return diagFromErr(err)
+	}
+
+	snapshot := findSnapshot(snapshots, "", d.Id())
+	if snapshot == nil {
+		log.Printf("[DEBUG] snapshot %s with guid %s no longer exists", d.Get("snapshot"), d.Id())
+		d.SetId("")
+		return diags
+	}
+
+	if err := d.Set("snapshot", snapshot.name); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("guid", snapshot.guid); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("creation", time.Unix(snapshot.creation, 0).UTC().Format(time.RFC3339)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceSnapshotImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	config := meta.(*Config)
+
+	datasetName, name, found := strings.Cut(d.Id(), "@")
+	if !found || datasetName == "" || name == "" {
+		return nil, fmt.Errorf("%q is not the full name of a snapshot, expected dataset@name", d.Id())
+	}
+
+	snapshots, err := listSnapshots(config, datasetName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := findSnapshot(snapshots, d.Id(), "")
+	if snapshot == nil {
+		return nil, fmt.Errorf("snapshot %s does not exist", d.Id())
+	}
+
+	d.SetId(snapshot.guid)
+	values := map[string]interface{}{
+		"dataset": datasetName,
+		"name":    name,
+		"adopted": false,
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// resourceSnapshotUpdate only handles changes of on_conflict, which only matters when the snapshot is taken.
+func resourceSnapshotUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return resourceSnapshotRead(ctx, d, meta)
+}
+
+func resourceSnapshotDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+	config := meta.(*Config)
+
+	snapshotName := d.Get("snapshot").(string)
+	if d.Get("adopted").(bool) {
+		log.Printf("[DEBUG] leaving adopted snapshot %s in place", snapshotName)
+		d.SetId("")
+		return diags
+	}
+
+	flags := ""
+	if d.Get("recursive").(bool) {
+		flags = "-r "
+	}
+
+	if _, err := callSshCommandContext(ctx, config, "zfs destroy %s%s", flags, snapshotName); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId("")
+	return diags
+}
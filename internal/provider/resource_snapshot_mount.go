@@ -0,0 +1,236 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// Ways to expose the contents of a snapshot: through the hidden .zfs/snapshot directory of its filesystem, which
+// zfs mounts on first access, or through a read-only clone of it.
+const (
+	SnapshotMountSnapdir = "snapdir"
+	SnapshotMountClone   = "clone"
+)
+
+var snapshotMountMethods = []string{SnapshotMountSnapdir, SnapshotMountClone}
+
+func resourceSnapshotMount() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Exposes the contents of a snapshot at a path, e.g. for jobs which verify backups. " +
+			"With the `snapdir` method the snapshot is accessed through the `.zfs/snapshot` directory of its filesystem, and nothing is created. " +
+			"With the `clone` method a read-only clone of the snapshot is created, which is destroyed with the resource.",
+
+		CreateContext: resourceSnapshotMountCreate,
+		ReadContext:   resourceSnapshotMountRead,
+		DeleteContext: resourceSnapshotMountDelete,
+
+		CustomizeDiff: resourceSnapshotMountCustomizeDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"snapshot": {
+				Description: "Full name of the snapshot, e.g. `tank/data@nightly`.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"method": {
+				Description:      "How to expose the snapshot: `snapdir` or `clone`. Snapshots of volumes can only be cloned. Defaults to `snapdir`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				Default:          SnapshotMountSnapdir,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(snapshotMountMethods, false)),
+			},
+			"clone_name": {
+				Description: "Name of the clone to create, which must be in the same pool as the snapshot. Required with the `clone` method.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"mountpoint": {
+				Description: "Mountpoint of the clone. Defaults to the mountpoint inherited from its parent. Only used with the `clone` method.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"path": {
+				Description: "Path the contents of the snapshot can be read at, or the device path of a cloned volume.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceSnapshotMountCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !strings.Contains(d.Get("snapshot").(string), "@") && d.NewValueKnown("snapshot") {
+		return fmt.Errorf("snapshot must be the full name of a snapshot, got %q", d.Get("snapshot"))
+	}
+
+	method := d.Get("method").(string)
+	if method == SnapshotMountClone && d.NewValueKnown("clone_name") && d.Get("clone_name").(string) == "" {
+		return fmt.Errorf("clone_name is required with the %s method", SnapshotMountClone)
+	}
+	if method == SnapshotMountSnapdir && (d.Get("clone_name").(string) != "" || d.Get("mountpoint").(string) != "") {
+		return fmt.Errorf("clone_name and mountpoint can only be used with the %s method", SnapshotMountClone)
+	}
+	return nil
+}
+
+// snapshotDirectoryPath returns the path of a snapshot below the .zfs/snapshot directory of its filesystem.
+func snapshotDirectoryPath(config *Config, snapshotName string) (string, error) {
+	parts := strings.SplitN(snapshotName, "@", 2)
+
+	stdout, err := callSshCommand(config, "zfs get -H -o value type,mountpoint %s", shellescape.Quote(parts[0]))
+	if err != nil {
+		return "", err
+	}
+
+	values := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(values) != 2 {
+		return "", fmt.Errorf("unexpected zfs get output %q", stdout)
+	}
+	if values[0] != "filesystem" {
+		return "", fmt.Errorf("%s is a %s, so its snapshots can only be cloned", parts[0], values[0])
+	}
+	if !strings.HasPrefix(values[1], "/") {
+		return "", fmt.Errorf("%s has mountpoint %s, so it has no .zfs/snapshot directory", parts[0], values[1])
+	}
+
+	return strings.TrimSuffix(values[1], "/") + "/.zfs/snapshot/" + parts[1], nil
+}
+
+func resourceSnapshotMountCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	snapshotName := d.Get("snapshot").(string)
+	snapshots, err := listSnapshots(config, strings.SplitN(snapshotName, "@", 2)[0])
+	if err != nil {
+		return diagFromErr(err)
+	}
+	snapshot := findSnapshot(snapshots, snapshotName, "")
+	if snapshot == nil {
+		return diagFromErr(fmt.Errorf("snapshot %s does not exist", snapshotName))
+	}
+
+	if d.Get("method").(string) == SnapshotMountSnapdir {
+		path, err := snapshotDirectoryPath(config, snapshotName)
+		if err != nil {
+			return diagFromErr(err)
+		}
+
+		// The snapshot is mounted when its directory is first accessed.
+		if _, err := callSshCommandContext(ctx, config, "ls -d %s/.", shellescape.Quote(path)); err != nil {
+			return diagFromErr(err)
+		}
+
+		d.SetId(snapshot.guid)
+		return resourceSnapshotMountRead(ctx, d, meta)
+	}
+
+	cloneName := d.Get("clone_name").(string)
+	options := "-o readonly=on"
+	if mountpoint := d.Get("mountpoint").(string); mountpoint != "" {
+		options += " -o mountpoint=" + shellescape.Quote(mountpoint)
+	}
+
+	if _, err := callSshCommandContext(ctx, config, "zfs clone %s %s %s", options, shellescape.Quote(snapshotName), shellescape.Quote(cloneName)); err != nil {
+		return diagFromErr(err)
+	}
+
+	clone, err := describeDataset(config, cloneName, nil)
+	if err != nil {
+		return diagFromErr(err)
+	}
+	d.SetId(clone.guid)
+
+	return resourceSnapshotMountRead(ctx, d, meta)
+}
+
+func resourceSnapshotMountRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	snapshotName := d.Get("snapshot").(string)
+
+	if d.Get("method").(string) == SnapshotMountSnapdir {
+		snapshots, err := listSnapshots(config, strings.SplitN(snapshotName, "@", 2)[0])
+		if _, ok := err.(*DatasetError); err != nil && !ok {
+			return diagFromErr(err)
+		}
+		if findSnapshot(snapshots, "", d.Id()) == nil {
+			log.Printf("[WARN] snapshot %s is gone, removing it from the state", snapshotName)
+			d.SetId("")
+			return diags
+		}
+
+		path, err := snapshotDirectoryPath(config, snapshotName)
+		if err != nil {
+			return diagFromErr(err)
+		}
+		if err := d.Set("path", path); err != nil {
+			return diagFromErr(err)
+		}
+		return diags
+	}
+
+	cloneName, err := getDatasetNameByGuid(config, d.Get("clone_name").(string), d.Id())
+	if err != nil {
+		return diagFromErr(fmt.Errorf("the clone %s of %s identified by guid %s could not be found. It was likely deleted on the server outside of terraform", d.Get("clone_name"), snapshotName, d.Id()))
+	}
+
+	clone, err := describeDataset(config, *cloneName, nil)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	path := clone.mountpoint
+	if clone.dsType == VolumeType {
+		path = volumeDevicePath(config, *cloneName)
+	}
+
+	if err := d.Set("clone_name", *cloneName); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("path", path); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceSnapshotMountDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	// zfs unmounts snapshots below .zfs/snapshot by itself after a while, so there is nothing to clean up.
+	if d.Get("method").(string) == SnapshotMountClone {
+		cloneName := d.Get("clone_name").(string)
+		log.Printf("[DEBUG] destroying clone %s of %s", cloneName, d.Get("snapshot"))
+		if _, err := callSshCommandContext(ctx, config, "zfs destroy %s", shellescape.Quote(cloneName)); err != nil {
+			if _, ok := err.(*DatasetError); !ok {
+				return diagFromErr(err)
+			}
+		}
+	}
+
+	d.SetId("")
+	return diags
+}
@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceSnapshotPolicy() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Takes a snapshot of a dataset on every apply, and prunes older snapshots taken by the same policy according to hourly, daily and weekly retention counts. " +
+			"Snapshots are named `<prefix>-<timestamp>` in UTC, and only snapshots matching that pattern are ever pruned. The latest snapshot is always kept. Destroying the resource leaves the snapshots in place.",
+
+		CreateContext: resourceSnapshotPolicyCreate,
+		ReadContext:   resourceSnapshotPolicyRead,
+		UpdateContext: resourceSnapshotPolicyUpdate,
+		DeleteContext: resourceSnapshotPolicyDelete,
+
+		CustomizeDiff: resourceSnapshotPolicyCustomizeDiff,
+
+		Schema: map[string]*schema.Schema{
+			"dataset": {
+				Description: "Name of the dataset to snapshot.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"prefix": {
+				Description:      "Prefix of the snapshot names, which tells the snapshots of this policy apart from others. Defaults to `tf`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				Default:          "tf",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(snapshotPrefixPattern, "must only contain letters, digits, dashes, underscores, periods and colons")),
+			},
+			"recursive": {
+				Description: "Snapshot and prune all descendent datasets as well. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+			"keep_hourly": {
+				Description: "Number of hours to keep the newest snapshot of. Defaults to `0`.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+			},
+			"keep_daily": {
+				Description: "Number of days to keep the newest snapshot of. Defaults to `0`.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+			},
+			"keep_weekly": {
+				Description: "Number of weeks to keep the newest snapshot of. Defaults to `0`.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+			},
+			"latest_snapshot": {
+				Description: "Full name of the most recent snapshot taken by the policy.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"snapshots": {
+				Description: "Full names of the snapshots of the policy which currently exist, oldest first.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// resourceSnapshotPolicyCustomizeDiff marks the latest snapshot as unknown on every plan, so that every apply
+// updates the policy and takes a new snapshot.
+func resourceSnapshotPolicyCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" {
+		return nil
+	}
+
+	if err := d.SetNewComputed("latest_snapshot"); err != nil {
+		return err
+	}
+	return d.SetNewComputed("snapshots")
+}
+
+func resourceSnapshotPolicyCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	d.SetId(fmt.Sprintf("%s@%s", d.Get("dataset").(string), d.Get("prefix").(string)))
+	return resourceSnapshotPolicyUpdate(ctx, d, meta)
+}
+
+func resourceSnapshotPolicyRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	datasetName := d.Get("dataset").(string)
+	snapshots, err := listSnapshots(config, datasetName)
+	if err != nil {
+		if _, ok := err.(*DatasetError); ok {
+			d.SetId("")
+			return diags
+		}
+		return diagFromErr(err)
+	}
+
+	snapshots = filterPolicySnapshots(snapshots, datasetName, d.Get("prefix").(string))
+
+	names := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.name)
+	}
+
+	latest := ""
+	if len(names) > 0 {
+		latest = names[len(names)-1]
+	}
+
+	if err := d.Set("latest_snapshot", latest); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("snapshots", names); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceSnapshotPolicyUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	datasetName := d.Get("dataset").(string)
+	prefix := d.Get("prefix").(string)
+
+	flags := ""
+	if d.Get("recursive").(bool) {
+		flags = "-r "
+	}
+
+	name := policySnapshotName(datasetName, prefix, time.Now())
+	if _, err := callSshCommandContext(ctx, config, "zfs snapshot %s%s", flags, name); err != nil {
+		return diagFromErr(err)
+	}
+
+	snapshots, err := listSnapshots(config, datasetName)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	_, pruned := applyRetention(filterPolicySnapshots(snapshots, datasetName, prefix), Retention{
+		hourly: d.Get("keep_hourly").(int),
+		daily:  d.Get("keep_daily").(int),
+		weekly: d.Get("keep_weekly").(int),
+	})
+
+	if len(pruned) > 0 {
+		// zfs destroy takes several snapshots of the same dataset as dataset@first,second,...
+		names := make([]string, 0, len(pruned))
+		for _, snapshot := range pruned {
+			names = append(names, strings.SplitN(snapshot.name, "@", 2)[1])
+		}
+
+		log.Printf("[DEBUG] pruning %d snapshots of %s", len(names), datasetName)
+		if _, err := callSshCommandContext(ctx, config, "zfs destroy %s%s@%s", flags, datasetName, strings.Join(names, ",")); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	return resourceSnapshotPolicyRead(ctx, d, meta)
+}
+
+func resourceSnapshotPolicyDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+	return diags
+}
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceStageVerification() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "The verify stage of evacuating a pool or dataset into another. Creating it checks that every filesystem and volume below `source` exists below `target`, " +
+			"that its newest snapshot was replicated, and that nothing was written to it since. On success the target is recorded in the `terraform:verified` user property of the source, " +
+			"which a `zfs_pool` in the `destroy` stage requires before it may be destroyed. Destroying the resource leaves the property in place.",
+
+		CreateContext: resourceStageVerificationCreate,
+		ReadContext:   resourceStageVerificationRead,
+		DeleteContext: resourceStageVerificationDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"source": {
+				Description: "Name of the pool or dataset being evacuated.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"target": {
+				Description: "Name of the dataset the source is replicated into. Datasets below the source are expected at the same path below the target.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"triggers": {
+				Description: "Arbitrary values which verify the replication again when changed, e.g. the id of the resource replicating it.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"verified_datasets": {
+				Description: "Names of the source datasets which were verified.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"verified_at": {
+				Description: "Time of the verification in RFC 3339 format.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceStageVerificationCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	source := d.Get("source").(string)
+	target := d.Get("target").(string)
+
+	verified, err := verifyReplication(config, source, target)
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	log.Printf("[DEBUG] verified replication of %d datasets from %s into %s", len(verified), source, target)
+	if _, err := callSshCommandContext(ctx, config, "zfs set %s=%s %s", verifiedProperty, shellescape.Quote(target), shellescape.Quote(source)); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(source + ":" + target)
+
+	if err := d.Set("verified_datasets", verified); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("verified_at", time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceStageVerificationRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	// The verification happened when the resource was created, there's nothing on the host to refresh.
+	return diags
+}
+
+func resourceStageVerificationDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	// The verified property is left on the source, so the apply which removes this resource can still destroy it.
+	d.SetId("")
+	return diags
+}
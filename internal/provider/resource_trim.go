@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// trimPollInterval is how often zpool status is checked while waiting for a trim to finish.
+const trimPollInterval = 10 * time.Second
+
+func resourceTrim() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "Starts a manual trim of a pool when created, and reports its progress. Change `triggers` to start another trim. Destroying the resource does not affect the pool. To trim continuously instead, set the `autotrim` property of the pool to `on`.",
+
+		CreateContext: resourceTrimCreate,
+		ReadContext:   resourceTrimRead,
+		UpdateContext: resourceTrimUpdate,
+		DeleteContext: resourceTrimDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"pool": {
+				Description: "Name of the pool to trim.",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"devices": {
+				Description: "Devices of the pool to trim. Defaults to every device which supports trim.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"rate": {
+				Description:      "Limit the trim of each device to this many bytes per second, e.g. `100M`. Defaults to no limit.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				ValidateDiagFunc: validateSize,
+			},
+			"secure": {
+				Description: "Perform a secure trim, which fails unless every device supports it. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+			"triggers": {
+				Description: "Arbitrary values which start a new trim when changed.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"wait_for_completion": {
+				Description: "Wait for the trim to finish before completing the apply, up to the create timeout. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"state": {
+				Description: "State of the trim, one of `in_progress`, `suspended`, `finished`, `none` or `unsupported`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"progress": {
+				Description: "Percentage of the trim which has completed, averaged over the devices which support trim.",
+				Type:        schema.TypeFloat,
+				Computed:    true,
+			},
+			"device_progress": {
+				Description: "Trim progress of every device in the pool.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Description: "Path of the device.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"state": {
+							Description: "State of the trim of the device.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"progress": {
+							Description: "Percentage of the device which has been trimmed.",
+							Type:        schema.TypeFloat,
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func resourceTrimCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	config := meta.(*Config)
+
+	poolName := d.Get("pool").(string)
+	if err := startTrim(config, poolName, expandStringList(d.Get("devices").([]interface{})), d.Get("rate").(string), d.Get("secure").(bool)); err != nil {
+		return diagFromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s:%d", poolName, time.Now().Unix()))
+
+	if d.Get("wait_for_completion").(bool) {
+		deadline := time.Now().Add(d.Timeout(schema.TimeoutCreate))
+		for {
+			trims, err := readDeviceTrims(config, poolName)
+			if err != nil {
+				return diagFromErr(err)
+			}
+
+			state, progress := summarizeTrims(trims)
+			if state != TrimInProgress {
+				break
+			}
+
+			log.Printf("[DEBUG] trim of %s is %.2f%% done", poolName, progress)
+			if time.Now().Add(trimPollInterval).After(deadline) {
+				return diag.Errorf("timed out waiting for the trim of %s to finish, it is %.2f%% done", poolName, progress)
+			}
+
+			select {
+			case <-ctx.Done():
+				return diagFromErr(ctx.Err())
+			case <-time.After(trimPollInterval):
+			}
+		}
+	}
+
+	return resourceTrimRead(ctx, d, meta)
+}
+
+func resourceTrimRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	config := meta.(*Config)
+
+	trims, err := readDeviceTrims(config, d.Get("pool").(string))
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	state, progress := summarizeTrims(trims)
+	if err := d.Set("state", string(state)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("progress", progress); err != nil {
+		return diagFromErr(err)
+	}
+
+	devices := make([]map[string]interface{}, 0)
+	for _, trim := range trims {
+		devices = append(devices, map[string]interface{}{
+			"path":     trim.path,
+			"state":    string(trim.state),
+			"progress": trim.progress,
+		})
+	}
+	if err := d.Set("device_progress", devices); err != nil {
+		return diagFromErr(err)
+	}
+
+	return diags
+}
+
+func resourceTrimUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// Only wait_for_completion can change without starting a new trim, and it only matters on create.
+	return resourceTrimRead(ctx, d, meta)
+}
+
+func resourceTrimDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+	return diags
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -20,9 +21,18 @@ func resourceVolume() *schema.Resource {
 		DeleteContext: resourceVolumeDelete,
 
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: importStateWithDefaults(resourceVolume, schema.ImportStatePassthroughContext),
 		},
 
+		// Retries of transient errors such as busy pools stop once the timeout of the operation has passed.
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		CustomizeDiff: resourceDatasetCustomizeDiff,
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				// This description is used by the documentation generator and the language server.
@@ -42,10 +52,36 @@ func resourceVolume() *schema.Resource {
 				Optional:    true,
 				Default:     false,
 			},
-			"property":       &propertySchema,
-			"property_mode":  &propertyModeSchema,
-			"properties":     &propertiesSchema,
-			"raw_properties": &rawPropertiesSchema,
+			"wait_for_device_timeout": {
+				Description:      "How long to wait for the device node of the volume to appear after it is created or renamed, so that resources using `device_path` don't race udev. `0s` doesn't wait. Volumes with `volmode` set to `none` have no device node and are never waited for. Defaults to `1m`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "1m",
+				ValidateDiagFunc: validateDuration,
+			},
+			"device_path": {
+				Description: "Path of the device node of the volume, e.g. `/dev/zvol/tank/disk`. It exists once the volume is created, unless waiting for it was disabled.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"force_destroy":              &forceDestroySchema,
+			"create_parents":             &createParentsSchema,
+			"allow_external_rename":      &allowExternalRenameSchema,
+			"rename_on_name_change":      &renameOnNameChangeSchema,
+			"force_unmount_on_rename":    &forceUnmountOnRenameSchema,
+			"current_name":               &currentNameSchema,
+			"expires_at":                 &expiresAtSchema,
+			"metadata":                   &metadataSchema,
+			"metadata_property":          &metadataPropertySchema,
+			"property":                   &propertySchema,
+			"property_mode":              &propertyModeSchema,
+			"drift_detection":            &driftDetectionSchema,
+			"sensitive_properties":       &sensitivePropertiesSchema,
+			"sensitive_property_storage": &sensitivePropertyStorageSchema,
+			"properties":                 &propertiesSchema,
+			"raw_properties":             &rawPropertiesSchema,
+			"properties_numeric":         &numericPropertiesSchema,
+			"property_sources":           &propertySourcesSchema,
 		},
 	}
 }
@@ -68,13 +104,13 @@ func resourceVolumeCreate(ctx context.Context, d *schema.ResourceData, meta inte
 			{
 				if err.errmsg != "dataset does not exist" {
 					log.Printf("[DEBUG] zfs err: %s", err.Error())
-					return diag.FromErr(err)
+					return diagFromErr(err)
 				}
 			}
 		default:
 			{
 				log.Printf("[DEBUG] zfs err: %s", err.Error())
-				return diag.FromErr(err)
+				return diagFromErr(err)
 			}
 		}
 	}
@@ -82,16 +118,24 @@ func resourceVolumeCreate(ctx context.Context, d *schema.ResourceData, meta inte
 	volsize := d.Get("volsize").(string)
 	sparse := d.Get("sparse").(bool)
 	properties := parsePropertyBlocks(d.Get("property").(*schema.Set).List())
-	volume, err = createDataset(config, &CreateDataset{
-		dsType:     VolumeType,
-		name:       volumeName,
-		volsize:    volsize,
-		sparse:     sparse,
-		properties: properties,
+	if err := addMetadataProperty(d, properties); err != nil {
+		return diagFromErr(err)
+	}
+	addExpiresAtProperty(d, properties)
+	for name, value := range sensitivePropertyValues(config, d.Get("sensitive_properties")) {
+		properties[name] = value
+	}
+	volume, err = createDataset(ctx, config, &CreateDataset{
+		dsType:        VolumeType,
+		name:          volumeName,
+		volsize:       volsize,
+		sparse:        sparse,
+		createParents: d.Get("create_parents").(bool),
+		properties:    properties,
 	})
 
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	// We're setting the ID here because the volume DOES exist, even if the mountpoint
@@ -99,6 +143,14 @@ func resourceVolumeCreate(ctx context.Context, d *schema.ResourceData, meta inte
 	log.Printf("[DEBUG] committing guid: %s", volume.guid)
 	d.SetId(volume.guid)
 
+	if err := waitForVolumeDevice(ctx, config, d, volumeName); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := d.Set("device_path", volumeDevicePath(config, volumeName)); err != nil {
+		return diagFromErr(err)
+	}
+
 	return diags
 }
 
@@ -107,32 +159,53 @@ func resourceVolumeRead(ctx context.Context, d *schema.ResourceData, meta interf
 
 	config := meta.(*Config)
 
-	volumeName := d.Get("name").(string)
+	volumeName := currentDatasetName(d)
 	if id := d.Id(); id != "" {
 		// If we have a Resource ID, then use that to lookup the real name
 		// of the zfs resource, in case the name has changed.
-		real_name, err := getDatasetNameByGuid(config, id)
+		real_name, err := getDatasetNameByGuid(config, volumeName, id)
 		if err != nil {
-			return diag.FromErr(fmt.Errorf("the volume %s identified by guid %s could not be found. It was likely deleted on the server outside of terraform", volumeName, id))
+			return diagFromErr(fmt.Errorf("the volume %s identified by guid %s could not be found. It was likely deleted on the server outside of terraform", volumeName, id))
 		}
 		volumeName = *real_name
 	}
 
-	if err := d.Set("name", volumeName); err != nil {
-		return diag.FromErr(err)
+	if err := reconcileDatasetName(d, volumeName); err != nil {
+		return diagFromErr(err)
 	}
 
-	volume, err := describeDataset(config, volumeName, getPropertyNames(d))
+	if !isNewOrFullRead(d) {
+		return diags
+	}
+
+	volume, err := describeDataset(config, volumeName, append(getPropertyNames(d), sensitivePropertyNames(d)...))
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+	sensitive := takeSensitiveProperties(config, d, volume.properties)
+
+	if err = d.Set("device_path", volumeDevicePath(config, volumeName)); err != nil {
+		return diagFromErr(err)
 	}
 
 	if err = d.Set("volsize", volume.volsize); err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+
+	if err := updateExpiresAtInState(d, volume.properties); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := updateMetadataInState(d, volume.properties); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := updateSensitivePropertiesInState(d, sensitive); err != nil {
+		return diagFromErr(err)
 	}
 
-	if err := updatePropertiesInState(d, volume.properties, []string{"volsize"}); err != nil {
-		return diag.FromErr(err)
+	if err := updatePropertiesInState(d, driftProperties(d, volume.properties, []string{"volsize", expiresAtProperty, d.Get("metadata_property").(string)}), []string{"volsize", expiresAtProperty, d.Get("metadata_property").(string)}); err != nil {
+		return diagFromErr(err)
 	}
 
 	d.SetId(volume.guid)
@@ -141,28 +214,51 @@ func resourceVolumeRead(ctx context.Context, d *schema.ResourceData, meta interf
 
 func resourceVolumeUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	config := meta.(*Config)
-	old_name, err := getDatasetNameByGuid(config, d.Id())
+	old_name, err := getDatasetNameByGuid(config, currentDatasetName(d), d.Id())
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
-	volumeName := d.Get("name").(string)
-	// Rename the volume
-	if volumeName != *old_name {
-		if err := renameDataset(config, *old_name, volumeName); err != nil {
-			return diag.FromErr(err)
+	volumeName := *old_name
+	// Rename the volume, unless only its name in the state differs because an external rename was adopted
+	if d.HasChange("name") && d.Get("name").(string) != *old_name {
+		volumeName = d.Get("name").(string)
+		if err := renameDataset(ctx, config, *old_name, volumeName, d.Get("create_parents").(bool), d.Get("force_unmount_on_rename").(bool)); err != nil {
+			return diagFromErr(err)
+		}
+		if err := waitForVolumeDevice(ctx, config, d, volumeName); err != nil {
+			return diagFromErr(err)
 		}
 	}
 
-	volume, err := describeDataset(config, volumeName, getPropertyNames(d))
+	volume, err := describeDataset(config, volumeName, append(getPropertyNames(d), sensitivePropertyNames(d)...))
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
+	sensitive := takeSensitiveProperties(config, d, volume.properties)
 
 	overrideProperties := map[string]string{"volsize": d.Get("volsize").(string)}
+	if err := resetMetadataProperty(config, d, volumeName); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := resetExpiresAtProperty(config, d, volumeName); err != nil {
+		return diagFromErr(err)
+	}
+	addExpiresAtProperty(d, overrideProperties)
+
+	if err := addMetadataProperty(d, overrideProperties); err != nil {
+		return diagFromErr(err)
+	}
+
 	err = applyPropertyDiff(config, d, volumeName, volume.properties, overrideProperties)
 	if err != nil {
-		return diag.FromErr(err)
+		// Refresh the state first, so it reflects the properties which were applied despite the failures.
+		return append(resourceVolumeRead(ctx, d, meta), diagFromErr(err)...)
+	}
+
+	if err := applySensitivePropertyDiff(config, d, volumeName, sensitive); err != nil {
+		return append(resourceVolumeRead(ctx, d, meta), diagFromErr(err)...)
 	}
 
 	return resourceVolumeRead(ctx, d, meta)
@@ -171,13 +267,44 @@ func resourceVolumeUpdate(ctx context.Context, d *schema.ResourceData, meta inte
 func resourceVolumeDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 	config := meta.(*Config)
-	volumeName := d.Get("name").(string)
+	volumeName := currentDatasetName(d)
 
-	if err := destroyDataset(config, volumeName); err != nil {
-		return diag.FromErr(err)
+	if err := checkDestroySafe(config, volumeName, d.Get("force_destroy").(bool)); err != nil {
+		return diagFromErr(err)
+	}
+
+	if err := destroyDataset(ctx, config, volumeName); err != nil {
+		return diagFromErr(err)
 	}
 
 	d.SetId("")
 
 	return diags
 }
+
+// volumeDevicePath returns the device node of a volume. illumos has separate block and raw device nodes, of which
+// the block device is the one to use like the others.
+func volumeDevicePath(config *Config, volumeName string) string {
+	if hostPlatform(config) == PlatformIllumos {
+		return "/dev/zvol/dsk/" + volumeName
+	}
+	return "/dev/zvol/" + volumeName
+}
+
+// waitForVolumeDevice waits for the device node of a volume to appear, for up to wait_for_device_timeout.
+func waitForVolumeDevice(ctx context.Context, config *Config, d *schema.ResourceData, volumeName string) error {
+	timeout := d.Get("wait_for_device_timeout").(string)
+	if duration, err := time.ParseDuration(timeout); err != nil || duration == 0 {
+		return err
+	}
+
+	for _, block := range d.Get("property").(*schema.Set).List() {
+		property := block.(map[string]interface{})
+		if property["name"] == "volmode" && property["value"] == "none" {
+			return nil
+		}
+	}
+
+	path := volumeDevicePath(config, volumeName)
+	return waitForDevices(ctx, config, map[string]Device{path: {path: path, waitTimeout: timeout}})
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var snapshotPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// snapshotTimestampLayout is the format of the timestamp in the names of snapshots taken by a snapshot policy.
+const snapshotTimestampLayout = "2006-01-02_15-04-05"
+
+type Retention struct {
+	hourly int
+	daily  int
+	weekly int
+}
+
+// policySnapshotName names a snapshot taken by a policy, e.g. tank/data@tf-2023-10-15_12-00-00.
+func policySnapshotName(datasetName string, prefix string, now time.Time) string {
+	return fmt.Sprintf("%s@%s-%s", datasetName, prefix, now.UTC().Format(snapshotTimestampLayout))
+}
+
+// isPolicySnapshot reports whether a snapshot was named by the policy with the given prefix.
+func isPolicySnapshot(name string, datasetName string, prefix string) bool {
+	timestamp := strings.TrimPrefix(name, datasetName+"@"+prefix+"-")
+	if timestamp == name {
+		return false
+	}
+	_, err := time.Parse(snapshotTimestampLayout, timestamp)
+	return err == nil
+}
+
+// filterPolicySnapshots returns the snapshots named by a policy, keeping their order.
+func filterPolicySnapshots(snapshots []Snapshot, datasetName string, prefix string) []Snapshot {
+	filtered := make([]Snapshot, 0)
+	for _, snapshot := range snapshots {
+		if isPolicySnapshot(snapshot.name, datasetName, prefix) {
+			filtered = append(filtered, snapshot)
+		}
+	}
+	return filtered
+}
+
+// applyRetention splits snapshots, given oldest first, into those to keep and those to prune. For each
+// period it keeps the newest snapshot of each of the most recent hours, days or (ISO) weeks which have
+// snapshots, up to the configured count. The newest snapshot is always kept.
+func applyRetention(snapshots []Snapshot, retention Retention) ([]Snapshot, []Snapshot) {
+	periods := []struct {
+		count  int
+		bucket func(time.Time) string
+	}{
+		{retention.hourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{retention.daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{retention.weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+	}
+
+	keep := make(map[string]bool)
+	if len(snapshots) > 0 {
+		keep[snapshots[len(snapshots)-1].name] = true
+	}
+
+	for _, period := range periods {
+		seen := make(map[string]bool)
+		for i := len(snapshots) - 1; i >= 0 && len(seen) < period.count; i-- {
+			bucket := period.bucket(time.Unix(snapshots[i].creation, 0).UTC())
+			if !seen[bucket] {
+				seen[bucket] = true
+				keep[snapshots[i].name] = true
+			}
+		}
+	}
+
+	kept := make([]Snapshot, 0)
+	pruned := make([]Snapshot, 0)
+	for _, snapshot := range snapshots {
+		if keep[snapshot.name] {
+			kept = append(kept, snapshot)
+		} else {
+			pruned = append(pruned, snapshot)
+		}
+	}
+	return kept, pruned
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestIsPolicySnapshot verifies that only snapshots named by the policy prefix and timestamp format are matched.
+func TestIsPolicySnapshot(t *testing.T) {
+	name := policySnapshotName("tank/data", "tf", time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC))
+	if name != "tank/data@tf-2023-10-15_12-00-00" {
+		t.Fatalf("unexpected snapshot name %s", name)
+	}
+
+	cases := map[string]bool{
+		name:                                true,
+		"tank/data@tf-manual":               false,
+		"tank/data@tfx-2023-10-15_12-00-00": false,
+		"tank/other@tf-2023-10-15_12-00-00": false,
+	}
+	for snapshot, expected := range cases {
+		if isPolicySnapshot(snapshot, "tank/data", "tf") != expected {
+			t.Fatalf("expected isPolicySnapshot(%s) to be %t", snapshot, expected)
+		}
+	}
+}
+
+// TestApplyRetention verifies that the newest snapshot of each recent hour, day and week is kept, and the rest pruned.
+func TestApplyRetention(t *testing.T) {
+	start := time.Date(2023, 10, 9, 0, 30, 0, 0, time.UTC) // Monday
+	snapshots := make([]Snapshot, 0)
+	// Two snapshots an hour, for 8 days.
+	for i := 0; i < 8*48; i++ {
+		created := start.Add(time.Duration(i) * 30 * time.Minute)
+		snapshots = append(snapshots, Snapshot{name: policySnapshotName("tank", "tf", created), creation: created.Unix()})
+	}
+
+	kept, pruned := applyRetention(snapshots, Retention{hourly: 3, daily: 2, weekly: 2})
+	if len(kept)+len(pruned) != len(snapshots) {
+		t.Fatalf("expected every snapshot to be kept or pruned")
+	}
+
+	names := make([]string, 0)
+	for _, snapshot := range kept {
+		names = append(names, snapshot.name)
+	}
+	expected := []string{
+		"tank@tf-2023-10-15_23-30-00", // newest of week 41
+		"tank@tf-2023-10-16_22-30-00", // hourly
+		"tank@tf-2023-10-16_23-30-00", // hourly and newest of Monday
+		"tank@tf-2023-10-17_00-00-00", // newest overall
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+
+	kept, _ = applyRetention(snapshots, Retention{})
+	if len(kept) != 1 || kept[0].name != snapshots[len(snapshots)-1].name {
+		t.Fatalf("expected only the newest snapshot to be kept, got %v", kept)
+	}
+}
@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// Methods of rewriting the existing data of a filesystem.
+const (
+	RewriteMethodRewrite = "rewrite"
+	RewriteMethodCopy    = "copy"
+)
+
+var rewriteMethods = []string{RewriteMethodRewrite, RewriteMethodCopy}
+
+type RewriteState string
+
+const (
+	RewriteInProgress RewriteState = "in_progress"
+	RewriteFinished   RewriteState = "finished"
+	RewriteFailed     RewriteState = "failed"
+)
+
+// rewriteLogDirectory holds the output of rewrites running in the background, as they outlive the ssh session. Each
+// job gets a private directory in it, see createJobDirectory.
+const rewriteLogDirectory = "/var/tmp"
+
+// rewriteJobPrefix starts the names of the directories of rewrite jobs.
+const rewriteJobPrefix = "terraform-zfs-rewrite"
+
+// RewriteJob is a rewrite running in the background on the host. Its output is written next to logPath: .log lists
+// the rewritten files, .err has the errors and .exit the exit code once it has finished.
+type RewriteJob struct {
+	logPath string
+	root    string
+	method  string
+}
+
+// fileFilter is the find expression of the files the job rewrites. Files with several hard links are skipped by
+// the copy method, as copying them would break the links.
+func (job RewriteJob) fileFilter() string {
+	if job.method == RewriteMethodCopy {
+		return "-type f -links 1"
+	}
+	return "-type f"
+}
+
+// command returns the command rewriting the files. zfs rewrite (OpenZFS 2.4) rewrites blocks in place, keeping
+// file contents and metadata. The copy method replaces every file by a copy of itself instead, which works with
+// any version, but isn't safe for files which are written to at the same time. Listing xattr explicitly makes cp fail
+// rather than silently drop extended attributes it can't copy, ACLs are kept along with the mode.
+func (job RewriteJob) command() string {
+	if job.method == RewriteMethodCopy {
+		copy := `cp -a --preserve=all,xattr --reflink=never "$1" "$1.tf-rewrite" && mv "$1.tf-rewrite" "$1" && echo "$1"`
+		return fmt.Sprintf("find %s -xdev %s -exec sh -c %s _ {} \\;", shellescape.Quote(job.root), job.fileFilter(), shellescape.Quote(copy))
+	}
+	return fmt.Sprintf("zfs rewrite -r -v -x %s", shellescape.Quote(job.root))
+}
+
+// rewriteRoot returns the directory or file to rewrite, which is path relative to the mountpoint of the dataset.
+func rewriteRoot(config *Config, datasetName string, relativePath string) (string, error) {
+	properties := make(map[string]Property)
+	if err := readSomeProperties(config, "zfs", datasetName, "mountpoint,mounted", properties); err != nil {
+		return "", err
+	}
+	if properties["mounted"].value != "yes" {
+		return "", fmt.Errorf("%s must be mounted to rewrite its data", datasetName)
+	}
+
+	cleaned := path.Clean("/" + relativePath)
+	return strings.TrimSuffix(path.Join(properties["mountpoint"].value, cleaned), "/"), nil
+}
+
+// rewriteSupported reports whether the zfs command on the host has the rewrite subcommand.
+func rewriteSupported(config *Config) (bool, error) {
+	stdout, err := callSshCommand(config, "zfs 2>&1 | grep -c '^[[:space:]]*rewrite' || true")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(stdout) != "0" && strings.TrimSpace(stdout) != "", nil
+}
+
+func countRewriteFiles(config *Config, job RewriteJob) (int64, error) {
+	stdout, err := callSshCommand(config, "find %s -xdev %s 2>/dev/null | wc -l", shellescape.Quote(job.root), job.fileFilter())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(stdout), 10, 64)
+}
+
+// startRewrite runs the job in the background, so it isn't bound by the timeout of a single command.
+func startRewrite(config *Config, job RewriteJob) error {
+	logPath := job.logPath
+	script := fmt.Sprintf("%s > %s.log 2> %s.err; echo $? > %s.exit", job.command(), logPath, logPath, logPath)
+	_, err := callSshCommand(config, "nohup sh -c %s > /dev/null 2>&1 &", shellescape.Quote(script))
+	return err
+}
+
+// RewriteProgress is how far a rewrite job has come.
+type RewriteProgress struct {
+	state     RewriteState
+	rewritten int64
+	errors    string
+}
+
+// parseRewriteProgress parses the output of readRewriteProgress: the number of rewritten files, the exit code
+// (empty while running), and the errors, separated by lines containing only "--".
+func parseRewriteProgress(output string) (*RewriteProgress, error) {
+	parts := strings.SplitN(output, "\n--\n", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("unexpected rewrite progress output %q", output)
+	}
+
+	progress := &RewriteProgress{state: RewriteInProgress, errors: strings.TrimSpace(parts[2])}
+	if rewritten := strings.TrimSpace(parts[0]); rewritten != "" {
+		value, err := strconv.ParseInt(rewritten, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number of rewritten files %q", rewritten)
+		}
+		progress.rewritten = value
+	}
+
+	switch exitCode := strings.TrimSpace(parts[1]); exitCode {
+	case "":
+	case "0":
+		progress.state = RewriteFinished
+	default:
+		progress.state = RewriteFailed
+	}
+	return progress, nil
+}
+
+func readRewriteProgress(config *Config, job RewriteJob) (*RewriteProgress, error) {
+	logPath := job.logPath
+	stdout, err := callSshCommand(config, "cat %s.log 2>/dev/null | wc -l; echo --; cat %s.exit 2>/dev/null; echo --; tail -n 5 %s.err 2>/dev/null || true", logPath, logPath, logPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseRewriteProgress(stdout)
+}
+
+// removeRewriteLogs removes the directory of the job. Rewrites started before jobs had their own directory only
+// have their logs removed.
+func removeRewriteLogs(config *Config, job RewriteJob) error {
+	if directory := path.Dir(job.logPath); isJobDirectory(directory, rewriteLogDirectory, rewriteJobPrefix) {
+		_, err := callSshCommand(config, "rm -rf %s", shellescape.Quote(directory))
+		return err
+	}
+
+	logPath := shellescape.Quote(job.logPath)
+	_, err := callSshCommand(config, "rm -f %s.log %s.err %s.exit", logPath, logPath, logPath)
+	return err
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseRewriteProgress verifies running, finished and failed rewrites are told apart.
+func TestParseRewriteProgress(t *testing.T) {
+	for output, expected := range map[string]RewriteProgress{
+		"42\n--\n\n--\n":   {state: RewriteInProgress, rewritten: 42},
+		"100\n--\n0\n--\n": {state: RewriteFinished, rewritten: 100},
+		"7\n--\n1\n--\nfind: '/tank/x': Permission denied": {state: RewriteFailed, rewritten: 7, errors: "find: '/tank/x': Permission denied"},
+	} {
+		progress, err := parseRewriteProgress(output)
+		if err != nil {
+			t.Fatalf("parseRewriteProgress(%q) returned error: %v", output, err)
+		}
+		if *progress != expected {
+			t.Fatalf("parseRewriteProgress(%q): expected %#v, got %#v", output, expected, *progress)
+		}
+	}
+
+	if _, err := parseRewriteProgress("garbage"); err == nil {
+		t.Fatalf("expected an error for unexpected output")
+	}
+}
+
+// TestRewriteRoot verifies the path to rewrite stays below the mountpoint, and unmounted filesystems are rejected.
+func TestRewriteRoot(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -H -o name,property,source,value mountpoint,mounted tank/data ",
+			"tank/data\tmountpoint\tlocal\t/srv/data\ntank/data\tmounted\t-\tyes\n"+propertyOutputSeparator+"\ntank/data\tmountpoint\t/srv/data\ntank/data\tmounted\tyes").
+		on("zfs get -H -o name,property,source,value mountpoint,mounted tank/off ",
+			"tank/off\tmountpoint\tlocal\t/srv/off\ntank/off\tmounted\t-\tno\n"+propertyOutputSeparator+"\ntank/off\tmountpoint\t/srv/off\ntank/off\tmounted\tno")
+	config := newFakeConfig(executor)
+
+	for relative, expected := range map[string]string{"": "/srv/data", "images": "/srv/data/images", "../../etc": "/srv/data/etc"} {
+		root, err := rewriteRoot(config, "tank/data", relative)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if root != expected {
+			t.Fatalf("rewriteRoot(%q): expected %q, got %q", relative, expected, root)
+		}
+	}
+
+	if _, err := rewriteRoot(config, "tank/off", ""); err == nil {
+		t.Fatalf("expected an error for an unmounted filesystem")
+	}
+}
+
+// TestStartRewrite verifies the rewrite runs in the background, recording its exit code next to its log.
+func TestStartRewrite(t *testing.T) {
+	executor := (&fakeExecutor{}).on("nohup sh -c", "")
+	config := newFakeConfig(executor)
+
+	job := RewriteJob{logPath: "/var/tmp/terraform-zfs-rewrite.Ab12Cd34/rewrite", root: "/srv/data", method: RewriteMethodRewrite}
+	if err := startRewrite(config, job); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	command := executor.commands[0]
+	for _, fragment := range []string{"zfs rewrite -r -v -x /srv/data", "/var/tmp/terraform-zfs-rewrite.Ab12Cd34/rewrite.exit", "> /dev/null 2>&1 &"} {
+		if !strings.Contains(command, fragment) {
+			t.Fatalf("expected %q in %q", fragment, command)
+		}
+	}
+
+	job.method = RewriteMethodCopy
+	if command := job.command(); !strings.HasPrefix(command, "find /srv/data -xdev -type f -links 1 -exec sh -c") || !strings.Contains(command, "cp -a --preserve=all,xattr") {
+		t.Fatalf("unexpected copy command %q", command)
+	}
+}
+
+// TestRemoveRewriteLogs verifies the private directory of a job is removed, and that rewrites started before jobs
+// had one only have their logs removed.
+func TestRemoveRewriteLogs(t *testing.T) {
+	executor := (&fakeExecutor{}).on("rm -", "")
+	config := newFakeConfig(executor)
+
+	if err := removeRewriteLogs(config, RewriteJob{logPath: "/var/tmp/terraform-zfs-rewrite.Ab12Cd34/rewrite"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := removeRewriteLogs(config, RewriteJob{logPath: "/var/tmp/terraform-zfs-rewrite-tank_data_1700000000"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{
+		"rm -rf /var/tmp/terraform-zfs-rewrite.Ab12Cd34",
+		"rm -f /var/tmp/terraform-zfs-rewrite-tank_data_1700000000.log /var/tmp/terraform-zfs-rewrite-tank_data_1700000000.err /var/tmp/terraform-zfs-rewrite-tank_data_1700000000.exit",
+	}
+	if strings.Join(executor.commands, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected commands %q", executor.commands)
+	}
+}
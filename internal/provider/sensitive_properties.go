@@ -0,0 +1,239 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	SensitiveStorageValue = "value"
+	SensitiveStorageHash  = "hash"
+)
+
+// sensitiveHashPrefix marks the values of sensitive properties which are stored as a hash in the state.
+const sensitiveHashPrefix = "sha256:"
+
+var sensitivePropertiesSchema = schema.Schema{
+	Description: "Properties whose values are secrets, such as user properties holding credentials for sharing services. They are set like `property` blocks, " +
+		"but their values are masked in plan output, left out of `properties`, `raw_properties`, `properties_numeric` and `property_sources`, and redacted from commands " +
+		"shown in logs and errors. A property can't be both in here and in a `property` block.",
+	Type:             schema.TypeMap,
+	Optional:         true,
+	Sensitive:        true,
+	Elem:             &schema.Schema{Type: schema.TypeString},
+	DiffSuppressFunc: suppressHashedSensitiveProperty,
+}
+
+var sensitivePropertyStorageSchema = schema.Schema{
+	Description: "How the values of `sensitive_properties` are kept in the state, either `value` or `hash`. With `hash` only a SHA-256 hash of each value is stored, " +
+		"and changes made outside of terraform are detected by comparing the hash of the value on the host. Defaults to `value`.",
+	Type:             schema.TypeString,
+	Optional:         true,
+	Default:          SensitiveStorageValue,
+	ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{SensitiveStorageValue, SensitiveStorageHash}, false)),
+}
+
+// hashSensitiveValue returns the value of a sensitive property as it is stored with hash storage.
+func hashSensitiveValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return sensitiveHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// suppressHashedSensitiveProperty hides the difference between a hash in the state and the configured value it is
+// the hash of.
+func suppressHashedSensitiveProperty(k, old, new string, d *schema.ResourceData) bool {
+	if strings.HasSuffix(k, ".%") {
+		return false
+	}
+	return strings.HasPrefix(old, sensitiveHashPrefix) && old == hashSensitiveValue(new)
+}
+
+// SecretSet holds the secrets seen by the provider, so they can be redacted from commands before they are logged or
+// shown in diagnostics. A nil set holds no secrets.
+type SecretSet struct {
+	mu      sync.Mutex
+	secrets map[string]bool
+}
+
+func newSecretSet() *SecretSet {
+	return &SecretSet{secrets: make(map[string]bool)}
+}
+
+// minSecretLength is the length below which a value isn't redacted, as it would mangle unrelated parts of commands.
+const minSecretLength = 3
+
+// trivialValues are values which can't be secret, such as the - zfs prints for an unset user property, and which
+// would otherwise be redacted from every command containing them.
+var trivialValues = []string{"-", "none", "off", "on", "yes", "no", "true", "false", "default"}
+
+// isTrivialSecret reports whether a value is too short or too common to be redacted, also in its quoted form.
+func isTrivialSecret(secret string) bool {
+	unquoted := strings.Trim(secret, `'"`)
+	return len(unquoted) < minSecretLength || contains(trivialValues, strings.ToLower(unquoted))
+}
+
+func (set *SecretSet) add(secrets ...string) {
+	if set == nil {
+		return
+	}
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	for _, secret := range secrets {
+		if !isTrivialSecret(secret) {
+			set.secrets[secret] = true
+		}
+	}
+}
+
+// list returns the secrets, longest first so a secret containing another one is redacted as a whole.
+func (set *SecretSet) list() []string {
+	if set == nil {
+		return nil
+	}
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	secrets := mapKeys(set.secrets)
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	return secrets
+}
+
+// sensitivePropertyValues returns the configured sensitive properties, registering their values as secrets.
+func sensitivePropertyValues(config *Config, raw interface{}) map[string]string {
+	values := make(map[string]string)
+	for name, value := range raw.(map[string]interface{}) {
+		values[name] = value.(string)
+		// The quoted form is what ends up in commands when the value holds characters special to the shell.
+		config.secrets.add(value.(string), shellescape.Quote(value.(string)))
+	}
+	return values
+}
+
+// sensitivePropertyNames returns the names of the sensitive properties of a resource, sorted. During an update this
+// includes the properties which are no longer configured, as their values are still secret until they are reset.
+func sensitivePropertyNames(d *schema.ResourceData) []string {
+	oldValues, newValues := d.GetChange("sensitive_properties")
+	names := mapKeys(newValues.(map[string]interface{}))
+	for name := range oldValues.(map[string]interface{}) {
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// takeSensitiveProperties removes the sensitive properties of a resource from properties read from the host and
+// returns them, so their values never end up in the computed property attributes or debug logs.
+func takeSensitiveProperties(config *Config, d *schema.ResourceData, properties map[string]Property) map[string]Property {
+	sensitive := make(map[string]Property)
+	for _, name := range sensitivePropertyNames(d) {
+		if property, ok := properties[name]; ok {
+			// Only values set on the dataset itself are secret, anything else is e.g. the - of an unset property.
+			if property.source == SourceLocal || property.source == SourceReceived {
+				config.secrets.add(property.value, property.rawValue)
+			}
+			sensitive[name] = property
+			delete(properties, name)
+		}
+	}
+	return sensitive
+}
+
+// updateSensitivePropertiesInState stores the values of the sensitive properties on the host, or their hashes. A
+// property which is no longer set locally shows up as empty, which is reported as a change when it is configured.
+func updateSensitivePropertiesInState(d *schema.ResourceData, properties map[string]Property) error {
+	hashed := d.Get("sensitive_property_storage").(string) == SensitiveStorageHash
+
+	values := make(map[string]interface{})
+	for name := range d.Get("sensitive_properties").(map[string]interface{}) {
+		value := ""
+		if property, ok := properties[name]; ok && property.source != SourceInherited && property.source != SourceDefault && property.source != SourceNone {
+			value = property.value
+		}
+		if hashed {
+			value = hashSensitiveValue(value)
+		}
+		values[name] = value
+	}
+	return d.Set("sensitive_properties", values)
+}
+
+// applySensitivePropertyDiff sets the sensitive properties which changed, and resets those which were removed.
+func applySensitivePropertyDiff(config *Config, d *schema.ResourceData, targetName string, actualProperties map[string]Property) error {
+	oldValues, newValues := d.GetChange("sensitive_properties")
+	desired := sensitivePropertyValues(config, newValues)
+
+	applyErr := &PropertyApplyError{applied: make([]string, 0), failed: make(map[string]error)}
+	removed := mapKeys(oldValues.(map[string]interface{}))
+	sort.Strings(removed)
+	for _, name := range removed {
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		if result, ok := getResetCommand(name); ok {
+			if _, err := callSshCommand(config, "%s %s", result, targetName); err != nil {
+				applyErr.failed[name] = err
+			} else {
+				applyErr.applied = append(applyErr.applied, name)
+			}
+		}
+	}
+
+	names := mapKeys(desired)
+	sort.Strings(names)
+	for _, name := range names {
+		if desired[name] == actualProperties[name].value {
+			continue
+		}
+		if _, err := callSshCommand(config, "zfs set %s=%s %s", shellescape.Quote(name), shellescape.Quote(desired[name]), targetName); err != nil {
+			applyErr.failed[name] = err
+		} else {
+			applyErr.applied = append(applyErr.applied, name)
+		}
+	}
+
+	if len(applyErr.failed) > 0 {
+		return applyErr
+	}
+	return nil
+}
+
+// validateSensitiveProperties checks the sensitive properties of a dataset at plan time. Their values are only
+// checked once known, and errors never include them.
+func validateSensitiveProperties(d *schema.ResourceDiff) error {
+	if !d.NewValueKnown("sensitive_properties") {
+		return nil
+	}
+
+	blocks := make(map[string]bool)
+	if d.NewValueKnown("property") {
+		for _, block := range d.Get("property").(*schema.Set).List() {
+			blocks[block.(map[string]interface{})["name"].(string)] = true
+		}
+	}
+
+	errs := make([]error, 0)
+	for name, value := range d.Get("sensitive_properties").(map[string]interface{}) {
+		if blocks[name] {
+			errs = append(errs, fmt.Errorf("%s is set both as a sensitive property and in a property block", name))
+			continue
+		}
+		if isCreateOnlyProperty(name) {
+			errs = append(errs, fmt.Errorf("%s can only be set on creation and can't be a sensitive property", name))
+			continue
+		}
+		if err := validateProperty(name, value.(string), false); err != nil {
+			errs = append(errs, fmt.Errorf("sensitive property %s is invalid", name))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// TestSensitivePropertyHashDiff verifies that a hash in the state matches the configured value it is the hash of,
+// and that a changed value on the host shows up as a change.
+func TestSensitivePropertyHashDiff(t *testing.T) {
+	cases := []struct {
+		stored string
+		change bool
+	}{
+		{hashSensitiveValue("hunter2"), false},
+		{hashSensitiveValue("changed"), true},
+		{"hunter2", false},
+	}
+
+	for _, c := range cases {
+		state := &terraform.InstanceState{
+			ID: "1234",
+			Attributes: map[string]string{
+				"id":                                  "1234",
+				"name":                                "tank/share",
+				"sensitive_property_storage":          SensitiveStorageHash,
+				"sensitive_properties.%":              "1",
+				"sensitive_properties.org.smb:secret": c.stored,
+			},
+		}
+		config := map[string]interface{}{
+			"name":                       "tank/share",
+			"sensitive_property_storage": SensitiveStorageHash,
+			"sensitive_properties":       map[string]interface{}{"org.smb:secret": "hunter2"},
+		}
+
+		diff, err := resourceFilesystem().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		changed := diff != nil && diff.Attributes["sensitive_properties.org.smb:secret"] != nil
+		if changed != c.change {
+			t.Fatalf("expected change %t for stored value %q, got %t", c.change, c.stored, changed)
+		}
+	}
+}
+
+// TestValidateSensitiveProperties verifies that sensitive properties can't also be property blocks, and that
+// invalid values are reported without the value.
+func TestValidateSensitiveProperties(t *testing.T) {
+	state := &terraform.InstanceState{ID: "1234", Attributes: map[string]string{"id": "1234", "name": "tank/share"}}
+
+	config := map[string]interface{}{
+		"name":                 "tank/share",
+		"sensitive_properties": map[string]interface{}{"org.smb:secret": "hunter2"},
+		"property":             []interface{}{map[string]interface{}{"name": "org.smb:secret", "value": "hunter2"}},
+	}
+	if _, err := resourceFilesystem().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), nil); err == nil {
+		t.Fatalf("expected an error for a property which is both sensitive and a property block")
+	}
+
+	config = map[string]interface{}{
+		"name":                 "tank/share",
+		"sensitive_properties": map[string]interface{}{"encryption": "hunter2"},
+	}
+	_, err := resourceFilesystem().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), nil)
+	if err == nil {
+		t.Fatalf("expected an error for a create-only property")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("the error reveals the value: %v", err)
+	}
+}
+
+// TestSensitivePropertiesInState verifies that sensitive properties are kept out of the computed property
+// attributes, and stored as hashes with hash storage.
+func TestSensitivePropertiesInState(t *testing.T) {
+	config := newFakeConfig(&fakeExecutor{})
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{
+		"name":                       "tank/share",
+		"sensitive_property_storage": SensitiveStorageHash,
+		"sensitive_properties":       map[string]interface{}{"org.smb:secret": "hunter2", "org.smb:token": "t0ken"},
+	})
+
+	properties := map[string]Property{
+		"compression":    {value: "lz4", rawValue: "lz4", source: SourceLocal},
+		"org.smb:secret": {value: "hunter2", rawValue: "hunter2", source: SourceLocal},
+	}
+	sensitive := takeSensitiveProperties(config, d, properties)
+	if _, ok := properties["org.smb:secret"]; ok {
+		t.Fatalf("the sensitive property wasn't taken out of %v", mapKeys(properties))
+	}
+	if err := updateSensitivePropertiesInState(d, sensitive); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stored := d.Get("sensitive_properties").(map[string]interface{})
+	if stored["org.smb:secret"] != hashSensitiveValue("hunter2") {
+		t.Fatalf("unexpected stored value %v", stored["org.smb:secret"])
+	}
+	// A property which isn't set on the host is stored as the hash of an empty value, which differs from the configuration.
+	if stored["org.smb:token"] != hashSensitiveValue("") {
+		t.Fatalf("unexpected stored value %v", stored["org.smb:token"])
+	}
+
+	if redacted := redactCommand(config, "zfs get org.smb:secret=hunter2"); strings.Contains(redacted, "hunter2") {
+		t.Fatalf("the value read from the host wasn't redacted: %s", redacted)
+	}
+}
+
+// TestTakeSensitivePropertiesTrivialValues verifies that the - of an unset property, inherited values and other
+// trivial values aren't registered as secrets, which would redact them from every command.
+func TestTakeSensitivePropertiesTrivialValues(t *testing.T) {
+	config := newFakeConfig(&fakeExecutor{})
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{
+		"name":                 "tank/share",
+		"sensitive_properties": map[string]interface{}{"org.smb:secret": "hunter2", "org.smb:flag": "on", "org.smb:parent": "s3cr3t"},
+	})
+
+	properties := map[string]Property{
+		"org.smb:secret": {value: "-", rawValue: "-", source: SourceNone},
+		"org.smb:flag":   {value: "on", rawValue: "on", source: SourceLocal},
+		"org.smb:parent": {value: "inherited-value", rawValue: "inherited-value", source: SourceInherited},
+	}
+	takeSensitiveProperties(config, d, properties)
+
+	if secrets := config.secrets.list(); len(secrets) != 0 {
+		t.Fatalf("expected no secrets to be registered, got %q", secrets)
+	}
+	command := "zfs inherit org.smb:secret tank/share && zpool import -d /dev/disk/by-id tank"
+	if redacted := redactCommand(config, command); redacted != command {
+		t.Fatalf("the command was mangled: %s", redacted)
+	}
+
+	config.secrets.add("-", "''", "on", shellescape.Quote("on"), "hunter2")
+	if secrets := config.secrets.list(); len(secrets) != 1 || secrets[0] != "hunter2" {
+		t.Fatalf("expected only hunter2 to be registered, got %q", secrets)
+	}
+}
+
+// TestApplySensitivePropertyDiff verifies that changed sensitive properties are set, and that their values are
+// redacted from the errors of failed commands.
+func TestApplySensitivePropertyDiff(t *testing.T) {
+	executor := (&fakeExecutor{}).fail("zfs set", "cannot set property: permission denied")
+	config := newFakeConfig(executor)
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{
+		"name":                 "tank/share",
+		"sensitive_properties": map[string]interface{}{"org.smb:secret": "hunter 2"},
+	})
+
+	err := applySensitivePropertyDiff(config, d, "tank/share", map[string]Property{})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if !executor.ran("zfs set org.smb:secret='hunter 2' tank/share") {
+		t.Fatalf("unexpected commands %v", executor.commands)
+	}
+
+	diags := diagFromErr(err)
+	for _, diagnostic := range diags {
+		if strings.Contains(diagnostic.Summary+diagnostic.Detail, "hunter") {
+			t.Fatalf("the diagnostic reveals the value: %s", diagnostic.Detail)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// ProviderServer returns a factory for the protocol 5 server which Terraform talks to. It serves the SDKv2 provider,
+// along with the provider-defined functions SDKv2 can't serve itself.
+func ProviderServer(version string) func() tfprotov5.ProviderServer {
+	return func() tfprotov5.ProviderServer {
+		return &functionServer{
+			ProviderServer: schema.NewGRPCProviderServer(New(version)()),
+			functions:      providerFunctions,
+		}
+	}
+}
+
+// functionServer adds provider-defined functions to a provider server, as SDKv2 has no support for them.
+type functionServer struct {
+	tfprotov5.ProviderServer
+	functions map[string]ProviderFunction
+}
+
+func (s *functionServer) definitions() map[string]*tfprotov5.Function {
+	definitions := make(map[string]*tfprotov5.Function, len(s.functions))
+	for name, function := range s.functions {
+		definitions[name] = function.definition
+	}
+	return definitions
+}
+
+func (s *functionServer) GetMetadata(ctx context.Context, req *tfprotov5.GetMetadataRequest) (*tfprotov5.GetMetadataResponse, error) {
+	resp, err := s.ProviderServer.GetMetadata(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for name := range s.functions {
+		resp.Functions = append(resp.Functions, tfprotov5.FunctionMetadata{Name: name})
+	}
+	return resp, nil
+}
+
+func (s *functionServer) GetProviderSchema(ctx context.Context, req *tfprotov5.GetProviderSchemaRequest) (*tfprotov5.GetProviderSchemaResponse, error) {
+	resp, err := s.ProviderServer.GetProviderSchema(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Functions = s.definitions()
+	return resp, nil
+}
+
+func (s *functionServer) GetFunctions(ctx context.Context, req *tfprotov5.GetFunctionsRequest) (*tfprotov5.GetFunctionsResponse, error) {
+	return &tfprotov5.GetFunctionsResponse{Functions: s.definitions()}, nil
+}
+
+func (s *functionServer) CallFunction(ctx context.Context, req *tfprotov5.CallFunctionRequest) (*tfprotov5.CallFunctionResponse, error) {
+	function, ok := s.functions[req.Name]
+	if !ok {
+		return &tfprotov5.CallFunctionResponse{Error: &tfprotov5.FunctionError{Text: fmt.Sprintf("unknown function %q", req.Name)}}, nil
+	}
+
+	parameters := function.definition.Parameters
+	if len(req.Arguments) != len(parameters) {
+		return &tfprotov5.CallFunctionResponse{Error: &tfprotov5.FunctionError{Text: fmt.Sprintf("expected %d arguments, got %d", len(parameters), len(req.Arguments))}}, nil
+	}
+
+	arguments := make([]tftypes.Value, len(parameters))
+	for i, parameter := range parameters {
+		value, err := req.Arguments[i].Unmarshal(parameter.Type)
+		if err != nil {
+			return &tfprotov5.CallFunctionResponse{Error: functionArgumentError(int64(i), "%s", err)}, nil
+		}
+		arguments[i] = value
+	}
+
+	result, callErr := function.call(arguments)
+	if callErr != nil {
+		return &tfprotov5.CallFunctionResponse{Error: callErr}, nil
+	}
+
+	value, err := tfprotov5.NewDynamicValue(function.definition.Return.Type, result)
+	if err != nil {
+		return &tfprotov5.CallFunctionResponse{Error: &tfprotov5.FunctionError{Text: err.Error()}}, nil
+	}
+	return &tfprotov5.CallFunctionResponse{Result: &value}, nil
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+)
+
+// What zfs_snapshot does when a snapshot of the same name already exists.
+const (
+	SnapshotConflictFail   = "fail"
+	SnapshotConflictAdopt  = "adopt"
+	SnapshotConflictSuffix = "suffix"
+)
+
+// maxSnapshotSuffix bounds the search for a free name with on_conflict = "suffix".
+const maxSnapshotSuffix = 1000
+
+// resolveSnapshotConflict picks the name of the snapshot to take, given the existing snapshots of the dataset. With
+// "adopt", an existing snapshot of the same name is returned instead, and with "suffix" the first free name of
+// <name>-1, <name>-2 and so on is picked.
+func resolveSnapshotConflict(snapshots []Snapshot, datasetName string, name string, onConflict string) (string, *Snapshot, error) {
+	existing := make(map[string]Snapshot, len(snapshots))
+	for _, snapshot := range snapshots {
+		existing[snapshot.name] = snapshot
+	}
+
+	fullName := fmt.Sprintf("%s@%s", datasetName, name)
+	snapshot, exists := existing[fullName]
+	if !exists {
+		return fullName, nil, nil
+	}
+
+	switch onConflict {
+	case SnapshotConflictAdopt:
+		return fullName, &snapshot, nil
+	case SnapshotConflictSuffix:
+		for i := 1; i <= maxSnapshotSuffix; i++ {
+			candidate := fmt.Sprintf("%s-%d", fullName, i)
+			if _, exists := existing[candidate]; !exists {
+				return candidate, nil, nil
+			}
+		}
+		return "", nil, fmt.Errorf("snapshots %s-1 through %s-%d already exist", fullName, fullName, maxSnapshotSuffix)
+	default:
+		return "", nil, fmt.Errorf("snapshot %s already exists. Set on_conflict to \"adopt\" to manage it, or to \"suffix\" to take a snapshot under a new name", fullName)
+	}
+}
+
+// isSnapshotExistsError reports whether zfs snapshot failed because the snapshot was taken in the meantime.
+func isSnapshotExistsError(err error) bool {
+	return strings.Contains(err.Error(), "dataset already exists")
+}
+
+// findSnapshot returns the snapshot with the given name or guid, or nil.
+func findSnapshot(snapshots []Snapshot, name string, guid string) *Snapshot {
+	for i := range snapshots {
+		if (name != "" && snapshots[i].name == name) || (guid != "" && snapshots[i].guid == guid) {
+			return &snapshots[i]
+		}
+	}
+	return nil
+}
+
+// newerSnapshots returns the names of the snapshots taken after the given one, which a rollback to it destroys.
+// Snapshots are given oldest first, as listed by listSnapshots. The second return value is false if the snapshot
+// doesn't exist.
+func newerSnapshots(snapshots []Snapshot, snapshotName string) ([]string, bool) {
+	for i, snapshot := range snapshots {
+		if snapshot.name == snapshotName {
+			newer := make([]string, 0, len(snapshots)-i-1)
+			for _, later := range snapshots[i+1:] {
+				newer = append(newer, later.name)
+			}
+			return newer, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// SnapshotDiff are the changes between a snapshot and a later snapshot or the live dataset, as listed by zfs diff.
+type SnapshotDiff struct {
+	added    []string
+	modified []string
+	removed  []string
+	renamed  []SnapshotDiffRename
+}
+
+type SnapshotDiffRename struct {
+	from string
+	to   string
+}
+
+func (diff *SnapshotDiff) count() int {
+	return len(diff.added) + len(diff.modified) + len(diff.removed) + len(diff.renamed)
+}
+
+// zfs diff escapes unprintable characters and whitespace in paths as a backslash followed by four octal digits.
+var snapshotDiffEscapePattern = regexp.MustCompile(`\\[0-7]{4}`)
+
+func unescapeSnapshotDiffPath(path string) string {
+	return snapshotDiffEscapePattern.ReplaceAllStringFunc(path, func(escape string) string {
+		value, _ := strconv.ParseUint(escape[1:], 8, 8)
+		return string([]byte{byte(value)})
+	})
+}
+
+// parseSnapshotDiff parses the output of zfs diff -H, e.g.
+//
+//	M	/tank/data/
+//	+	/tank/data/new\0040file
+//	R	/tank/data/old	/tank/data/renamed
+func parseSnapshotDiff(output string) (*SnapshotDiff, error) {
+	diff := SnapshotDiff{
+		added:    make([]string, 0),
+		modified: make([]string, 0),
+		removed:  make([]string, 0),
+		renamed:  make([]SnapshotDiffRename, 0),
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("unexpected zfs diff output %q", line)
+		}
+		path := unescapeSnapshotDiffPath(fields[1])
+
+		switch fields[0] {
+		case "+":
+			diff.added = append(diff.added, path)
+		case "M":
+			diff.modified = append(diff.modified, path)
+		case "-":
+			diff.removed = append(diff.removed, path)
+		case "R":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("unexpected zfs diff output %q", line)
+			}
+			diff.renamed = append(diff.renamed, SnapshotDiffRename{from: path, to: unescapeSnapshotDiffPath(fields[2])})
+		default:
+			return nil, fmt.Errorf("unknown change type %q in zfs diff output %q", fields[0], line)
+		}
+	}
+
+	return &diff, nil
+}
+
+// readSnapshotDiff diffs a snapshot against a later snapshot, or against the live dataset if to is empty.
+func readSnapshotDiff(config *Config, from string, to string) (*SnapshotDiff, error) {
+	command := fmt.Sprintf("zfs diff -H %s", shellescape.Quote(from))
+	if to != "" {
+		command += " " + shellescape.Quote(to)
+	}
+
+	stdout, err := callSshCommand(config, "%s", command)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshotDiff(stdout)
+}
@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseSnapshotDiff verifies that changes are sorted by type, and escaped paths are decoded.
+func TestParseSnapshotDiff(t *testing.T) {
+	diff, err := parseSnapshotDiff("M\t/tank/data/\n" +
+		"+\t/tank/data/new\\0040file\n" +
+		"-\t/tank/data/old\n" +
+		"R\t/tank/data/a\t/tank/data/b\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(diff.added, []string{"/tank/data/new file"}) || !reflect.DeepEqual(diff.modified, []string{"/tank/data/"}) ||
+		!reflect.DeepEqual(diff.removed, []string{"/tank/data/old"}) || !reflect.DeepEqual(diff.renamed, []SnapshotDiffRename{{from: "/tank/data/a", to: "/tank/data/b"}}) {
+		t.Fatalf("unexpected diff %+v", *diff)
+	}
+	if diff.count() != 4 {
+		t.Fatalf("expected 4 changes, got %d", diff.count())
+	}
+
+	if _, err := parseSnapshotDiff("?\t/tank/data/x\n"); err == nil {
+		t.Fatalf("expected an error for an unknown change type")
+	}
+}
+
+// TestReadSnapshotDiff verifies that snapshots are diffed against the live dataset unless another snapshot is given.
+func TestReadSnapshotDiff(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zfs diff -H", "")
+	config := newFakeConfig(executor)
+
+	if diff, err := readSnapshotDiff(config, "tank/data@monday", ""); err != nil || diff.count() != 0 {
+		t.Fatalf("unexpected result %v, %v", diff, err)
+	}
+	if _, err := readSnapshotDiff(config, "tank/data@monday", "tank/data@tuesday"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(executor.commands, []string{"zfs diff -H tank/data@monday", "zfs diff -H tank/data@monday tank/data@tuesday"}) {
+		t.Fatalf("unexpected commands %v", executor.commands)
+	}
+}
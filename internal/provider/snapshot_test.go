@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestResolveSnapshotConflict verifies that conflicting snapshots fail, are adopted or get the first free suffix.
+func TestResolveSnapshotConflict(t *testing.T) {
+	snapshots := []Snapshot{
+		{name: "tank/data@deploy", guid: "1111"},
+		{name: "tank/data@deploy-1", guid: "2222"},
+	}
+
+	if name, adopted, err := resolveSnapshotConflict(snapshots, "tank/data", "release", SnapshotConflictFail); err != nil || adopted != nil || name != "tank/data@release" {
+		t.Fatalf("unexpected result %q, %v, %v", name, adopted, err)
+	}
+
+	if _, _, err := resolveSnapshotConflict(snapshots, "tank/data", "deploy", SnapshotConflictFail); err == nil {
+		t.Fatalf("expected the conflict to fail")
+	}
+
+	if _, adopted, err := resolveSnapshotConflict(snapshots, "tank/data", "deploy", SnapshotConflictAdopt); err != nil || adopted == nil || adopted.guid != "1111" {
+		t.Fatalf("expected the existing snapshot to be adopted, got %v, %v", adopted, err)
+	}
+
+	if name, adopted, err := resolveSnapshotConflict(snapshots, "tank/data", "deploy", SnapshotConflictSuffix); err != nil || adopted != nil || name != "tank/data@deploy-2" {
+		t.Fatalf("expected the first free suffix, got %q, %v, %v", name, adopted, err)
+	}
+}
+
+// TestResourceSnapshotAdopt verifies that adopted snapshots are neither taken nor destroyed.
+func TestResourceSnapshotAdopt(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation tank/data", "tank/data@deploy\t1111\t1697371200\n")
+	config := newFakeConfig(executor)
+
+	d := schema.TestResourceDataRaw(t, resourceSnapshot().Schema, map[string]interface{}{"dataset": "tank/data", "name": "deploy", "on_conflict": "adopt"})
+	if diags := resourceSnapshotCreate(context.Background(), d, config); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Id() != "1111" || !d.Get("adopted").(bool) || d.Get("creation") != "2023-10-15T12:00:00Z" {
+		t.Fatalf("unexpected state %s, %v, %v", d.Id(), d.Get("adopted"), d.Get("creation"))
+	}
+
+	if diags := resourceSnapshotDelete(context.Background(), d, config); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if executor.ran("zfs snapshot") || executor.ran("zfs destroy") {
+		t.Fatalf("expected the adopted snapshot to be left alone, ran %v", executor.commands)
+	}
+}
+
+// TestResourceSnapshotImport verifies that snapshots are imported by their full name and tracked by their guid.
+func TestResourceSnapshotImport(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation tank/data", "tank/data@deploy\t1111\t1697371200\n")
+	config := newFakeConfig(executor)
+
+	d := schema.TestResourceDataRaw(t, resourceSnapshot().Schema, map[string]interface{}{})
+	d.SetId("tank/data@deploy")
+	imported, err := resourceSnapshot().Importer.StateContext(context.Background(), d, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(imported) != 1 || d.Id() != "1111" || d.Get("dataset") != "tank/data" || d.Get("name") != "deploy" || d.Get("on_conflict") != SnapshotConflictFail {
+		t.Fatalf("unexpected state %s, %v, %v, %v", d.Id(), d.Get("dataset"), d.Get("name"), d.Get("on_conflict"))
+	}
+
+	for _, id := range []string{"tank/data", "tank/data@missing"} {
+		d.SetId(id)
+		if _, err := resourceSnapshot().Importer.StateContext(context.Background(), d, config); err == nil {
+			t.Fatalf("expected importing %q to fail", id)
+		}
+	}
+}
+
+// TestNewerSnapshots verifies that the snapshots after the target are listed, and missing targets are reported.
+func TestNewerSnapshots(t *testing.T) {
+	snapshots := []Snapshot{{name: "tank/data@a"}, {name: "tank/data@b"}, {name: "tank/data@c"}}
+
+	if newer, ok := newerSnapshots(snapshots, "tank/data@a"); !ok || !reflect.DeepEqual(newer, []string{"tank/data@b", "tank/data@c"}) {
+		t.Fatalf("unexpected result %v, %t", newer, ok)
+	}
+	if newer, ok := newerSnapshots(snapshots, "tank/data@c"); !ok || len(newer) != 0 {
+		t.Fatalf("expected nothing newer than the latest snapshot, got %v, %t", newer, ok)
+	}
+	if _, ok := newerSnapshots(snapshots, "tank/data@missing"); ok {
+		t.Fatalf("expected a missing snapshot to be reported")
+	}
+}
+
+// TestResourceRollbackCreate verifies that newer snapshots are destroyed with destroy_newer.
+func TestResourceRollbackCreate(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs list -H -p -t snapshot", "tank/data@a\t1111\t1697371200\ntank/data@b\t2222\t1697371300\n").
+		on("zfs rollback", "")
+
+	d := schema.TestResourceDataRaw(t, resourceRollback().Schema, map[string]interface{}{"dataset": "tank/data", "snapshot": "a", "destroy_newer": true})
+	if diags := resourceRollbackCreate(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if !executor.ran("zfs rollback -r tank/data@a") {
+		t.Fatalf("expected a recursive rollback, ran %v", executor.commands)
+	}
+	if destroyed := d.Get("destroyed_snapshots").([]interface{}); len(destroyed) != 1 || destroyed[0] != "tank/data@b" {
+		t.Fatalf("unexpected destroyed snapshots %v", destroyed)
+	}
+}
+
+// TestResourceSnapshotMountSnapdir verifies that a snapshot is exposed below the .zfs/snapshot directory of its filesystem.
+func TestResourceSnapshotMountSnapdir(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation tank/data", "tank/data@nightly\t5678\t1697371200\n").
+		on("zfs get -H -o value type,mountpoint tank/data", "filesystem\n/srv/data\n").
+		on("ls -d /srv/data/.zfs/snapshot/nightly/.", "/srv/data/.zfs/snapshot/nightly/.\n")
+
+	d := schema.TestResourceDataRaw(t, resourceSnapshotMount().Schema, map[string]interface{}{"snapshot": "tank/data@nightly"})
+	if diags := resourceSnapshotMountCreate(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+
+	if d.Id() != "5678" || d.Get("path").(string) != "/srv/data/.zfs/snapshot/nightly" {
+		t.Fatalf("unexpected state %s, %v", d.Id(), d.Get("path"))
+	}
+	if !executor.ran("ls -d /srv/data/.zfs/snapshot/nightly/.") {
+		t.Fatalf("expected the snapshot to be mounted, ran %v", executor.commands)
+	}
+}
+
+// TestSnapshotDirectoryPath verifies that snapshots of volumes and unmounted filesystems have no snapshot directory.
+func TestSnapshotDirectoryPath(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -H -o value type,mountpoint tank/vm", "volume\n-\n").
+		on("zfs get -H -o value type,mountpoint tank/legacy", "filesystem\nlegacy\n")
+	config := newFakeConfig(executor)
+
+	if _, err := snapshotDirectoryPath(config, "tank/vm@nightly"); err == nil {
+		t.Fatalf("expected an error for a volume")
+	}
+	if _, err := snapshotDirectoryPath(config, "tank/legacy@nightly"); err == nil {
+		t.Fatalf("expected an error for a legacy mountpoint")
+	}
+}
+
+// TestResourceSnapshotMountCloneDelete verifies that the clone is destroyed with the resource, and tolerated to be gone.
+func TestResourceSnapshotMountCloneDelete(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		fail("zfs destroy tank/verify", "cannot open 'tank/verify': dataset does not exist")
+
+	d := schema.TestResourceDataRaw(t, resourceSnapshotMount().Schema, map[string]interface{}{
+		"snapshot":   "tank/data@nightly",
+		"method":     "clone",
+		"clone_name": "tank/verify",
+	})
+	d.SetId("1234")
+	if diags := resourceSnapshotMountDelete(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if !executor.ran("zfs destroy tank/verify") {
+		t.Fatalf("expected the clone to be destroyed, ran %v", executor.commands)
+	}
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// Stages of evacuating a pool into another: the target is created, the datasets are replicated into it, the
+// replication is verified and then the source is destroyed. terraform orders resources by their references only,
+// so the provider enforces that a pool in the destroy stage is only destroyed after a zfs_stage_verification has
+// succeeded for it, no matter in which order terraform gets to it.
+const (
+	StageCreate    = "create"
+	StageReplicate = "replicate"
+	StageVerify    = "verify"
+	StageDestroy   = "destroy"
+)
+
+var poolStages = []string{StageCreate, StageDestroy}
+
+// verifiedProperty is the user property holding the dataset a pool or dataset was verified to be replicated into.
+const verifiedProperty = "terraform:verified"
+
+// ReplicatedDataset is a dataset below the source of a verification, and its counterpart below the target.
+type ReplicatedDataset struct {
+	source  string
+	target  string
+	written int64
+}
+
+// parseReplicatedDatasets parses `zfs list -H -p -r -o name,written` of the source, mapping every dataset to
+// the same path below the target.
+func parseReplicatedDatasets(source string, target string, output string) ([]ReplicatedDataset, error) {
+	datasets := make([]ReplicatedDataset, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected zfs list output %q", line)
+		}
+
+		written, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid written %s of %s: %s", fields[1], fields[0], err)
+		}
+
+		datasets = append(datasets, ReplicatedDataset{
+			source:  fields[0],
+			target:  target + strings.TrimPrefix(fields[0], source),
+			written: written,
+		})
+	}
+	return datasets, nil
+}
+
+// verifyReplicatedDataset returns why a dataset isn't fully replicated, or an empty string if it is: its newest
+// snapshot must exist on the target, and nothing may have been written to it since.
+func verifyReplicatedDataset(dataset ReplicatedDataset, source []Snapshot, target []Snapshot) string {
+	if len(source) == 0 {
+		return fmt.Sprintf("%s has no snapshots", dataset.source)
+	}
+
+	latest := source[len(source)-1]
+	if common := newestCommonSnapshot(source, target); common == nil || common.guid != latest.guid {
+		return fmt.Sprintf("%s is missing on %s", latest.name, dataset.target)
+	}
+
+	if dataset.written > 0 {
+		return fmt.Sprintf("%d bytes were written to %s after %s", dataset.written, dataset.source, latest.name)
+	}
+	return ""
+}
+
+// verifyReplication checks that every filesystem and volume below source is replicated up to date into target,
+// and returns the names of the verified datasets.
+func verifyReplication(config *Config, source string, target string) ([]string, error) {
+	if target == source || strings.HasPrefix(target, source+"/") {
+		return nil, fmt.Errorf("the target %s of a verification can't be below its source %s", target, source)
+	}
+
+	stdout, err := callSshCommand(config, "zfs list -H -p -r -t filesystem,volume -o name,written %s", shellescape.Quote(source))
+	if err != nil {
+		return nil, err
+	}
+
+	datasets, err := parseReplicatedDatasets(source, target, stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	verified := make([]string, 0, len(datasets))
+	problems := make([]string, 0)
+	for _, dataset := range datasets {
+		sourceSnapshots, err := listSnapshots(config, dataset.source)
+		if err != nil {
+			return nil, err
+		}
+
+		targetSnapshots, err := listSnapshots(config, dataset.target)
+		if err != nil {
+			if _, ok := err.(*DatasetError); ok {
+				problems = append(problems, fmt.Sprintf("%s does not exist", dataset.target))
+				continue
+			}
+			return nil, err
+		}
+
+		if problem := verifyReplicatedDataset(dataset, sourceSnapshots, targetSnapshots); problem != "" {
+			problems = append(problems, problem)
+			continue
+		}
+		verified = append(verified, dataset.source)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s is not fully replicated into %s: %s", source, target, strings.Join(problems, "; "))
+	}
+	return verified, nil
+}
+
+// checkStageVerified refuses to destroy a pool in the destroy stage unless a verification recorded where it was
+// replicated to. The replication is verified again, since the pool may have been written to since.
+func checkStageVerified(config *Config, poolName string) error {
+	stdout, err := callSshCommand(config, "zfs get -H -o value %s %s", verifiedProperty, shellescape.Quote(poolName))
+	if err != nil {
+		return err
+	}
+
+	target := strings.TrimSpace(stdout)
+	if target == "" || target == "-" {
+		return fmt.Errorf("refusing to destroy %s, which is in the destroy stage but hasn't been verified by a zfs_stage_verification", poolName)
+	}
+
+	if _, err := verifyReplication(config, poolName, target); err != nil {
+		return fmt.Errorf("refusing to destroy %s: %s", poolName, err)
+	}
+	return nil
+}
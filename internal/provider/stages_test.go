@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// TestVerifyReplication verifies that every dataset below the source must have its newest snapshot on the target,
+// without writes since.
+func TestVerifyReplication(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs list -H -p -r -t filesystem,volume -o name,written old", "old\t0\nold/data\t0\nold/logs\t4096\n").
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation old/data", "old/data@move\t2\t1700000000\n").
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation old/logs", "old/logs@move\t3\t1700000000\n").
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation old", "old@move\t1\t1700000000\n").
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation new/old/data", "new/old/data@move\t2\t1700000000\n").
+		fail("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation new/old/logs", "cannot open 'new/old/logs': dataset does not exist").
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation new/old", "new/old@move\t1\t1700000000\n")
+	config := newFakeConfig(executor)
+
+	_, err := verifyReplication(config, "old", "new/old")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if !strings.Contains(err.Error(), "new/old/logs does not exist") {
+		t.Fatalf("expected the missing dataset to be reported, got %s", err)
+	}
+
+	if _, err := verifyReplication(config, "old", "old/backup"); err == nil {
+		t.Fatalf("expected a target below the source to be rejected")
+	}
+}
+
+// TestVerifyReplicatedDataset verifies the reasons a single dataset isn't fully replicated.
+func TestVerifyReplicatedDataset(t *testing.T) {
+	dataset := ReplicatedDataset{source: "old/data", target: "new/data"}
+	source := []Snapshot{{name: "old/data@a", guid: "1"}, {name: "old/data@b", guid: "2"}}
+
+	if problem := verifyReplicatedDataset(dataset, nil, nil); problem != "old/data has no snapshots" {
+		t.Fatalf("unexpected problem %q", problem)
+	}
+	if problem := verifyReplicatedDataset(dataset, source, []Snapshot{{name: "new/data@a", guid: "1"}}); problem != "old/data@b is missing on new/data" {
+		t.Fatalf("unexpected problem %q", problem)
+	}
+	if problem := verifyReplicatedDataset(dataset, source, []Snapshot{{name: "new/data@b", guid: "2"}}); problem != "" {
+		t.Fatalf("unexpected problem %q", problem)
+	}
+
+	dataset.written = 4096
+	if problem := verifyReplicatedDataset(dataset, source, []Snapshot{{name: "new/data@b", guid: "2"}}); problem != "4096 bytes were written to old/data after old/data@b" {
+		t.Fatalf("unexpected problem %q", problem)
+	}
+}
+
+// TestPoolDestroyStage verifies that a pool in the destroy stage is only destroyed after its replication was verified.
+func TestPoolDestroyStage(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -H -o value terraform:verified old", "-\n").
+		on("zpool destroy", "")
+	config := newFakeConfig(executor)
+
+	d := schema.TestResourceDataRaw(t, resourcePool().Schema, map[string]interface{}{
+		"name":  "old",
+		"stage": "destroy",
+	})
+	d.SetId("1234")
+
+	if diags := resourcePoolDelete(context.Background(), d, config); !diags.HasError() {
+		t.Fatalf("expected destroying an unverified pool to fail")
+	}
+	if executor.ran("zpool destroy") {
+		t.Fatalf("expected the pool to be kept, ran %v", executor.commands)
+	}
+
+	executor = (&fakeExecutor{}).
+		on("zfs get -H -o value terraform:verified old", "new/old\n").
+		on("zfs list -H -p -r -t filesystem,volume -o name,written old", "old\t0\n").
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation old", "old@move\t1\t1700000000\n").
+		on("zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation new/old", "new/old@move\t1\t1700000000\n").
+		on("zpool destroy", "")
+	if diags := resourcePoolDelete(context.Background(), d, newFakeConfig(executor)); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if !executor.ran("zpool destroy") {
+		t.Fatalf("expected the pool to be destroyed, ran %v", executor.commands)
+	}
+}
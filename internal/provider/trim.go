@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+type TrimState string
+
+const (
+	TrimNone        TrimState = "none"
+	TrimInProgress  TrimState = "in_progress"
+	TrimSuspended   TrimState = "suspended"
+	TrimFinished    TrimState = "finished"
+	TrimUnsupported TrimState = "unsupported"
+)
+
+// DeviceTrim is the trim progress of a single leaf vdev, as reported by zpool status -t.
+type DeviceTrim struct {
+	path     string
+	state    TrimState
+	progress float64
+}
+
+var (
+	trimProgressPattern    = regexp.MustCompile(`\((\d+)% trimmed(?:, ([^)]*))?\)`)
+	trimUntrimmedPattern   = regexp.MustCompile(`\(untrimmed\)`)
+	trimUnsupportedPattern = regexp.MustCompile(`\(trim unsupported\)`)
+)
+
+// parseDeviceTrims parses the trim annotations which zpool status -t adds to leaf vdevs, e.g.
+//
+//	sda  ONLINE  0  0  0  (100% trimmed, completed at Sun Oct 15 12:00:00 2023)
+//	sdb  ONLINE  0  0  0  (35% trimmed, started at Sun Oct 15 12:00:00 2023)
+//	sdc  ONLINE  0  0  0  (trim unsupported)
+//
+// Vdevs without an annotation, such as the pool itself or mirrors, are skipped.
+func parseDeviceTrims(status string) ([]DeviceTrim, error) {
+	parsed, err := parsePoolStatus(status)
+	if err != nil {
+		return nil, err
+	}
+
+	trims := make([]DeviceTrim, 0)
+	for _, vdev := range parsed.vdevs {
+		trim := DeviceTrim{path: vdev.name}
+		if match := trimProgressPattern.FindStringSubmatch(vdev.message); match != nil {
+			progress, err := strconv.ParseFloat(match[1], 64)
+			if err != nil {
+				return nil, err
+			}
+			trim.progress = progress
+			switch {
+			case strings.Contains(match[2], "suspended"):
+				trim.state = TrimSuspended
+			case strings.Contains(match[2], "completed"):
+				trim.state = TrimFinished
+			default:
+				trim.state = TrimInProgress
+			}
+		} else if trimUntrimmedPattern.MatchString(vdev.message) {
+			trim.state = TrimNone
+		} else if trimUnsupportedPattern.MatchString(vdev.message) {
+			trim.state = TrimUnsupported
+		} else {
+			continue
+		}
+		trims = append(trims, trim)
+	}
+	return trims, nil
+}
+
+// summarizeTrims combines the trim progress of all devices into the state and progress of the pool. Devices which
+// don't support trim are left out, and a pool with no such devices is unsupported.
+func summarizeTrims(trims []DeviceTrim) (TrimState, float64) {
+	supported := 0
+	progress := float64(0)
+	states := make(map[TrimState]int)
+	for _, trim := range trims {
+		if trim.state == TrimUnsupported {
+			continue
+		}
+		supported++
+		progress += trim.progress
+		states[trim.state]++
+	}
+
+	switch {
+	case supported == 0:
+		return TrimUnsupported, 0
+	case states[TrimInProgress] > 0:
+		return TrimInProgress, progress / float64(supported)
+	case states[TrimSuspended] > 0:
+		return TrimSuspended, progress / float64(supported)
+	case states[TrimFinished] == supported:
+		return TrimFinished, 100
+	default:
+		return TrimNone, progress / float64(supported)
+	}
+}
+
+func readDeviceTrims(config *Config, poolName string) ([]DeviceTrim, error) {
+	status, err := callSshCommand(config, "zpool status -pPt %s", poolName)
+	if err != nil {
+		return nil, err
+	}
+	return parseDeviceTrims(status)
+}
+
+// startTrim starts trimming the given devices of a pool, or all of them if none are given. rate limits
+// the bytes per second trimmed per device, and secure requests a secure erase where the device supports it.
+func startTrim(config *Config, poolName string, devices []string, rate string, secure bool) error {
+	options := ""
+	if rate != "" {
+		options += fmt.Sprintf(" -r %s", shellescape.Quote(rate))
+	}
+	if secure {
+		options += " -d"
+	}
+
+	serialized_devices := ""
+	for _, device := range devices {
+		serialized_devices += " " + shellescape.Quote(device)
+	}
+
+	_, err := callSshCommand(config, "zpool trim%s %s%s", options, poolName, serialized_devices)
+	return err
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"testing"
+)
+
+const testStatusTrim = `  pool: tank
+ state: ONLINE
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	tank          ONLINE       0     0     0
+	  mirror-0    ONLINE       0     0     0
+	    /dev/sda  ONLINE       0     0     0  (100% trimmed, completed at Sun Oct 15 12:00:00 2023)
+	    /dev/sdb  ONLINE       0     0     0  (40% trimmed, started at Sun Oct 15 12:00:00 2023)
+	logs
+	  /dev/sdc    ONLINE       0     0     0  (trim unsupported)
+	cache
+	  /dev/sdd    ONLINE       0     0     0  (untrimmed)
+
+errors: No known data errors`
+
+// TestParseDeviceTrims verifies that the trim annotations of leaf vdevs are parsed, and other vdevs are skipped.
+func TestParseDeviceTrims(t *testing.T) {
+	trims, err := parseDeviceTrims(testStatusTrim)
+	if err != nil {
+		t.Fatalf("parseDeviceTrims returned error: %v", err)
+	}
+
+	expected := []DeviceTrim{
+		{path: "/dev/sda", state: TrimFinished, progress: 100},
+		{path: "/dev/sdb", state: TrimInProgress, progress: 40},
+		{path: "/dev/sdc", state: TrimUnsupported},
+		{path: "/dev/sdd", state: TrimNone},
+	}
+	if len(trims) != len(expected) {
+		t.Fatalf("expected %#v, got %#v", expected, trims)
+	}
+	for i := range expected {
+		if trims[i] != expected[i] {
+			t.Fatalf("expected %#v, got %#v", expected[i], trims[i])
+		}
+	}
+}
+
+// TestSummarizeTrims verifies that devices without trim support don't hold back the state of the pool.
+func TestSummarizeTrims(t *testing.T) {
+	for _, test := range []struct {
+		trims    []DeviceTrim
+		state    TrimState
+		progress float64
+	}{
+		{[]DeviceTrim{{state: TrimFinished, progress: 100}, {state: TrimInProgress, progress: 40}}, TrimInProgress, 70},
+		{[]DeviceTrim{{state: TrimFinished, progress: 100}, {state: TrimUnsupported}}, TrimFinished, 100},
+		{[]DeviceTrim{{state: TrimSuspended, progress: 20}, {state: TrimNone}}, TrimSuspended, 10},
+		{[]DeviceTrim{{state: TrimUnsupported}}, TrimUnsupported, 0},
+		{[]DeviceTrim{}, TrimUnsupported, 0},
+	} {
+		state, progress := summarizeTrims(test.trims)
+		if state != test.state || progress != test.progress {
+			t.Fatalf("summarizeTrims(%#v): expected %s at %.2f, got %s at %.2f", test.trims, test.state, test.progress, state, progress)
+		}
+	}
+}
+
+// TestStartTrim verifies the rate limit, secure trim and device arguments are passed to zpool trim.
+func TestStartTrim(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zpool trim", "")
+	config := newFakeConfig(executor)
+
+	if err := startTrim(config, "tank", nil, "", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := startTrim(config, "tank", []string{"/dev/sda"}, "100M", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{"zpool trim tank", "zpool trim -r 100M -d tank /dev/sda"}
+	for i := range expected {
+		if executor.commands[i] != expected[i] {
+			t.Fatalf("expected %q, got %q", expected[i], executor.commands[i])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ZfsVersion is an OpenZFS release, e.g. 2.2.4.
+type ZfsVersion struct {
+	major int
+	minor int
+	patch int
+}
+
+func (v ZfsVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+func (v ZfsVersion) atLeast(other ZfsVersion) bool {
+	if v.major != other.major {
+		return v.major > other.major
+	}
+	if v.minor != other.minor {
+		return v.minor > other.minor
+	}
+	return v.patch >= other.patch
+}
+
+var zfsVersionPattern = regexp.MustCompile(`^zfs-(kmod-)?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseZfsVersion parses the output of `zfs version`, e.g.
+//
+//	zfs-2.2.2-0ubuntu9
+//	zfs-kmod-2.2.2-0ubuntu9
+//
+// The version of the kernel module is preferred, as it decides which properties are supported.
+func parseZfsVersion(output string) (*ZfsVersion, error) {
+	var found *ZfsVersion
+	for _, line := range strings.Split(output, "\n") {
+		match := zfsVersionPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		version := &ZfsVersion{}
+		version.major, _ = strconv.Atoi(match[2])
+		version.minor, _ = strconv.Atoi(match[3])
+		if match[4] != "" {
+			version.patch, _ = strconv.Atoi(match[4])
+		}
+		if match[1] != "" {
+			return version, nil
+		}
+		found = version
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unrecognized zfs version %q", output)
+	}
+	return found, nil
+}
+
+// hostZfsVersion returns the OpenZFS version of the host, which is read once per provider instance. It returns nil
+// if the version can't be told, e.g. on releases before 0.8 which lack `zfs version`.
+func hostZfsVersion(config *Config) *ZfsVersion {
+	config.version_once.Do(func() {
+		stdout, err := callSshCommand(config, "zfs version 2>/dev/null || true")
+		if err != nil {
+			log.Printf("[DEBUG] failed to read the zfs version: %s", err)
+			return
+		}
+		version, err := parseZfsVersion(stdout)
+		if err != nil {
+			log.Printf("[DEBUG] %s", err)
+			return
+		}
+		log.Printf("[DEBUG] zfs version: %s", version)
+		config.zfs_version = version
+	})
+	return config.zfs_version
+}
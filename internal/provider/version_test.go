@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"testing"
+)
+
+// TestParseZfsVersion verifies the version of the kernel module is preferred over the userland version.
+func TestParseZfsVersion(t *testing.T) {
+	for output, expected := range map[string]ZfsVersion{
+		"zfs-2.2.2-0ubuntu9\nzfs-kmod-2.1.5-1ubuntu6": {major: 2, minor: 1, patch: 5},
+		"zfs-2.3.0-1":                     {major: 2, minor: 3, patch: 0},
+		"zfs-2.2.99-1\nzfs-kmod-v2024.01": {major: 2, minor: 2, patch: 99},
+		"zfs-0.8":                         {major: 0, minor: 8},
+	} {
+		version, err := parseZfsVersion(output)
+		if err != nil {
+			t.Fatalf("parseZfsVersion(%q) returned error: %v", output, err)
+		}
+		if *version != expected {
+			t.Fatalf("parseZfsVersion(%q): expected %s, got %s", output, expected, version)
+		}
+	}
+
+	if _, err := parseZfsVersion("zfs: command not found"); err == nil {
+		t.Fatalf("expected an error for unrecognized output")
+	}
+}
+
+// TestCheckPropertyVersions verifies newer properties are rejected on older hosts, and the host is only asked when needed.
+func TestCheckPropertyVersions(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zfs version", "zfs-2.2.4-1\nzfs-kmod-2.2.4-1")
+	config := newFakeConfig(executor)
+
+	if err := checkPropertyVersions(config, map[string]string{"compression": "lz4"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(executor.commands) != 0 {
+		t.Fatalf("expected no commands without newer properties, ran %v", executor.commands)
+	}
+
+	if err := checkPropertyVersions(config, map[string]string{"prefetch": "metadata"}); err != nil {
+		t.Fatalf("expected prefetch to be supported on 2.2.4, got %s", err)
+	}
+	if err := checkPropertyVersions(config, map[string]string{"direct": "always", "prefetch": "none"}); err == nil {
+		t.Fatalf("expected direct to be rejected on 2.2.4")
+	}
+
+	unknown := newFakeConfig((&fakeExecutor{}).on("zfs version", ""))
+	if err := checkPropertyVersions(unknown, map[string]string{"direct": "always"}); err != nil {
+		t.Fatalf("expected hosts with an unknown version to be left to zfs, got %s", err)
+	}
+}
@@ -1,11 +1,16 @@
 package provider
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alessio/shellescape"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -45,7 +50,9 @@ func parsePropertySource(input string) (PropertySource, error) {
 	case "-":
 		return SourceNone, nil
 	default:
-		return "", fmt.Errorf("unrecognized source %s", input)
+		// Sources added by newer releases are kept as they are, rather than failing the whole read.
+		log.Printf("[WARN] unrecognized property source %q", input)
+		return PropertySource(parts[0]), nil
 	}
 }
 
@@ -56,6 +63,9 @@ var poolProperties = []string{
 	"autoexpand",
 	"autoreplace",
 	"autotrim",
+	"bcloneratio",
+	"bclonesaved",
+	"bcloneused",
 	"bootfs",
 	"cachefile",
 	"capacity",
@@ -80,6 +90,20 @@ var poolProperties = []string{
 	"version",
 }
 
+// poolPropertyDefaults are the default values of the settable zpool properties which can be reset, since there
+// is no `zfs inherit` equivalent for zpool. bootfs and compatibility are left out, as they have dedicated attributes.
+var poolPropertyDefaults = map[string]string{
+	"autoexpand":    "off",
+	"autoreplace":   "off",
+	"autotrim":      "off",
+	"cachefile":     "",
+	"comment":       "",
+	"delegation":    "on",
+	"failmode":      "wait",
+	"listsnapshots": "off",
+	"multihost":     "off",
+}
+
 func isPoolProperty(property string) bool {
 	for _, poolProperty := range poolProperties {
 		if property == poolProperty {
@@ -93,66 +117,155 @@ type Property struct {
 	source   PropertySource
 	value    string
 	rawValue string
+	// inheritedFrom is the dataset an inherited property is inherited from.
+	inheritedFrom string
 }
 
-func readSomeProperties(config *Config, baseCommand string, resourceName string, propertyName string, properties map[string]Property) error {
-	// First read the regular (formatted) values + the sources.
-	stdout, err := callSshCommand(config, "%s get -H -o property,source,value %s %s", baseCommand, propertyName, resourceName)
-	if err != nil {
-		return err
+// describeSource formats the source of a property the way zfs get does, e.g. "local" or "inherited from tank".
+func (property Property) describeSource() string {
+	switch property.source {
+	case SourceInherited:
+		if property.inheritedFrom != "" {
+			return "inherited from " + property.inheritedFrom
+		}
+	case SourceNone:
+		return "-"
 	}
+	return string(property.source)
+}
 
-	reader := csv.NewReader(strings.NewReader(stdout))
-	reader.Comma = '\t'
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
+// propertyOutputSeparator separates the formatted and the parsable output of zfs get, which are read in one go.
+const propertyOutputSeparator = "--terraform-provider-zfs--"
+
+// propertyGetCommand returns a command printing the formatted values and sources of properties, followed by
+// propertyOutputSeparator and the parsable values, so both are read with a single round trip to the host.
+// options are passed to both invocations, e.g. "-r" to include descendants.
+func propertyGetCommand(config *Config, baseCommand string, options string, propertyName string, resourceName string) string {
+	if useJsonOutput(config) {
+		return fmt.Sprintf("%s get -j%s %s %s && echo %s && %s get -jp%s %s %s",
+			baseCommand, options, propertyName, resourceName, propertyOutputSeparator, baseCommand, options, propertyName, resourceName)
+	}
+	return fmt.Sprintf("%s get%s -H -o %s %s %s && echo %s && %s get%s -Hp -o %s %s %s",
+		baseCommand, options, strings.Join(propertyColumns, ","), propertyName, resourceName, propertyOutputSeparator,
+		baseCommand, options, strings.Join(rawPropertyColumns, ","), propertyName, resourceName)
+}
+
+// propertyColumns and rawPropertyColumns are the columns requested from zfs get and zpool get, and read back by
+// name, so that the output doesn't depend on the default columns of the release.
+var (
+	propertyColumns    = []string{"name", "property", "source", "value"}
+	rawPropertyColumns = []string{"name", "property", "value"}
+)
+
+// parseColumns splits tab separated output of -H into rows keyed by column name. The last column takes the rest of
+// the line, as values may contain tabs themselves.
+func parseColumns(output string, columns []string) ([]map[string]string, error) {
+	rows := make([]map[string]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.SplitN(line, "\t", len(columns))
+		if len(fields) < len(columns) {
+			return nil, fmt.Errorf("expected %d columns (%s), got %q", len(columns), strings.Join(columns, ","), line)
 		}
 
-		name := line[0]
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[column] = fields[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// splitPropertyOutput splits the output of a propertyGetCommand into the formatted and the parsable part.
+func splitPropertyOutput(stdout string) (string, string, error) {
+	parts := strings.SplitN(stdout, propertyOutputSeparator, 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("unexpected property output %q", stdout)
+	}
+	return strings.Trim(parts[0], "\n"), strings.Trim(parts[1], "\n"), nil
+}
+
+// parsePropertyOutput parses the output of a propertyGetCommand into the properties of every dataset or pool in it.
+func parsePropertyOutput(config *Config, stdout string) (map[string]map[string]Property, error) {
+	formatted, raw, err := splitPropertyOutput(stdout)
+	if err != nil {
+		return nil, err
+	}
+	if useJsonOutput(config) {
+		return parseJsonPropertyOutput(formatted, raw)
+	}
+
+	resources := make(map[string]map[string]Property)
+
+	// First read the regular (formatted) values + the sources.
+	rows, err := parseColumns(formatted, propertyColumns)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		resourceName, name := row["name"], row["property"]
 		property := Property{}
-		property.value = line[2]
-		if source, err := parsePropertySource(line[1]); err == nil {
+		property.value = row["value"]
+		if source, err := parsePropertySource(row["source"]); err == nil {
 			property.source = source
+			property.inheritedFrom = strings.TrimPrefix(row["source"], "inherited from ")
+			if source != SourceInherited {
+				property.inheritedFrom = ""
+			}
 		} else {
-			return fmt.Errorf("Error in property %s: %s", name, err)
+			return nil, fmt.Errorf("Error in property %s: %s", name, err)
 		}
-		properties[name] = property
+		if resources[resourceName] == nil {
+			resources[resourceName] = make(map[string]Property)
+		}
+		resources[resourceName][name] = property
 	}
 
 	// Then read the properties again in -p(arsable) mode to get the raw values.
-	stdout, err = callSshCommand(config, "%s get -Hp -o property,value %s %s", baseCommand, propertyName, resourceName)
+	rows, err = parseColumns(raw, rawPropertyColumns)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	reader = csv.NewReader(strings.NewReader(stdout))
-	reader.Comma = '\t'
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
-
-		name := line[0]
-		property, ok := properties[name]
+	for _, row := range rows {
+		resourceName, name := row["name"], row["property"]
+		property, ok := resources[resourceName][name]
 		if !ok {
 			continue
 		}
-		property.rawValue = line[1]
-		properties[name] = property
+		property.rawValue = row["value"]
+		resources[resourceName][name] = property
+	}
+
+	return resources, nil
+}
+
+func readSomeProperties(config *Config, baseCommand string, resourceName string, propertyName string, properties map[string]Property) error {
+	stdout, err := callSshCommand(config, "%s", propertyGetCommand(config, baseCommand, "", propertyName, resourceName))
+	if err != nil {
+		return err
 	}
 
+	resources, err := parsePropertyOutput(config, stdout)
+	if err != nil {
+		return err
+	}
+
+	for name, property := range resources[resourceName] {
+		properties[name] = property
+	}
 	return nil
 }
 
 func readAllProperties(config *Config, baseCommand string, resourceName string, requiredProperties []string, properties map[string]Property) error {
-	if err := readSomeProperties(config, baseCommand, resourceName, "all", properties); err != nil {
+	if cached, ok := config.property_cache.lookup(config, baseCommand, resourceName); ok {
+		for name, property := range cached {
+			properties[name] = property
+		}
+	} else if err := readSomeProperties(config, baseCommand, resourceName, "all", properties); err != nil {
 		return err
 	}
 	// Most properties will have been fetched by querying 'all', but some are only returned when specifically asked for
@@ -195,7 +308,13 @@ func updateCalculatedPropertiesInState(d *schema.ResourceData, properties map[st
 	if err := d.Set("properties", flattenProperties(properties)); err != nil {
 		return err
 	}
-	return d.Set("raw_properties", flattenRawProperties(properties))
+	if err := d.Set("raw_properties", flattenRawProperties(properties)); err != nil {
+		return err
+	}
+	if err := d.Set("property_sources", flattenPropertySources(properties)); err != nil {
+		return err
+	}
+	return d.Set("properties_numeric", flattenNumericProperties(properties))
 }
 
 func updatePropertiesInState(d *schema.ResourceData, properties map[string]Property, ignoredProperties []string) error {
@@ -204,9 +323,11 @@ func updatePropertiesInState(d *schema.ResourceData, properties map[string]Prope
 	}
 
 	defined := make(map[string]string)
+	inherited := make(map[string]bool)
 	for _, property := range d.Get("property").(*schema.Set).List() {
 		property := property.(map[string]interface{})
 		defined[property["name"].(string)] = property["value"].(string)
+		inherited[property["name"].(string)] = property["inherit"].(bool)
 	}
 
 	ignored := make(map[string]bool)
@@ -242,12 +363,17 @@ func updatePropertiesInState(d *schema.ResourceData, properties map[string]Prope
 					// Ignore properties that aren't in some way overridden on the resource.
 					continue
 				}
-				if isPoolProperty(name) {
-					// Pool properties cannot be reset to a default value (as there is no `zfs inherit` equivalent for zpool),
+				if _, ok := poolPropertyDefaults[name]; isPoolProperty(name) && !ok {
+					// Most pool properties cannot be reset to a default value (as there is no `zfs inherit` equivalent for zpool),
 					// so there is no point tracking these unless they are defined in the property (in which case we have a
 					// target value).
 					continue
 				}
+				if isCreateOnlyProperty(name) {
+					// Properties which can only be set on creation can't be reset either.
+					continue
+				}
+				log.Printf("[WARN] %s is set locally to %s but not defined in the configuration, it will be reset", name, property.value)
 			default:
 				return fmt.Errorf("invalid value %s for property_mode", mode)
 			}
@@ -258,15 +384,26 @@ func updatePropertiesInState(d *schema.ResourceData, properties map[string]Prope
 		if defined[name] == property.rawValue {
 			block["value"] = property.rawValue
 		}
+		// A property which should be inherited only matches the configuration while it isn't set on the dataset itself.
+		if inherited[name] && (property.source == SourceInherited || property.source == SourceDefault || property.source == SourceNone) {
+			block["value"] = ""
+			block["inherit"] = true
+		}
 		blocks = append(blocks, block)
 	}
 	return d.Set("property", blocks)
 }
 
 func getResetCommand(property string) (string, bool) {
+	if value, ok := poolPropertyDefaults[property]; ok {
+		return fmt.Sprintf("zpool set %s=%s", property, shellescape.Quote(value)), true
+	}
 	if isPoolProperty(property) {
 		return "zpool properties cannot be reset back to a default value", false
 	}
+	if isCreateOnlyProperty(property) {
+		return fmt.Sprintf("%s can only be set on creation", property), false
+	}
 	if strings.Contains(property, "quota@") {
 		return fmt.Sprintf("zfs set %s=none", shellescape.Quote(property)), true
 	}
@@ -297,13 +434,24 @@ func applyPropertyDiff(
 		newProperties.Add(property)
 	}
 
-	// Unset (inherit) all properties that are no longer defined.
+	// Unset (inherit) all properties that are no longer defined. Properties which only changed value are set below.
+	// A failing property doesn't stop the others from being applied, all failures are reported together at the end.
+	applyErr := &PropertyApplyError{applied: make([]string, 0), failed: make(map[string]error)}
+	desiredProperties := parsePropertyBlocks(newProperties.List())
 	removedProperties := parsePropertyBlocks(oldProperties.Difference(newProperties).List())
 	log.Printf("[DEBUG] removed properties: %s", removedProperties)
-	for property := range removedProperties {
+	inheritedProperties := parseInheritBlocks(newProperties.List())
+	removedNames := mapKeys(removedProperties)
+	sort.Strings(removedNames)
+	for _, property := range removedNames {
+		if _, ok := desiredProperties[property]; ok || contains(inheritedProperties, property) {
+			continue
+		}
 		if result, ok := getResetCommand(property); ok {
 			if _, err := callSshCommand(config, "%s %s", result, targetName); err != nil {
-				return err
+				applyErr.failed[property] = err
+			} else {
+				applyErr.applied = append(applyErr.applied, property)
 			}
 		} else {
 			log.Printf("%s, leaving %s at whatever value it's currently at", result, property)
@@ -311,21 +459,38 @@ func applyPropertyDiff(
 	}
 
 	// Update properties which don't match the desired state.
-	desiredProperties := parsePropertyBlocks(newProperties.List())
 	log.Printf("[DEBUG] desired properties: %s", desiredProperties)
 	log.Printf("[DEBUG] actual properties: %s", actualProperties)
-	for name, value := range desiredProperties {
-		if value != actualProperties[name].value {
+	for _, name := range orderPropertyChanges(desiredProperties, actualProperties) {
+		if value := desiredProperties[name]; value != actualProperties[name].value {
 			baseCommand := "zfs"
 			if isPoolProperty(name) {
 				baseCommand = "zpool"
 			}
 			if _, err := callSshCommand(config, "%s set %s=%s %s", baseCommand, shellescape.Quote(name), shellescape.Quote(value), targetName); err != nil {
-				return err
+				applyErr.failed[name] = err
+			} else {
+				applyErr.applied = append(applyErr.applied, name)
 			}
 		}
 	}
 
+	// Reset properties which should be inherited, but are set locally or received.
+	for _, name := range inheritedProperties {
+		switch actualProperties[name].source {
+		case SourceInherited, SourceDefault, SourceNone:
+			continue
+		}
+		if _, err := callSshCommand(config, "zfs inherit %s %s", shellescape.Quote(name), targetName); err != nil {
+			applyErr.failed[name] = err
+		} else {
+			applyErr.applied = append(applyErr.applied, name)
+		}
+	}
+
+	if len(applyErr.failed) > 0 {
+		return applyErr
+	}
 	return nil
 }
 
@@ -342,13 +507,46 @@ type Dataset struct {
 	properties map[string]Property
 }
 
-func getZfsResourceNameByGuid(config *Config, resource_type string, guid string) (*string, error) {
-	stdout, err := callSshCommand(config, "%s list -H -o name,guid", resource_type)
+// getZfsResourceNameByGuid finds the current name of a dataset or pool. The last known name is checked first,
+// so the (potentially long) list of all datasets is only needed when the resource was renamed outside of terraform.
+// Datasets can't be renamed into another pool, so only the pool of the last known name is listed.
+func getZfsResourceNameByGuid(config *Config, resource_type string, name string, guid string) (*string, error) {
+	if name != "" {
+		stdout, err := callSshCommand(config, "%s get -H -o value guid %s", resource_type, shellescape.Quote(name))
+		if err == nil && strings.TrimSpace(stdout) == guid {
+			return &name, nil
+		}
+	}
+
+	options := "-H"
+	if useJsonOutput(config) {
+		options = "-j"
+	}
+	command := fmt.Sprintf("%s list %s -o name,guid", resource_type, options)
+	if resource_type == "zfs" {
+		command = fmt.Sprintf("zfs list %s -t filesystem,volume -o name,guid", options)
+		if name != "" {
+			command += " -r " + shellescape.Quote(poolOf(name))
+		}
+	}
+	stdout, err := callSshCommand(config, "%s", command)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if useJsonOutput(config) {
+		found, err := findJsonResourceByGuid(stdout, guid)
+		if err != nil {
+			return nil, err
+		}
+		if found != "" {
+			log.Printf("[DEBUG] found resource by guid: %s", found)
+			return &found, nil
+		}
+		return nil, resourceNotFoundByGuid(resource_type, guid)
+	}
+
 	reader := csv.NewReader(strings.NewReader(stdout))
 	reader.Comma = '\t'
 
@@ -365,15 +563,23 @@ func getZfsResourceNameByGuid(config *Config, resource_type string, guid string)
 		}
 	}
 
-	return nil, fmt.Errorf("no resource found with guid %s", guid)
+	return nil, resourceNotFoundByGuid(resource_type, guid)
+}
+
+func resourceNotFoundByGuid(resource_type string, guid string) error {
+	errmsg := fmt.Sprintf("no resource found with guid %s", guid)
+	if resource_type == "zpool" {
+		return &PoolError{errmsg: errmsg}
+	}
+	return &DatasetError{errmsg: errmsg}
 }
 
-func getDatasetNameByGuid(config *Config, guid string) (*string, error) {
-	return getZfsResourceNameByGuid(config, "zfs", guid)
+func getDatasetNameByGuid(config *Config, name string, guid string) (*string, error) {
+	return getZfsResourceNameByGuid(config, "zfs", name, guid)
 }
 
-func getPoolNameByGuid(config *Config, guid string) (*string, error) {
-	return getZfsResourceNameByGuid(config, "zpool", guid)
+func getPoolNameByGuid(config *Config, name string, guid string) (*string, error) {
+	return getZfsResourceNameByGuid(config, "zpool", name, guid)
 }
 
 func describeDataset(config *Config, datasetName string, requiredProperties []string) (*Dataset, error) {
@@ -406,34 +612,60 @@ func describeDataset(config *Config, datasetName string, requiredProperties []st
 }
 
 type Device struct {
-	path string
+	path        string
+	waitTimeout string
 }
 
 type Mirror struct {
 	devices []Device
 }
 
+type Raidz struct {
+	parity  int
+	devices []Device
+}
+
 type Pool struct {
 	guid       string
 	properties map[string]Property
 	layout     PoolLayout
+	status     *PoolStatus
+	usage      *PoolUsage
 }
 
 type PoolLayout struct {
 	mirrors []Mirror
+	raidz   []Raidz
 	striped []Device
+	logs    []Device
+	caches  []Device
 }
 
 func readPoolLayout(config *Config, poolName string) (*PoolLayout, error) {
 	log.Printf("[DEBUG] reading zpool layout for %s", poolName)
+	if useJsonOutput(config) {
+		stdout, err := callSshCommand(config, "zpool status -j -P %s", poolName)
+		if err != nil {
+			return nil, err
+		}
+		return parseJsonPoolLayout(stdout, poolName)
+	}
+
 	stdout, err := callSshCommand(config, "zpool list -HPv %s", poolName)
 
 	if err != nil {
 		return nil, err
 	}
 
-	reader := csv.NewReader(strings.NewReader(stdout))
+	return parsePoolLayout(stdout)
+}
+
+func parsePoolLayout(output string) (*PoolLayout, error) {
+	reader := csv.NewReader(strings.NewReader(output))
 	reader.Comma = '\t'
+	// Section headers such as "cache" are not printed in scripted form, so lines
+	// don't necessarily have the same number of fields.
+	reader.FieldsPerRecord = -1
 
 	// First line of zpool list output is the pool name/statistics themselves,
 	// so we skip this line, of course making sure that the read itself works.
@@ -448,9 +680,14 @@ func readPoolLayout(config *Config, poolName string) (*PoolLayout, error) {
 
 	layout := PoolLayout{
 		mirrors: make([]Mirror, 0),
+		raidz:   make([]Raidz, 0),
 		striped: make([]Device, 0),
+		logs:    make([]Device, 0),
+		caches:  make([]Device, 0),
 	}
 
+	section := ""
+	group := ""
 	for {
 		line, err := reader.Read()
 		if err == io.EOF {
@@ -459,35 +696,82 @@ func readPoolLayout(config *Config, poolName string) (*PoolLayout, error) {
 			return nil, err
 		}
 
-		// All vdevs prefixed with "mirror" indicate the start of a mirrored vdev definition.
-		// mirror* is also a reserved name so we know that if it starts with mirror, it is a mirror.
-		// This is further ensured because we use the -P flag (use full path) with the zpool list
-		// command, meaning all divide vdevs should start with a a forward slash.
-		if strings.HasPrefix(line[1], "mirror") {
-			layout.mirrors = append(layout.mirrors, Mirror{
-				devices: make([]Device, 0),
-			})
-		} else {
+		// vdev lines start with an empty column, section headers may not.
+		name := strings.TrimSpace(line[0])
+		if name == "" && len(line) > 1 {
+			name = line[1]
+		}
+		if fields := strings.Fields(name); len(fields) > 0 {
+			name = fields[0]
+		}
+
+		switch name {
+		case "logs", "cache", "spare", "spares", "dedup", "special":
+			section = name
+			continue
+		}
+
+		// While a device is being replaced, both the old and the new device are grouped under a
+		// temporary "replacing-N" vdev inside the mirror. The grouping itself isn't part of the layout.
+		if strings.HasPrefix(name, "replacing-") {
+			continue
+		}
 
-			// If no mirror vdev has been instantiated, this is just a plain striped vdev.
-			if len(layout.mirrors) == 0 {
-				layout.striped = append(layout.striped, Device{
-					path: line[1],
+		switch section {
+		case "":
+			// All vdevs prefixed with "mirror" indicate the start of a mirrored vdev definition.
+			// mirror* is also a reserved name so we know that if it starts with mirror, it is a mirror.
+			// This is further ensured because we use the -P flag (use full path) with the zpool list
+			// command, meaning all divide vdevs should start with a a forward slash.
+			// The same goes for raidz, which is listed as raidz<parity>-<index>.
+			if strings.HasPrefix(name, "mirror") {
+				layout.mirrors = append(layout.mirrors, Mirror{
+					devices: make([]Device, 0),
 				})
+				group = "mirror"
+			} else if strings.HasPrefix(name, "raidz") {
+				parity := 1
+				if _, err := fmt.Sscanf(name, "raidz%d-", &parity); err != nil {
+					log.Printf("[DEBUG] assuming single parity for %s", name)
+				}
+				layout.raidz = append(layout.raidz, Raidz{
+					parity:  parity,
+					devices: make([]Device, 0),
+				})
+				group = "raidz"
 			} else {
-				// Otherwise, this vdev belongs to the last defined mirror.
-				mirror := &layout.mirrors[len(layout.mirrors)-1]
-				mirror.devices = append(mirror.devices, Device{path: line[1]})
+				switch group {
+				case "mirror":
+					// This vdev belongs to the last defined mirror.
+					mirror := &layout.mirrors[len(layout.mirrors)-1]
+					mirror.devices = append(mirror.devices, Device{path: name})
+				case "raidz":
+					raidz := &layout.raidz[len(layout.raidz)-1]
+					raidz.devices = append(raidz.devices, Device{path: name})
+				default:
+					// If no mirror or raidz vdev has been instantiated, this is just a plain striped vdev.
+					layout.striped = append(layout.striped, Device{
+						path: name,
+					})
+				}
 			}
+		case "logs":
+			layout.logs = append(layout.logs, Device{path: name})
+		case "cache":
+			layout.caches = append(layout.caches, Device{path: name})
+		default:
+			log.Printf("[DEBUG] ignoring %s vdev %s", section, name)
 		}
 	}
 
-	log.Printf("[DEBUG] pool layout: %s", layout)
+	log.Printf("[DEBUG] pool layout: %v", layout)
 
 	return &layout, nil
 }
 
-func describePool(config *Config, poolName string, requiredProperties []string) (*Pool, error) {
+// describePool reads the layout and properties of a pool. Its status is only read with withStatus, as that takes
+// another zpool status, and is left nil otherwise.
+func describePool(config *Config, poolName string, requiredProperties []string, withStatus bool) (*Pool, error) {
 	layout, err := readPoolLayout(config, poolName)
 	if err != nil {
 		return nil, err
@@ -501,25 +785,118 @@ func describePool(config *Config, poolName string, requiredProperties []string)
 		return nil, err
 	}
 
+	var status *PoolStatus
+	if withStatus {
+		if status, err = describePoolStatus(config, poolName); err != nil {
+			return nil, err
+		}
+	}
+
+	// The usage is part of the pool properties which were read already, so there's no need for a zpool list.
+	usage, err := poolUsageFromProperties(properties)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Pool{
 		guid:       properties["guid"].value,
 		properties: properties,
 		layout:     *layout,
+		status:     status,
+		usage:      usage,
 	}, nil
 }
 
+var createParentsSchema = schema.Schema{
+	Description: "Create missing parent datasets, like `zfs create -p`, so e.g. `tank/a/b/c` can be created without managing `tank/a` and `tank/a/b`. The parents are created with default properties, the `property` blocks only apply to this dataset. They are also created when the dataset is renamed below a missing parent. Parents managed by terraform should be referenced instead, so they are created first. Defaults to `false`.",
+	Type:        schema.TypeBool,
+	Optional:    true,
+	Default:     false,
+}
+
+var allowExternalRenameSchema = schema.Schema{
+	Description: "Adopt the new name when the dataset is renamed outside of terraform, instead of renaming it back on the next apply. The dataset is tracked by its guid either way, so a rename never replaces it. `name` keeps the configured name, `current_name` follows the dataset. Changing `name` still renames the dataset. Defaults to `false`.",
+	Type:        schema.TypeBool,
+	Optional:    true,
+	Default:     false,
+}
+
+var renameOnNameChangeSchema = schema.Schema{
+	Description: "Rename the dataset with `zfs rename` when `name` changes, which keeps its data, snapshots and children. Otherwise the dataset is destroyed and created anew under the new name. Moving a dataset into another pool always replaces it, since zfs can't rename across pools. Defaults to `true`.",
+	Type:        schema.TypeBool,
+	Optional:    true,
+	Default:     true,
+}
+
+var forceUnmountOnRenameSchema = schema.Schema{
+	Description: "Forcibly unmount the dataset and its children when renaming it, like `zfs rename -f`, rather than failing when one of their mountpoints is busy. They are mounted again at their new mountpoints afterwards. Defaults to `false`.",
+	Type:        schema.TypeBool,
+	Optional:    true,
+	Default:     false,
+}
+
+// forceNewOnNameChange replaces a dataset whose name changes, unless it can be renamed in place.
+func forceNewOnNameChange(d *schema.ResourceDiff) error {
+	if d.Id() == "" || !d.HasChange("name") || !d.NewValueKnown("name") {
+		return nil
+	}
+
+	oldName, newName := d.GetChange("name")
+	if !d.Get("rename_on_name_change").(bool) || poolOf(oldName.(string)) != poolOf(newName.(string)) {
+		return d.ForceNew("name")
+	}
+	return nil
+}
+
+var currentNameSchema = schema.Schema{
+	Description: "Actual name of the dataset. Differs from `name` when the dataset was renamed outside of terraform and `allow_external_rename` is set.",
+	Type:        schema.TypeString,
+	Computed:    true,
+}
+
+// reconcileDatasetName records the actual name of a dataset, which was found by its guid. A dataset renamed outside of
+// terraform shows up as a change of its name, which renames it back, unless allow_external_rename adopts the new name.
+func reconcileDatasetName(d *schema.ResourceData, actualName string) error {
+	name := d.Get("name").(string)
+	if name != actualName && name != "" && d.Get("allow_external_rename").(bool) {
+		log.Printf("[WARN] dataset %s was renamed to %s outside of terraform, adopting the new name", name, actualName)
+	} else {
+		if name != actualName && name != "" {
+			log.Printf("[WARN] dataset %s was renamed to %s outside of terraform", name, actualName)
+		}
+		if err := d.Set("name", actualName); err != nil {
+			return err
+		}
+	}
+	return d.Set("current_name", actualName)
+}
+
+// currentDatasetName returns the actual name of the dataset of a resource, as recorded by reconcileDatasetName.
+func currentDatasetName(d *schema.ResourceData) string {
+	if name := d.Get("current_name").(string); name != "" {
+		return name
+	}
+	return d.Get("name").(string)
+}
+
 type CreateDataset struct {
-	dsType     DatasetType
-	name       string
-	mountpoint string
-	volsize    string
-	sparse     bool
-	properties map[string]string
+	dsType        DatasetType
+	name          string
+	mountpoint    string
+	volsize       string
+	sparse        bool
+	createParents bool
+	properties    map[string]string
 }
 
-func createDataset(config *Config, dataset *CreateDataset) (*Dataset, error) {
+func createDataset(ctx context.Context, config *Config, dataset *CreateDataset) (*Dataset, error) {
 	properties := dataset.properties
 	serialized_options := ""
+	if dataset.createParents {
+		// Parents are created by the same command, which runs one at a time per pool, so datasets sharing
+		// missing parents don't race each other to create them.
+		serialized_options += " -p"
+	}
 
 	switch dataset.dsType {
 	case FilesystemType:
@@ -537,7 +914,7 @@ func createDataset(config *Config, dataset *CreateDataset) (*Dataset, error) {
 		serialized_options += fmt.Sprintf(" -o %s=%s", shellescape.Quote(property), shellescape.Quote(value))
 	}
 
-	_, err := callSshCommand(config, "zfs create %s %s", serialized_options, dataset.name)
+	_, err := callSshCommandContext(ctx, config, "zfs create %s %s", serialized_options, dataset.name)
 
 	if err != nil {
 		// We might have an error, but it's possible that the dataset was still created
@@ -555,13 +932,39 @@ func createDataset(config *Config, dataset *CreateDataset) (*Dataset, error) {
 	return fetch_dataset, fetcherr
 }
 
-func destroyDataset(config *Config, datasetName string) error {
-	_, err := callSshCommand(config, "zfs destroy -r %s", datasetName)
+func destroyDataset(ctx context.Context, config *Config, datasetName string) error {
+	_, err := callSshCommandContext(ctx, config, "zfs destroy -r %s", datasetName)
+	return err
+}
+
+func renameDataset(ctx context.Context, config *Config, oldName string, newName string, createParents bool, forceUnmount bool) error {
+	options := ""
+	if createParents {
+		options += " -p"
+	}
+	if forceUnmount {
+		options += " -f"
+	}
+	_, err := callSshCommandContext(ctx, config, "zfs rename%s %s %s", options, oldName, newName)
 	return err
 }
 
-func renameDataset(config *Config, oldName string, newName string) error {
-	_, err := callSshCommand(config, "zfs rename %s %s", oldName, newName)
+// setMounted mounts or unmounts a filesystem, unless it already is in the desired state.
+func setMounted(ctx context.Context, config *Config, datasetName string, mounted bool) error {
+	stdout, err := callSshCommand(config, "zfs get -H -o value mounted %s", datasetName)
+	if err != nil {
+		return err
+	}
+
+	if (stdout == "yes") == mounted {
+		return nil
+	}
+
+	if mounted {
+		_, err = callSshCommandContext(ctx, config, "zfs mount %s", datasetName)
+	} else {
+		_, err = callSshCommandContext(ctx, config, "zfs unmount %s", datasetName)
+	}
 	return err
 }
 
@@ -571,7 +974,7 @@ type CreatePool struct {
 	properties map[string]string
 }
 
-func createPool(config *Config, pool *CreatePool) (*Pool, error) {
+func createPool(ctx context.Context, config *Config, pool *CreatePool) (*Pool, error) {
 	serialized_options := ""
 	for property, value := range pool.properties {
 		if isPoolProperty(property) {
@@ -581,11 +984,11 @@ func createPool(config *Config, pool *CreatePool) (*Pool, error) {
 		}
 	}
 
-	_, err := callSshCommand(config, "zpool create %s %s %s", serialized_options, pool.name, pool.vdevs)
+	_, err := callSshCommandContext(ctx, config, "zpool create %s %s %s", serialized_options, pool.name, pool.vdevs)
 
 	if err != nil {
 		// We might have an error, but it's possible that the pool was still created
-		fetch_pool, fetcherr := describePool(config, pool.name, mapKeys(pool.properties))
+		fetch_pool, fetcherr := describePool(config, pool.name, mapKeys(pool.properties), true)
 
 		// This is really dumb, but return both?
 		if fetcherr != nil {
@@ -595,23 +998,50 @@ func createPool(config *Config, pool *CreatePool) (*Pool, error) {
 		return nil, err
 	}
 
-	fetch_pool, fetcherr := describePool(config, pool.name, mapKeys(pool.properties))
+	fetch_pool, fetcherr := describePool(config, pool.name, mapKeys(pool.properties), true)
 	return fetch_pool, fetcherr
 }
 
-func renamePool(config *Config, oldName string, newName string) error {
-	_, err := callSshCommand(config, "zpool export %s", oldName)
+// addVdevs adds new top-level vdevs to an existing pool. vdevs uses the same syntax as zpool create,
+// e.g. "mirror /dev/sda /dev/sdb" or "log /dev/nvme0n1".
+func addVdevs(ctx context.Context, config *Config, poolName string, vdevs string) error {
+	_, err := callSshCommandContext(ctx, config, "zpool add %s %s", poolName, vdevs)
+	return err
+}
+
+// removeVdev removes a device from a pool. Only log, cache and spare devices are removed this way.
+func removeVdev(ctx context.Context, config *Config, poolName string, device string) error {
+	_, err := callSshCommandContext(ctx, config, "zpool remove %s %s", poolName, shellescape.Quote(device))
+	return err
+}
+
+func renamePool(ctx context.Context, config *Config, oldName string, newName string) error {
+	_, err := callSshCommandContext(ctx, config, "zpool export %s", oldName)
 	if err != nil {
 		return err
 	}
 
-	_, err = callSshCommand(config, "zpool import %s %s", oldName, newName)
+	_, err = callSshCommandContext(ctx, config, "zpool import %s %s", oldName, newName)
 
 	return err
 }
 
-func destroyPool(config *Config, poolName string) error {
-	_, err := callSshCommand(config, "zpool destroy %s", poolName)
+// What happens to a pool when its resource is destroyed.
+const (
+	DestroyBehaviorDestroy = "destroy"
+	DestroyBehaviorExport  = "export"
+	DestroyBehaviorAbandon = "abandon"
+)
+
+var destroyBehaviors = []string{DestroyBehaviorDestroy, DestroyBehaviorExport, DestroyBehaviorAbandon}
+
+func destroyPool(ctx context.Context, config *Config, poolName string) error {
+	_, err := callSshCommandContext(ctx, config, "zpool destroy %s", poolName)
+	return err
+}
+
+func exportPool(ctx context.Context, config *Config, poolName string) error {
+	_, err := callSshCommandContext(ctx, config, "zpool export %s", poolName)
 	return err
 }
 
@@ -635,6 +1065,43 @@ func flattenRawProperties(properties map[string]Property) map[string]interface{}
 	return out
 }
 
+func flattenPropertySources(properties map[string]Property) map[string]interface{} {
+	out := make(map[string]interface{})
+	for name, property := range properties {
+		out[name] = property.describeSource()
+	}
+
+	return out
+}
+
+// identifierProperties are numeric properties which identify something rather than measure it. Most are
+// 64 bit numbers, which don't fit the float of a number in state exactly.
+var identifierProperties = map[string]bool{
+	"guid":      true,
+	"load_guid": true,
+	"objsetid":  true,
+	"createtxg": true,
+}
+
+// flattenNumericProperties converts the raw values of numeric properties to numbers. The raw values of sizes are
+// bytes already, ratios and percentages lose their "x" or "%" suffix if the host prints one.
+func flattenNumericProperties(properties map[string]Property) map[string]interface{} {
+	out := make(map[string]interface{})
+	for name, property := range properties {
+		if identifierProperties[name] {
+			continue
+		}
+		value := strings.TrimSuffix(strings.TrimSuffix(property.rawValue, "x"), "%")
+		number, err := parseDecimal(value)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			continue
+		}
+		out[name] = number
+	}
+
+	return out
+}
+
 func flattenMirror(mirror Mirror) map[string]interface{} {
 	out := make(map[string]interface{})
 	devices := make([]map[string]interface{}, len(mirror.devices))
@@ -647,9 +1114,548 @@ func flattenMirror(mirror Mirror) map[string]interface{} {
 	return out
 }
 
+// serializeDataVdevs formats the data vdevs of a layout the same way they would be passed to zpool create.
+func serializeDataVdevs(layout PoolLayout) string {
+	vdevs := make([]string, 0)
+	for _, mirror := range layout.mirrors {
+		vdevs = append(vdevs, "mirror")
+		for _, device := range mirror.devices {
+			vdevs = append(vdevs, device.path)
+		}
+	}
+	for _, raidz := range layout.raidz {
+		vdevs = append(vdevs, fmt.Sprintf("raidz%d", raidz.parity))
+		for _, device := range raidz.devices {
+			vdevs = append(vdevs, device.path)
+		}
+	}
+	for _, device := range layout.striped {
+		vdevs = append(vdevs, device.path)
+	}
+	return strings.Join(vdevs, " ")
+}
+
 func flattenDevice(device Device) map[string]interface{} {
 	out := make(map[string]interface{})
 	out["path"] = device.path
+	out["wait_for_device_timeout"] = device.waitTimeout
 
 	return out
 }
+
+type PermissionPrincipal string
+
+const (
+	PrincipalUser     PermissionPrincipal = "user"
+	PrincipalGroup    PermissionPrincipal = "group"
+	PrincipalEveryone PermissionPrincipal = "everyone"
+)
+
+type PermissionScope string
+
+const (
+	PermissionScopeLocal           PermissionScope = "local"
+	PermissionScopeDescendent      PermissionScope = "descendent"
+	PermissionScopeLocalDescendent PermissionScope = "local+descendent"
+)
+
+var permissionScopes = []string{
+	string(PermissionScopeLocal),
+	string(PermissionScopeDescendent),
+	string(PermissionScopeLocalDescendent),
+}
+
+// Permissions is the allow table of a single dataset, keyed by scope, principal type and principal name.
+type Permissions map[string][]string
+
+func permissionKey(principal PermissionPrincipal, name string, scope PermissionScope) string {
+	return fmt.Sprintf("%s %s %s", scope, principal, name)
+}
+
+func (p Permissions) granted(principal PermissionPrincipal, name string, scope PermissionScope) []string {
+	return p[permissionKey(principal, name, scope)]
+}
+
+// parsePermissions parses the output of `zfs allow <dataset>`, which looks like this:
+//
+//	---- Permissions on tank/home ----------------------------------------
+//	Local+Descendent permissions:
+//		user cindys create,destroy,mount,snapshot
+//		everyone send
+//	---- Permissions on tank ---------------------------------------------
+//	Local permissions:
+//		group staff snapshot
+//
+// Permissions inherited from ancestors are listed as well, so only the section belonging to
+// the dataset itself is considered. Permission sets and create time permissions are ignored.
+func parsePermissions(output string, dataset string) Permissions {
+	permissions := make(Permissions)
+
+	var scope PermissionScope
+	inDataset := false
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "---- Permissions on ") {
+			name := strings.TrimPrefix(line, "---- Permissions on ")
+			name = strings.TrimSuffix(strings.TrimRight(name, "-"), " ")
+			inDataset = name == dataset
+			scope = ""
+			continue
+		}
+		if !inDataset {
+			continue
+		}
+
+		switch strings.TrimSpace(line) {
+		case "Local permissions:":
+			scope = PermissionScopeLocal
+			continue
+		case "Descendent permissions:":
+			scope = PermissionScopeDescendent
+			continue
+		case "Local+Descendent permissions:":
+			scope = PermissionScopeLocalDescendent
+			continue
+		case "Permission sets:", "Create time permissions:":
+			scope = ""
+			continue
+		}
+		if scope == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		var principal PermissionPrincipal
+		var name string
+		var granted string
+		switch {
+		case len(fields) == 2 && fields[0] == string(PrincipalEveryone):
+			principal, granted = PrincipalEveryone, fields[1]
+		case len(fields) == 3 && (fields[0] == string(PrincipalUser) || fields[0] == string(PrincipalGroup)):
+			principal, name, granted = PermissionPrincipal(fields[0]), fields[1], fields[2]
+		default:
+			log.Printf("[DEBUG] ignoring unrecognized zfs allow line: %s", line)
+			continue
+		}
+
+		key := permissionKey(principal, name, scope)
+		permissions[key] = append(permissions[key], strings.Split(granted, ",")...)
+	}
+
+	return permissions
+}
+
+func describePermissions(config *Config, datasetName string) (Permissions, error) {
+	stdout, err := callSshCommand(config, "zfs allow %s", shellescape.Quote(datasetName))
+	if err != nil {
+		return nil, err
+	}
+	return parsePermissions(stdout, datasetName), nil
+}
+
+func serializePermissionTarget(principal PermissionPrincipal, name string, scope PermissionScope) string {
+	options := ""
+	switch scope {
+	case PermissionScopeLocal:
+		options += "-l "
+	case PermissionScopeDescendent:
+		options += "-d "
+	}
+
+	switch principal {
+	case PrincipalUser:
+		options += "-u " + shellescape.Quote(name)
+	case PrincipalGroup:
+		options += "-g " + shellescape.Quote(name)
+	case PrincipalEveryone:
+		options += "-e"
+	}
+	return options
+}
+
+func allowPermissions(config *Config, datasetName string, principal PermissionPrincipal, name string, scope PermissionScope, permissions []string) error {
+	_, err := callSshCommand(config, "zfs allow %s %s %s", serializePermissionTarget(principal, name, scope), shellescape.Quote(strings.Join(permissions, ",")), shellescape.Quote(datasetName))
+	return err
+}
+
+func unallowPermissions(config *Config, datasetName string, principal PermissionPrincipal, name string, scope PermissionScope, permissions []string) error {
+	_, err := callSshCommand(config, "zfs unallow %s %s %s", serializePermissionTarget(principal, name, scope), shellescape.Quote(strings.Join(permissions, ",")), shellescape.Quote(datasetName))
+	return err
+}
+
+type Snapshot struct {
+	name     string
+	guid     string
+	creation int64
+}
+
+// listSnapshots returns the snapshots of a single dataset (not its descendents), oldest first.
+func listSnapshots(config *Config, datasetName string) ([]Snapshot, error) {
+	stdout, err := callSshCommand(config, "zfs list -H -p -t snapshot -d 1 -s createtxg -o name,guid,creation %s", shellescape.Quote(datasetName))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSnapshotList(stdout)
+}
+
+func parseSnapshotList(output string) ([]Snapshot, error) {
+	snapshots := make([]Snapshot, 0)
+
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.Comma = '\t'
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		creation, err := strconv.ParseInt(line[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid creation time %s for snapshot %s: %s", line[2], line[0], err)
+		}
+
+		snapshots = append(snapshots, Snapshot{
+			name:     line[0],
+			guid:     line[1],
+			creation: creation,
+		})
+	}
+
+	return snapshots, nil
+}
+
+// newestCommonSnapshot finds the most recent snapshot of source which also exists on target.
+// Snapshots keep their guid when sent and received, so they are matched by guid rather than name.
+func newestCommonSnapshot(source []Snapshot, target []Snapshot) *Snapshot {
+	targetGuids := make(map[string]bool)
+	for _, snapshot := range target {
+		targetGuids[snapshot.guid] = true
+	}
+
+	for i := len(source) - 1; i >= 0; i-- {
+		if targetGuids[source[i].guid] {
+			return &source[i]
+		}
+	}
+	return nil
+}
+
+// estimateSendSize runs a dry-run `zfs send` and returns the estimated stream size in bytes.
+// If from is empty a full stream is estimated, otherwise an incremental stream including all
+// intermediary snapshots.
+func estimateSendSize(config *Config, from string, to string) (int64, error) {
+	options := ""
+	if from != "" {
+		options = fmt.Sprintf("-I %s", shellescape.Quote(from))
+	}
+
+	stdout, err := callSshCommand(config, "zfs send -n -P %s %s", options, shellescape.Quote(to))
+	if err != nil {
+		return 0, err
+	}
+
+	return parseSendSize(stdout)
+}
+
+func parseSendSize(output string) (int64, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "size" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no size estimate found in zfs send output")
+}
+
+type QuotaKind string
+
+const (
+	UserQuota    QuotaKind = "user"
+	GroupQuota   QuotaKind = "group"
+	ProjectQuota QuotaKind = "project"
+)
+
+func (k QuotaKind) quotaProperty(principal string) string {
+	return fmt.Sprintf("%squota@%s", k, principal)
+}
+
+func (k QuotaKind) objectQuotaProperty(principal string) string {
+	return fmt.Sprintf("%sobjquota@%s", k, principal)
+}
+
+type SpaceUsage struct {
+	used           string
+	rawUsed        string
+	quota          string
+	rawQuota       string
+	objectUsed     string
+	rawObjectUsed  string
+	objectQuota    string
+	rawObjectQuota string
+}
+
+// parseSpaceUsage parses `zfs {user,group,project}space -H -o name,used,quota,objused,objquota` output
+// and returns the columns belonging to principal, or nil if the principal isn't listed.
+func parseSpaceUsage(output string, principal string) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.Comma = '\t'
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if line[0] == principal {
+			return line, nil
+		}
+	}
+}
+
+// describeSpaceUsage reads the usage and quotas of a single user, group or project on a dataset.
+// Principals without any usage or quota are not listed by zfs, in which case everything is reported as unset.
+func describeSpaceUsage(config *Config, kind QuotaKind, datasetName string, principal string) (*SpaceUsage, error) {
+	options := ""
+	if _, err := strconv.Atoi(principal); err == nil && kind != ProjectQuota {
+		// Principal was given as a numeric id, so don't resolve ids to names.
+		options = "-n"
+	}
+
+	usage := SpaceUsage{
+		used:           "0",
+		rawUsed:        "0",
+		quota:          "none",
+		rawQuota:       "none",
+		objectUsed:     "0",
+		rawObjectUsed:  "0",
+		objectQuota:    "none",
+		rawObjectQuota: "none",
+	}
+
+	stdout, err := callSshCommand(config, "zfs %sspace -H %s -o name,used,quota,objused,objquota %s", kind, options, shellescape.Quote(datasetName))
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := parseSpaceUsage(stdout, principal)
+	if err != nil {
+		return nil, err
+	} else if line == nil {
+		return &usage, nil
+	}
+	usage.used, usage.quota, usage.objectUsed, usage.objectQuota = line[1], line[2], line[3], line[4]
+
+	stdout, err = callSshCommand(config, "zfs %sspace -Hp %s -o name,used,quota,objused,objquota %s", kind, options, shellescape.Quote(datasetName))
+	if err != nil {
+		return nil, err
+	}
+
+	line, err = parseSpaceUsage(stdout, principal)
+	if err != nil {
+		return nil, err
+	} else if line != nil {
+		usage.rawUsed, usage.rawQuota, usage.rawObjectUsed, usage.rawObjectQuota = line[1], line[2], line[3], line[4]
+	}
+
+	return &usage, nil
+}
+
+func setQuota(config *Config, datasetName string, property string, value string) error {
+	_, err := callSshCommand(config, "zfs set %s=%s %s", shellescape.Quote(property), shellescape.Quote(value), shellescape.Quote(datasetName))
+	return err
+}
+
+type MirrorChanges struct {
+	attach  []string
+	detach  []string
+	replace [][2]string
+}
+
+// diffMirror works out which devices must be attached to, detached from or replaced in a mirror
+// to turn oldDevices into newDevices. When replace is set, removed and added devices are paired up in
+// order and replaced, so the mirror never has to resilver onto a device which is about to be detached.
+func diffMirror(oldDevices []string, newDevices []string, replace bool) MirrorChanges {
+	changes := MirrorChanges{
+		attach:  make([]string, 0),
+		detach:  make([]string, 0),
+		replace: make([][2]string, 0),
+	}
+
+	removed := make([]string, 0)
+	for _, device := range oldDevices {
+		if !contains(newDevices, device) {
+			removed = append(removed, device)
+		}
+	}
+
+	added := make([]string, 0)
+	for _, device := range newDevices {
+		if !contains(oldDevices, device) {
+			added = append(added, device)
+		}
+	}
+
+	if replace {
+		for len(removed) > 0 && len(added) > 0 {
+			changes.replace = append(changes.replace, [2]string{removed[0], added[0]})
+			removed, added = removed[1:], added[1:]
+		}
+	}
+
+	changes.attach = append(changes.attach, added...)
+	changes.detach = append(changes.detach, removed...)
+	return changes
+}
+
+// resilverPollInterval is how often a resilver is checked while waiting to detach the devices it replaces.
+var resilverPollInterval = 10 * time.Second
+
+// waitForResilver waits until no resilver is running on the pool, or the context is done, e.g. because the timeout of
+// the resource operation has passed.
+func waitForResilver(ctx context.Context, config *Config, poolName string) error {
+	for {
+		status, err := callSshCommandContext(ctx, config, "zpool status -pP %s", poolName)
+		if err != nil {
+			return err
+		}
+		scan, err := parseScan(status)
+		if err != nil {
+			return err
+		}
+		if scan.function != "resilver" || scan.state != ScanInProgress {
+			return nil
+		}
+
+		log.Printf("[DEBUG] resilver of %s is %.2f%% done", poolName, scan.progress)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the resilver of %s to finish, it is %.2f%% done. Devices which were to be detached are still attached", poolName, scan.progress)
+		case <-time.After(resilverPollInterval):
+		}
+	}
+}
+
+// applyMirrorChanges replaces and attaches devices first, and only detaches devices once the new ones have
+// resilvered, so redundancy is never lower than it was before the change. Devices are attached to a device which
+// stays in the mirror, or to one of the replacements once they have resilvered.
+func applyMirrorChanges(ctx context.Context, config *Config, poolName string, oldDevices []string, changes MirrorChanges) error {
+	replaced := make([]string, 0, len(changes.replace))
+	for _, replacement := range changes.replace {
+		if _, err := callSshCommandContext(ctx, config, "zpool replace %s %s %s", shellescape.Quote(poolName), shellescape.Quote(replacement[0]), shellescape.Quote(replacement[1])); err != nil {
+			return err
+		}
+		replaced = append(replaced, replacement[0])
+	}
+
+	if len(changes.attach) > 0 {
+		var existing string
+		for _, device := range oldDevices {
+			if !contains(changes.detach, device) && !contains(replaced, device) {
+				existing = device
+				break
+			}
+		}
+		if existing == "" && len(changes.replace) > 0 {
+			// A device which is being replaced can't be attached to, but its replacement can once it has resilvered.
+			if err := waitForResilver(ctx, config, poolName); err != nil {
+				return err
+			}
+			existing = changes.replace[0][1]
+		}
+		if existing == "" {
+			// Every device is detached afterwards, which only happens once the new devices have resilvered.
+			existing = oldDevices[0]
+		}
+
+		for _, device := range changes.attach {
+			if _, err := callSshCommandContext(ctx, config, "zpool attach %s %s %s", shellescape.Quote(poolName), shellescape.Quote(existing), shellescape.Quote(device)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(changes.detach) > 0 {
+		if err := waitForResilver(ctx, config, poolName); err != nil {
+			return err
+		}
+	}
+
+	for _, device := range changes.detach {
+		if _, err := callSshCommandContext(ctx, config, "zpool detach %s %s", shellescape.Quote(poolName), shellescape.Quote(device)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readPoolSize returns the size of a pool and the amount of space it could still be expanded by, in bytes.
+func readPoolSize(config *Config, poolName string) (int64, int64, error) {
+	if useJsonOutput(config) {
+		stdout, err := callSshCommand(config, "zpool list -jp -o size,expandsize %s", poolName)
+		if err != nil {
+			return 0, 0, err
+		}
+		properties, err := parseJsonProperties(stdout, poolName)
+		if err != nil {
+			return 0, 0, err
+		}
+		return parsePoolSize(properties["size"].Value + "\t" + properties["expandsize"].Value)
+	}
+
+	stdout, err := callSshCommand(config, "zpool list -Hp -o size,expandsize %s", poolName)
+	if err != nil {
+		return 0, 0, err
+	}
+	return parsePoolSize(stdout)
+}
+
+func parsePoolSize(output string) (int64, int64, error) {
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected zpool list output %q", output)
+	}
+
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	expandSize := int64(0)
+	if fields[1] != "-" {
+		if expandSize, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	return size, expandSize, nil
+}
+
+// expandDevice tells zfs to make use of all space on a device which has grown.
+func expandDevice(config *Config, poolName string, device string) error {
+	_, err := callSshCommand(config, "zpool online -e %s %s", poolName, shellescape.Quote(device))
+	return err
+}
+
+// leafDevices returns all devices holding data or logs in a pool layout.
+func leafDevices(layout PoolLayout) []string {
+	devices := make([]string, 0)
+	for _, mirror := range layout.mirrors {
+		for _, device := range mirror.devices {
+			devices = append(devices, device.path)
+		}
+	}
+	for _, raidz := range layout.raidz {
+		for _, device := range raidz.devices {
+			devices = append(devices, device.path)
+		}
+	}
+	for _, device := range layout.striped {
+		devices = append(devices, device.path)
+	}
+	for _, device := range layout.logs {
+		devices = append(devices, device.path)
+	}
+	return devices
+}
@@ -0,0 +1,289 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// TestFlattenNumericProperties verifies sizes, ratios and percentages become numbers, and that unset values,
+// strings and identifiers are left out.
+func TestFlattenNumericProperties(t *testing.T) {
+	properties := map[string]Property{
+		"used":          {value: "1.50T", rawValue: "1649267441664"},
+		"compressratio": {value: "1.23x", rawValue: "1.23x"},
+		"capacity":      {value: "12%", rawValue: "12"},
+		"quota":         {value: "none", rawValue: "0"},
+		"origin":        {value: "-", rawValue: "-"},
+		"compression":   {value: "lz4", rawValue: "lz4"},
+		"guid":          {value: "12345678901234567890", rawValue: "12345678901234567890"},
+	}
+
+	expected := map[string]interface{}{
+		"used":          float64(1649267441664),
+		"compressratio": 1.23,
+		"capacity":      float64(12),
+		"quota":         float64(0),
+	}
+	if got := flattenNumericProperties(properties); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+// TestFlattenPropertySources verifies sources are reported the way zfs get prints them, including where inherited properties come from.
+func TestFlattenPropertySources(t *testing.T) {
+	resources, err := parsePropertyOutput(newFakeConfig(&fakeExecutor{}), "tank/a\tcompression\tinherited from tank\tlz4\n"+
+		"tank/a\tatime\tlocal\toff\n"+
+		"tank/a\tused\t-\t1G\n"+
+		propertyOutputSeparator+"\n"+
+		"tank/a\tcompression\tlz4\ntank/a\tatime\toff\ntank/a\tused\t1073741824")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]interface{}{"compression": "inherited from tank", "atime": "local", "used": "-"}
+	if got := flattenPropertySources(resources["tank/a"]); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+// TestApplyPropertyDiffInherit verifies properties which should be inherited are only reset while they are set locally or received.
+func TestApplyPropertyDiffInherit(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zfs inherit", "")
+
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{
+		"name": "tank/data",
+		"property": []interface{}{
+			map[string]interface{}{"name": "compression", "inherit": true},
+			map[string]interface{}{"name": "atime", "inherit": true},
+			map[string]interface{}{"name": "recordsize", "inherit": true},
+		},
+	})
+
+	actual := map[string]Property{
+		"compression": {source: SourceLocal, value: "gzip"},
+		"atime":       {source: SourceInherited, value: "off", inheritedFrom: "tank"},
+		"recordsize":  {source: SourceReceived, value: "1M"},
+	}
+	if err := applyPropertyDiff(newFakeConfig(executor), d, "tank/data", actual, map[string]string{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{"zfs inherit compression tank/data", "zfs inherit recordsize tank/data"}
+	if !reflect.DeepEqual(executor.commands, expected) {
+		t.Fatalf("expected %v, got %v", expected, executor.commands)
+	}
+}
+
+// TestUpdatePropertiesInStateInherit verifies inherited properties match an inherit block, and locally set ones show up as a change.
+func TestUpdatePropertiesInStateInherit(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{
+		"name": "tank/data",
+		"property": []interface{}{
+			map[string]interface{}{"name": "compression", "inherit": true},
+			map[string]interface{}{"name": "atime", "inherit": true},
+		},
+	})
+
+	err := updatePropertiesInState(d, map[string]Property{
+		"compression": {source: SourceInherited, value: "lz4", rawValue: "lz4", inheritedFrom: "tank"},
+		"atime":       {source: SourceLocal, value: "off", rawValue: "off"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	blocks := map[string]map[string]interface{}{}
+	for _, block := range d.Get("property").(*schema.Set).List() {
+		block := block.(map[string]interface{})
+		blocks[block["name"].(string)] = block
+	}
+	if blocks["compression"]["inherit"] != true || blocks["compression"]["value"] != "" {
+		t.Fatalf("expected compression to match its inherit block, got %v", blocks["compression"])
+	}
+	if blocks["atime"]["inherit"] != false || blocks["atime"]["value"] != "off" {
+		t.Fatalf("expected atime to show its local value, got %v", blocks["atime"])
+	}
+}
+
+// TestCreateDatasetParents verifies create_parents creates missing parents with zfs create -p.
+func TestCreateDatasetParents(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs create", "").
+		on("zfs get", "tank/a/b/c\tguid\t-\t42\ntank/a/b/c\ttype\t-\tfilesystem\n"+propertyOutputSeparator+"\ntank/a/b/c\tguid\t42\ntank/a/b/c\ttype\tfilesystem")
+
+	dataset, err := createDataset(context.Background(), newFakeConfig(executor), &CreateDataset{
+		dsType:        FilesystemType,
+		name:          "tank/a/b/c",
+		createParents: true,
+		properties:    map[string]string{},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !executor.ran("zfs create  -p tank/a/b/c") || dataset.guid != "42" {
+		t.Fatalf("expected the parents to be created, ran %v", executor.commands)
+	}
+}
+
+// TestReconcileDatasetName verifies that external renames show up as a change of the name, unless
+// allow_external_rename adopts the new name, and that the actual name is always recorded.
+func TestReconcileDatasetName(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{"name": "tank/data"})
+	if err := reconcileDatasetName(d, "tank/renamed"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if d.Get("name") != "tank/renamed" || currentDatasetName(d) != "tank/renamed" {
+		t.Fatalf("expected the rename to show up as a change of the name, got %v and %v", d.Get("name"), d.Get("current_name"))
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{"name": "tank/data", "allow_external_rename": true})
+	if err := reconcileDatasetName(d, "tank/renamed"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if d.Get("name") != "tank/data" || currentDatasetName(d) != "tank/renamed" {
+		t.Fatalf("expected the new name to be adopted, got %v and %v", d.Get("name"), d.Get("current_name"))
+	}
+}
+
+// TestParsePropertyOutputResilience verifies that values containing tabs and quotes are kept whole, and that
+// sources unknown to the provider don't fail the read.
+func TestParsePropertyOutputResilience(t *testing.T) {
+	resources, err := parsePropertyOutput(newFakeConfig(&fakeExecutor{}), "tank/data\tnote:x\tlocal\ta \"quoted\"\tvalue\n"+
+		"tank/data\tcompression\tpropagated\tlz4\n"+
+		propertyOutputSeparator+"\n"+
+		"tank/data\tnote:x\ta \"quoted\"\tvalue\n"+
+		"tank/data\tcompression\tlz4\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if note := resources["tank/data"]["note:x"]; note.value != "a \"quoted\"\tvalue" || note.rawValue != note.value {
+		t.Fatalf("unexpected property %+v", note)
+	}
+	if compression := resources["tank/data"]["compression"]; compression.source != "propagated" || compression.value != "lz4" {
+		t.Fatalf("unexpected property %+v", compression)
+	}
+}
+
+// TestForceNewOnNameChange verifies that a changed name renames the dataset within its pool, and replaces it otherwise.
+func TestForceNewOnNameChange(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "1234",
+		Attributes: map[string]string{
+			"id":                    "1234",
+			"name":                  "tank/old",
+			"rename_on_name_change": "true",
+		},
+	}
+
+	cases := []struct {
+		config      map[string]interface{}
+		replacement bool
+	}{
+		{map[string]interface{}{"name": "tank/new"}, false},
+		{map[string]interface{}{"name": "backup/old"}, true},
+		{map[string]interface{}{"name": "tank/new", "rename_on_name_change": false}, true},
+	}
+
+	for _, c := range cases {
+		diff, err := resourceFilesystem().Diff(context.Background(), state, terraform.NewResourceConfigRaw(c.config), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff.RequiresNew() != c.replacement {
+			t.Fatalf("expected replacement %t for %v, got %t", c.replacement, c.config, diff.RequiresNew())
+		}
+	}
+}
+
+// TestRenameDataset verifies the flags which create missing parents and forcibly unmount busy children.
+func TestRenameDataset(t *testing.T) {
+	executor := (&fakeExecutor{}).on("zfs rename", "")
+	if err := renameDataset(context.Background(), newFakeConfig(executor), "tank/old", "tank/a/new", true, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !executor.ran("zfs rename -p -f tank/old tank/a/new") {
+		t.Fatalf("unexpected commands %v", executor.commands)
+	}
+}
+
+// TestSetMounted verifies that filesystems are only mounted or unmounted when they aren't in the desired state already.
+func TestSetMounted(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -H -o value mounted tank/data", "no").
+		on("zfs mount tank/data", "")
+	config := newFakeConfig(executor)
+
+	if err := setMounted(context.Background(), config, "tank/data", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if executor.ran("zfs unmount") || executor.ran("zfs mount") {
+		t.Fatalf("expected an unmounted filesystem to be left alone, ran %v", executor.commands)
+	}
+
+	if err := setMounted(context.Background(), config, "tank/data", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !executor.ran("zfs mount tank/data") {
+		t.Fatalf("expected the filesystem to be mounted, ran %v", executor.commands)
+	}
+}
+
+// TestGetDatasetNameByGuid verifies that the last known name is checked before listing all datasets,
+// and that renamed datasets are still found.
+func TestGetDatasetNameByGuid(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		on("zfs get -H -o value guid tank/data", "1234\n").
+		fail("zfs get -H -o value guid tank/old", "cannot open 'tank/old': dataset does not exist").
+		on("zfs list -H -t filesystem,volume -o name,guid -r tank", "tank\t1111\ntank/renamed\t5678\n")
+	config := newFakeConfig(executor)
+
+	name, err := getDatasetNameByGuid(config, "tank/data", "1234")
+	if err != nil || *name != "tank/data" {
+		t.Fatalf("unexpected result %v, %v", name, err)
+	}
+	if executor.ran("zfs list") {
+		t.Fatalf("expected the dataset list to be skipped, ran %v", executor.commands)
+	}
+
+	name, err = getDatasetNameByGuid(config, "tank/old", "5678")
+	if err != nil || *name != "tank/renamed" {
+		t.Fatalf("unexpected result %v, %v", name, err)
+	}
+}
+
+// TestApplyPropertyDiffContinuesAfterFailure verifies that a failing property doesn't stop the remaining
+// properties from being applied, and that the error lists both.
+func TestApplyPropertyDiffContinuesAfterFailure(t *testing.T) {
+	executor := (&fakeExecutor{}).
+		fail("zfs set compression=bogus", "cannot set property for 'tank/data': 'compression' must be one of 'on | off | lz4'").
+		on("zfs set", "")
+
+	d := schema.TestResourceDataRaw(t, resourceFilesystem().Schema, map[string]interface{}{
+		"name": "tank/data",
+		"property": []interface{}{
+			map[string]interface{}{"name": "atime", "value": "off"},
+			map[string]interface{}{"name": "compression", "value": "bogus"},
+			map[string]interface{}{"name": "recordsize", "value": "1M"},
+		},
+	})
+
+	err := applyPropertyDiff(newFakeConfig(executor), d, "tank/data", map[string]Property{}, map[string]string{})
+	applyErr, ok := err.(*PropertyApplyError)
+	if !ok {
+		t.Fatalf("expected a PropertyApplyError, got %v", err)
+	}
+	if len(applyErr.failed) != 1 || applyErr.failed["compression"] == nil || len(applyErr.applied) != 2 {
+		t.Fatalf("unexpected result: %s", applyErr)
+	}
+	if !executor.ran("zfs set atime=off") || !executor.ran("zfs set recordsize=1M") {
+		t.Fatalf("expected the remaining properties to be applied, ran %v", executor.commands)
+	}
+	if !strings.Contains(applyErr.Error(), "failed to apply 1 of 3 properties") || !strings.Contains(applyErr.Error(), "applied: atime, recordsize") {
+		t.Fatalf("unexpected error message: %s", applyErr)
+	}
+}
@@ -0,0 +1,313 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type ScanState string
+
+const (
+	ScanNone       ScanState = "none"
+	ScanInProgress ScanState = "in_progress"
+	ScanFinished   ScanState = "finished"
+	ScanCanceled   ScanState = "canceled"
+)
+
+// Scan is the result of the last scrub or resilver of a pool, as reported on the
+// "scan:" line of zpool status.
+type Scan struct {
+	function string
+	state    ScanState
+	repaired int64
+	errors   int64
+	duration int64
+	progress float64
+}
+
+var (
+	scanFinishedPattern   = regexp.MustCompile(`^(scrub repaired|resilvered) (\S+) in (.+?) with (\d+) errors`)
+	scanInProgressPattern = regexp.MustCompile(`^(scrub|resilver) in progress`)
+	scanCanceledPattern   = regexp.MustCompile(`^(scrub|resilver) canceled`)
+	scanRepairedPattern   = regexp.MustCompile(`(\S+) (?:repaired|resilvered), ([\d.,]+)% done`)
+	scanDurationPattern   = regexp.MustCompile(`^(?:(\d+) days? )?(\d+):(\d+):(\d+)$`)
+)
+
+// parseScanDuration parses the durations printed by zpool status, e.g. "00:01:02" or "1 days 02:03:04".
+func parseScanDuration(duration string) (int64, error) {
+	match := scanDurationPattern.FindStringSubmatch(strings.TrimSpace(duration))
+	if match == nil {
+		return 0, fmt.Errorf("unrecognized duration %q", duration)
+	}
+
+	seconds := int64(0)
+	for i, multiplier := range []int64{86400, 3600, 60, 1} {
+		if match[i+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(match[i+1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		seconds += value * multiplier
+	}
+	return seconds, nil
+}
+
+// parseScan parses the scan section of `zpool status -p` output. The section starts at the "scan:" line
+// and continues on indented lines until the next section, e.g.
+//
+//	  scan: scrub in progress since Sun Oct 15 12:00:00 2023
+//		1.23G scanned at 100M/s, 500M issued at 50M/s, 10G total
+//		0B repaired, 5.00% done, 00:03:00 to go
+func parseScan(status string) (*Scan, error) {
+	scan := Scan{state: ScanNone}
+
+	lines := strings.Split(status, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "scan:") {
+			continue
+		}
+		summary := strings.TrimSpace(strings.TrimPrefix(trimmed, "scan:"))
+
+		// Continuation lines belong to the scan section until the next "name:" section starts.
+		details := make([]string, 0)
+		for _, next := range lines[i+1:] {
+			next = strings.TrimSpace(next)
+			if next == "" || sectionHeader(next) {
+				break
+			}
+			details = append(details, next)
+		}
+
+		if match := scanFinishedPattern.FindStringSubmatch(summary); match != nil {
+			scan.function = "scrub"
+			if match[1] == "resilvered" {
+				scan.function = "resilver"
+			}
+			scan.state = ScanFinished
+			scan.progress = 100
+
+			repaired, err := parseSize(match[2])
+			if err != nil {
+				return nil, err
+			}
+			scan.repaired = repaired
+
+			if scan.duration, err = parseScanDuration(match[3]); err != nil {
+				return nil, err
+			}
+
+			if scan.errors, err = strconv.ParseInt(match[4], 10, 64); err != nil {
+				return nil, err
+			}
+		} else if match := scanInProgressPattern.FindStringSubmatch(summary); match != nil {
+			scan.function = match[1]
+			scan.state = ScanInProgress
+			for _, detail := range details {
+				if match := scanRepairedPattern.FindStringSubmatch(detail); match != nil {
+					if repaired, err := parseSize(match[1]); err == nil {
+						scan.repaired = repaired
+					}
+					if progress, err := parseDecimal(match[2]); err == nil {
+						scan.progress = progress
+					}
+				}
+			}
+		} else if match := scanCanceledPattern.FindStringSubmatch(summary); match != nil {
+			scan.function = match[1]
+			scan.state = ScanCanceled
+		}
+		break
+	}
+
+	return &scan, nil
+}
+
+// sectionHeader reports whether a (trimmed) zpool status line starts a new section, e.g. "config:".
+func sectionHeader(line string) bool {
+	for _, header := range []string{"pool:", "id:", "state:", "status:", "action:", "see:", "scan:", "remove:", "checkpoint:", "config:", "errors:"} {
+		if strings.HasPrefix(line, header) {
+			return true
+		}
+	}
+	return false
+}
+
+type VdevStatus struct {
+	name           string
+	state          string
+	readErrors     int64
+	writeErrors    int64
+	checksumErrors int64
+	slowIos        int64
+	message        string
+}
+
+type PoolStatus struct {
+	state  string
+	status string
+	action string
+	errors string
+	scan   Scan
+	vdevs  []VdevStatus
+}
+
+// parseStatusSections splits zpool status output into its "name: value" sections. Values spanning
+// multiple lines are joined with newlines, with their indentation removed.
+func parseStatusSections(status string) map[string]string {
+	sections := make(map[string]string)
+
+	current := ""
+	for _, line := range strings.Split(status, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if sectionHeader(trimmed) {
+			parts := strings.SplitN(trimmed, ":", 2)
+			current = parts[0]
+			sections[current] = strings.TrimSpace(parts[1])
+			continue
+		}
+		if current == "" || (trimmed == "" && current != "config") {
+			continue
+		}
+		if sections[current] == "" {
+			sections[current] = trimmed
+		} else {
+			// Keep the raw line for the config section, as the indentation encodes the vdev tree.
+			if current == "config" {
+				trimmed = line
+			}
+			sections[current] += "\n" + trimmed
+		}
+	}
+	return sections
+}
+
+// parseErrorCount parses an error counter, which is exact with -p but may be abbreviated (e.g. 1.2K) without it.
+func parseErrorCount(count string) (int64, error) {
+	if value, err := strconv.ParseInt(count, 10, 64); err == nil {
+		return value, nil
+	}
+	value, err := parseDecimal(strings.TrimRight(count, "KMGTPE"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid error count %q", count)
+	}
+	multiplier := map[string]float64{"K": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15, "E": 1e18}[count[len(count)-1:]]
+	return int64(value * multiplier), nil
+}
+
+// parseVdevStatus parses the config section of zpool status, e.g.
+//
+//	NAME        STATE     READ WRITE CKSUM
+//	tank        DEGRADED     0     0     0
+//	  mirror-0  DEGRADED     0     0     0
+//	    sda     ONLINE       0     0     0
+//	    sdb     FAULTED      3     0    12  too many errors
+//	logs
+//	  sdc       ONLINE       0     0     0
+//	spares
+//	  sdd       AVAIL
+//
+// Class headers such as "logs" are skipped, anything after the counters is kept as the message. Columns are
+// looked up by their name in the header, e.g. the SLOW column added by -s which counts the I/Os which took longer
+// than zio_slow_io_ms, and columns added by newer releases are skipped.
+func parseVdevStatus(config string) ([]VdevStatus, error) {
+	vdevs := make([]VdevStatus, 0)
+
+	columns := defaultVdevColumns
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "NAME" {
+			columns = fields
+			continue
+		}
+		if len(fields) < 2 {
+			continue
+		}
+
+		vdev := VdevStatus{
+			name:  fields[0],
+			state: fields[1],
+		}
+
+		if len(fields) < len(columns) {
+			// Vdevs such as spares only have a state, and possibly a message.
+			vdev.message = strings.Join(fields[2:], " ")
+			vdevs = append(vdevs, vdev)
+			continue
+		}
+
+		for i, column := range columns {
+			// Only leaf vdevs count slow I/Os, the others show a dash.
+			if i < 2 || fields[i] == "-" {
+				continue
+			}
+
+			var counter *int64
+			switch column {
+			case "READ":
+				counter = &vdev.readErrors
+			case "WRITE":
+				counter = &vdev.writeErrors
+			case "CKSUM":
+				counter = &vdev.checksumErrors
+			case "SLOW":
+				counter = &vdev.slowIos
+			default:
+				continue
+			}
+
+			var err error
+			if *counter, err = parseErrorCount(fields[i]); err != nil {
+				return nil, err
+			}
+		}
+		vdev.message = strings.Join(fields[len(columns):], " ")
+
+		vdevs = append(vdevs, vdev)
+	}
+
+	return vdevs, nil
+}
+
+// defaultVdevColumns are the columns of the vdev table, for output which lacks the header.
+var defaultVdevColumns = []string{"NAME", "STATE", "READ", "WRITE", "CKSUM"}
+
+func parsePoolStatus(status string) (*PoolStatus, error) {
+	sections := parseStatusSections(status)
+
+	vdevs, err := parseVdevStatus(sections["config"])
+	if err != nil {
+		return nil, err
+	}
+
+	scan, err := parseScan(status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PoolStatus{
+		state:  sections["state"],
+		status: sections["status"],
+		action: sections["action"],
+		errors: sections["errors"],
+		scan:   *scan,
+		vdevs:  vdevs,
+	}, nil
+}
+
+func readPoolStatus(config *Config, poolName string) (string, error) {
+	return callSshCommand(config, "zpool status -pP %s", poolName)
+}
+
+// describePoolStatus reads and parses the status of a pool, including the slow I/O counters of its vdevs.
+func describePoolStatus(config *Config, poolName string) (*PoolStatus, error) {
+	status, err := callSshCommand(config, "zpool status -pPs %s", poolName)
+	if err != nil {
+		return nil, err
+	}
+	return parsePoolStatus(status)
+}
@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+const testStatusScrubFinished = `  pool: tank
+ state: ONLINE
+  scan: scrub repaired 4096 in 1 days 02:03:04 with 3 errors on Sun Oct 15 12:00:00 2023
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  sda       ONLINE       0     0     0
+
+errors: No known data errors`
+
+const testStatusScrubInProgress = `  pool: tank
+ state: ONLINE
+  scan: scrub in progress since Sun Oct 15 12:00:00 2023
+	1288490188 scanned at 104857600/s, 524288000 issued at 52428800/s, 10737418240 total
+	0 repaired, 4.88% done, 00:03:00 to go
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0`
+
+// TestParseScan_Finished verifies the results of a completed scrub are parsed.
+func TestParseScan_Finished(t *testing.T) {
+	scan, err := parseScan(testStatusScrubFinished)
+	if err != nil {
+		t.Fatalf("parseScan returned error: %v", err)
+	}
+
+	expected := Scan{function: "scrub", state: ScanFinished, repaired: 4096, errors: 3, duration: 93784, progress: 100}
+	if *scan != expected {
+		t.Fatalf("expected %#v, got %#v", expected, *scan)
+	}
+}
+
+// TestParseScan_InProgress verifies the progress of a running scrub is parsed.
+func TestParseScan_InProgress(t *testing.T) {
+	scan, err := parseScan(testStatusScrubInProgress)
+	if err != nil {
+		t.Fatalf("parseScan returned error: %v", err)
+	}
+
+	if scan.function != "scrub" || scan.state != ScanInProgress || scan.progress != 4.88 {
+		t.Fatalf("unexpected scan: %#v", *scan)
+	}
+}
+
+// TestParseScan_InProgressGermanLocale verifies that the progress of a scrub is parsed when printed with a decimal comma.
+func TestParseScan_InProgressGermanLocale(t *testing.T) {
+	scan, err := parseScan(strings.Replace(testStatusScrubInProgress, "4.88%", "4,88%", 1))
+	if err != nil {
+		t.Fatalf("parseScan returned error: %v", err)
+	}
+
+	if scan.state != ScanInProgress || scan.progress != 4.88 {
+		t.Fatalf("unexpected scan: %#v", *scan)
+	}
+}
+
+// TestParseScan_Resilvered verifies that resilvers are told apart from scrubs.
+func TestParseScan_Resilvered(t *testing.T) {
+	scan, err := parseScan("  scan: resilvered 1.50G in 00:00:10 with 0 errors on Sun Oct 15 12:00:00 2023")
+	if err != nil {
+		t.Fatalf("parseScan returned error: %v", err)
+	}
+
+	if scan.function != "resilver" || scan.repaired != 1610612736 || scan.duration != 10 {
+		t.Fatalf("unexpected scan: %#v", *scan)
+	}
+}
+
+// TestParseScan_None verifies that pools which were never scanned report no scan.
+func TestParseScan_None(t *testing.T) {
+	scan, err := parseScan("  pool: tank\n state: ONLINE\nconfig:\n")
+	if err != nil {
+		t.Fatalf("parseScan returned error: %v", err)
+	}
+
+	if scan.state != ScanNone {
+		t.Fatalf("unexpected scan: %#v", *scan)
+	}
+}
+
+const testStatusDegraded = `  pool: tank
+ state: DEGRADED
+status: One or more devices are faulted in response to persistent errors.
+	Sufficient replicas exist for the pool to continue functioning in a
+	degraded state.
+action: Replace the faulted device, or use 'zpool clear' to mark the device
+	repaired.
+  scan: resilver in progress since Sun Oct 15 12:00:00 2023
+	1288490188 scanned at 104857600/s, 524288000 issued at 52428800/s, 10737418240 total
+	524288000 resilvered, 4.88% done, 00:03:00 to go
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	tank          DEGRADED     0     0     0
+	  mirror-0    DEGRADED     0     0     0
+	    /dev/sda  ONLINE       0     0     0
+	    /dev/sdb  FAULTED      3     0  1200  too many errors
+	logs
+	  /dev/sdc    ONLINE       0     0     0
+	spares
+	  /dev/sdd    AVAIL
+
+errors: No known data errors`
+
+// TestParsePoolStatus_Degraded verifies that the state, messages, scan and
+// per-vdev counters of a degraded pool are parsed.
+func TestParsePoolStatus_Degraded(t *testing.T) {
+	status, err := parsePoolStatus(testStatusDegraded)
+	if err != nil {
+		t.Fatalf("parsePoolStatus returned error: %v", err)
+	}
+
+	if status.state != "DEGRADED" {
+		t.Fatalf("unexpected state %q", status.state)
+	}
+	if status.status != "One or more devices are faulted in response to persistent errors.\nSufficient replicas exist for the pool to continue functioning in a\ndegraded state." {
+		t.Fatalf("unexpected status %q", status.status)
+	}
+	if status.errors != "No known data errors" {
+		t.Fatalf("unexpected errors %q", status.errors)
+	}
+	if status.scan.function != "resilver" || status.scan.state != ScanInProgress || status.scan.repaired != 524288000 {
+		t.Fatalf("unexpected scan %#v", status.scan)
+	}
+
+	if len(status.vdevs) != 6 {
+		t.Fatalf("expected 6 vdevs, got %d: %#v", len(status.vdevs), status.vdevs)
+	}
+
+	faulted := status.vdevs[3]
+	expected := VdevStatus{name: "/dev/sdb", state: "FAULTED", readErrors: 3, checksumErrors: 1200, message: "too many errors"}
+	if faulted != expected {
+		t.Fatalf("expected %#v, got %#v", expected, faulted)
+	}
+
+	spare := status.vdevs[5]
+	if spare.name != "/dev/sdd" || spare.state != "AVAIL" {
+		t.Fatalf("unexpected spare %#v", spare)
+	}
+}
+
+// TestParseErrorCount verifies abbreviated error counters are expanded.
+func TestParseErrorCount(t *testing.T) {
+	for input, expected := range map[string]int64{"0": 0, "12": 12, "1.5K": 1500, "2M": 2000000} {
+		got, err := parseErrorCount(input)
+		if err != nil {
+			t.Fatalf("parseErrorCount(%q) returned error: %v", input, err)
+		}
+		if got != expected {
+			t.Fatalf("parseErrorCount(%q): expected %d, got %d", input, expected, got)
+		}
+	}
+}
+
+// TestFlattenPoolHealth verifies the health booleans of healthy and degraded pools.
+func TestFlattenPoolHealth(t *testing.T) {
+	healthy, err := parsePoolStatus(testStatusScrubFinished)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	health := flattenPoolHealth(*healthy)
+	if health["is_healthy"] != true || health["is_degraded"] != false || health["has_checksum_errors"] != false || health["has_data_errors"] != false {
+		t.Fatalf("unexpected health of a healthy pool: %v", health)
+	}
+
+	degraded, err := parsePoolStatus(testStatusDegraded)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	health = flattenPoolHealth(*degraded)
+	if health["is_healthy"] != false || health["is_degraded"] != true || health["has_checksum_errors"] != true || health["has_data_errors"] != false {
+		t.Fatalf("unexpected health of a degraded pool: %v", health)
+	}
+}
+
+// TestParseVdevStatus_SlowIos verifies the SLOW column of zpool status -s is parsed, and kept out of the message.
+func TestParseVdevStatus_SlowIos(t *testing.T) {
+	vdevs, err := parseVdevStatus(`	NAME          STATE     READ WRITE CKSUM  SLOW
+	tank          ONLINE       0     0     0     -
+	  mirror-0    ONLINE       0     0     0     -
+	    /dev/sda  ONLINE       0     0     0     0
+	    /dev/sdb  ONLINE       0     0     0    14  (resilvering)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := VdevStatus{name: "/dev/sdb", state: "ONLINE", slowIos: 14, message: "(resilvering)"}
+	if len(vdevs) != 4 || vdevs[3] != expected {
+		t.Fatalf("expected %#v, got %#v", expected, vdevs)
+	}
+}
+
+// TestParseVdevStatusUnknownColumns verifies that columns added by newer releases are skipped, and don't end up in the message.
+func TestParseVdevStatusUnknownColumns(t *testing.T) {
+	vdevs, err := parseVdevStatus("\tNAME    STATE     READ WRITE CKSUM  SLOW  POWER\n" +
+		"\ttank    ONLINE       0     0     0     -      -\n" +
+		"\t  sda   FAULTED      3     0    12     7     on  too many errors\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(vdevs) != 2 || vdevs[1].checksumErrors != 12 || vdevs[1].slowIos != 7 || vdevs[1].message != "too many errors" {
+		t.Fatalf("unexpected vdevs %+v", vdevs)
+	}
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
-	"context"
 	"flag"
+	"log"
 
 	"github.com/MathiasPius/terraform-provider-zfs/internal/provider"
-	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5/tf5server"
 )
 
 // Run "go generate" to format example terraform files and generate the docs for the registry/website
@@ -33,13 +33,13 @@ func main() {
 	flag.BoolVar(&debugMode, "debug", false, "set to true to run the provider with support for debuggers like delve")
 	flag.Parse()
 
-	opts := &plugin.ServeOpts{ProviderFunc: provider.New(version)}
-
+	serveOpts := []tf5server.ServeOpt{}
 	if debugMode {
-		opts.Debug = true
-		opts.ProviderAddr = "registry.terraform.io/MathiasPius/zfs"
-		opts.TestConfig.Context = context.Background()
+		serveOpts = append(serveOpts, tf5server.WithManagedDebug())
 	}
 
-	plugin.Serve(opts)
+	err := tf5server.Serve("registry.terraform.io/MathiasPius/zfs", provider.ProviderServer(version), serveOpts...)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
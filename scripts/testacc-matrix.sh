@@ -0,0 +1,33 @@
+#!/bin/sh
+# Runs the acceptance tests once for every OpenZFS release in ZFS_PROVIDER_TEST_MATRIX, a space separated list of
+# release=host[:port] entries, e.g. "2.0=10.0.0.20 2.1=10.0.0.21 2.2=10.0.0.22 2.3=10.0.0.23:2222". The hosts are
+# usually VMs, as zfs runs in the kernel and containers share the release of the machine they run on. All other
+# ZFS_PROVIDER_* settings, such as the user and key, are shared by every host.
+set -u
+
+if [ -z "${ZFS_PROVIDER_TEST_MATRIX:-}" ]; then
+	echo "ZFS_PROVIDER_TEST_MATRIX must list the hosts to test, e.g. \"2.1=10.0.0.21 2.2=10.0.0.22\"" >&2
+	exit 2
+fi
+
+failed=""
+for target in $ZFS_PROVIDER_TEST_MATRIX; do
+	release="${target%%=*}"
+	address="${target#*=}"
+	host="${address%%:*}"
+	port="22"
+	if [ "$address" != "$host" ]; then
+		port="${address#*:}"
+	fi
+
+	echo "==> OpenZFS $release on $host:$port"
+	if ! ZFS_PROVIDER_HOSTNAME="$host" ZFS_PROVIDER_PORT="$port" ZFS_PROVIDER_TEST_ZFS_VERSION="$release" \
+		TF_ACC=1 go test -v -cover -timeout 120m ./internal/provider/; then
+		failed="$failed $release"
+	fi
+done
+
+if [ -n "$failed" ]; then
+	echo "acceptance tests failed for OpenZFS$failed" >&2
+	exit 1
+fi